@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+)
+
+var (
+	buildOutput string
+	buildExe    bool
+)
+
+var buildCmd = &cobra.Command{
+	Use:          "build <file>",
+	Short:        "Type check a Gust program and compile it to a bytecode file or an executable",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		in, checker := newInterpreter(nil)
+		program, err := checkFile(args[0], checker)
+		if err != nil {
+			return err
+		}
+		if program, err = optimize(program); err != nil || dumpOpt {
+			return dumpOptimized(cmd, program, err)
+		}
+
+		in.SetFile(args[0])
+		bc, err := in.Compile(program)
+		if err != nil {
+			return err
+		}
+		data, err := bc.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		out := buildOutput
+		if out == "" {
+			out = strings.TrimSuffix(args[0], filepath.Ext(args[0]))
+			if !buildExe {
+				out += ".gbc"
+			}
+		}
+		if filepath.Clean(out) == filepath.Clean(args[0]) {
+			return fmt.Errorf("%s: the output would overwrite the source file, name another with -o", args[0])
+		}
+		if !buildExe {
+			return os.WriteFile(out, data, 0o644)
+		}
+
+		// the executable is a copy of this one with the bytecode embedded
+		self, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		exe, err := os.ReadFile(self)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(out, interpreter.EmbedBytecode(exe, data), 0o755); err != nil {
+			return err
+		}
+		// WriteFile sets the mode only of a file it creates
+		return os.Chmod(out, 0o755)
+	},
+}
+
+func init() {
+	buildCmd.Flags().StringVarP(&buildOutput, "output", "o", "", "file to write to (default: the source file with the extension .gbc, or none for --exe)")
+	buildCmd.Flags().BoolVar(&buildExe, "exe", false, "build an executable that runs the program without gust installed")
+	addOptimizeFlags(buildCmd)
+	RootCmd.AddCommand(buildCmd)
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+var parseFormat string
+
+var parseCmd = &cobra.Command{
+	Use:          "parse <file>",
+	Short:        "Print the syntax tree of a Gust source file",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var encode func(io.Writer, parser.Node) error
+		switch parseFormat {
+		case "json":
+			encode = parser.EncodeJSON
+		case "sexpr":
+			encode = parser.EncodeSexpr
+		default:
+			return fmt.Errorf("unknown format %q, expected json or sexpr", parseFormat)
+		}
+
+		program, err := parseFile(args[0])
+		if err != nil {
+			return err
+		}
+		return encode(cmd.OutOrStdout(), program)
+	},
+}
+
+// parseFile reads and parses the Gust source file at path,
+// returning all parser errors at once.
+func parseFile(path string) (*parser.Program, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseSource(path, src)
+}
+
+// parseSource parses src, the Gust source read from the file at path,
+// returning all parser errors at once.
+func parseSource(path string, src []byte) (*parser.Program, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, errors.New(path + ":\n\t" + strings.Join(errs, "\n\t"))
+	}
+
+	return program, nil
+}
+
+func init() {
+	parseCmd.Flags().StringVar(&parseFormat, "format", "json", "output format (json or sexpr)")
+	RootCmd.AddCommand(parseCmd)
+}
@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/gust/internal/interpreter"
 )
 
 var RootCmd = &cobra.Command{
@@ -15,9 +19,65 @@ var RootCmd = &cobra.Command{
 }
 
 func Execute() {
+	// an executable built with `gust build --exe` runs its program
+	// instead of the commands
+	bc, err := embeddedBytecode()
+	if err == nil && bc != nil {
+		err = runEmbedded(bc)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if bc != nil {
+		return
+	}
+
 	if err := RootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
+// embeddedBytecode returns the program embedded in the running
+// executable by `gust build --exe`, or nil if it is plain gust.
+func embeddedBytecode() (*interpreter.Bytecode, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, nil
+	}
+	f, err := os.Open(self)
+	if err != nil {
+		return nil, nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil
+	}
+
+	data, err := interpreter.EmbeddedBytecode(f, info.Size())
+	if err != nil || data == nil {
+		return nil, err
+	}
+	bc := &interpreter.Bytecode{}
+	if err := bc.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("embedded program: %w", err)
+	}
+	return bc, nil
+}
+
+// runEmbedded runs the program embedded in the executable, as
+// `gust run` runs a bytecode file.
+func runEmbedded(bc *interpreter.Bytecode) error {
+	in, _ := newInterpreter(os.Stdout)
+	in.SetFile(bc.Source)
+	_, err := in.RunBytecode(bc)
+
+	var rerr *interpreter.RuntimeError
+	if errors.As(err, &rerr) {
+		return errors.New(strings.TrimSuffix(rerr.Trace(), "\n"))
+	}
+	return err
+}
+
 func init() {}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/gust/internal/host"
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+	"github.com/voidwyrm-2/gust/internal/optimizer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+	"github.com/voidwyrm-2/gust/internal/typechecker"
+	"github.com/voidwyrm-2/gust/stdlib"
+)
+
+var (
+	runMaxDepth  int
+	runEngine    string
+	runTimeout   time.Duration
+	runMaxSteps  int64
+	runMaxMemory int64
+
+	deterministic bool
+	seed          uint64
+
+	optLevel int
+	dumpOpt  bool
+)
+
+var runCmd = &cobra.Command{
+	Use:          "run <file>",
+	Short:        "Type check and run a Gust program, or run a bytecode file",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		engine, err := interpreter.ParseEngine(runEngine)
+		if err != nil {
+			return err
+		}
+
+		in, checker := newInterpreter(cmd.OutOrStdout())
+		in.SetMaxDepth(runMaxDepth)
+		in.SetEngine(engine)
+		in.SetLimits(interpreter.Limits{Steps: runMaxSteps, Memory: runMaxMemory})
+		if runTimeout > 0 {
+			ctx, cancel := context.WithTimeout(cmd.Context(), runTimeout)
+			defer cancel()
+			in.SetContext(ctx)
+		}
+
+		// the file is read once, so that it can be a pipe such as
+		// /dev/stdin
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		if interpreter.IsBytecode(data) {
+			var bc *interpreter.Bytecode
+			if bc, err = decodeBytecode(args[0], data); err != nil {
+				return err
+			}
+			in.SetFile(bc.Source)
+			_, err = in.RunBytecode(bc)
+		} else {
+			var program *parser.Program
+			program, err = checkSource(args[0], data, checker)
+			if err != nil {
+				return err
+			}
+			if program, err = optimize(program); err != nil || dumpOpt {
+				return dumpOptimized(cmd, program, err)
+			}
+			in.SetFile(args[0])
+			_, err = in.Run(program)
+		}
+
+		var rerr *interpreter.RuntimeError
+		if errors.As(err, &rerr) {
+			return errors.New(strings.TrimSuffix(rerr.Trace(), "\n"))
+		}
+		return err
+	},
+}
+
+// newInterpreter returns an interpreter writing program output to out
+// and a checker for the programs it runs, with the standard library
+// declared in both, and both deterministic if the --deterministic flag
+// is set.
+func newInterpreter(out io.Writer) (*interpreter.Interpreter, *typechecker.Checker) {
+	in, checker := interpreter.New(out), typechecker.New()
+	h := host.New(in, checker)
+	stdlib.Register(h)
+	if deterministic {
+		h.SetDeterministic(seed)
+	}
+	return in, checker
+}
+
+// checkFile parses and type checks the Gust source file at path with
+// checker, returning all type errors at once.
+func checkFile(path string, checker *typechecker.Checker) (*parser.Program, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return checkSource(path, src, checker)
+}
+
+// checkSource parses and type checks src, the Gust source read from
+// the file at path, with checker.
+func checkSource(path string, src []byte, checker *typechecker.Checker) (*parser.Program, error) {
+	program, err := parseSource(path, src)
+	if err != nil {
+		return nil, err
+	}
+
+	checker.Check(program)
+	if errs := checker.Errors(); len(errs) > 0 {
+		return nil, errors.New(path + ":\n\t" + strings.Join(errs, "\n\t"))
+	}
+	return program, nil
+}
+
+// optimize optimizes program at the level of the -O flag.
+func optimize(program *parser.Program) (*parser.Program, error) {
+	level, err := optimizer.ParseLevel(optLevel)
+	if err != nil {
+		return nil, err
+	}
+	return optimizer.Optimize(program, level), nil
+}
+
+// dumpOptimized prints the optimized program for --dump-opt, unless
+// optimizing it failed.
+func dumpOptimized(cmd *cobra.Command, program *parser.Program, err error) error {
+	if err != nil {
+		return err
+	}
+	return parser.EncodeSexpr(cmd.OutOrStdout(), program)
+}
+
+// addOptimizeFlags adds the flags selecting the optimizations of a
+// program to cmd.
+func addOptimizeFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVarP(&optLevel, "optimize", "O", 0, "optimization level: 0 for none, 1 to fold constants and remove dead code, 2 to also inline functions and hoist loop-invariant code")
+	cmd.Flags().BoolVar(&dumpOpt, "dump-opt", false, "print the syntax tree of the optimized program instead of running it")
+}
+
+// decodeBytecode decodes data, the bytecode read from the file at path.
+func decodeBytecode(path string, data []byte) (*interpreter.Bytecode, error) {
+	bc := &interpreter.Bytecode{}
+	if err := bc.UnmarshalBinary(data); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	return bc, nil
+}
+
+func init() {
+	runCmd.Flags().IntVar(&runMaxDepth, "max-depth", interpreter.DefaultMaxDepth, "maximum depth of function calls, at most "+strconv.Itoa(interpreter.MaxDepth))
+	runCmd.Flags().StringVar(&runEngine, "engine", interpreter.TreeEngine.String(), "engine to run source files with, tree or vm")
+	runCmd.Flags().DurationVar(&runTimeout, "timeout", 0, "stop the program after this long, such as 5s (0 for no limit)")
+	runCmd.Flags().Int64Var(&runMaxSteps, "max-steps", 0, "stop the program after this many steps (0 for no limit)")
+	runCmd.Flags().Int64Var(&runMaxMemory, "max-memory", 0, "stop the program once it has allocated this many bytes (0 for no limit)")
+	runCmd.Flags().BoolVar(&deterministic, "deterministic", false, "run with a virtual clock and seeded random numbers, rejecting what cannot be reproduced")
+	runCmd.Flags().Uint64Var(&seed, "seed", 0, "seed of the random numbers of --deterministic")
+	addOptimizeFlags(runCmd)
+	RootCmd.AddCommand(runCmd)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/voidwyrm-2/gust/internal/lexer"
+)
+
+var tokensFormat string
+
+var tokensCmd = &cobra.Command{
+	Use:   "tokens <file>",
+	Short: "Print the token stream of a Gust source file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		src, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		var tokens []lexer.Token
+		l := lexer.New(string(src))
+		for {
+			tok := l.NextToken()
+			tokens = append(tokens, tok)
+			if tok.Type == lexer.EOF {
+				break
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		switch tokensFormat {
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(tokens)
+		case "text":
+			for _, tok := range tokens {
+				fmt.Fprintf(out, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+			}
+			return nil
+		default:
+			return fmt.Errorf("unknown format %q, expected json or text", tokensFormat)
+		}
+	},
+}
+
+func init() {
+	tokensCmd.Flags().StringVar(&tokensFormat, "format", "text", "output format (json or text)")
+	RootCmd.AddCommand(tokensCmd)
+}
@@ -1,6 +1,6 @@
 module github.com/voidwyrm-2/gust
 
-go 1.23.1
+go 1.24
 
 require github.com/spf13/cobra v1.8.1
 
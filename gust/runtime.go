@@ -0,0 +1,341 @@
+// Package gust embeds the Gust interpreter in Go programs. A Runtime
+// compiles and runs Gust source, calls the functions it declares, and
+// shares global variables with the host, converting between Go values
+// and Gust values:
+//
+//	rt := gust.New(nil)
+//	if err := rt.Set("limit", 10); err != nil { ... }
+//	if err := rt.Compile(`fn double(n: int) -> int { n * 2 }`); err != nil { ... }
+//	if _, err := rt.Run(ctx); err != nil { ... }
+//	v, err := rt.Call(ctx, "double", 21)
+//	var n int
+//	err = v.Decode(&n)
+package gust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/voidwyrm-2/gust/internal/host"
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+	"github.com/voidwyrm-2/gust/internal/typechecker"
+	"github.com/voidwyrm-2/gust/stdlib"
+)
+
+// Engine selects how a Runtime runs programs.
+type Engine = interpreter.Engine
+
+const (
+	// TreeEngine evaluates programs by walking their syntax tree.
+	TreeEngine = interpreter.TreeEngine
+	// VMEngine compiles programs to bytecode for a stack virtual
+	// machine.
+	VMEngine = interpreter.VMEngine
+)
+
+// RuntimeError is the error Run and Call return when a program raises
+// a runtime error. Its Trace method formats it with the Gust stack.
+type RuntimeError = interpreter.RuntimeError
+
+// Limits bound the steps and memory of each run of a program, as
+// SetLimits sets them.
+type Limits = interpreter.Limits
+
+// ErrStepLimit and ErrMemoryLimit are the errors a *RuntimeError wraps
+// when a run exceeds its Limits, which errors.Is reports.
+var (
+	ErrStepLimit   = interpreter.ErrStepLimit
+	ErrMemoryLimit = interpreter.ErrMemoryLimit
+)
+
+// Capabilities are the side effects programs may have beyond writing
+// their output: using files, reading the environment and reading the
+// clock. The standard library denies what they do not allow with a
+// PermissionError.
+type Capabilities = host.Capabilities
+
+// FileAccess is how programs may use the file system.
+type FileAccess = host.FileAccess
+
+// The file access of Capabilities: none, reading files and listing
+// directories, or reading and writing.
+const (
+	NoFiles    = host.NoFiles
+	ReadFiles  = host.ReadFiles
+	WriteFiles = host.WriteFiles
+)
+
+// PermissionError is the error of an operation the capabilities of a
+// runtime do not allow.
+type PermissionError = host.PermissionError
+
+// AllCapabilities allows everything, as a new runtime does.
+func AllCapabilities() Capabilities {
+	return host.AllCapabilities()
+}
+
+// Value is a Gust value, which Decode converts to Go values.
+type Value = host.Value
+
+// Pair is an entry of a map, as Value.Pairs gives it.
+type Pair = host.Pair
+
+// Enum is a value of an enum type, as Value.Decode stores it in an
+// interface.
+type Enum = host.Enum
+
+// Module is a set of native functions and values declared as one
+// global, which programs use as `name.member`.
+type Module = host.Module
+
+// Call is the call of a native function, which gets it as its first
+// parameter if that has type *Call.
+type Call = host.Call
+
+// NewModule returns an empty module called name, for Register.
+func NewModule(name string) *Module {
+	return host.NewModule(name)
+}
+
+// Raise raises a runtime error with the formatted message from a
+// native function.
+func Raise(format string, a ...any) {
+	host.Raise(format, a...)
+}
+
+// CompileError lists the syntax or type errors of a program.
+type CompileError struct {
+	Errors []string
+}
+
+func (e *CompileError) Error() string {
+	return strings.Join(e.Errors, "\n")
+}
+
+// Runtime is a Gust interpreter with a type checker. The programs it
+// compiles share their global variables and types with each other and
+// with the values the host sets, so each program can use what the
+// programs before it declared.
+type Runtime struct {
+	in      *interpreter.Interpreter
+	checker *typechecker.Checker
+	host    *host.Host
+	// program is the program the last call to Compile checked, and
+	// unrun the checker's declarations from before it while it has not
+	// run, which the next Compile returns to.
+	program *parser.Program
+	unrun   *typechecker.Snapshot
+}
+
+// New returns a runtime whose programs write their output to out, or
+// to os.Stdout if out is nil. The modules of the standard library are
+// registered in it.
+func New(out io.Writer) *Runtime {
+	in := interpreter.New(out)
+	checker := typechecker.New()
+	r := &Runtime{in: in, checker: checker, host: host.New(in, checker)}
+	stdlib.Register(r.host)
+	return r
+}
+
+// SetEngine sets the engine programs run on. The default is
+// TreeEngine.
+func (r *Runtime) SetEngine(e Engine) {
+	r.in.SetEngine(e)
+}
+
+// SetErrOutput sets the writer programs write errors to, such as
+// fmt.eprintln does. The default is os.Stderr.
+func (r *Runtime) SetErrOutput(w io.Writer) {
+	r.in.SetErrOutput(w)
+}
+
+// SetInput sets the reader programs read their input from, such as
+// io.read_line(io.stdin) does. The default is os.Stdin.
+func (r *Runtime) SetInput(rd io.Reader) {
+	r.in.SetInput(rd)
+}
+
+// SetFile sets the name of the file the source comes from, which
+// runtime errors are reported with.
+func (r *Runtime) SetFile(name string) {
+	r.in.SetFile(name)
+}
+
+// SetMaxDepth limits the depth of function calls to n, or to the
+// interpreter's default if n is below 1. The limit is at most 25000,
+// as deeper calls would overflow the Go stack.
+func (r *Runtime) SetMaxDepth(n int) {
+	r.in.SetMaxDepth(n)
+}
+
+// SetLimits sets the limits each call to Run or Call is held to. The
+// default is no limits.
+func (r *Runtime) SetLimits(l Limits) {
+	r.in.SetLimits(l)
+}
+
+// SetCapabilities sets the side effects programs may have. A runtime
+// running programs it does not trust can deny them everything:
+//
+//	rt.SetCapabilities(gust.Capabilities{})
+//
+// or allow them to read the files of one directory:
+//
+//	rt.SetCapabilities(gust.Capabilities{Files: gust.ReadFiles, Dir: "data"})
+func (r *Runtime) SetCapabilities(c Capabilities) {
+	r.host.SetCapabilities(c)
+}
+
+// SetDeterministic makes every run of a program give the same output:
+// the time module reads a virtual clock and the random module draws
+// from seed, and programs using what cannot be reproduced, such as the
+// env module, do not compile. Call it before compiling programs.
+func (r *Runtime) SetDeterministic(seed uint64) {
+	r.host.SetDeterministic(seed)
+}
+
+// Compile parses and type checks src, which the next call to Run runs.
+// The errors of a program that does not compile are returned as a
+// *CompileError. Later programs see the declarations of a program only
+// once it has run: those of a program that does not compile, or that
+// is compiled over before it runs, are dropped.
+func (r *Runtime) Compile(src string) error {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return &CompileError{Errors: errs}
+	}
+
+	if r.unrun != nil {
+		r.checker.Restore(r.unrun)
+		r.program, r.unrun = nil, nil
+	}
+	before := r.checker.Snapshot()
+	n := len(r.checker.Errors())
+	r.checker.Check(program)
+	if errs := r.checker.Errors()[n:]; len(errs) > 0 {
+		r.checker.Restore(before)
+		return &CompileError{Errors: append([]string(nil), errs...)}
+	}
+	r.program, r.unrun = program, before
+	return nil
+}
+
+// Run runs the program the last call to Compile checked and returns
+// the value of its last statement. A runtime error is returned as a
+// *RuntimeError, and later programs see only the declarations the
+// program reached before it. The program does not start if ctx is done, and stops
+// once it is, with a *RuntimeError wrapping ctx.Err(); exceeding the
+// runtime's Limits stops it likewise, wrapping ErrStepLimit or
+// ErrMemoryLimit. Programs cannot catch these errors with try.
+func (r *Runtime) Run(ctx context.Context) (Value, error) {
+	if r.program == nil {
+		return Value{}, errors.New("gust: no program compiled")
+	}
+	if err := ctx.Err(); err != nil {
+		return Value{}, err
+	}
+	// The declarations of a program that stops before reaching them
+	// are dropped, as its globals are never set.
+	before := r.unrun
+	var declared map[string]interpreter.Object
+	if before != nil {
+		declared = map[string]interpreter.Object{}
+		for _, name := range r.checker.Declared(before) {
+			declared[name], _ = r.in.Globals().Get(name)
+		}
+	}
+	r.unrun = nil
+	r.in.SetContext(ctx)
+	defer r.in.SetContext(nil)
+	obj, err := r.in.Run(r.program)
+	if err != nil {
+		var unset []string
+		for name, old := range declared {
+			if obj, _ := r.in.Globals().Get(name); obj == old {
+				unset = append(unset, name)
+			}
+		}
+		if before != nil {
+			r.checker.Undeclare(before, unset...)
+		}
+		return Value{}, err
+	}
+	return host.Wrap(obj), nil
+}
+
+// Call calls the global function called name with args, converted to
+// Gust values as Set converts them, and returns its result. Arguments
+// the function does not take, by their number or type, are an error,
+// as they are in a call a program makes. Like Run, the call does not
+// start if ctx is done, and stops once it is.
+func (r *Runtime) Call(ctx context.Context, name string, args ...any) (Value, error) {
+	if err := ctx.Err(); err != nil {
+		return Value{}, err
+	}
+	fn, ok := r.in.Globals().Get(name)
+	if !ok {
+		return Value{}, fmt.Errorf("gust: undefined function %s", name)
+	}
+	objs := make([]interpreter.Object, len(args))
+	types := make([]typechecker.Type, len(args))
+	for i, arg := range args {
+		obj, t, err := r.host.Convert(arg)
+		if err != nil {
+			return Value{}, fmt.Errorf("gust: argument %d of %s: %w", i+1, name, err)
+		}
+		objs[i], types[i] = obj, t
+	}
+	if t, ok := r.checker.Lookup(name); ok {
+		if sig, ok := t.(*typechecker.Function); ok {
+			if err := typechecker.CheckCall(name, sig, types); err != nil {
+				return Value{}, fmt.Errorf("gust: %w", err)
+			}
+		}
+	}
+	r.in.SetContext(ctx)
+	defer r.in.SetContext(nil)
+	obj, err := r.in.Call(fn, objs...)
+	if err != nil {
+		return Value{}, err
+	}
+	return host.Wrap(obj), nil
+}
+
+// Get returns the global variable called name, and whether it exists.
+func (r *Runtime) Get(name string) (Value, bool) {
+	obj, ok := r.in.Globals().Get(name)
+	if !ok {
+		return Value{}, false
+	}
+	return host.Wrap(obj), true
+}
+
+// Set sets the global variable called name to v, declaring it for the
+// programs compiled afterwards if it does not exist yet; an existing
+// variable keeps its type, which v must have. Go values convert by
+// their type: scalars to bool, int, float and str, slices and maps to
+// arrays and maps, structs to Gust structs named after their Go type,
+// with fields named by their `gust` tags, and functions to native
+// functions.
+//
+// The declarations of a program compiled but not yet run are kept
+// from then on, as the host may set its variables before running it.
+func (r *Runtime) Set(name string, v any) error {
+	r.unrun = nil
+	return r.host.Set(name, v)
+}
+
+// Register declares the module m as a global for the programs compiled
+// afterwards. Like Set, it keeps the declarations of a program that
+// has not run yet.
+func (r *Runtime) Register(m *Module) error {
+	r.unrun = nil
+	return r.host.Register(m)
+}
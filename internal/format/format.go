@@ -0,0 +1,197 @@
+// Package format parses the format strings of the fmt module's printf
+// and sprintf, which the type checker validates and the module
+// interprets. They follow Go's: text in which each directive, such as
+// %d, %-8s or %.2f, formats the next argument.
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxNumber is the largest width or precision a directive may have,
+// written or given by a * argument, so that formats cannot make huge
+// strings of padding.
+const MaxNumber = 1_000_000
+
+// Directive is a directive of a format string: a %, flags, a width and
+// a precision, each optional, and a verb.
+type Directive struct {
+	// Text is the directive as it is written, such as "%-8s".
+	Text  string
+	Flags string
+	// Width and Precision are -1 if the directive has none, and
+	// StarWidth and StarPrecision report whether they are written *
+	// and come from an argument of type int before the value.
+	Width, Precision         int
+	StarWidth, StarPrecision bool
+	Verb                     byte
+}
+
+// Args returns the number of arguments d reads.
+func (d Directive) Args() int {
+	n := 1
+	if d.StarWidth {
+		n++
+	}
+	if d.StarPrecision {
+		n++
+	}
+	return n
+}
+
+// Spec returns the Go format of d with the width and precision given,
+// for fmt.Sprintf to format a value with the verb verb.
+func (d Directive) Spec(width, precision int, verb byte) string {
+	var b strings.Builder
+	b.WriteByte('%')
+	b.WriteString(d.Flags)
+	if width >= 0 {
+		fmt.Fprint(&b, width)
+	}
+	if precision >= 0 {
+		fmt.Fprintf(&b, ".%d", precision)
+	}
+	b.WriteByte(verb)
+	return b.String()
+}
+
+// Part is a part of a format string: text, in which %% has become %,
+// or a directive.
+type Part struct {
+	Text      string
+	Directive *Directive
+}
+
+// Parse splits format into text and directives. It fails if a
+// directive has no verb, or one that Kinds does not know.
+func Parse(format string) ([]Part, error) {
+	var parts []Part
+	var text strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			text.WriteByte(format[i])
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '%' {
+			text.WriteByte('%')
+			i++
+			continue
+		}
+
+		d, n, err := parseDirective(format[i:])
+		if err != nil {
+			return nil, err
+		}
+		if text.Len() > 0 {
+			parts = append(parts, Part{Text: text.String()})
+			text.Reset()
+		}
+		parts = append(parts, Part{Directive: d})
+		i += n - 1
+	}
+	if text.Len() > 0 {
+		parts = append(parts, Part{Text: text.String()})
+	}
+	return parts, nil
+}
+
+// parseDirective parses the directive at the start of s, returning it
+// and its length.
+func parseDirective(s string) (*Directive, int, error) {
+	d := &Directive{Width: -1, Precision: -1}
+	i := 1
+	for i < len(s) && strings.IndexByte("-+# 0", s[i]) >= 0 {
+		i++
+	}
+	d.Flags = s[1:i]
+
+	d.Width, d.StarWidth, i = parseNumber(s, i)
+	if i < len(s) && s[i] == '.' {
+		// a lone . is a precision of 0, as in Go
+		d.Precision, d.StarPrecision, i = parseNumber(s, i+1)
+		if d.Precision < 0 && !d.StarPrecision {
+			d.Precision = 0
+		}
+	}
+
+	if i == len(s) {
+		return nil, 0, fmt.Errorf("directive %s has no verb", s)
+	}
+	d.Verb = s[i]
+	d.Text = s[:i+1]
+	if _, ok := verbs[d.Verb]; !ok {
+		return nil, 0, fmt.Errorf("directive %s has unknown verb %c", d.Text, d.Verb)
+	}
+	if d.Width > MaxNumber {
+		return nil, 0, fmt.Errorf("directive %s has width over %d", d.Text, MaxNumber)
+	}
+	if d.Precision > MaxNumber {
+		return nil, 0, fmt.Errorf("directive %s has precision over %d", d.Text, MaxNumber)
+	}
+	return d, i + 1, nil
+}
+
+// parseNumber parses the width or precision at s[i:]: digits, a *, or
+// nothing, which gives -1. A number over MaxNumber gives MaxNumber+1.
+func parseNumber(s string, i int) (n int, star bool, end int) {
+	if i < len(s) && s[i] == '*' {
+		return -1, true, i + 1
+	}
+	start := i
+	n = 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		n = min(n*10+int(s[i]-'0'), MaxNumber+1)
+		i++
+	}
+	if i == start {
+		return -1, false, i
+	}
+	return n, false, i
+}
+
+// Kind is the kind of a scalar value, which decides the verbs that
+// format it.
+type Kind int
+
+const (
+	Int Kind = iota
+	Float
+	Str
+	Bool
+)
+
+func (k Kind) String() string {
+	return [...]string{"int", "float", "str", "bool"}[k]
+}
+
+// verbs are the verbs other than v and the kinds of values they
+// format. A verb formats arrays, maps, structs and enum values by
+// formatting their elements; v formats every value as println prints
+// it.
+var verbs = map[byte][]Kind{
+	'v': {Int, Float, Str, Bool},
+	'd': {Int},
+	'b': {Int},
+	'o': {Int},
+	'x': {Int, Str},
+	'X': {Int, Str},
+	'e': {Float},
+	'E': {Float},
+	'f': {Float},
+	'g': {Float},
+	'G': {Float},
+	's': {Str},
+	'q': {Str},
+	't': {Bool},
+}
+
+// Accepts reports whether verb formats scalars of kind k.
+func Accepts(verb byte, k Kind) bool {
+	for _, ok := range verbs[verb] {
+		if ok == k {
+			return true
+		}
+	}
+	return false
+}
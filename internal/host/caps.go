@@ -0,0 +1,147 @@
+package host
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Capabilities are the side effects the programs a host runs may have
+// beyond writing their output. The standard library checks them before
+// it touches the file system, the environment or the clock, and fails
+// with a *PermissionError if they do not allow it.
+type Capabilities struct {
+	// Files is how programs may use the file system.
+	Files FileAccess
+	// Dir, if not empty, is the only directory programs may use files
+	// in. Relative paths are resolved in it rather than in the working
+	// directory, and symbolic links may not lead out of it.
+	Dir string
+	// Env allows programs to read environment variables.
+	Env bool
+	// Clock allows programs to read the time.
+	Clock bool
+}
+
+// FileAccess is how programs may use the file system.
+type FileAccess int
+
+const (
+	// NoFiles denies all use of the file system.
+	NoFiles FileAccess = iota
+	// ReadFiles allows reading files and listing directories.
+	ReadFiles
+	// WriteFiles allows writing files as well as reading them.
+	WriteFiles
+)
+
+// AllCapabilities allows everything, as hosts do unless told
+// otherwise.
+func AllCapabilities() Capabilities {
+	return Capabilities{Files: WriteFiles, Env: true, Clock: true}
+}
+
+// PermissionError is the error of an operation the capabilities of a
+// host do not allow. Programs get it as a PermissionError struct.
+type PermissionError struct {
+	// Op is the function that was denied, such as io.read_file.
+	Op string
+	// Path is the file or environment variable it was denied, if any.
+	Path string
+	// Capability is what it lacked: "read", "write", "env" or "clock".
+	Capability string
+}
+
+func (e *PermissionError) Error() string {
+	if e.Path == "" {
+		return e.Op + ": permission denied: no " + e.Capability + " capability"
+	}
+	return e.Op + " " + e.Path + ": permission denied: no " + e.Capability + " capability"
+}
+
+// OpenFile opens the file at path for the function op, as os.OpenFile
+// does, if c allows it: flags that create or write files need the write
+// capability, and the others the read one. With a Dir, the file is
+// opened through an os.Root of it, so that neither .. nor symbolic
+// links, even ones made while it is opened, lead out of it.
+func (c Capabilities) OpenFile(op, path string, flag int, perm fs.FileMode) (*os.File, error) {
+	capability := "read"
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		capability = "write"
+	}
+	denied := &PermissionError{Op: op, Path: path, Capability: capability}
+	if c.Files < ReadFiles || capability == "write" && c.Files < WriteFiles {
+		return nil, denied
+	}
+	if c.Dir == "" {
+		return os.OpenFile(path, flag, perm)
+	}
+
+	rel, ok := c.local(path)
+	if !ok {
+		return nil, denied
+	}
+	root, err := os.OpenRoot(c.Dir)
+	if err != nil {
+		return nil, denied
+	}
+	defer root.Close()
+	f, err := root.OpenFile(rel, flag, perm)
+	if escapes(err) {
+		return nil, denied
+	}
+	return f, err
+}
+
+// CheckEnv checks that the function op may read the environment
+// variable name.
+func (c Capabilities) CheckEnv(op, name string) *PermissionError {
+	if !c.Env {
+		return &PermissionError{Op: op, Path: name, Capability: "env"}
+	}
+	return nil
+}
+
+// CheckClock checks that the function op may read the time.
+func (c Capabilities) CheckClock(op string) *PermissionError {
+	if !c.Clock {
+		return &PermissionError{Op: op, Capability: "clock"}
+	}
+	return nil
+}
+
+// local returns path relative to c.Dir, and false if it is an absolute
+// path outside it.
+func (c Capabilities) local(path string) (string, bool) {
+	if !filepath.IsAbs(path) {
+		return path, true
+	}
+	dir, err := filepath.Abs(c.Dir)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err == nil && filepath.IsLocal(rel) {
+		return rel, true
+	}
+	// the path may lead through the target of a link to the directory
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return "", false
+	}
+	rel, err = filepath.Rel(dir, path)
+	return rel, err == nil && filepath.IsLocal(rel)
+}
+
+// escapes reports whether err is the error of an os.Root refusing a
+// path that leads out of it, which is an error of its own rather than
+// one of the system.
+func escapes(err error) bool {
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) {
+		return false
+	}
+	var errno syscall.Errno
+	return !errors.As(pathErr.Err, &errno)
+}
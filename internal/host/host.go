@@ -0,0 +1,291 @@
+// Package host connects Go programs to the Gust programs they run. It
+// converts values between Go and Gust, and declares the globals, types
+// and native functions of a host program both in an interpreter and in
+// the type checker of the programs it runs, so that the two agree.
+//
+// The public gust package and the standard library build on it.
+package host
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+	"github.com/voidwyrm-2/gust/internal/typechecker"
+)
+
+// Host declares Go values in an interpreter and a checker.
+type Host struct {
+	in      *interpreter.Interpreter
+	checker *typechecker.Checker
+	// structs are the Go struct types declared as Gust structs.
+	structs map[reflect.Type]*structType
+	caps    Capabilities
+	// now and rand are the clock and random numbers of native
+	// functions, which deterministic hosts replace.
+	now           func() time.Time
+	rand          *rand.Rand
+	deterministic bool
+}
+
+// New returns a host declaring values in the interpreter in and the
+// checker of the programs it runs.
+func New(in *interpreter.Interpreter, checker *typechecker.Checker) *Host {
+	h := &Host{
+		in:      in,
+		checker: checker,
+		structs: map[reflect.Type]*structType{},
+		caps:    AllCapabilities(),
+		now:     time.Now,
+		rand:    rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+	in.SetOpenFile(h.openFile)
+	return h
+}
+
+// openFile opens the file at path for the read_file builtin, if the
+// capabilities of h allow it.
+func (h *Host) openFile(path string) (io.ReadCloser, error) {
+	return h.caps.OpenFile("read_file", path, os.O_RDONLY, 0)
+}
+
+// SetDeterministic makes the programs h runs deterministic, so that
+// every run of a program gives the same output. Native functions get a
+// virtual clock, which starts at the beginning of 2000 UTC and advances
+// by a millisecond each time it is read, and random numbers from seed.
+// Programs using the nondeterministic members of modules, such as
+// env.get, are rejected by the checker, and calling them raises a
+// runtime error in programs that were not checked, such as bytecode
+// files.
+func (h *Host) SetDeterministic(seed uint64) {
+	t := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	h.now = func() time.Time {
+		t = t.Add(time.Millisecond)
+		return t
+	}
+	h.rand = rand.New(rand.NewPCG(seed, seed))
+	h.deterministic = true
+	h.checker.SetDeterministic(true)
+}
+
+// SetCapabilities sets the side effects programs may have, which the
+// native functions of the host check with Call.Capabilities. The
+// read_file builtin is held to them too. The default is
+// AllCapabilities.
+func (h *Host) SetCapabilities(c Capabilities) {
+	h.caps = c
+}
+
+// Convert converts the Go value v to a Gust value as Set does, and
+// returns it with its type.
+func (h *Host) Convert(v any) (interpreter.Object, typechecker.Type, error) {
+	return h.toGust(reflect.ValueOf(v))
+}
+
+// Set sets the global variable called name to v, converted to a Gust
+// value, declaring it for the programs checked afterwards if it does
+// not exist yet. An existing variable keeps its type, which v must
+// have.
+//
+// Booleans, integers, floats and strings become bool, int, float and
+// str; slices and arrays become arrays and maps become maps, with their
+// keys in order; a pointer or interface becomes the value it refers
+// to, and a Value stays as it is. A struct becomes a value of a Gust
+// struct type declared with the Go type's name, whose fields are its
+// exported fields. A field is named by its `gust:"name"` tag, or by its
+// Go name with the first letter in lower case; the tag `gust:"-"`
+// leaves the field out. A function becomes a native function, as
+// Module.Func describes.
+func (h *Host) Set(name string, v any) error {
+	rv := reflect.ValueOf(v)
+	var obj interpreter.Object
+	var t typechecker.Type
+	var err error
+	if rv.Kind() == reflect.Func && !rv.IsNil() {
+		// named after the variable in stacks
+		var fn *native
+		if fn, err = h.function(name, rv, ""); err == nil {
+			obj, t = fn.builtin, fn.typ
+		}
+	} else {
+		obj, t, err = h.toGust(rv)
+	}
+	if err != nil {
+		return fmt.Errorf("gust: %s: %w", name, err)
+	}
+
+	if old, ok := h.checker.Lookup(name); ok {
+		if !typechecker.AssignableTo(t, old) {
+			return fmt.Errorf("gust: cannot set %s of type %s to a value of type %s", name, old, t)
+		}
+	} else {
+		h.checker.Declare(name, t)
+	}
+	h.in.Globals().Set(name, obj)
+	return nil
+}
+
+// Module is a set of native functions and values a host program
+// declares as one global, which programs use as `name.member`.
+type Module struct {
+	Name    string
+	members []member
+	// atRunEnd are called when each run of a program ends
+	atRunEnd []func()
+}
+
+// member is a function or value of a module. A function may have a
+// Gust signature to declare it with.
+type member struct {
+	name string
+	v    any
+	sig  string
+	fn   bool
+	// nondeterministic members give results the host cannot
+	// reproduce, such as the environment's
+	nondeterministic bool
+	// format members take a format string, which the checker checks
+	format bool
+}
+
+// NewModule returns an empty module called name.
+func NewModule(name string) *Module {
+	return &Module{Name: name}
+}
+
+// Func adds the Go function fn to m as name and returns m. The types of
+// its parameters and results declare its Gust signature, as Set
+// converts values of those types:
+//
+//   - A function with no result returns null; a result of type error
+//     makes it return Result, `(T, error)` giving Result[T, str] and a
+//     lone error Result[void, str]. A result of a concrete type that
+//     implements error, such as *MyError, gives the type of that value
+//     instead of str.
+//   - A variadic function is variadic in Gust.
+//   - A first parameter of type *Call is not one of its Gust
+//     parameters: it gets the call, to write output or call the Gust
+//     functions it is passed.
+//   - A parameter of a Go function type takes a Gust function, which
+//     returns an error to a Go result of type error, and raises a
+//     runtime error otherwise.
+//
+// A native function raises a runtime error by returning or panicking
+// with a *interpreter.RuntimeError, as Raise does; any other panic is
+// raised as a runtime error too.
+func (m *Module) Func(name string, fn any) *Module {
+	m.members = append(m.members, member{name: name, v: fn, fn: true})
+	return m
+}
+
+// FuncSig adds fn to m as Func does, but declares it with the Gust
+// signature sig, such as `fn first[T](xs: [T]) -> Option[T]`, which is
+// how generic native functions are declared. Its parameters must be
+// those of fn, after a *Call, and its parameter and result types ones
+// that fn's Go types convert to and from; only a Value may stand for a
+// type parameter.
+func (m *Module) FuncSig(name, sig string, fn any) *Module {
+	m.members = append(m.members, member{name: name, v: fn, sig: sig, fn: true})
+	return m
+}
+
+// Value adds the value v to m as name, converted as Set converts it,
+// and returns m.
+func (m *Module) Value(name string, v any) *Module {
+	m.members = append(m.members, member{name: name, v: v})
+	return m
+}
+
+// guard makes the nondeterministic builtin b raise a runtime error
+// when h is deterministic.
+func (h *Host) guard(b *interpreter.Builtin) {
+	call := b.Fn
+	b.Fn = func(in *interpreter.Interpreter, args ...interpreter.Object) interpreter.Object {
+		if h.deterministic {
+			return &interpreter.RuntimeError{Message: b.Name + " is nondeterministic and cannot be used in deterministic mode"}
+		}
+		return call(in, args...)
+	}
+}
+
+// Nondeterministic marks the members of m called names as giving
+// results a deterministic host cannot reproduce, so that deterministic
+// programs may not use them, and returns m. The clock and random
+// numbers native functions get from their Call are reproducible.
+func (m *Module) Nondeterministic(names ...string) *Module {
+	for i := range m.members {
+		if slices.Contains(names, m.members[i].name) {
+			m.members[i].nondeterministic = true
+		}
+	}
+	return m
+}
+
+// Format marks the members of m called names as functions whose first
+// parameter is a format string, such as fmt.printf, and returns m. The
+// checker checks calls of them that pass a string literal against its
+// directives. They must take a str and variadic arguments after it.
+func (m *Module) Format(names ...string) *Module {
+	for i := range m.members {
+		if slices.Contains(names, m.members[i].name) {
+			m.members[i].format = true
+		}
+	}
+	return m
+}
+
+// AtRunEnd adds f to the functions called when each run of a program
+// ends, and returns m. Modules whose functions acquire resources, such
+// as open files, release those of the run with it.
+func (m *Module) AtRunEnd(f func()) *Module {
+	m.atRunEnd = append(m.atRunEnd, f)
+	return m
+}
+
+// Register declares the module m as a global for the programs checked
+// afterwards.
+func (h *Host) Register(m *Module) error {
+	mod := &interpreter.Module{Name: m.Name, Members: map[string]interpreter.Object{}}
+	typ := &typechecker.Module{Name: m.Name, Members: map[string]typechecker.Type{}, Nondeterministic: map[string]bool{}}
+	for _, mem := range m.members {
+		if mem.nondeterministic {
+			typ.Nondeterministic[mem.name] = true
+		}
+		rv := reflect.ValueOf(mem.v)
+		var err error
+		if mem.fn {
+			if rv.Kind() != reflect.Func || rv.IsNil() {
+				return fmt.Errorf("gust: %s.%s: %T is not a function", m.Name, mem.name, mem.v)
+			}
+			var fn *native
+			if fn, err = h.function(m.Name+"."+mem.name, rv, mem.sig); err == nil {
+				if mem.nondeterministic {
+					h.guard(fn.builtin)
+				}
+				if mem.format {
+					if len(fn.typ.Params) < 2 || fn.typ.Params[0] != typechecker.Str || !fn.typ.Variadic {
+						return fmt.Errorf("gust: %s.%s: a format function must take a str and variadic arguments", m.Name, mem.name)
+					}
+					fn.typ.Format = true
+				}
+				mod.Members[mem.name], typ.Members[mem.name] = fn.builtin, fn.typ
+			}
+		} else {
+			mod.Members[mem.name], typ.Members[mem.name], err = h.toGust(rv)
+		}
+		if err != nil {
+			return fmt.Errorf("gust: %s.%s: %w", m.Name, mem.name, err)
+		}
+	}
+	h.checker.Declare(m.Name, typ)
+	h.in.Globals().Set(m.Name, mod)
+	for _, f := range m.atRunEnd {
+		h.in.AtRunEnd(f)
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+package host
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+	"github.com/voidwyrm-2/gust/internal/typechecker"
+)
+
+// Call is the call of a native function, which gets it as its first
+// parameter if that has type *Call.
+type Call struct {
+	h  *Host
+	in *interpreter.Interpreter
+}
+
+var callType = reflect.TypeOf((*Call)(nil))
+
+// Output returns the writer the program's output goes to.
+func (c *Call) Output() io.Writer {
+	return c.in.Output()
+}
+
+// Input returns the reader the program's input comes from.
+func (c *Call) Input() io.Reader {
+	return c.in.Input()
+}
+
+// ErrOutput returns the writer the program's errors go to.
+func (c *Call) ErrOutput() io.Writer {
+	return c.in.ErrOutput()
+}
+
+// Display returns v as println prints it, calling the show method of a
+// struct that implements Display. A runtime error show raises is raised
+// in turn.
+func (c *Call) Display(v Value) string {
+	s, err := c.in.Display(v.Object())
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Capabilities returns the side effects the program may have, which
+// the native function must check before it has any.
+func (c *Call) Capabilities() Capabilities {
+	return c.h.caps
+}
+
+// Now returns the time, from the host's clock.
+func (c *Call) Now() time.Time {
+	return c.h.now()
+}
+
+// Rand returns the source of random numbers of the host.
+func (c *Call) Rand() *rand.Rand {
+	return c.h.rand
+}
+
+// Call calls the Gust function fn with args, converted as Set converts
+// them, and returns its result. An error it raises is returned as a
+// *interpreter.RuntimeError, which the native function may return to
+// raise it in turn.
+func (c *Call) Call(fn Value, args ...any) (Value, error) {
+	objs := make([]interpreter.Object, len(args))
+	for i, arg := range args {
+		obj, _, err := c.h.toGust(reflect.ValueOf(arg))
+		if err != nil {
+			return Value{}, err
+		}
+		objs[i] = obj
+	}
+	result := c.in.Apply(fn.Object(), objs...)
+	if err, ok := result.(*interpreter.RuntimeError); ok {
+		return Value{}, err
+	}
+	return Value{result}, nil
+}
+
+// ReadAll reads r to the end, charging what it reads to the memory
+// limit of the run. A run that would exceed it stops before more than
+// the limit allows is read.
+func (c *Call) ReadAll(r io.Reader) ([]byte, error) {
+	data, err := c.in.ReadAll(r)
+	if rerr, ok := err.(*interpreter.RuntimeError); ok {
+		panic(rerr)
+	}
+	return data, err
+}
+
+// Charge charges n bytes to the memory limit of the run, for memory a
+// native function uses on the way to its result, which is charged when
+// it is returned. A run that would exceed the limit stops here.
+func (c *Call) Charge(n int64) {
+	if err := c.in.Charge(n); err != nil {
+		panic(err)
+	}
+}
+
+// Raise raises a runtime error with the formatted message from a
+// native function.
+func Raise(format string, a ...any) {
+	panic(&interpreter.RuntimeError{Message: fmt.Sprintf(format, a...)})
+}
+
+// native is a Go function declared as a Gust function.
+type native struct {
+	builtin *interpreter.Builtin
+	typ     *typechecker.Function
+}
+
+// function declares the Go function fn as the native function name,
+// with the signature sig, or the one its Go type gives if sig is empty.
+func (h *Host) function(name string, fn reflect.Value, sig string) (*native, error) {
+	t := fn.Type()
+	typ, err := h.funcType(t)
+	if err != nil {
+		return nil, err
+	}
+	if sig != "" {
+		declared, err := h.checker.ParseSignature(sig)
+		if err != nil {
+			return nil, err
+		}
+		if len(declared.Params) != len(typ.Params) {
+			return nil, fmt.Errorf("the signature %q has %d parameters, the function %d", sig, len(declared.Params), len(typ.Params))
+		}
+		for i, p := range params(t) {
+			if !h.conforms(declared.Params[i], p) {
+				return nil, fmt.Errorf("the signature %q has parameter %d of type %s, the function %s", sig, i+1, declared.Params[i], p)
+			}
+		}
+		if !h.resultConforms(declared.Return, t) {
+			return nil, fmt.Errorf("the signature %q has result type %s, the function %s", sig, declared.Return, t)
+		}
+		declared.Variadic = typ.Variadic
+		typ = declared
+	}
+
+	builtin := &interpreter.Builtin{Name: name}
+	builtin.Fn = func(in *interpreter.Interpreter, args ...interpreter.Object) interpreter.Object {
+		return h.call(in, name, fn, args)
+	}
+	return &native{builtin, typ}, nil
+}
+
+// conforms reports whether values of the declared Gust type convert to
+// and from the Go type t. A Value holds values of any type, including
+// type parameters, which no other Go type may stand for.
+func (h *Host) conforms(declared typechecker.Type, t reflect.Type) bool {
+	if t == valueType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return !hasTypeParam(declared)
+	case reflect.Pointer:
+		return h.conforms(declared, t.Elem())
+	case reflect.Slice, reflect.Array:
+		d, ok := declared.(*typechecker.Array)
+		return ok && h.conforms(d.Elem, t.Elem())
+	case reflect.Map:
+		d, ok := declared.(*typechecker.Map)
+		return ok && h.conforms(d.Key, t.Key()) && h.conforms(d.Value, t.Elem())
+	case reflect.Func:
+		d, ok := declared.(*typechecker.Function)
+		ps := params(t)
+		if !ok || len(d.Params) != len(ps) || d.Variadic != t.IsVariadic() {
+			return false
+		}
+		for i, p := range ps {
+			if !h.conforms(d.Params[i], p) {
+				return false
+			}
+		}
+		return h.resultConforms(d.Return, t)
+	}
+	got, err := h.typeOf(t)
+	return err == nil && !hasTypeParam(declared) && typechecker.Identical(declared, got)
+}
+
+// resultConforms reports whether the results of the Go function type t
+// convert to values of the declared Gust type, as funcType converts
+// them.
+func (h *Host) resultConforms(declared typechecker.Type, t reflect.Type) bool {
+	switch {
+	case t.NumOut() == 0:
+		return declared == typechecker.Void
+	case t.NumOut() == 1 && !t.Out(0).Implements(errorType):
+		return h.conforms(declared, t.Out(0))
+	case t.NumOut() <= 2 && t.Out(t.NumOut()-1).Implements(errorType):
+		d, ok := declared.(*typechecker.Enum)
+		if !ok || d.Origin != typechecker.Result {
+			return false
+		}
+		if t.NumOut() == 1 && d.Args[0] != typechecker.Void || t.NumOut() == 2 && !h.conforms(d.Args[0], t.Out(0)) {
+			return false
+		}
+		if et := t.Out(t.NumOut() - 1); et != errorType {
+			return h.conforms(d.Args[1], et)
+		}
+		return d.Args[1] == typechecker.Str
+	}
+	return false
+}
+
+// hasTypeParam reports whether t is or contains a type parameter.
+func hasTypeParam(t typechecker.Type) bool {
+	var args []typechecker.Type
+	switch t := t.(type) {
+	case *typechecker.TypeParam:
+		return true
+	case *typechecker.Array:
+		args = []typechecker.Type{t.Elem}
+	case *typechecker.Map:
+		args = []typechecker.Type{t.Key, t.Value}
+	case *typechecker.Function:
+		args = append([]typechecker.Type{t.Return}, t.Params...)
+	case *typechecker.Struct:
+		args = t.Args
+	case *typechecker.Enum:
+		args = t.Args
+	}
+	return slices.ContainsFunc(args, hasTypeParam)
+}
+
+// params returns the parameters of the Go function type t that are
+// Gust parameters.
+func params(t reflect.Type) []reflect.Type {
+	var ps []reflect.Type
+	for i := 0; i < t.NumIn(); i++ {
+		if i == 0 && t.In(0) == callType {
+			continue
+		}
+		ps = append(ps, t.In(i))
+	}
+	return ps
+}
+
+// funcType returns the Gust type of the Go function type t.
+func (h *Host) funcType(t reflect.Type) (*typechecker.Function, error) {
+	typ := &typechecker.Function{Variadic: t.IsVariadic()}
+	for _, p := range params(t) {
+		pt, err := h.typeOf(p)
+		if err != nil {
+			return nil, err
+		}
+		typ.Params = append(typ.Params, pt)
+	}
+
+	switch {
+	case t.NumOut() == 0:
+		typ.Return = typechecker.Void
+	case t.NumOut() == 1 && !t.Out(0).Implements(errorType):
+		rt, err := h.typeOf(t.Out(0))
+		if err != nil {
+			return nil, err
+		}
+		typ.Return = rt
+	case t.NumOut() <= 2 && t.Out(t.NumOut()-1).Implements(errorType):
+		ok := typechecker.Type(typechecker.Void)
+		if t.NumOut() == 2 {
+			var err error
+			if ok, err = h.typeOf(t.Out(0)); err != nil {
+				return nil, err
+			}
+		}
+		e := typechecker.Type(typechecker.Str)
+		if et := t.Out(t.NumOut() - 1); et != errorType {
+			var err error
+			if e, err = h.typeOf(et); err != nil {
+				return nil, err
+			}
+		}
+		typ.Return = typechecker.Result.Instantiate(ok, e)
+	default:
+		return nil, fmt.Errorf("cannot convert the results of %s to a Gust result", t)
+	}
+	return typ, nil
+}
+
+// call calls the Go function fn, declared as the native function name,
+// with args.
+func (h *Host) call(in *interpreter.Interpreter, name string, fn reflect.Value, args []interpreter.Object) (result interpreter.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(*interpreter.RuntimeError); ok {
+				result = err
+				return
+			}
+			result = &interpreter.RuntimeError{Message: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+
+	t := fn.Type()
+	ps := params(t)
+	if len(args) != len(ps) && !(t.IsVariadic() && len(args) >= len(ps)-1) {
+		return &interpreter.RuntimeError{Message: fmt.Sprintf("wrong number of arguments to builtin %s: want=%d, got=%d", name, len(ps), len(args))}
+	}
+
+	var goArgs []reflect.Value
+	if len(ps) < t.NumIn() {
+		goArgs = append(goArgs, reflect.ValueOf(&Call{h, in}))
+	}
+	for i, arg := range args {
+		var pt reflect.Type
+		if t.IsVariadic() && i >= len(ps)-1 {
+			pt = ps[len(ps)-1].Elem()
+		} else {
+			pt = ps[i]
+		}
+		v := reflect.New(pt).Elem()
+		if err := h.decode(in, arg, v); err != nil {
+			return &interpreter.RuntimeError{Message: fmt.Sprintf("argument %d of %s: %v", i+1, name, err)}
+		}
+		goArgs = append(goArgs, v)
+	}
+	return h.results(in, name, fn.Call(goArgs))
+}
+
+// results converts the results of a native function to its Gust
+// result, charging the value it returns to the run's memory limit
+// before converting it.
+func (h *Host) results(in *interpreter.Interpreter, name string, out []reflect.Value) interpreter.Object {
+	if len(out) == 0 {
+		return interpreter.NULL
+	}
+	last := out[len(out)-1]
+	if !last.Type().Implements(errorType) {
+		if err := in.Charge(sizeOf(last)); err != nil {
+			return err
+		}
+		obj, _, err := h.toGust(last)
+		if err != nil {
+			return &interpreter.RuntimeError{Message: fmt.Sprintf("result of %s: %v", name, err)}
+		}
+		return obj
+	}
+
+	if last.Kind() != reflect.Interface && last.Kind() != reflect.Pointer || !last.IsNil() {
+		if err, ok := last.Interface().(*interpreter.RuntimeError); ok {
+			return err
+		}
+		if last.Type() == errorType {
+			return interpreter.NewErr(&interpreter.String{Value: last.Interface().(error).Error()})
+		}
+		obj, _, err := h.toGust(last)
+		if err != nil {
+			return &interpreter.RuntimeError{Message: fmt.Sprintf("error of %s: %v", name, err)}
+		}
+		return interpreter.NewErr(obj)
+	}
+	if len(out) == 1 {
+		return interpreter.NewOk(interpreter.NULL)
+	}
+	if err := in.Charge(sizeOf(out[0])); err != nil {
+		return err
+	}
+	obj, _, err := h.toGust(out[0])
+	if err != nil {
+		return &interpreter.RuntimeError{Message: fmt.Sprintf("result of %s: %v", name, err)}
+	}
+	return interpreter.NewOk(obj)
+}
+
+// goFunc returns a Go function of type t that calls the Gust function
+// fn while in runs a program.
+func (h *Host) goFunc(in *interpreter.Interpreter, fn interpreter.Object, t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.New(t.Out(i)).Elem()
+		}
+		fail := func(err *interpreter.RuntimeError) []reflect.Value {
+			if t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType {
+				out[len(out)-1].Set(reflect.ValueOf(err))
+				return out
+			}
+			panic(err)
+		}
+
+		objs := make([]interpreter.Object, len(args))
+		for i, arg := range args {
+			obj, _, err := h.toGust(arg)
+			if err != nil {
+				return fail(&interpreter.RuntimeError{Message: err.Error()})
+			}
+			objs[i] = obj
+		}
+		result := in.Apply(fn, objs...)
+		if err, ok := result.(*interpreter.RuntimeError); ok {
+			return fail(err)
+		}
+		if len(out) > 0 && t.Out(0) != errorType {
+			if err := h.decode(in, result, out[0]); err != nil {
+				return fail(&interpreter.RuntimeError{Message: err.Error()})
+			}
+		}
+		return out
+	})
+}
@@ -0,0 +1,640 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+	"github.com/voidwyrm-2/gust/internal/typechecker"
+)
+
+// Value is a Gust value. The zero Value is null.
+type Value struct {
+	obj interpreter.Object
+}
+
+// Wrap returns obj as a Value.
+func Wrap(obj interpreter.Object) Value {
+	return Value{obj}
+}
+
+// Object returns the interpreter object of v.
+func (v Value) Object() interpreter.Object {
+	if v.obj == nil {
+		return interpreter.NULL
+	}
+	return v.obj
+}
+
+// Enum is a value of an enum type, such as Some(1), as Interface and
+// Decode give it.
+type Enum struct {
+	Variant string
+	Fields  []any
+}
+
+// String formats v as println prints it.
+func (v Value) String() string {
+	return v.Object().Inspect()
+}
+
+// IsNull reports whether v is null.
+func (v Value) IsNull() bool {
+	_, null := v.Object().(*interpreter.Null)
+	return null
+}
+
+// Equal reports whether v == w in Gust.
+func (v Value) Equal(w Value) bool {
+	return interpreter.Equal(v.Object(), w.Object())
+}
+
+// Pair is an entry of a map.
+type Pair struct {
+	Key, Value Value
+}
+
+// Pairs returns the entries of v, a map, in its order, or nil if v is
+// not a map.
+func (v Value) Pairs() []Pair {
+	m, ok := v.obj.(*interpreter.Map)
+	if !ok {
+		return nil
+	}
+	var pairs []Pair
+	for _, p := range m.Pairs() {
+		pairs = append(pairs, Pair{Value{p.Key}, Value{p.Value}})
+	}
+	return pairs
+}
+
+// Interface returns v as the Go value Decode stores in an interface:
+// an int64, float64, string, bool, []any, map[any]any, a map[string]any
+// of the fields of a struct, an Enum, nil for null, or the Value itself
+// for a function.
+func (v Value) Interface() any {
+	var x any
+	if err := v.Decode(&x); err != nil {
+		return v
+	}
+	return x
+}
+
+// Decode stores v in the Go value dst points to, converting it as Set
+// converts Go values the other way. A null sets it to its zero value.
+//
+// Into a type other than an interface, Some(x) and Ok(x) decode as x,
+// None as null and Err(e) as an error, which Decode returns.
+func (v Value) Decode(dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("gust: cannot decode into %T, want a non-nil pointer", dst)
+	}
+	if err := (*Host)(nil).decode(nil, v.Object(), rv.Elem()); err != nil {
+		return fmt.Errorf("gust: %w", err)
+	}
+	return nil
+}
+
+var (
+	valueType = reflect.TypeOf(Value{})
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// isNull reports whether obj decodes as null into types other than
+// interfaces: it is null or None.
+func isNull(obj interpreter.Object) bool {
+	if e, ok := obj.(*interpreter.EnumValue); ok {
+		return e.Variant.Enum.Name == "Option" && e.Variant.Name == "None"
+	}
+	return Value{obj}.IsNull()
+}
+
+// decode stores obj in dst. Functions decode into Go functions only
+// while in runs a program that called a native function, which h
+// declared.
+func (h *Host) decode(in *interpreter.Interpreter, obj interpreter.Object, dst reflect.Value) error {
+	return h.decodeIn(nil, in, obj, dst)
+}
+
+// decodeIn is decode inside the values of active, which are being
+// decoded. A value found inside itself cannot be decoded.
+func (h *Host) decodeIn(active map[interpreter.Object]bool, in *interpreter.Interpreter, obj interpreter.Object, dst reflect.Value) error {
+	if dst.Type() == valueType {
+		dst.Set(reflect.ValueOf(Value{obj}))
+		return nil
+	}
+	if isNull(obj) && dst.Kind() != reflect.Interface {
+		dst.SetZero()
+		return nil
+	}
+	if dst.Kind() == reflect.Pointer {
+		elem := reflect.New(dst.Type().Elem())
+		if err := h.decodeIn(active, in, obj, elem.Elem()); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	}
+	switch obj.(type) {
+	case *interpreter.Array, *interpreter.Map, *interpreter.Struct, *interpreter.EnumValue:
+		if active[obj] {
+			return errors.New("cannot decode a value that contains itself")
+		}
+		if active == nil {
+			active = map[interpreter.Object]bool{}
+		}
+		active[obj] = true
+		defer delete(active, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *interpreter.Null:
+		dst.SetZero()
+		return nil
+
+	case *interpreter.Integer:
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.OverflowInt(obj.Value) {
+				return fmt.Errorf("%d overflows %s", obj.Value, dst.Type())
+			}
+			dst.SetInt(obj.Value)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if obj.Value < 0 || dst.OverflowUint(uint64(obj.Value)) {
+				return fmt.Errorf("%d overflows %s", obj.Value, dst.Type())
+			}
+			dst.SetUint(uint64(obj.Value))
+			return nil
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(float64(obj.Value))
+			return nil
+		}
+		return set(dst, obj.Value, obj)
+
+	case *interpreter.Float:
+		if dst.Kind() == reflect.Float32 || dst.Kind() == reflect.Float64 {
+			dst.SetFloat(obj.Value)
+			return nil
+		}
+		return set(dst, obj.Value, obj)
+
+	case *interpreter.String:
+		return set(dst, obj.Value, obj)
+
+	case *interpreter.Boolean:
+		return set(dst, obj.Value, obj)
+
+	case *interpreter.Array:
+		switch dst.Kind() {
+		case reflect.Interface:
+			xs := make([]any, len(obj.Elements))
+			for i, el := range obj.Elements {
+				if err := h.decodeIn(active, in, el, reflect.ValueOf(&xs[i]).Elem()); err != nil {
+					return err
+				}
+			}
+			return set(dst, xs, obj)
+		case reflect.Slice:
+			dst.Set(reflect.MakeSlice(dst.Type(), len(obj.Elements), len(obj.Elements)))
+		case reflect.Array:
+			if dst.Len() != len(obj.Elements) {
+				return fmt.Errorf("cannot decode an array of %d elements into %s", len(obj.Elements), dst.Type())
+			}
+		default:
+			return mismatch(obj, dst)
+		}
+		for i, el := range obj.Elements {
+			if err := h.decodeIn(active, in, el, dst.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *interpreter.Map:
+		t := dst.Type()
+		if dst.Kind() == reflect.Interface {
+			t = reflect.TypeOf(map[any]any{})
+		} else if dst.Kind() != reflect.Map {
+			return mismatch(obj, dst)
+		}
+		m := reflect.MakeMapWithSize(t, obj.Len())
+		for _, pair := range obj.Pairs() {
+			key := reflect.New(t.Key()).Elem()
+			val := reflect.New(t.Elem()).Elem()
+			if err := h.decodeIn(active, in, pair.Key, key); err != nil {
+				return err
+			}
+			if err := h.decodeIn(active, in, pair.Value, val); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, val)
+		}
+		if dst.Kind() == reflect.Interface {
+			return set(dst, m.Interface(), obj)
+		}
+		dst.Set(m)
+		return nil
+
+	case *interpreter.Struct:
+		switch dst.Kind() {
+		case reflect.Interface:
+			m := map[string]any{}
+			for _, name := range obj.Def.Fields {
+				var x any
+				if err := h.decodeIn(active, in, obj.Fields[name], reflect.ValueOf(&x).Elem()); err != nil {
+					return err
+				}
+				m[name] = x
+			}
+			return set(dst, m, obj)
+		case reflect.Struct:
+			for _, f := range structFields(dst.Type()) {
+				val, ok := obj.Fields[f.name]
+				if !ok {
+					continue
+				}
+				if err := h.decodeIn(active, in, val, dst.FieldByIndex(f.index)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return mismatch(obj, dst)
+
+	case *interpreter.EnumValue:
+		if dst.Kind() == reflect.Interface {
+			e := Enum{Variant: obj.Variant.Name, Fields: make([]any, len(obj.Fields))}
+			for i, field := range obj.Fields {
+				if err := h.decodeIn(active, in, field, reflect.ValueOf(&e.Fields[i]).Elem()); err != nil {
+					return err
+				}
+			}
+			return set(dst, e, obj)
+		}
+		switch obj.Variant.Enum.Name + "." + obj.Variant.Name {
+		case "Option.Some", "Result.Ok":
+			return h.decodeIn(active, in, obj.Fields[0], dst)
+		case "Result.Err":
+			return errors.New(obj.Fields[0].Inspect())
+		}
+		return mismatch(obj, dst)
+	}
+
+	if dst.Kind() == reflect.Func && in != nil {
+		dst.Set(h.goFunc(in, obj, dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		dst.Set(reflect.ValueOf(Value{obj}))
+		return nil
+	}
+	return mismatch(obj, dst)
+}
+
+// set stores x, the Go value of obj, in dst if it has x's type or is
+// an interface x implements.
+func set(dst reflect.Value, x any, obj interpreter.Object) error {
+	rx := reflect.ValueOf(x)
+	if !rx.Type().AssignableTo(dst.Type()) {
+		if !rx.Type().ConvertibleTo(dst.Type()) || rx.Kind() != dst.Kind() {
+			return mismatch(obj, dst)
+		}
+		rx = rx.Convert(dst.Type())
+	}
+	dst.Set(rx)
+	return nil
+}
+
+func mismatch(obj interpreter.Object, dst reflect.Value) error {
+	return fmt.Errorf("cannot decode %s into %s", strings.ToLower(string(obj.Type())), dst.Type())
+}
+
+// structType is a Go struct type declared as a Gust struct.
+type structType struct {
+	def    *interpreter.StructDef
+	typ    *typechecker.Struct
+	fields []structField
+}
+
+// structField is a field of a Go struct and the name it has in Gust.
+type structField struct {
+	name  string
+	index []int
+}
+
+// structFields returns the fields of the Go struct type t that Gust
+// sees.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name, tagged := f.Tag.Lookup("gust")
+		if name == "-" {
+			continue
+		}
+		if !tagged || name == "" {
+			r, size := utf8.DecodeRuneInString(f.Name)
+			name = string(unicode.ToLower(r)) + f.Name[size:]
+		}
+		fields = append(fields, structField{name, f.Index})
+	}
+	return fields
+}
+
+// sizeOf estimates the bytes of the Gust value v converts to, as
+// interpreter.Alloc counts them, so that a native function's result is
+// charged before it is converted.
+func sizeOf(v reflect.Value) int64 {
+	return sizeIn(nil, v)
+}
+
+// sizeIn is sizeOf inside the Go values of active, whose sizes are
+// being added up. A value inside itself is counted once.
+func sizeIn(active map[goRef]bool, v reflect.Value) int64 {
+	if !v.IsValid() || v.Type() == valueType {
+		return 0
+	}
+	ref, ok := refOf(v)
+	if ok {
+		if active[ref] {
+			return 0
+		}
+		if active == nil {
+			active = map[goRef]bool{}
+		}
+		active[ref] = true
+		defer delete(active, ref)
+	}
+	var n int64
+	switch v.Kind() {
+	case reflect.String:
+		return 16 + int64(v.Len())
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return sizeIn(active, v.Elem())
+	case reflect.Slice, reflect.Array:
+		n = 24 + 16*int64(v.Len())
+		for i := range v.Len() {
+			n += sizeIn(active, v.Index(i))
+		}
+	case reflect.Map:
+		n = 48 + 64*int64(v.Len())
+		for it := v.MapRange(); it.Next(); {
+			n += sizeIn(active, it.Key()) + sizeIn(active, it.Value())
+		}
+	case reflect.Struct:
+		n = 16 + 64*int64(v.NumField())
+		for i := range v.NumField() {
+			n += sizeIn(active, v.Field(i))
+		}
+	}
+	return n
+}
+
+// goRef identifies the Go value a pointer, map or slice refers to.
+type goRef struct {
+	typ reflect.Type
+	ptr uintptr
+}
+
+// refOf returns what v refers to, and whether it is a non-nil pointer,
+// map or slice.
+func refOf(v reflect.Value) (goRef, bool) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if !v.IsNil() {
+			return goRef{v.Type(), v.Pointer()}, true
+		}
+	}
+	return goRef{}, false
+}
+
+// toGust converts a Go value to a Gust value and its static type.
+func (h *Host) toGust(v reflect.Value) (interpreter.Object, typechecker.Type, error) {
+	return h.toGustIn(nil, v)
+}
+
+// toGustIn is toGust inside the Go values of active, which are being
+// converted. A value found inside itself cannot be converted.
+func (h *Host) toGustIn(active map[goRef]bool, v reflect.Value) (interpreter.Object, typechecker.Type, error) {
+	if !v.IsValid() {
+		return interpreter.NULL, typechecker.Any, nil
+	}
+	if v.Type() == valueType {
+		return v.Interface().(Value).Object(), typechecker.Any, nil
+	}
+
+	if ref, ok := refOf(v); ok {
+		if active[ref] {
+			return nil, nil, fmt.Errorf("cannot convert a %s that contains itself", v.Type())
+		}
+		if active == nil {
+			active = map[goRef]bool{}
+		}
+		active[ref] = true
+		defer delete(active, ref)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return interpreter.TRUE, typechecker.Bool, nil
+		}
+		return interpreter.FALSE, typechecker.Bool, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &interpreter.Integer{Value: v.Int()}, typechecker.Int, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%d overflows int", v.Uint())
+		}
+		return &interpreter.Integer{Value: int64(v.Uint())}, typechecker.Int, nil
+	case reflect.Float32, reflect.Float64:
+		return &interpreter.Float{Value: v.Float()}, typechecker.Float, nil
+	case reflect.String:
+		return &interpreter.String{Value: v.String()}, typechecker.Str, nil
+
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			t, err := h.typeOf(v.Type())
+			return interpreter.NULL, t, err
+		}
+		return h.toGustIn(active, v.Elem())
+
+	case reflect.Slice, reflect.Array:
+		elem, err := h.typeOf(v.Type().Elem())
+		if err != nil {
+			return nil, nil, err
+		}
+		arr := &interpreter.Array{Elements: make([]interpreter.Object, v.Len())}
+		for i := range arr.Elements {
+			if arr.Elements[i], _, err = h.toGustIn(active, v.Index(i)); err != nil {
+				return nil, nil, err
+			}
+		}
+		return arr, &typechecker.Array{Elem: elem}, nil
+
+	case reflect.Map:
+		t, err := h.typeOf(v.Type())
+		if err != nil {
+			return nil, nil, err
+		}
+		m := interpreter.NewMap()
+		for _, key := range sortedMapKeys(v) {
+			k, _, err := h.toGustIn(active, key)
+			if err != nil {
+				return nil, nil, err
+			}
+			val, _, err := h.toGustIn(active, v.MapIndex(key))
+			if err != nil {
+				return nil, nil, err
+			}
+			m.Set(k.(interpreter.Hashable), val)
+		}
+		return m, t, nil
+
+	case reflect.Struct:
+		st, t, err := h.structType(v.Type())
+		if err != nil {
+			return nil, nil, err
+		}
+		s := &interpreter.Struct{Def: st.def, Fields: map[string]interpreter.Object{}}
+		for _, f := range st.fields {
+			if s.Fields[f.name], _, err = h.toGustIn(active, v.FieldByIndex(f.index)); err != nil {
+				return nil, nil, err
+			}
+		}
+		return s, t, nil
+
+	case reflect.Func:
+		if v.IsNil() {
+			return nil, nil, errors.New("cannot convert a nil function to a Gust value")
+		}
+		fn, err := h.function("fn", v, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		return fn.builtin, fn.typ, nil
+	}
+	return nil, nil, fmt.Errorf("cannot convert %s to a Gust value", v.Type())
+}
+
+// typeOf returns the Gust type of the values of the Go type t.
+func (h *Host) typeOf(t reflect.Type) (typechecker.Type, error) {
+	if t == valueType {
+		return typechecker.Any, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return typechecker.Bool, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return typechecker.Int, nil
+	case reflect.Float32, reflect.Float64:
+		return typechecker.Float, nil
+	case reflect.String:
+		return typechecker.Str, nil
+	case reflect.Interface:
+		return typechecker.Any, nil
+	case reflect.Pointer:
+		return h.typeOf(t.Elem())
+	case reflect.Slice, reflect.Array:
+		elem, err := h.typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &typechecker.Array{Elem: elem}, nil
+	case reflect.Map:
+		key, err := h.typeOf(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		if key != typechecker.Int && key != typechecker.Str && key != typechecker.Bool {
+			return nil, fmt.Errorf("cannot use %s as the key of a Gust map", t.Key())
+		}
+		val, err := h.typeOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &typechecker.Map{Key: key, Value: val}, nil
+	case reflect.Struct:
+		_, st, err := h.structType(t)
+		return st, err
+	case reflect.Func:
+		return h.funcType(t)
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Gust value", t)
+}
+
+// structType returns the Gust struct type of the Go struct type t,
+// declaring it the first time.
+func (h *Host) structType(t reflect.Type) (*structType, typechecker.Type, error) {
+	if st, ok := h.structs[t]; ok {
+		return st, st.typ, nil
+	}
+	if t.Name() == "" {
+		return nil, nil, fmt.Errorf("cannot convert the unnamed struct type %s to a Gust value", t)
+	}
+
+	st := &structType{
+		def: &interpreter.StructDef{
+			Name:    t.Name(),
+			Methods: map[string]interpreter.Object{},
+			Traits:  map[string]bool{},
+		},
+		typ: &typechecker.Struct{
+			Name:    t.Name(),
+			Methods: map[string]*typechecker.Function{},
+			Traits:  map[*typechecker.Trait]bool{},
+		},
+		fields: structFields(t),
+	}
+	// known before its fields are, which may refer to the struct
+	h.structs[t] = st
+	for _, f := range st.fields {
+		ft, err := h.typeOf(t.FieldByIndex(f.index).Type)
+		if err != nil {
+			delete(h.structs, t)
+			return nil, nil, fmt.Errorf("field %s of %s: %w", f.name, t, err)
+		}
+		st.def.Fields = append(st.def.Fields, f.name)
+		st.typ.Fields = append(st.typ.Fields, &typechecker.Field{Name: f.name, Type: ft})
+	}
+	if !h.checker.DeclareType(st.typ.Name, st.typ) {
+		delete(h.structs, t)
+		return nil, nil, fmt.Errorf("the type %s is already declared", st.typ.Name)
+	}
+	h.in.DeclareStruct(st.def)
+	return st, st.typ, nil
+}
+
+// sortedMapKeys returns the keys of the map m in increasing order.
+func sortedMapKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Bool:
+			return !a.Bool() && b.Bool()
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+	return keys
+}
@@ -0,0 +1,298 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+)
+
+// builtins is filled in by init, since println refers back to the
+// evaluator through the show methods of Display values.
+var builtins map[string]*Builtin
+
+// builtinNames lists the names of the builtins in the order the VM
+// numbers them.
+var builtinNames []string
+
+func init() {
+	builtins = map[string]*Builtin{
+		"println": {Name: "println", Fn: builtinPrintln},
+		"print":   {Name: "print", Fn: builtinPrint},
+		"len":     {Name: "len", Fn: builtinLen},
+		"append":  {Name: "append", Fn: builtinAppend},
+		"delete":  {Name: "delete", Fn: builtinDelete},
+		"panic":   {Name: "panic", Fn: builtinPanic},
+
+		"parse_int":   {Name: "parse_int", Fn: builtinParseInt},
+		"parse_float": {Name: "parse_float", Fn: builtinParseFloat},
+		"read_file":   {Name: "read_file", Fn: builtinReadFile},
+	}
+
+	for name := range builtins {
+		builtinNames = append(builtinNames, name)
+	}
+	sort.Strings(builtinNames)
+}
+
+func builtinPrintln(in *Interpreter, args ...Object) Object {
+	s, err := in.joinArgs(args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(in.out, s)
+	return NULL
+}
+
+func builtinPrint(in *Interpreter, args ...Object) Object {
+	s, err := in.joinArgs(args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(in.out, s)
+	return NULL
+}
+
+func (in *Interpreter) joinArgs(args []Object) (string, Object) {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		s, err := in.Display(arg)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// Display returns the printed form of obj: the result of its show
+// method if its type implements a trait named Display, and its
+// Inspect form otherwise, in which the elements of arrays, maps,
+// structs and enum values are displayed the same way. The error is the
+// runtime error show raised.
+func (in *Interpreter) Display(obj Object) (string, Object) {
+	if s, ok := obj.(*String); ok {
+		return s.Value, nil
+	}
+	return in.displayNested(obj, nil)
+}
+
+// displayNested returns the printed form of obj as an element of
+// another value, in which strings are quoted. A value found inside
+// itself, as one of active, is printed as <cycle>.
+func (in *Interpreter) displayNested(obj Object, active map[Object]bool) (string, Object) {
+	switch obj.(type) {
+	case *Array, *Map, *Struct, *EnumValue:
+		if active[obj] {
+			return "<cycle>", nil
+		}
+		if active == nil {
+			active = map[Object]bool{}
+		}
+		active[obj] = true
+		defer delete(active, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		s, err := in.displayList(obj.Elements, active)
+		return "[" + s + "]", err
+	case *Map:
+		pairs := make([]string, 0, obj.Len())
+		for _, pair := range obj.Pairs() {
+			k, err := in.displayNested(pair.Key, active)
+			if err != nil {
+				return "", err
+			}
+			v, err := in.displayNested(pair.Value, active)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, k+": "+v)
+		}
+		return "{" + strings.Join(pairs, ", ") + "}", nil
+	case *Struct:
+		if show, ok := obj.Def.Methods["show"]; ok && obj.Def.Traits["Display"] {
+			result := in.applyFunction(show, []Object{obj}, lexer.Position{})
+			if unwinds(result) {
+				return "", result
+			}
+			if str, ok := result.(*String); ok {
+				return str.Value, nil
+			}
+			return result.Inspect(), nil
+		}
+		fields := make([]string, len(obj.Def.Fields))
+		for i, name := range obj.Def.Fields {
+			v, err := in.displayNested(obj.Fields[name], active)
+			if err != nil {
+				return "", err
+			}
+			fields[i] = name + ": " + v
+		}
+		return obj.Def.Name + "{" + strings.Join(fields, ", ") + "}", nil
+	case *EnumValue:
+		if len(obj.Fields) == 0 {
+			return obj.Variant.Name, nil
+		}
+		s, err := in.displayList(obj.Fields, active)
+		return obj.Variant.Name + "(" + s + ")", err
+	}
+	return repr(obj, nil), nil
+}
+
+// displayList returns the printed forms of objs, separated by commas.
+func (in *Interpreter) displayList(objs []Object, active map[Object]bool) (string, Object) {
+	parts := make([]string, len(objs))
+	for i, obj := range objs {
+		s, err := in.displayNested(obj, active)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+func builtinLen(in *Interpreter, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to len: want=1, got=%d", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		return &Integer{Value: int64(len(arg.Elements))}
+	case *String:
+		return &Integer{Value: int64(len(arg.Value))}
+	case *Map:
+		return &Integer{Value: int64(arg.Len())}
+	}
+
+	return newError("argument to len not supported, got %s", args[0].Type())
+}
+
+// builtinAppend returns a new array holding the elements of its first
+// argument followed by the remaining arguments.
+func builtinAppend(in *Interpreter, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments to append: want at least 1, got=0")
+	}
+
+	array, ok := args[0].(*Array)
+	if !ok {
+		return newError("first argument to append must be ARRAY, got %s", args[0].Type())
+	}
+
+	n := len(array.Elements) + len(args) - 1
+	if err := in.Charge(3*wordSize + objectSize*int64(n)); err != nil {
+		return err
+	}
+	elements := make([]Object, 0, n)
+	elements = append(elements, array.Elements...)
+	elements = append(elements, args[1:]...)
+	return &Array{Elements: elements}
+}
+
+// builtinDelete removes a key from a map. Deleting a missing key does
+// nothing.
+func builtinDelete(in *Interpreter, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to delete: want=2, got=%d", len(args))
+	}
+
+	m, ok := args[0].(*Map)
+	if !ok {
+		return newError("first argument to delete must be MAP, got %s", args[0].Type())
+	}
+
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as map key: %s", args[1].Type())
+	}
+
+	m.Delete(key)
+	return NULL
+}
+
+// stringArg returns the single string argument of the builtin name.
+func stringArg(name string, args []Object) (string, *RuntimeError) {
+	if len(args) != 1 {
+		return "", newError("wrong number of arguments to %s: want=1, got=%d", name, len(args))
+	}
+	s, ok := args[0].(*String)
+	if !ok {
+		return "", newError("argument to %s must be STRING, got %s", name, args[0].Type())
+	}
+	return s.Value, nil
+}
+
+// builtinPanic raises a runtime error with the given message, which
+// unwinds like any other unless a try expression catches it.
+func builtinPanic(in *Interpreter, args ...Object) Object {
+	msg, err := stringArg("panic", args)
+	if err != nil {
+		return err
+	}
+	return &RuntimeError{Message: msg, Panic: true}
+}
+
+// builtinParseInt parses a base 10 integer, returning Err with a
+// message if the string is not one.
+func builtinParseInt(in *Interpreter, args ...Object) Object {
+	s, err := stringArg("parse_int", args)
+	if err != nil {
+		return err
+	}
+
+	n, perr := strconv.ParseInt(s, 10, 64)
+	if perr != nil {
+		return NewErr(&String{Value: parseError("int", s, perr)})
+	}
+	return NewOk(&Integer{Value: n})
+}
+
+func builtinParseFloat(in *Interpreter, args ...Object) Object {
+	s, err := stringArg("parse_float", args)
+	if err != nil {
+		return err
+	}
+
+	f, perr := strconv.ParseFloat(s, 64)
+	if perr != nil {
+		return NewErr(&String{Value: parseError("float", s, perr)})
+	}
+	return NewOk(&Float{Value: f})
+}
+
+func parseError(typ, s string, err error) string {
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Sprintf("%s out of range: %q", typ, s)
+	}
+	return fmt.Sprintf("invalid %s: %q", typ, s)
+}
+
+// builtinReadFile returns the contents of a file, or Err with the
+// reason it could not be read.
+func builtinReadFile(in *Interpreter, args ...Object) Object {
+	path, err := stringArg("read_file", args)
+	if err != nil {
+		return err
+	}
+
+	f, ferr := in.openFile(path)
+	if ferr != nil {
+		return NewErr(&String{Value: ferr.Error()})
+	}
+	defer f.Close()
+	data, ferr := in.ReadAll(f)
+	if rerr, ok := ferr.(*RuntimeError); ok {
+		return rerr
+	}
+	if ferr != nil {
+		return NewErr(&String{Value: ferr.Error()})
+	}
+	return NewOk(&String{Value: string(data)})
+}
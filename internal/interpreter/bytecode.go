@@ -0,0 +1,515 @@
+package interpreter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+)
+
+// The binary format of Bytecode is
+//
+//	magic    "GBC\x00"
+//	version  uint16, big-endian
+//	program  the fields of Bytecode, below
+//	checksum uint32, big-endian: the CRC-32 (IEEE) of everything before it
+//
+// The program is made of unsigned varints, signed varints for integer
+// constants, and strings written as their length followed by their
+// bytes:
+//
+//	source name
+//	globals    count, then each name
+//	structs    count, then for each: name, fields, traits, and methods
+//	           as a name and the index of their function constant
+//	enums      count, then for each: name, and its variants as a name
+//	           and an arity
+//	constants  count, then each constant as a tag and its value
+//	main       the top-level function
+//
+// A function is its name, number of locals and parameters, upvalues,
+// instructions and line table, which maps instruction offsets to the
+// line and column of the source they were compiled from.
+const (
+	BytecodeMagic   = "GBC\x00"
+	BytecodeVersion = 3
+)
+
+// ErrNotBytecode is returned when unmarshaling data that does not start
+// with BytecodeMagic.
+var ErrNotBytecode = errors.New("not a gust bytecode file")
+
+// IsBytecode reports whether data starts with BytecodeMagic.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(BytecodeMagic))
+}
+
+// tags of the constants in the binary format
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagBoolean
+	tagNull
+	tagFunction
+	tagArray
+	tagJumpTable
+)
+
+// MarshalBinary encodes bc in the format described above.
+func (bc *Bytecode) MarshalBinary() ([]byte, error) {
+	e := &encoder{buf: []byte(BytecodeMagic)}
+	e.buf = binary.BigEndian.AppendUint16(e.buf, BytecodeVersion)
+
+	e.str(bc.Source)
+	e.strs(bc.Globals)
+
+	functions := map[*CompiledFunction]int{}
+	for i, c := range bc.Constants {
+		if fn, ok := c.(*CompiledFunction); ok {
+			functions[fn] = i
+		}
+	}
+	e.uint(len(bc.Structs))
+	for _, def := range bc.Structs {
+		e.str(def.Name)
+		e.strs(def.Fields)
+		e.strs(sortedKeys(def.Traits))
+		e.uint(len(def.Methods))
+		for _, name := range sortedKeys(def.Methods) {
+			cl, ok := def.Methods[name].(*Closure)
+			if !ok {
+				return nil, fmt.Errorf("method %s.%s is not compiled", def.Name, name)
+			}
+			i, ok := functions[cl.Fn]
+			if !ok {
+				return nil, fmt.Errorf("method %s.%s is not a constant", def.Name, name)
+			}
+			e.str(name)
+			e.uint(i)
+		}
+	}
+
+	e.uint(len(bc.Enums))
+	for _, def := range bc.Enums {
+		e.str(def.Name)
+		e.uint(len(def.Variants))
+		for _, v := range def.Variants {
+			e.str(v.Name)
+			e.uint(v.Arity)
+		}
+	}
+
+	e.uint(len(bc.Constants))
+	for _, c := range bc.Constants {
+		e.constant(c)
+	}
+	e.function(bc.Main)
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return binary.BigEndian.AppendUint32(e.buf, crc32.ChecksumIEEE(e.buf)), nil
+}
+
+// UnmarshalBinary decodes bytecode written by MarshalBinary, checking
+// its magic header, version and checksum.
+func (bc *Bytecode) UnmarshalBinary(data []byte) error {
+	if !IsBytecode(data) {
+		return ErrNotBytecode
+	}
+	if len(data) < len(BytecodeMagic)+2+4 {
+		return errors.New("truncated bytecode")
+	}
+	if v := binary.BigEndian.Uint16(data[len(BytecodeMagic):]); v != BytecodeVersion {
+		return fmt.Errorf("unsupported bytecode version %d, want %d", v, BytecodeVersion)
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return errors.New("bytecode checksum mismatch")
+	}
+
+	d := &decoder{data: body, off: len(BytecodeMagic) + 2, bc: bc}
+	out := &Bytecode{}
+	out.Source = d.str()
+	out.Globals = d.strs()
+
+	type method struct {
+		def   *StructDef
+		name  string
+		index int
+	}
+	var methods []method
+	for n := d.count(); n > 0; n-- {
+		def := &StructDef{Name: d.str(), Fields: d.strs(), Methods: map[string]Object{}, Traits: map[string]bool{}}
+		for _, trait := range d.strs() {
+			def.Traits[trait] = true
+		}
+		for m := d.count(); m > 0; m-- {
+			methods = append(methods, method{def, d.str(), d.uint()})
+		}
+		out.Structs = append(out.Structs, def)
+	}
+
+	for n := d.count(); n > 0; n-- {
+		def := &EnumDef{Name: d.str()}
+		for m := d.count(); m > 0; m-- {
+			def.variant(d.str(), d.uint())
+		}
+		if builtin, ok := builtinEnums[def.Name]; ok {
+			// programs cannot declare enums of these names, and the
+			// interpreter knows the variants of these by identity
+			if !sameVariants(def, builtin) {
+				d.fail("enum %s does not have the variants of the builtin one", def.Name)
+			}
+			def = builtin
+		}
+		out.Enums = append(out.Enums, def)
+	}
+
+	for n := d.count(); n > 0; n-- {
+		out.Constants = append(out.Constants, d.constant())
+	}
+	out.Main = d.function()
+	if d.err == nil && d.off != len(d.data) {
+		d.fail("%d bytes of trailing data", len(d.data)-d.off)
+	}
+
+	for _, m := range methods {
+		if d.err != nil {
+			break
+		}
+		if m.index >= len(out.Constants) {
+			d.fail("method %s.%s refers to constant %d of %d", m.def.Name, m.name, m.index, len(out.Constants))
+			break
+		}
+		fn, ok := out.Constants[m.index].(*CompiledFunction)
+		if !ok {
+			d.fail("method %s.%s is not a function", m.def.Name, m.name)
+			break
+		}
+		m.def.Methods[m.name] = &Closure{Fn: fn}
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	*bc = *out
+	return nil
+}
+
+// builtinEnums are the enums every program has.
+var builtinEnums = map[string]*EnumDef{optionDef.Name: optionDef, resultDef.Name: resultDef}
+
+// sameVariants reports whether the enums a and b have variants of the
+// same names and arities.
+func sameVariants(a, b *EnumDef) bool {
+	return slices.EqualFunc(a.Variants, b.Variants, func(v, w *VariantDef) bool {
+		return v.Name == w.Name && v.Arity == w.Arity
+	})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type encoder struct {
+	buf []byte
+	err error
+}
+
+func (e *encoder) uint(n int) { e.buf = binary.AppendUvarint(e.buf, uint64(n)) }
+
+func (e *encoder) str(s string) {
+	e.uint(len(s))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) strs(ss []string) {
+	e.uint(len(ss))
+	for _, s := range ss {
+		e.str(s)
+	}
+}
+
+func (e *encoder) constant(obj Object) {
+	switch obj := obj.(type) {
+	case *Integer:
+		e.buf = append(e.buf, tagInteger)
+		e.buf = binary.AppendVarint(e.buf, obj.Value)
+	case *Float:
+		e.buf = append(e.buf, tagFloat)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(obj.Value))
+	case *String:
+		e.buf = append(e.buf, tagString)
+		e.str(obj.Value)
+	case *Boolean:
+		e.buf = append(e.buf, tagBoolean)
+		if obj.Value {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+	case *Null:
+		e.buf = append(e.buf, tagNull)
+	case *CompiledFunction:
+		e.buf = append(e.buf, tagFunction)
+		e.function(obj)
+	case *Array:
+		e.buf = append(e.buf, tagArray)
+		e.uint(len(obj.Elements))
+		for _, el := range obj.Elements {
+			e.constant(el)
+		}
+	case *jumpTable:
+		e.buf = append(e.buf, tagJumpTable)
+		e.uint(obj.Default)
+		keys := make([]HashKey, 0, len(obj.Cases))
+		for k := range obj.Cases {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+		e.uint(len(keys))
+		for _, k := range keys {
+			e.str(string(k.Type))
+			e.buf = binary.AppendUvarint(e.buf, k.Value)
+			e.str(k.Str)
+			e.uint(obj.Cases[k])
+		}
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot encode constant %s", obj.Inspect())
+		}
+	}
+}
+
+func (e *encoder) function(fn *CompiledFunction) {
+	e.str(fn.Name)
+	e.uint(fn.NumLocals)
+	e.uint(fn.NumParams)
+	e.uint(len(fn.Upvalues))
+	for _, u := range fn.Upvalues {
+		if u.Local {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+		e.uint(u.Index)
+	}
+	e.uint(len(fn.Instructions))
+	e.buf = append(e.buf, fn.Instructions...)
+	e.uint(len(fn.Lines))
+	for _, line := range fn.Lines {
+		e.uint(line.Offset)
+		e.uint(line.Pos.Line)
+		e.uint(line.Pos.Column)
+	}
+}
+
+// decoder reads the program of a bytecode file. After the first error
+// every read returns a zero value, and the error is reported at the end.
+type decoder struct {
+	data []byte
+	off  int
+	err  error
+	// bc is the bytecode the decoded functions belong to.
+	bc *Bytecode
+}
+
+func (d *decoder) fail(format string, a ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("invalid bytecode at offset %d: %s", d.off, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.off >= len(d.data) {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	d.off++
+	return d.data[d.off-1]
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data)-d.off {
+		d.fail("unexpected end of data")
+		return nil
+	}
+	d.off += n
+	return d.data[d.off-n : d.off]
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, read := binary.Uvarint(d.data[d.off:])
+	if read <= 0 {
+		d.fail("bad varint")
+		return 0
+	}
+	d.off += read
+	return n
+}
+
+func (d *decoder) uint() int {
+	n := d.uint64()
+	if n > math.MaxInt32 {
+		d.fail("number %d out of range", n)
+		return 0
+	}
+	return int(n)
+}
+
+// count reads the length of a sequence, each element of which takes at
+// least a byte, so that corrupt data cannot make it allocate much.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > len(d.data)-d.off {
+		d.fail("count %d exceeds the data left", n)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) str() string {
+	return string(d.bytes(d.count()))
+}
+
+func (d *decoder) strs() []string {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+	ss := make([]string, n)
+	for i := range ss {
+		ss[i] = d.str()
+	}
+	return ss
+}
+
+func (d *decoder) constant() Object {
+	switch tag := d.byte(); tag {
+	case tagInteger:
+		n, read := binary.Varint(d.data[d.off:])
+		if read <= 0 {
+			d.fail("bad varint")
+			return NULL
+		}
+		d.off += read
+		return &Integer{Value: n}
+	case tagFloat:
+		b := d.bytes(8)
+		if b == nil {
+			return NULL
+		}
+		return &Float{Value: math.Float64frombits(binary.BigEndian.Uint64(b))}
+	case tagString:
+		return &String{Value: d.str()}
+	case tagBoolean:
+		return nativeBoolToBooleanObject(d.byte() != 0)
+	case tagNull:
+		return NULL
+	case tagFunction:
+		return d.function()
+	case tagArray:
+		arr := &Array{}
+		for n := d.count(); n > 0; n-- {
+			arr.Elements = append(arr.Elements, d.constant())
+		}
+		return arr
+	case tagJumpTable:
+		table := &jumpTable{Default: d.uint(), Cases: map[HashKey]int{}}
+		for n := d.count(); n > 0; n-- {
+			key := HashKey{Type: ObjectType(d.str()), Value: d.uint64(), Str: d.str()}
+			table.Cases[key] = d.uint()
+		}
+		return table
+	default:
+		d.fail("unknown constant tag %d", tag)
+		return NULL
+	}
+}
+
+func (d *decoder) function() *CompiledFunction {
+	fn := &CompiledFunction{Name: d.str(), NumLocals: d.uint(), NumParams: d.uint(), bc: d.bc}
+	for n := d.count(); n > 0; n-- {
+		fn.Upvalues = append(fn.Upvalues, UpvalueRef{Local: d.byte() != 0, Index: d.uint()})
+	}
+	fn.Instructions = Instructions(bytes.Clone(d.bytes(d.count())))
+	for n := d.count(); n > 0; n-- {
+		fn.Lines = append(fn.Lines, LineInfo{Offset: d.uint(), Pos: lexer.Position{Line: d.uint(), Column: d.uint()}})
+	}
+	return fn
+}
+
+// exeMagic ends an executable with a bytecode file embedded in it. It
+// follows the bytecode file and its length, a big-endian uint64.
+const exeMagic = "GBCEXE\x00\x00"
+
+// EmbedBytecode returns a copy of the executable exe with the bytecode
+// file data appended to it, replacing the one exe embeds, if any. The
+// gust binary runs the bytecode embedded in it instead of its commands.
+func EmbedBytecode(exe, data []byte) []byte {
+	if n, ok := embeddedLength(exe[max(len(exe)-16, 0):], int64(len(exe))); ok {
+		exe = exe[:int64(len(exe))-16-n]
+	}
+	out := make([]byte, 0, len(exe)+len(data)+16)
+	out = append(out, exe...)
+	out = append(out, data...)
+	out = binary.BigEndian.AppendUint64(out, uint64(len(data)))
+	return append(out, exeMagic...)
+}
+
+// EmbeddedBytecode returns the bytecode file embedded by EmbedBytecode
+// in the executable r, of the given size, or nil if it embeds none.
+func EmbeddedBytecode(r io.ReaderAt, size int64) ([]byte, error) {
+	if size < 16 {
+		return nil, nil
+	}
+	trailer := make([]byte, 16)
+	if _, err := r.ReadAt(trailer, size-16); err != nil {
+		return nil, err
+	}
+	n, ok := embeddedLength(trailer, size)
+	if !ok {
+		return nil, nil
+	}
+	data := make([]byte, n)
+	if _, err := r.ReadAt(data, size-16-n); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// embeddedLength returns the length of the bytecode embedded in an
+// executable of the given size, given the last 16 bytes of it.
+func embeddedLength(trailer []byte, size int64) (int64, bool) {
+	if len(trailer) != 16 || string(trailer[8:]) != exeMagic {
+		return 0, false
+	}
+	n := binary.BigEndian.Uint64(trailer)
+	if n > uint64(size-16) {
+		return 0, false
+	}
+	return int64(n), true
+}
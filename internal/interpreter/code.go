@@ -0,0 +1,311 @@
+package interpreter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Instructions is the bytecode of a compiled function: a sequence of
+// opcodes, each followed by its operands in big-endian order. Jumps
+// take four-byte offsets, so that functions can be of any size.
+type Instructions []byte
+
+// Opcode is the first byte of an instruction.
+type Opcode byte
+
+const (
+	// OpConstant pushes the constant with the given index.
+	OpConstant Opcode = iota
+	OpNull
+	OpTrue
+	OpFalse
+	OpPop
+
+	// binary operators pop their right operand, then their left
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpConcat
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpGreater
+
+	OpMinus
+	OpBang
+	// OpBool replaces the value on top of the stack with whether it is
+	// truthy, for the right operand of && and ||.
+	OpBool
+
+	OpJump
+	// OpJumpNotTruthy pops a value and jumps if it is false or null.
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetUpvalue
+	OpSetUpvalue
+	OpGetBuiltin
+	// OpCloseUpvalues closes the upvalues of the locals from the given
+	// slot up, so that closures created in one loop iteration keep the
+	// variables of that iteration.
+	OpCloseUpvalues
+	// OpClosure pushes a closure of the compiled function constant with
+	// the given index, capturing the upvalues it lists.
+	OpClosure
+	// OpError raises a runtime error whose message is the string
+	// constant with the given index.
+	OpError
+
+	OpArray
+	OpMap
+	// OpStruct pops the values of the fields named by an array constant
+	// and pushes a struct of the given type.
+	OpStruct
+	// OpVariant pushes a variant of an enum: a value if it has no
+	// payload, and a constructor otherwise.
+	OpVariant
+
+	OpIndex
+	// OpSetIndex pops an index, a container and a value and stores the
+	// value in the container.
+	OpSetIndex
+	// OpSlice pops the bounds its flags say are present, and the value
+	// to slice.
+	OpSlice
+	OpGetField
+	// OpSetField pops a struct and a value and stores the value in the
+	// named field.
+	OpSetField
+	// OpCommaOk pops a key and a map. If the key is present it pushes
+	// its value and true and jumps; otherwise it goes on to the
+	// instructions pushing the zero value and false.
+	OpCommaOk
+
+	OpCall
+	// OpCallable raises the error of calling the value on top of the
+	// stack if it is not a function, for defer statements, which check
+	// that before evaluating the arguments.
+	OpCallable
+	// OpTailCall is OpCall for a call in tail position. It replaces the
+	// current frame when the function has no deferred calls, and is
+	// followed by an OpReturn for when it does.
+	OpTailCall
+	OpReturn
+	OpDefer
+	// OpUnwrap implements `?`: it unwraps a Some or an Ok, and returns a
+	// None or an Err from the function.
+	OpUnwrap
+
+	// OpTry starts the body of a try expression whose catch block is at
+	// the given offset; OpEndTry ends it.
+	OpTry
+	OpEndTry
+
+	// OpIter replaces the value on top of the stack with an iterator
+	// over a snapshot of it. OpNext pushes the next key, value or both,
+	// or pops the iterator and jumps when it is done.
+	OpIter
+	OpNext
+
+	// OpSwitch pops a value and jumps to its case in a jump table
+	// constant. OpVariantField replaces an enum value with one of its
+	// fields. OpNoMatch raises the error of a match no arm matched.
+	OpSwitch
+	OpVariantField
+	OpNoMatch
+
+	// Superinstructions for the operands of binary operators that are
+	// most often locals and constants, as in `i < n` and `n - 1`. The
+	// first operand is the opcode of the operator.
+	OpBinaryLocalConst
+	OpBinaryLocals
+)
+
+// Definition describes an opcode: its name and the width in bytes of
+// each of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpNull:     {"OpNull", nil},
+	OpTrue:     {"OpTrue", nil},
+	OpFalse:    {"OpFalse", nil},
+	OpPop:      {"OpPop", nil},
+
+	OpAdd:      {"OpAdd", nil},
+	OpSub:      {"OpSub", nil},
+	OpMul:      {"OpMul", nil},
+	OpDiv:      {"OpDiv", nil},
+	OpMod:      {"OpMod", nil},
+	OpConcat:   {"OpConcat", nil},
+	OpEqual:    {"OpEqual", nil},
+	OpNotEqual: {"OpNotEqual", nil},
+	OpLess:     {"OpLess", nil},
+	OpGreater:  {"OpGreater", nil},
+
+	OpMinus: {"OpMinus", nil},
+	OpBang:  {"OpBang", nil},
+	OpBool:  {"OpBool", nil},
+
+	OpJump:          {"OpJump", []int{4}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{4}},
+
+	OpGetGlobal:     {"OpGetGlobal", []int{2}},
+	OpSetGlobal:     {"OpSetGlobal", []int{2}},
+	OpGetLocal:      {"OpGetLocal", []int{2}},
+	OpSetLocal:      {"OpSetLocal", []int{2}},
+	OpGetUpvalue:    {"OpGetUpvalue", []int{1}},
+	OpSetUpvalue:    {"OpSetUpvalue", []int{1}},
+	OpGetBuiltin:    {"OpGetBuiltin", []int{1}},
+	OpCloseUpvalues: {"OpCloseUpvalues", []int{2}},
+	OpClosure:       {"OpClosure", []int{2}},
+	OpError:         {"OpError", []int{2}},
+
+	OpArray:   {"OpArray", []int{2}},
+	OpMap:     {"OpMap", []int{2}},
+	OpStruct:  {"OpStruct", []int{2, 2}},
+	OpVariant: {"OpVariant", []int{2, 1}},
+
+	OpIndex:    {"OpIndex", nil},
+	OpSetIndex: {"OpSetIndex", nil},
+	OpSlice:    {"OpSlice", []int{1}},
+	OpGetField: {"OpGetField", []int{2}},
+	OpSetField: {"OpSetField", []int{2}},
+	OpCommaOk:  {"OpCommaOk", []int{4}},
+
+	OpCall:     {"OpCall", []int{1}},
+	OpCallable: {"OpCallable", nil},
+	OpTailCall: {"OpTailCall", []int{1}},
+	OpReturn:   {"OpReturn", nil},
+	OpDefer:    {"OpDefer", []int{1}},
+	OpUnwrap:   {"OpUnwrap", nil},
+
+	OpTry:    {"OpTry", []int{4}},
+	OpEndTry: {"OpEndTry", nil},
+
+	OpIter: {"OpIter", nil},
+	OpNext: {"OpNext", []int{1, 4}},
+
+	OpSwitch:       {"OpSwitch", []int{2}},
+	OpVariantField: {"OpVariantField", []int{1}},
+	OpNoMatch:      {"OpNoMatch", nil},
+
+	OpBinaryLocalConst: {"OpBinaryLocalConst", []int{1, 2, 2}},
+	OpBinaryLocals:     {"OpBinaryLocals", []int{1, 2, 2}},
+}
+
+// Lookup returns the definition of op.
+func Lookup(op Opcode) (*Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction. Operands that do not fit their width
+// are truncated; the compiler checks them first.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	ins := make([]byte, length)
+	ins[0] = byte(op)
+	offset := 1
+	for i, o := range operands {
+		switch def.OperandWidths[i] {
+		case 1:
+			ins[offset] = byte(o)
+		case 2:
+			binary.BigEndian.PutUint16(ins[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(ins[offset:], uint32(o))
+		}
+		offset += def.OperandWidths[i]
+	}
+	return ins
+}
+
+// ReadOperands decodes the operands of an instruction of def from ins,
+// which starts after the opcode, and returns them with the number of
+// bytes they take.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, w := range def.OperandWidths {
+		switch w {
+		case 1:
+			operands[i] = int(ins[offset])
+		case 2:
+			operands[i] = int(readUint16(ins[offset:]))
+		case 4:
+			operands[i] = int(readUint32(ins[offset:]))
+		}
+		offset += w
+	}
+	return operands, offset
+}
+
+func readUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func readUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
+// String disassembles the instructions, one per line with its offset.
+//
+//	0000 OpGetLocal 0
+//	0003 OpConstant 1
+//	0006 OpAdd
+func (ins Instructions) String() string {
+	var out strings.Builder
+	for i := 0; i < len(ins); {
+		def, err := Lookup(Opcode(ins[i]))
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s", i, def.Name)
+		for _, o := range operands {
+			fmt.Fprintf(&out, " %d", o)
+		}
+		out.WriteString("\n")
+		i += 1 + read
+	}
+	return out.String()
+}
+
+// binaryOperators are the source operators of the binary opcodes, for
+// the operations and errors they share with the tree-walking engine.
+var binaryOperators = map[Opcode]string{
+	OpAdd:      "+",
+	OpSub:      "-",
+	OpMul:      "*",
+	OpDiv:      "/",
+	OpMod:      "%",
+	OpConcat:   "..",
+	OpEqual:    "==",
+	OpNotEqual: "!=",
+	OpLess:     "<",
+	OpGreater:  ">",
+}
@@ -0,0 +1,1004 @@
+package interpreter
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+// Bytecode is a program compiled for the VM: its top level as a
+// function, the constants its instructions load, and the names of the
+// globals and the structs and enums they refer to by index. Source is
+// the name of the file it was compiled from, if the interpreter had
+// one.
+type Bytecode struct {
+	Source    string
+	Main      *CompiledFunction
+	Constants []Object
+	Globals   []string
+	Structs   []*StructDef
+	Enums     []*EnumDef
+}
+
+// Compile compiles a type-checked program to bytecode for the VM. The
+// globals, structs and enums declared by programs the interpreter ran
+// before are visible to it, as they are to Run.
+func (in *Interpreter) Compile(program *parser.Program) (*Bytecode, error) {
+	c := &compiler{
+		in:      in,
+		bc:      &Bytecode{Source: in.file},
+		consts:  map[HashKey]int{},
+		structs: map[*StructDef]int{},
+		enums:   map[*EnumDef]int{},
+	}
+	// in order, so that compiling a program always gives the same
+	// bytecode
+	names := make([]string, 0, len(in.globals.store))
+	for name := range in.globals.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		in.globalSlot(name)
+	}
+	c.enterFunction("main")
+	c.declareTypes(program.Statements)
+	for _, name := range topLevelNames(program.Statements) {
+		in.globalSlot(name)
+	}
+	c.compileBlock(program.Statements)
+	c.emit(OpReturn)
+	c.bc.Main = c.leaveFunction()
+	c.bc.Globals = append([]string(nil), in.globalNames...)
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.bc, nil
+}
+
+// compiler translates a program to bytecode. Names are resolved when
+// they are compiled, to locals of the function being compiled, upvalues
+// captured from the functions enclosing it, globals and builtins, in
+// that order. Declarations at the top level of the program are globals;
+// every other declaration is a local.
+type compiler struct {
+	in      *Interpreter
+	bc      *Bytecode
+	consts  map[HashKey]int
+	structs map[*StructDef]int
+	enums   map[*EnumDef]int
+
+	scope *funcScope
+	// pos is the source position of the instructions being emitted.
+	pos lexer.Position
+	err error
+}
+
+// funcScope is a function being compiled.
+type funcScope struct {
+	outer     *funcScope
+	name      string
+	code      Instructions
+	lines     []LineInfo
+	block     *blockScope
+	numLocals int
+	numParams int
+	captured  map[int]bool
+	upvalues  []UpvalueRef
+	// trying counts the try expressions whose bodies are being compiled.
+	trying int
+
+	// the last two instructions emitted, and the offset of the last
+	// instruction a jump lands on, for fusing superinstructions
+	prev, last emitted
+	target     int
+}
+
+type emitted struct {
+	op     Opcode
+	offset int
+}
+
+// opNone marks an instruction slot of funcScope that holds nothing.
+const opNone Opcode = 255
+
+// blockScope maps the names declared in a block to their local slots.
+type blockScope struct {
+	names map[string]int
+	outer *blockScope
+}
+
+type symbolScope int
+
+const (
+	localScope symbolScope = iota
+	upvalueScope
+	globalScope
+	builtinScope
+)
+
+type symbol struct {
+	scope symbolScope
+	index int
+}
+
+func (c *compiler) errorf(format string, a ...any) {
+	if c.err == nil {
+		c.err = fmt.Errorf("%s: %s", c.pos, fmt.Sprintf(format, a...))
+	}
+}
+
+// at sets the position of the instructions emitted next to pos, and
+// returns a function restoring the previous one.
+func (c *compiler) at(pos lexer.Position) func() {
+	old := c.pos
+	c.pos = pos
+	return func() { c.pos = old }
+}
+
+func (c *compiler) enterFunction(name string) {
+	c.scope = &funcScope{
+		outer:    c.scope,
+		name:     name,
+		block:    &blockScope{names: map[string]int{}},
+		captured: map[int]bool{},
+		prev:     emitted{op: opNone},
+		last:     emitted{op: opNone},
+	}
+}
+
+func (c *compiler) leaveFunction() *CompiledFunction {
+	s := c.scope
+	c.scope = s.outer
+
+	// one line entry for each run of instructions at the same position
+	var lines []LineInfo
+	for _, line := range s.lines {
+		if len(lines) == 0 || lines[len(lines)-1].Pos != line.Pos {
+			lines = append(lines, line)
+		}
+	}
+	return &CompiledFunction{
+		Name:         s.name,
+		Instructions: s.code,
+		NumLocals:    s.numLocals,
+		NumParams:    s.numParams,
+		Upvalues:     s.upvalues,
+		Lines:        lines,
+		bc:           c.bc,
+	}
+}
+
+func (c *compiler) enterBlock() {
+	c.scope.block = &blockScope{names: map[string]int{}, outer: c.scope.block}
+}
+
+func (c *compiler) leaveBlock() {
+	c.scope.block = c.scope.block.outer
+}
+
+// topLevel reports whether declarations being compiled are globals.
+func (c *compiler) topLevel() bool {
+	return c.scope.outer == nil && c.scope.block.outer == nil
+}
+
+// declare declares name in the current block. Declaring a name twice
+// in the same block reuses its variable, as the tree-walking engine
+// does.
+func (c *compiler) declare(name string) symbol {
+	if c.topLevel() {
+		return symbol{globalScope, c.in.globalSlot(name)}
+	}
+	s := c.scope
+	if slot, ok := s.block.names[name]; ok {
+		return symbol{localScope, slot}
+	}
+	slot := s.numLocals
+	s.numLocals++
+	s.block.names[name] = slot
+	return symbol{localScope, slot}
+}
+
+// local allocates a local slot no name refers to.
+func (c *compiler) local() int {
+	c.scope.numLocals++
+	return c.scope.numLocals - 1
+}
+
+func (c *compiler) resolve(name string) (symbol, bool) {
+	if sym, ok := c.resolveIn(c.scope, name); ok {
+		return sym, true
+	}
+	if slot, ok := c.in.globalSlots[name]; ok {
+		return symbol{globalScope, slot}, true
+	}
+	if i := sort.SearchStrings(builtinNames, name); i < len(builtinNames) && builtinNames[i] == name {
+		return symbol{builtinScope, i}, true
+	}
+	return symbol{}, false
+}
+
+// resolveIn resolves name to a local of s or of a function enclosing
+// it, which s then captures as an upvalue.
+func (c *compiler) resolveIn(s *funcScope, name string) (symbol, bool) {
+	for b := s.block; b != nil; b = b.outer {
+		if slot, ok := b.names[name]; ok {
+			return symbol{localScope, slot}, true
+		}
+	}
+	if s.outer == nil {
+		return symbol{}, false
+	}
+	sym, ok := c.resolveIn(s.outer, name)
+	if !ok {
+		return symbol{}, false
+	}
+	if sym.scope == localScope {
+		s.outer.captured[sym.index] = true
+	}
+	return symbol{upvalueScope, s.addUpvalue(UpvalueRef{Local: sym.scope == localScope, Index: sym.index})}, true
+}
+
+func (s *funcScope) addUpvalue(ref UpvalueRef) int {
+	for i, u := range s.upvalues {
+		if u == ref {
+			return i
+		}
+	}
+	s.upvalues = append(s.upvalues, ref)
+	return len(s.upvalues) - 1
+}
+
+func (c *compiler) load(sym symbol) {
+	switch sym.scope {
+	case localScope:
+		c.emit(OpGetLocal, sym.index)
+	case upvalueScope:
+		c.emit(OpGetUpvalue, sym.index)
+	case globalScope:
+		c.emit(OpGetGlobal, sym.index)
+	case builtinScope:
+		c.emit(OpGetBuiltin, sym.index)
+	}
+}
+
+func (c *compiler) store(sym symbol) {
+	switch sym.scope {
+	case localScope:
+		c.emit(OpSetLocal, sym.index)
+	case upvalueScope:
+		c.emit(OpSetUpvalue, sym.index)
+	case globalScope:
+		c.emit(OpSetGlobal, sym.index)
+	}
+}
+
+// emit appends an instruction to the function being compiled and
+// returns its offset.
+func (c *compiler) emit(op Opcode, operands ...int) int {
+	def := definitions[op]
+	for i, w := range def.OperandWidths {
+		if operands[i] < 0 || operands[i] >= 1<<(8*w) {
+			c.errorf("%s operand %d does not fit in %d bytes", def.Name, operands[i], w)
+		}
+	}
+
+	s := c.scope
+	offset := len(s.code)
+	s.code = append(s.code, Make(op, operands...)...)
+	s.lines = append(s.lines, LineInfo{Offset: offset, Pos: c.pos})
+	s.prev, s.last = s.last, emitted{op, offset}
+	return offset
+}
+
+// emitBinary emits the instruction of a binary operator. When its
+// operands were pushed by the two instructions before it, a local and
+// a constant or two locals, and no jump lands between them, the three
+// are fused into one superinstruction.
+func (c *compiler) emitBinary(op Opcode) {
+	s := c.scope
+	if s.prev.op == OpGetLocal && s.target <= s.prev.offset {
+		var fused Opcode
+		switch s.last.op {
+		case OpConstant:
+			fused = OpBinaryLocalConst
+		case OpGetLocal:
+			fused = OpBinaryLocals
+		}
+		if fused != 0 {
+			a := int(readUint16(s.code[s.prev.offset+1:]))
+			b := int(readUint16(s.code[s.last.offset+1:]))
+			s.code = s.code[:s.prev.offset]
+			s.lines = s.lines[:len(s.lines)-2]
+			c.emit(fused, int(op), a, b)
+			s.prev = emitted{op: opNone}
+			return
+		}
+	}
+	c.emit(op)
+}
+
+// label returns the offset of the next instruction, which a jump is
+// going to land on.
+func (c *compiler) label() int {
+	c.scope.target = len(c.scope.code)
+	return c.scope.target
+}
+
+// patch makes the jump at offset, whose target is its last operand,
+// land on the next instruction.
+func (c *compiler) patch(offset int) {
+	s := c.scope
+	def := definitions[Opcode(s.code[offset])]
+	at := offset + 1
+	for _, w := range def.OperandWidths[:len(def.OperandWidths)-1] {
+		at += w
+	}
+	copy(s.code[at:], Make(OpJump, c.label())[1:])
+}
+
+func (c *compiler) constant(obj Object) int {
+	if h, ok := obj.(Hashable); ok {
+		key := h.HashKey()
+		if i, ok := c.consts[key]; ok {
+			return i
+		}
+		c.consts[key] = len(c.bc.Constants)
+	}
+	c.bc.Constants = append(c.bc.Constants, obj)
+	return len(c.bc.Constants) - 1
+}
+
+func (c *compiler) structIndex(def *StructDef) int {
+	if i, ok := c.structs[def]; ok {
+		return i
+	}
+	c.structs[def] = len(c.bc.Structs)
+	c.bc.Structs = append(c.bc.Structs, def)
+	return len(c.bc.Structs) - 1
+}
+
+func (c *compiler) enumIndex(def *EnumDef) int {
+	if i, ok := c.enums[def]; ok {
+		return i
+	}
+	c.enums[def] = len(c.bc.Enums)
+	c.bc.Enums = append(c.bc.Enums, def)
+	return len(c.bc.Enums) - 1
+}
+
+// raise emits an instruction raising a runtime error with a fixed
+// message.
+func (c *compiler) raise(format string, a ...any) {
+	c.emit(OpError, c.constant(&String{Value: fmt.Sprintf(format, a...)}))
+}
+
+// topLevelNames returns the globals the top level of a program
+// declares, so that functions may refer to globals declared after them.
+func topLevelNames(stmts []parser.Statement) []string {
+	var names []string
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *parser.LetStatement:
+			names = append(names, stmt.Name.Value)
+			if stmt.Ok != nil {
+				names = append(names, stmt.Ok.Value)
+			}
+		case *parser.FunctionStatement:
+			names = append(names, stmt.Name.Value)
+		}
+	}
+	return names
+}
+
+// declareTypes declares the structs, methods and enum variants of a
+// program, as declareTypes does for the tree-walking engine. Methods
+// are compiled here; the variants are stored in their globals by the
+// first instructions of the program.
+func (c *compiler) declareTypes(stmts []parser.Statement) {
+	for _, stmt := range stmts {
+		switch st := stmt.(type) {
+		case *parser.StructStatement:
+			def := &StructDef{Name: st.Name.Value, Methods: map[string]Object{}, Traits: map[string]bool{}}
+			for _, field := range st.Fields {
+				def.Fields = append(def.Fields, field.Value)
+			}
+			c.in.structs[def.Name] = def
+		case *parser.EnumStatement:
+			def := &EnumDef{Name: st.Name.Value}
+			for _, v := range st.Variants {
+				def.variant(v.Name.Value, len(v.Fields))
+			}
+			restore := c.at(st.Pos())
+			for i, variant := range def.Variants {
+				c.in.variants[variant.Name] = variant
+				c.emit(OpVariant, c.enumIndex(def), i)
+				c.emit(OpSetGlobal, c.in.globalSlot(variant.Name))
+			}
+			restore()
+		}
+	}
+
+	for _, stmt := range stmts {
+		impl, ok := stmt.(*parser.ImplStatement)
+		if !ok {
+			continue
+		}
+		def, ok := c.in.structs[impl.Name.Value]
+		if !ok {
+			continue
+		}
+		if impl.Trait != nil {
+			def.Traits[impl.Trait.Value] = true
+		}
+		for _, method := range impl.Methods {
+			fn := c.compileFunctionBody(method.Function, def.Name+"."+method.Name.Value)
+			c.constant(fn)
+			def.Methods[method.Name.Value] = &Closure{Fn: fn}
+		}
+	}
+}
+
+// compileBlock compiles statements in the current block scope, leaving
+// the value of the last one on the stack.
+func (c *compiler) compileBlock(stmts []parser.Statement) {
+	if len(stmts) == 0 {
+		c.emit(OpNull)
+		return
+	}
+	for _, stmt := range stmts[:len(stmts)-1] {
+		c.compileStatement(stmt)
+	}
+
+	switch last := stmts[len(stmts)-1].(type) {
+	case *parser.ExpressionStatement:
+		c.compileExpression(last.Expression)
+	case *parser.BlockStatement:
+		c.enterBlock()
+		c.compileBlock(last.Statements)
+		c.leaveBlock()
+	default:
+		c.compileStatement(last)
+		c.emit(OpNull)
+	}
+}
+
+func (c *compiler) compileStatement(stmt parser.Statement) {
+	defer c.at(stmt.Pos())()
+
+	switch node := stmt.(type) {
+	case *parser.ExpressionStatement:
+		c.compileExpression(node.Expression)
+		c.emit(OpPop)
+
+	case *parser.BlockStatement:
+		c.enterBlock()
+		for _, s := range node.Statements {
+			c.compileStatement(s)
+		}
+		c.leaveBlock()
+
+	case *parser.LetStatement:
+		if node.Ok != nil {
+			c.compileCommaOk(node)
+			return
+		}
+		if lit, ok := node.Value.(*parser.FunctionLiteral); ok {
+			// declared first so that the literal may call itself
+			sym := c.declare(node.Name.Value)
+			c.compileFunction(lit, node.Name.Value)
+			c.store(sym)
+			return
+		}
+		c.compileExpression(node.Value)
+		c.store(c.declare(node.Name.Value))
+
+	case *parser.AssignStatement:
+		c.compileAssignStatement(node)
+
+	case *parser.FunctionStatement:
+		sym := c.declare(node.Name.Value)
+		c.compileFunction(node.Function, node.Name.Value)
+		c.store(sym)
+
+	case *parser.ForStatement:
+		c.compileForStatement(node)
+
+	case *parser.ForInStatement:
+		c.compileForInStatement(node)
+
+	case *parser.StructStatement, *parser.ImplStatement, *parser.EnumStatement, *parser.TraitStatement:
+		// declared by declareTypes
+
+	case *parser.DeferStatement:
+		c.compileExpression(node.Call.Function)
+		c.emit(OpCallable)
+		for _, arg := range node.Call.Arguments {
+			c.compileExpression(arg)
+		}
+		restore := c.at(node.Call.Pos())
+		c.emit(OpDefer, len(node.Call.Arguments))
+		restore()
+
+	case *parser.ReturnStatement:
+		c.compileReturnStatement(node)
+
+	default:
+		c.errorf("cannot compile %T", stmt)
+	}
+}
+
+// compileReturnStatement compiles `return`. A call in tail position,
+// outside the top level and the bodies of try expressions, compiles to
+// OpTailCall at the position of the call, followed by the OpReturn
+// whose position errors raised by the tail call itself are reported at.
+func (c *compiler) compileReturnStatement(node *parser.ReturnStatement) {
+	call, ok := node.ReturnValue.(*parser.CallExpression)
+	switch {
+	case node.ReturnValue == nil:
+		c.emit(OpNull)
+	case ok && c.scope.outer != nil && c.scope.trying == 0:
+		c.compileExpression(call.Function)
+		for _, arg := range call.Arguments {
+			c.compileExpression(arg)
+		}
+		restore := c.at(call.Pos())
+		c.emit(OpTailCall, len(call.Arguments))
+		restore()
+	default:
+		c.compileExpression(node.ReturnValue)
+	}
+	c.emit(OpReturn)
+}
+
+func (c *compiler) compileAssignStatement(node *parser.AssignStatement) {
+	c.compileExpression(node.Value)
+
+	switch target := node.Target.(type) {
+	case *parser.Identifier:
+		sym, ok := c.resolve(target.Value)
+		if !ok || sym.scope == builtinScope {
+			c.emit(OpPop)
+			c.raise("identifier not found: %s", target.Value)
+			return
+		}
+		c.store(sym)
+
+	case *parser.IndexExpression:
+		c.compileExpression(target.Left)
+		c.compileExpression(target.Index)
+		c.emit(OpSetIndex)
+
+	case *parser.SelectorExpression:
+		c.compileExpression(target.Left)
+		c.emit(OpSetField, c.constant(&String{Value: target.Field.Value}))
+
+	default:
+		c.errorf("cannot assign to %T", node.Target)
+	}
+}
+
+func (c *compiler) compileCommaOk(node *parser.LetStatement) {
+	index, ok := node.Value.(*parser.IndexExpression)
+	if !ok {
+		c.raise("comma-ok declaration requires a map index")
+		return
+	}
+	c.compileExpression(index.Left)
+	c.compileExpression(index.Index)
+	found := c.emit(OpCommaOk, 0)
+	c.compileZero(node.Zero)
+	c.emit(OpFalse)
+	c.patch(found)
+	okSym := c.declare(node.Ok.Value)
+	valSym := c.declare(node.Name.Value)
+	c.store(okSym)
+	c.store(valSym)
+}
+
+// compileZero compiles the zero value exp of a comma-ok declaration,
+// as zeroValue builds it.
+func (c *compiler) compileZero(exp parser.Expression) {
+	switch exp := exp.(type) {
+	case nil:
+		c.emit(OpNull)
+	case *parser.Identifier:
+		c.emit(OpVariant, c.enumIndex(optionDef), slices.Index(optionDef.Variants, noneVariant))
+	case *parser.StructLiteral:
+		def, ok := c.in.structs[exp.Name.Value]
+		if !ok {
+			c.raise("undefined struct type: %s", exp.Name.Value)
+			return
+		}
+		fields := &Array{}
+		for i, field := range exp.Fields {
+			c.compileZero(exp.Values[i])
+			fields.Elements = append(fields.Elements, &String{Value: field.Value})
+		}
+		c.emit(OpStruct, c.structIndex(def), c.constant(fields))
+	default:
+		c.compileExpression(exp)
+	}
+}
+
+// compileForStatement compiles a three-clause loop. Closures created in
+// an iteration keep the loop variables of that iteration: their
+// upvalues are closed before the post statement runs.
+func (c *compiler) compileForStatement(node *parser.ForStatement) {
+	c.enterBlock()
+	first := c.scope.numLocals
+
+	if node.Init != nil {
+		c.compileStatement(node.Init)
+	}
+
+	start := c.label()
+	exit := -1
+	if node.Condition != nil {
+		c.compileExpression(node.Condition)
+		exit = c.emit(OpJumpNotTruthy, 0)
+	}
+
+	c.compileStatement(node.Body)
+	c.closeUpvalues(first)
+
+	if node.Post != nil {
+		c.compileStatement(node.Post)
+	}
+	c.emit(OpJump, start)
+	if exit >= 0 {
+		c.patch(exit)
+	}
+
+	c.leaveBlock()
+}
+
+// compileForInStatement compiles a for-in loop. The iterator stays on
+// the stack while the loop runs.
+func (c *compiler) compileForInStatement(node *parser.ForInStatement) {
+	c.compileExpression(node.Iterable)
+	c.emit(OpIter)
+
+	mode := 0
+	if node.Value != nil {
+		mode = 1
+	}
+	start := c.label()
+	exit := c.emit(OpNext, mode, 0)
+
+	c.enterBlock()
+	first := c.scope.numLocals
+	key := c.declare(node.Key.Value)
+	if node.Value != nil {
+		c.store(c.declare(node.Value.Value))
+	}
+	c.store(key)
+	for _, stmt := range node.Body.Statements {
+		c.compileStatement(stmt)
+	}
+	c.closeUpvalues(first)
+	c.leaveBlock()
+
+	c.emit(OpJump, start)
+	c.patch(exit)
+}
+
+// closeUpvalues emits an OpCloseUpvalues for the locals from slot up,
+// if any closure captured one of them.
+func (c *compiler) closeUpvalues(slot int) {
+	for i := slot; i < c.scope.numLocals; i++ {
+		if c.scope.captured[i] {
+			c.emit(OpCloseUpvalues, slot)
+			return
+		}
+	}
+}
+
+// compileFunction compiles a function literal and emits the closure
+// creating it.
+func (c *compiler) compileFunction(lit *parser.FunctionLiteral, name string) {
+	fn := c.compileFunctionBody(lit, name)
+	c.emit(OpClosure, c.constant(fn))
+}
+
+func (c *compiler) compileFunctionBody(lit *parser.FunctionLiteral, name string) *CompiledFunction {
+	defer c.at(lit.Pos())()
+
+	c.enterFunction(name)
+	for _, param := range lit.Parameters {
+		c.declare(param.Value)
+	}
+	c.scope.numParams = len(lit.Parameters)
+	c.compileBlock(lit.Body.Statements)
+	c.emit(OpReturn)
+	return c.leaveFunction()
+}
+
+var binaryOpcodes = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"%":  OpMod,
+	"..": OpConcat,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"<":  OpLess,
+	">":  OpGreater,
+}
+
+func (c *compiler) compileExpression(exp parser.Expression) {
+	defer c.at(exp.Pos())()
+
+	switch node := exp.(type) {
+	case *parser.IntegerLiteral:
+		c.emit(OpConstant, c.constant(&Integer{Value: node.Value}))
+
+	case *parser.FloatLiteral:
+		c.emit(OpConstant, c.constant(&Float{Value: node.Value}))
+
+	case *parser.StringLiteral:
+		c.emit(OpConstant, c.constant(&String{Value: node.Value}))
+
+	case *parser.Boolean:
+		if node.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+
+	case *parser.Identifier:
+		sym, ok := c.resolve(node.Value)
+		if !ok {
+			c.raise("identifier not found: %s", node.Value)
+			return
+		}
+		c.load(sym)
+
+	case *parser.PrefixExpression:
+		c.compileExpression(node.Right)
+		switch node.Operator {
+		case "!":
+			c.emit(OpBang)
+		case "-":
+			c.emit(OpMinus)
+		default:
+			c.errorf("unknown operator: %s", node.Operator)
+		}
+
+	case *parser.InfixExpression:
+		c.compileInfixExpression(node)
+
+	case *parser.IfExpression:
+		c.compileExpression(node.Condition)
+		alternative := c.emit(OpJumpNotTruthy, 0)
+		c.enterBlock()
+		c.compileBlock(node.Consequence.Statements)
+		c.leaveBlock()
+		end := c.emit(OpJump, 0)
+		c.patch(alternative)
+		if node.Alternative != nil {
+			c.enterBlock()
+			c.compileBlock(node.Alternative.Statements)
+			c.leaveBlock()
+		} else {
+			c.emit(OpNull)
+		}
+		c.patch(end)
+
+	case *parser.MatchExpression:
+		c.compileMatchExpression(node)
+
+	case *parser.TryCatchExpression:
+		c.compileTryCatchExpression(node)
+
+	case *parser.TryExpression:
+		c.compileExpression(node.Left)
+		c.emit(OpUnwrap)
+
+	case *parser.FunctionLiteral:
+		c.compileFunction(node, "")
+
+	case *parser.CallExpression:
+		c.compileExpression(node.Function)
+		for _, arg := range node.Arguments {
+			c.compileExpression(arg)
+		}
+		c.emit(OpCall, len(node.Arguments))
+
+	case *parser.ArrayLiteral:
+		for _, el := range node.Elements {
+			c.compileExpression(el)
+		}
+		c.emit(OpArray, len(node.Elements))
+
+	case *parser.MapLiteral:
+		for i, key := range node.Keys {
+			c.compileExpression(key)
+			c.compileExpression(node.Values[i])
+		}
+		c.emit(OpMap, len(node.Keys))
+
+	case *parser.StructLiteral:
+		def, ok := c.in.structs[node.Name.Value]
+		if !ok {
+			c.raise("undefined struct type: %s", node.Name.Value)
+			return
+		}
+		fields := &Array{}
+		for i, field := range node.Fields {
+			c.compileExpression(node.Values[i])
+			fields.Elements = append(fields.Elements, &String{Value: field.Value})
+		}
+		c.emit(OpStruct, c.structIndex(def), c.constant(fields))
+
+	case *parser.SelectorExpression:
+		c.compileExpression(node.Left)
+		c.emit(OpGetField, c.constant(&String{Value: node.Field.Value}))
+
+	case *parser.IndexExpression:
+		c.compileExpression(node.Left)
+		c.compileExpression(node.Index)
+		c.emit(OpIndex)
+
+	case *parser.SliceExpression:
+		c.compileExpression(node.Left)
+		flags := 0
+		if node.Low != nil {
+			c.compileExpression(node.Low)
+			flags |= sliceLow
+		}
+		if node.High != nil {
+			c.compileExpression(node.High)
+			flags |= sliceHigh
+		}
+		c.emit(OpSlice, flags)
+
+	default:
+		c.errorf("cannot compile %T", exp)
+	}
+}
+
+// The flags of OpSlice saying which bounds are on the stack.
+const (
+	sliceLow = 1 << iota
+	sliceHigh
+)
+
+// compileInfixExpression compiles a binary operator. && and || jump
+// over their right operand when the left one decides the result.
+func (c *compiler) compileInfixExpression(node *parser.InfixExpression) {
+	c.compileExpression(node.Left)
+
+	switch node.Operator {
+	case "&&":
+		short := c.emit(OpJumpNotTruthy, 0)
+		c.compileExpression(node.Right)
+		c.emit(OpBool)
+		end := c.emit(OpJump, 0)
+		c.patch(short)
+		c.emit(OpFalse)
+		c.patch(end)
+		return
+	case "||":
+		right := c.emit(OpJumpNotTruthy, 0)
+		c.emit(OpTrue)
+		end := c.emit(OpJump, 0)
+		c.patch(right)
+		c.compileExpression(node.Right)
+		c.emit(OpBool)
+		c.patch(end)
+		return
+	}
+
+	c.compileExpression(node.Right)
+	op, ok := binaryOpcodes[node.Operator]
+	if !ok {
+		c.errorf("unknown operator: %s", node.Operator)
+		return
+	}
+	c.emitBinary(op)
+}
+
+// compileTryCatchExpression compiles a try expression. OpTry registers
+// the catch block, which the VM jumps to with the error's message on
+// the stack.
+func (c *compiler) compileTryCatchExpression(node *parser.TryCatchExpression) {
+	handler := c.emit(OpTry, 0)
+	c.scope.trying++
+	c.enterBlock()
+	c.compileBlock(node.Body.Statements)
+	c.leaveBlock()
+	c.scope.trying--
+	c.emit(OpEndTry)
+	end := c.emit(OpJump, 0)
+
+	c.patch(handler)
+	c.enterBlock()
+	c.store(c.declare(node.Name.Value))
+	c.compileBlock(node.Handler.Statements)
+	c.leaveBlock()
+	c.patch(end)
+}
+
+// compileMatchExpression compiles the decision tree of a match, with
+// OpSwitch for its switch nodes and jumps for the guards of its leaves.
+// The subject is kept in a local the tree loads its parts from.
+func (c *compiler) compileMatchExpression(node *parser.MatchExpression) {
+	c.compileExpression(node.Subject)
+	subject := c.local()
+	c.emit(OpSetLocal, subject)
+
+	tree := compileMatch(c.in.variants, []occurrence{{}}, matchRows(node))
+	var ends []int
+	c.compileDecision(tree, subject, &ends)
+	for _, end := range ends {
+		c.patch(end)
+	}
+}
+
+func (c *compiler) compileDecision(tree decision, subject int, ends *[]int) {
+	switch d := tree.(type) {
+	case nil:
+		c.emit(OpGetLocal, subject)
+		c.emit(OpNoMatch)
+
+	case *switchNode:
+		c.loadOccurrence(subject, d.occ)
+		table := &jumpTable{Cases: map[HashKey]int{}}
+		c.emit(OpSwitch, c.constant(table))
+
+		keys := make([]HashKey, 0, len(d.cases))
+		for key := range d.cases {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+		for _, key := range keys {
+			table.Cases[key] = c.label()
+			c.compileDecision(d.cases[key], subject, ends)
+		}
+		table.Default = c.label()
+		c.compileDecision(d.fallback, subject, ends)
+
+	case *leafNode:
+		c.enterBlock()
+		for _, b := range d.bindings {
+			c.loadOccurrence(subject, b.occ)
+			c.store(c.declare(b.name))
+		}
+		next := -1
+		if d.arm.Guard != nil {
+			c.compileExpression(d.arm.Guard)
+			next = c.emit(OpJumpNotTruthy, 0)
+		}
+		c.compileBlock(d.arm.Body.Statements)
+		*ends = append(*ends, c.emit(OpJump, 0))
+		c.leaveBlock()
+
+		if next >= 0 {
+			c.patch(next)
+			c.compileDecision(d.next, subject, ends)
+		}
+	}
+}
+
+func (c *compiler) loadOccurrence(subject int, occ occurrence) {
+	c.emit(OpGetLocal, subject)
+	for _, i := range occ {
+		c.emit(OpVariantField, i)
+	}
+}
+
+func (k HashKey) less(other HashKey) bool {
+	if k.Type != other.Type {
+		return k.Type < other.Type
+	}
+	if k.Value != other.Value {
+		return k.Value < other.Value
+	}
+	return k.Str < other.Str
+}
@@ -0,0 +1,69 @@
+package interpreter
+
+// Environment maps variable names to values. Every block and function
+// call gets its own environment enclosing the one it was created in.
+//
+// A function literal captures the environment it is evaluated in, not
+// the values in it: assignments made after the closure is created are
+// visible to it, and assignments it makes are visible outside. A
+// closure declared with let may call itself, since the let adds its
+// name to the environment the closure captured.
+//
+// Loops declare fresh variables on every iteration, so closures
+// created in different iterations capture different variables. For a
+// for-in loop these are the key and value; for a three-clause loop
+// they are the variables declared by its init statement, which are
+// copied into a new environment before each post statement runs.
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Get looks name up in e and its enclosing environments.
+func (e *Environment) Get(name string) (Object, bool) {
+	for ; e != nil; e = e.outer {
+		if obj, ok := e.store[name]; ok {
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+// Set declares name in e, shadowing any variable of the same name in
+// an enclosing environment.
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+// copy returns a new environment with the same variables and values as
+// e, enclosed by the same environment.
+func (e *Environment) copy() *Environment {
+	c := &Environment{store: make(map[string]Object, len(e.store)), outer: e.outer}
+	for name, val := range e.store {
+		c.store[name] = val
+	}
+	return c
+}
+
+// Assign updates the innermost existing variable called name. It
+// reports false if there is no such variable.
+func (e *Environment) Assign(name string, val Object) bool {
+	for ; e != nil; e = e.outer {
+		if _, ok := e.store[name]; ok {
+			e.store[name] = val
+			return true
+		}
+	}
+	return false
+}
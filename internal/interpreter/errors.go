@@ -0,0 +1,195 @@
+package interpreter
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+)
+
+// RuntimeError is an error raised while a program runs, such as a
+// division by zero or an index out of range. It unwinds to the top of
+// the program, where Run returns it as a Go error.
+type RuntimeError struct {
+	Message string
+	// Values are the values the failed operation was applied to, such
+	// as the operands of a division or an out of range index.
+	Values []Object
+	// Stack is the Gust call stack when the error was raised, innermost
+	// frame first. The last frame is the top level of the program.
+	Stack []Frame
+	// File is the name of the source file, if the interpreter knows it.
+	File string
+	// Panic reports whether the error was raised by the panic builtin
+	// rather than by a failed operation.
+	Panic bool
+	// Err is the reason the run was stopped from outside the program:
+	// ErrStepLimit, ErrMemoryLimit or the error of its context. A try
+	// expression does not catch errors with a reason.
+	Err error
+}
+
+// Frame is a function on the call stack of a RuntimeError.
+type Frame struct {
+	// Function is the name of the function, or "main" for the top level
+	// of the program.
+	Function string
+	// Pos is where the function was executing: the expression that
+	// failed in the innermost frame, and the call of the next function
+	// in the others. It is invalid in frames of builtins.
+	Pos lexer.Position
+}
+
+func (e *RuntimeError) Type() ObjectType { return ERROR_OBJ }
+func (e *RuntimeError) Inspect() string  { return "error: " + e.Message }
+func (e *RuntimeError) Error() string    { return e.Message }
+func (e *RuntimeError) Unwrap() error    { return e.Err }
+
+// Trace formats the error the way Go prints a panic: the message, the
+// offending values, and then each frame of the stack with the position
+// it was executing. Errors raised by the panic builtin start with
+// "panic: " instead of "runtime error: ".
+//
+//	runtime error: integer divide by zero
+//	values: 1, 0
+//
+//	div(...)
+//		app.gt:2:14
+//	main()
+//		app.gt:6:9
+func (e *RuntimeError) Trace() string {
+	var b strings.Builder
+	if e.Panic {
+		b.WriteString("panic: " + e.Message + "\n")
+	} else {
+		b.WriteString("runtime error: " + e.Message + "\n")
+	}
+	if len(e.Values) > 0 {
+		values := make([]string, len(e.Values))
+		for i, v := range e.Values {
+			values[i] = repr(v, nil)
+		}
+		b.WriteString("values: " + strings.Join(values, ", ") + "\n")
+	}
+	if len(e.Stack) > 0 {
+		b.WriteString("\n")
+	}
+	for i, frame := range e.Stack {
+		// like Go, print only the ends of very deep stacks
+		if len(e.Stack) > maxTraceFrames && i == maxTraceFrames/2 {
+			fmt.Fprintf(&b, "...%d frames elided...\n", len(e.Stack)-maxTraceFrames)
+		}
+		if len(e.Stack) > maxTraceFrames && i >= maxTraceFrames/2 && i < len(e.Stack)-maxTraceFrames/2 {
+			continue
+		}
+		if frame.Function == "main" {
+			b.WriteString("main()\n")
+		} else {
+			b.WriteString(frame.Function + "(...)\n")
+		}
+		switch {
+		case !frame.Pos.IsValid():
+			b.WriteString("\t<builtin>\n")
+		case e.File != "":
+			fmt.Fprintf(&b, "\t%s:%s\n", e.File, frame.Pos)
+		default:
+			fmt.Fprintf(&b, "\t%s\n", frame.Pos)
+		}
+	}
+	return b.String()
+}
+
+// maxTraceFrames is the number of frames Trace prints.
+const maxTraceFrames = 100
+
+func newError(format string, a ...any) *RuntimeError {
+	return &RuntimeError{Message: fmt.Sprintf(format, a...)}
+}
+
+// with records values as the offending values of e, unless it already
+// has some, and returns e. Errors passed up from a nested operation
+// keep the values they were raised with.
+func (e *RuntimeError) with(values ...Object) *RuntimeError {
+	if e.Values == nil {
+		e.Values = values
+	}
+	return e
+}
+
+// withValues is with for an evaluation result that may or may not be
+// an error.
+func withValues(result Object, values ...Object) Object {
+	if err, ok := result.(*RuntimeError); ok {
+		return err.with(values...)
+	}
+	return result
+}
+
+// A call is an active function call: the function's name, where it was
+// called from, and the calls its defer statements have deferred. The
+// top level of the program is a call named main.
+type call struct {
+	name   string
+	pos    lexer.Position
+	defers []deferred
+	// trying counts the try expressions whose bodies the function is
+	// evaluating.
+	trying int
+}
+
+// deferred is a call deferred by a defer statement at pos, with its
+// function and arguments already evaluated.
+type deferred struct {
+	fn   Object
+	args []Object
+	pos  lexer.Position
+}
+
+// stack returns the frames of the active calls, innermost first, with
+// the innermost executing at pos.
+func (in *Interpreter) stack(pos lexer.Position) []Frame {
+	frames := make([]Frame, 0, len(in.calls))
+	for i := len(in.calls) - 1; i >= 0; i-- {
+		frames = append(frames, Frame{Function: in.calls[i].name, Pos: pos})
+		pos = in.calls[i].pos
+	}
+	return frames
+}
+
+// runDefers makes the calls deferred by c, last first, once its
+// function has finished with result. A runtime error raised by a
+// deferred call replaces result, as a panic in a deferred function does
+// in Go, unless result stops the run, and the remaining deferred calls
+// still run.
+func (in *Interpreter) runDefers(c *call, result Object) Object {
+	for len(c.defers) > 0 {
+		d := c.defers[len(c.defers)-1]
+		c.defers = c.defers[:len(c.defers)-1]
+
+		if err, ok := in.applyFunction(d.fn, d.args, d.pos).(*RuntimeError); ok && !isStopped(result) {
+			if err.Stack == nil {
+				err.Stack = in.stack(d.pos)
+			}
+			result = err
+		}
+	}
+	return result
+}
+
+// recovered converts a Go panic raised while running a program into a
+// RuntimeError with the given stack, so that a bug in the interpreter
+// or in a builtin does not crash the program embedding it. The position
+// the panic was raised at is not known.
+func (in *Interpreter) recovered(r any, stack []Frame) *RuntimeError {
+	var msg string
+	switch r := r.(type) {
+	case runtime.Error:
+		msg = strings.TrimPrefix(r.Error(), "runtime error: ")
+	case error:
+		msg = r.Error()
+	default:
+		msg = fmt.Sprint(r)
+	}
+	return &RuntimeError{Message: "panic: " + msg, Stack: stack}
+}
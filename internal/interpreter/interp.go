@@ -0,0 +1,1344 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+// Interpreter runs type-checked programs, by walking their syntax tree
+// or by compiling them to bytecode for a virtual machine, as its Engine
+// says. Builtins such as println write to the interpreter's output.
+type Interpreter struct {
+	out     io.Writer
+	errOut  io.Writer
+	input   io.Reader
+	globals *Environment
+	structs map[string]*StructDef
+
+	variants map[string]*VariantDef
+	matches  map[*parser.MatchExpression]decision
+
+	// calls are the active function calls, outermost first.
+	calls    []*call
+	maxDepth int
+	file     string
+
+	engine Engine
+	// vm is the virtual machine running a program, if one is.
+	vm *machine
+	// the slots the VM keeps global variables in, which persist across
+	// runs like the global environment
+	globalSlots  map[string]int
+	globalNames  []string
+	globalValues []Object
+
+	ctx    context.Context
+	limits Limits
+	// budget is the number of steps left before the next call to tick,
+	// and steps the number tick has granted the run, including those.
+	budget int64
+	steps  int64
+	// memory is the number of bytes the run has allocated.
+	memory int64
+
+	// openFile opens files for the read_file builtin.
+	openFile func(path string) (io.ReadCloser, error)
+	// atRunEnd are called when each run ends.
+	atRunEnd []func()
+}
+
+// Engine selects how an Interpreter runs programs. Both engines give
+// programs the same results, output and runtime errors.
+type Engine int
+
+const (
+	// TreeEngine evaluates programs by walking their syntax tree.
+	TreeEngine Engine = iota
+	// VMEngine compiles programs to bytecode and runs it on a stack
+	// virtual machine.
+	VMEngine
+)
+
+func (e Engine) String() string {
+	if e == VMEngine {
+		return "vm"
+	}
+	return "tree"
+}
+
+// ParseEngine returns the engine called name, "tree" or "vm".
+func ParseEngine(name string) (Engine, error) {
+	switch name {
+	case "tree":
+		return TreeEngine, nil
+	case "vm":
+		return VMEngine, nil
+	}
+	return 0, fmt.Errorf("unknown engine %q, want tree or vm", name)
+}
+
+// DefaultMaxDepth is the default limit on the depth of function calls.
+// Calls in tail position, `return f(x)`, do not count toward it.
+const DefaultMaxDepth = 10000
+
+// MaxDepth is the highest limit on the depth of function calls. Both
+// engines make each call on the Go stack, and calls this deep stay
+// well within its 1GB limit, which would otherwise crash the process.
+const MaxDepth = 25000
+
+// New returns an interpreter writing program output to out,
+// or to os.Stdout if out is nil.
+func New(out io.Writer) *Interpreter {
+	if out == nil {
+		out = os.Stdout
+	}
+	in := &Interpreter{
+		out:      out,
+		errOut:   os.Stderr,
+		input:    os.Stdin,
+		globals:  NewEnvironment(),
+		structs:  map[string]*StructDef{},
+		variants: map[string]*VariantDef{},
+		matches:  map[*parser.MatchExpression]decision{},
+		calls:    []*call{{name: "main"}},
+		maxDepth: DefaultMaxDepth,
+
+		globalSlots: map[string]int{},
+		openFile:    func(path string) (io.ReadCloser, error) { return os.Open(path) },
+	}
+	in.declareEnum(optionDef, in.globals)
+	in.declareEnum(resultDef, in.globals)
+	return in
+}
+
+// Globals returns the environment top-level declarations are stored in.
+// It persists across calls to Run.
+func (in *Interpreter) Globals() *Environment {
+	return in.globals
+}
+
+// Output returns the writer builtins such as println write to.
+func (in *Interpreter) Output() io.Writer {
+	return in.out
+}
+
+// ErrOutput returns the writer programs write errors to, such as
+// fmt.eprintln does.
+func (in *Interpreter) ErrOutput() io.Writer {
+	return in.errOut
+}
+
+// SetErrOutput sets the writer programs write errors to, which is
+// os.Stderr by default.
+func (in *Interpreter) SetErrOutput(w io.Writer) {
+	in.errOut = w
+}
+
+// Input returns the reader programs read their input from, such as
+// io.read_line(io.stdin) does.
+func (in *Interpreter) Input() io.Reader {
+	return in.input
+}
+
+// SetInput sets the reader programs read their input from, which is
+// os.Stdin by default.
+func (in *Interpreter) SetInput(r io.Reader) {
+	in.input = r
+}
+
+// DeclareStruct declares the struct type def for the programs the
+// interpreter runs, as a struct statement would.
+func (in *Interpreter) DeclareStruct(def *StructDef) {
+	in.structs[def.Name] = def
+}
+
+// SetOpenFile sets the function the read_file builtin opens files
+// with, which hosts use to restrict what programs may read. The default
+// is os.Open.
+func (in *Interpreter) SetOpenFile(fn func(path string) (io.ReadCloser, error)) {
+	in.openFile = fn
+}
+
+// AtRunEnd adds f to the functions called when each run ends, after
+// its deferred calls, which hosts use to release what a run acquired.
+// A run is a call of Run, Call or RunBytecode.
+func (in *Interpreter) AtRunEnd(f func()) {
+	in.atRunEnd = append(in.atRunEnd, f)
+}
+
+// endRun calls the functions added with AtRunEnd.
+func (in *Interpreter) endRun() {
+	for _, f := range in.atRunEnd {
+		f()
+	}
+}
+
+// SetFile sets the name of the source file the programs run come from,
+// which traces of runtime errors print with positions.
+func (in *Interpreter) SetFile(name string) {
+	in.file = name
+}
+
+// SetMaxDepth limits the depth of function calls to n. A call deeper
+// than that raises a "stack overflow" runtime error. A limit below 1
+// restores DefaultMaxDepth, and one above MaxDepth is MaxDepth.
+func (in *Interpreter) SetMaxDepth(n int) {
+	if n < 1 {
+		n = DefaultMaxDepth
+	}
+	in.maxDepth = min(n, MaxDepth)
+}
+
+// SetEngine sets the engine the interpreter runs programs with. The
+// default is TreeEngine.
+func (in *Interpreter) SetEngine(e Engine) {
+	in.engine = e
+}
+
+// Run evaluates program in the interpreter's global environment and
+// returns the value of its last statement. Runtime errors are returned
+// as *RuntimeError, including Go panics raised while the program runs.
+func (in *Interpreter) Run(program *parser.Program) (result Object, err error) {
+	if in.engine == VMEngine {
+		bc, err := in.Compile(program)
+		if err != nil {
+			return nil, err
+		}
+		return in.execute(bc)
+	}
+
+	in.calls = []*call{{name: "main"}}
+	in.resetLimits()
+	defer in.endRun()
+	defer func() {
+		if r := recover(); r != nil {
+			rerr := in.recovered(r, in.stack(lexer.Position{}))
+			rerr.File = in.file
+			result, err = nil, rerr
+		}
+	}()
+
+	result = in.evalProgram(program, in.globals)
+	result = in.runDefers(in.calls[0], result)
+	if rerr, ok := result.(*RuntimeError); ok {
+		if rerr.Stack == nil {
+			rerr.Stack = in.stack(lexer.Position{})
+		}
+		rerr.File = in.file
+		return nil, rerr
+	}
+	return result, nil
+}
+
+// Call calls fn, a function value of a program the interpreter has run,
+// with args on the interpreter's engine, as if the top level of a
+// program called it. Runtime errors are returned as *RuntimeError.
+func (in *Interpreter) Call(fn Object, args ...Object) (result Object, err error) {
+	if in.engine == VMEngine {
+		return in.runMachine(func(m *machine) Object {
+			m.frames = append(m.frames, frame{name: "main"})
+			return m.call(fn, args, lexer.Position{})
+		})
+	}
+
+	in.calls = []*call{{name: "main"}}
+	in.resetLimits()
+	defer in.endRun()
+	defer func() {
+		if r := recover(); r != nil {
+			rerr := in.recovered(r, in.stack(lexer.Position{}))
+			rerr.File = in.file
+			result, err = nil, rerr
+		}
+	}()
+
+	result = in.applyFunction(fn, args, lexer.Position{})
+	if rerr, ok := result.(*RuntimeError); ok {
+		if rerr.Stack == nil {
+			rerr.Stack = in.stack(lexer.Position{})
+		}
+		rerr.File = in.file
+		return nil, rerr
+	}
+	return result, nil
+}
+
+// Apply calls fn with args from a builtin, while a program runs, and
+// returns its result or the *RuntimeError it raised.
+func (in *Interpreter) Apply(fn Object, args ...Object) Object {
+	return in.applyFunction(fn, args, lexer.Position{})
+}
+
+// eval evaluates node. An error raised by node itself, rather than one
+// of its children, gets the call stack with node's position.
+func (in *Interpreter) eval(node parser.Node, env *Environment) Object {
+	if in.budget--; in.budget < 0 {
+		if err := in.tick(); err != nil {
+			err.Stack = in.stack(node.Pos())
+			return err
+		}
+	}
+	result := in.evalNode(node, env)
+	if err, ok := result.(*RuntimeError); ok && err.Stack == nil {
+		err.Stack = in.stack(node.Pos())
+	}
+	return result
+}
+
+func (in *Interpreter) evalNode(node parser.Node, env *Environment) Object {
+	switch node := node.(type) {
+	case *parser.Program:
+		return in.evalProgram(node, env)
+
+	case *parser.ExpressionStatement:
+		return in.eval(node.Expression, env)
+
+	case *parser.BlockStatement:
+		return in.evalBlockStatement(node, NewEnclosedEnvironment(env))
+
+	case *parser.LetStatement:
+		if node.Ok != nil {
+			return in.evalCommaOk(node, env)
+		}
+		val := in.eval(node.Value, env)
+		if unwinds(val) {
+			return val
+		}
+		if fn, ok := val.(*Function); ok && fn.Name == "" {
+			if _, literal := node.Value.(*parser.FunctionLiteral); literal {
+				fn.Name = node.Name.Value
+			}
+		}
+		env.Set(node.Name.Value, val)
+		return NULL
+
+	case *parser.AssignStatement:
+		return in.evalAssignStatement(node, env)
+
+	case *parser.FunctionStatement:
+		fn := in.newFunction(node.Function, env)
+		fn.Name = node.Name.Value
+		env.Set(fn.Name, fn)
+		return NULL
+
+	case *parser.ForStatement:
+		return in.evalForStatement(node, env)
+
+	case *parser.ForInStatement:
+		return in.evalForInStatement(node, env)
+
+	case *parser.StructStatement, *parser.ImplStatement, *parser.EnumStatement, *parser.TraitStatement:
+		// declared by declareTypes before the program runs
+		return NULL
+
+	case *parser.DeferStatement:
+		return in.evalDeferStatement(node, env)
+
+	case *parser.ReturnStatement:
+		if node.ReturnValue == nil {
+			return &ReturnValue{Value: NULL}
+		}
+		if call, ok := node.ReturnValue.(*parser.CallExpression); ok && in.canTailCall() {
+			return in.evalTailCall(call, env)
+		}
+		val := in.eval(node.ReturnValue, env)
+		if unwinds(val) {
+			return val
+		}
+		return &ReturnValue{Value: val}
+
+	case *parser.IntegerLiteral:
+		return &Integer{Value: node.Value}
+
+	case *parser.FloatLiteral:
+		return &Float{Value: node.Value}
+
+	case *parser.StringLiteral:
+		return &String{Value: node.Value}
+
+	case *parser.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *parser.Identifier:
+		return in.evalIdentifier(node, env)
+
+	case *parser.PrefixExpression:
+		right := in.eval(node.Right, env)
+		if unwinds(right) {
+			return right
+		}
+		return withValues(evalPrefixExpression(node.Operator, right), right)
+
+	case *parser.InfixExpression:
+		return in.evalInfixExpression(node, env)
+
+	case *parser.IfExpression:
+		return in.evalIfExpression(node, env)
+
+	case *parser.MatchExpression:
+		return in.evalMatchExpression(node, env)
+
+	case *parser.TryCatchExpression:
+		return in.evalTryCatchExpression(node, env)
+
+	case *parser.TryExpression:
+		left := in.eval(node.Left, env)
+		if unwinds(left) {
+			return left
+		}
+		return evalTryExpression(left)
+
+	case *parser.FunctionLiteral:
+		return in.newFunction(node, env)
+
+	case *parser.CallExpression:
+		function := in.eval(node.Function, env)
+		if unwinds(function) {
+			return function
+		}
+		args := in.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && unwinds(args[0]) {
+			return args[0]
+		}
+		return in.applyFunction(function, args, node.Pos())
+
+	case *parser.ArrayLiteral:
+		elements := in.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && unwinds(elements[0]) {
+			return elements[0]
+		}
+		return in.Alloc(&Array{Elements: elements})
+
+	case *parser.MapLiteral:
+		return in.evalMapLiteral(node, env)
+
+	case *parser.StructLiteral:
+		return in.evalStructLiteral(node, env)
+
+	case *parser.SelectorExpression:
+		left := in.eval(node.Left, env)
+		if unwinds(left) {
+			return left
+		}
+		return evalSelectorExpression(left, node.Field.Value)
+
+	case *parser.IndexExpression:
+		left := in.eval(node.Left, env)
+		if unwinds(left) {
+			return left
+		}
+		index := in.eval(node.Index, env)
+		if unwinds(index) {
+			return index
+		}
+		return withValues(evalIndexExpression(left, index), index)
+
+	case *parser.SliceExpression:
+		return in.evalSliceExpression(node, env)
+	}
+
+	return newError("cannot evaluate %T", node)
+}
+
+func (in *Interpreter) evalProgram(program *parser.Program, env *Environment) Object {
+	in.declareTypes(program.Statements, env)
+
+	var result Object = NULL
+
+	for _, statement := range program.Statements {
+		result = in.eval(statement, env)
+
+		switch result := result.(type) {
+		case *ReturnValue:
+			return result.Value
+		case *RuntimeError:
+			return result
+		}
+	}
+
+	return result
+}
+
+// declareTypes declares the structs, methods and enum variants of a
+// program before it runs, so that they may be used before their
+// declaration.
+func (in *Interpreter) declareTypes(stmts []parser.Statement, env *Environment) {
+	for _, stmt := range stmts {
+		switch st := stmt.(type) {
+		case *parser.StructStatement:
+			def := &StructDef{Name: st.Name.Value, Methods: map[string]Object{}, Traits: map[string]bool{}}
+			for _, field := range st.Fields {
+				def.Fields = append(def.Fields, field.Value)
+			}
+			in.structs[def.Name] = def
+		case *parser.EnumStatement:
+			def := &EnumDef{Name: st.Name.Value}
+			for _, v := range st.Variants {
+				def.variant(v.Name.Value, len(v.Fields))
+			}
+			in.declareEnum(def, env)
+		}
+	}
+
+	for _, stmt := range stmts {
+		impl, ok := stmt.(*parser.ImplStatement)
+		if !ok {
+			continue
+		}
+		def, ok := in.structs[impl.Name.Value]
+		if !ok {
+			continue
+		}
+		if impl.Trait != nil {
+			def.Traits[impl.Trait.Value] = true
+		}
+		for _, method := range impl.Methods {
+			fn := in.newFunction(method.Function, env)
+			fn.Name = def.Name + "." + method.Name.Value
+			def.Methods[method.Name.Value] = fn
+		}
+	}
+}
+
+// declareEnum declares the variants of an enum in env.
+func (in *Interpreter) declareEnum(def *EnumDef, env *Environment) {
+	for _, variant := range def.Variants {
+		in.variants[variant.Name] = variant
+		env.Set(variant.Name, variantValue(variant))
+	}
+}
+
+// variantValue returns the value a variant's name refers to: the value
+// itself if it has no payload, and a function constructing values
+// otherwise.
+func variantValue(variant *VariantDef) Object {
+	if variant.Arity == 0 {
+		return &EnumValue{Variant: variant}
+	}
+	return &Builtin{Name: variant.Name, Fn: func(in *Interpreter, args ...Object) Object {
+		if len(args) != variant.Arity {
+			return newError("wrong number of arguments to %s: want=%d, got=%d",
+				variant.Name, variant.Arity, len(args))
+		}
+		return in.Alloc(&EnumValue{Variant: variant, Fields: args})
+	}}
+}
+
+// evalBlockStatement evaluates the statements of block in env. Return
+// values and errors are passed up unwrapped so that they unwind through
+// nested blocks to the enclosing function or program.
+func (in *Interpreter) evalBlockStatement(block *parser.BlockStatement, env *Environment) Object {
+	var result Object = NULL
+
+	for _, statement := range block.Statements {
+		result = in.eval(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == RETURN_VALUE_OBJ || rt == ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+func (in *Interpreter) evalIdentifier(node *parser.Identifier, env *Environment) Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	if builtin, ok := builtins[node.Value]; ok {
+		return builtin
+	}
+
+	return newError("identifier not found: %s", node.Value)
+}
+
+func (in *Interpreter) evalAssignStatement(node *parser.AssignStatement, env *Environment) Object {
+	val := in.eval(node.Value, env)
+	if unwinds(val) {
+		return val
+	}
+
+	switch target := node.Target.(type) {
+	case *parser.Identifier:
+		if !env.Assign(target.Value, val) {
+			return newError("identifier not found: %s", target.Value)
+		}
+		return NULL
+
+	case *parser.IndexExpression:
+		left := in.eval(target.Left, env)
+		if unwinds(left) {
+			return left
+		}
+		index := in.eval(target.Index, env)
+		if unwinds(index) {
+			return index
+		}
+		return withValues(in.assignIndex(left, index, val), index)
+
+	case *parser.SelectorExpression:
+		left := in.eval(target.Left, env)
+		if unwinds(left) {
+			return left
+		}
+		return evalFieldAssignment(left, target.Field.Value, val)
+	}
+
+	return newError("cannot assign to %T", node.Target)
+}
+
+func evalFieldAssignment(left Object, name string, val Object) Object {
+	s, ok := left.(*Struct)
+	if !ok {
+		return newError("field assignment not supported: %s", left.Type())
+	}
+	if _, ok := s.Fields[name]; !ok {
+		return newError("%s has no field %s", s.Def.Name, name)
+	}
+	s.Fields[name] = val
+	return NULL
+}
+
+// evalCommaOk evaluates `let v, ok = m[k]`. A missing key binds v to
+// the zero value of the map's value type and ok to false instead of
+// failing.
+func (in *Interpreter) evalCommaOk(node *parser.LetStatement, env *Environment) Object {
+	index, ok := node.Value.(*parser.IndexExpression)
+	if !ok {
+		return newError("comma-ok declaration requires a map index")
+	}
+
+	left := in.eval(index.Left, env)
+	if unwinds(left) {
+		return left
+	}
+	if _, ok := left.(*Map); !ok {
+		return newError("comma-ok declaration requires a map index, got %s", left.Type())
+	}
+
+	key := in.eval(index.Index, env)
+	if unwinds(key) {
+		return key
+	}
+	val, found, err := lookupCommaOk(left, key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		if val = in.zeroValue(node.Zero); unwinds(val) {
+			return val
+		}
+	}
+
+	env.Set(node.Name.Value, val)
+	env.Set(node.Ok.Value, nativeBoolToBooleanObject(found))
+	return NULL
+}
+
+// lookupCommaOk looks key up in the map m, reporting whether it is
+// present rather than failing if it is missing.
+func lookupCommaOk(m, key Object) (Object, bool, *RuntimeError) {
+	mp, ok := m.(*Map)
+	if !ok {
+		return nil, false, newError("comma-ok declaration requires a map index, got %s", m.Type())
+	}
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return nil, false, newError("unusable as map key: %s", key.Type())
+	}
+
+	val, found := mp.Get(hashable)
+	return val, found, nil
+}
+
+// zeroValue builds the zero value exp, which the type checker gave a
+// comma-ok declaration. The None in it is always the variant, even
+// where a program declares a variable of that name; a nil exp is null.
+func (in *Interpreter) zeroValue(exp parser.Expression) Object {
+	switch exp := exp.(type) {
+	case nil:
+		return NULL
+	case *parser.Identifier:
+		return variantValue(noneVariant)
+	case *parser.StructLiteral:
+		def, ok := in.structs[exp.Name.Value]
+		if !ok {
+			return newError("undefined struct type: %s", exp.Name.Value)
+		}
+		s := &Struct{Def: def, Fields: make(map[string]Object, len(def.Fields))}
+		for i, field := range exp.Fields {
+			val := in.zeroValue(exp.Values[i])
+			if unwinds(val) {
+				return val
+			}
+			s.Fields[field.Value] = val
+		}
+		return in.Alloc(s)
+	}
+	// the other zero values are literals, which need no environment
+	return in.eval(exp, nil)
+}
+
+// evalLoopBody evaluates one iteration of a loop body. It reports
+// whether the loop should stop, which it does when the body returns
+// or fails.
+func (in *Interpreter) evalLoopBody(body *parser.BlockStatement, env *Environment) (Object, bool) {
+	result := in.evalBlockStatement(body, env)
+	if result != nil {
+		rt := result.Type()
+		if rt == RETURN_VALUE_OBJ || rt == ERROR_OBJ {
+			return result, true
+		}
+	}
+	return NULL, false
+}
+
+func (in *Interpreter) evalForStatement(node *parser.ForStatement, env *Environment) Object {
+	env = NewEnclosedEnvironment(env)
+
+	if node.Init != nil {
+		if init := in.eval(node.Init, env); unwinds(init) {
+			return init
+		}
+	}
+
+	for {
+		if node.Condition != nil {
+			condition := in.eval(node.Condition, env)
+			if unwinds(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		if result, stop := in.evalLoopBody(node.Body, NewEnclosedEnvironment(env)); stop {
+			return result
+		}
+
+		// the next iteration gets its own copy of the loop variables
+		env = env.copy()
+
+		if node.Post != nil {
+			if post := in.eval(node.Post, env); unwinds(post) {
+				return post
+			}
+		}
+	}
+}
+
+// evalForInStatement iterates over a snapshot of an array, string or
+// map taken before the first iteration, so the body may modify the
+// value it is iterating over.
+func (in *Interpreter) evalForInStatement(node *parser.ForInStatement, env *Environment) Object {
+	iterable := in.eval(node.Iterable, env)
+	if unwinds(iterable) {
+		return iterable
+	}
+
+	pairs, err := rangePairs(iterable)
+	if err != nil {
+		return err
+	}
+	_, isMap := iterable.(*Map)
+
+	for _, pair := range pairs {
+		loopEnv := NewEnclosedEnvironment(env)
+		switch {
+		case node.Value != nil:
+			loopEnv.Set(node.Key.Value, pair.Key)
+			loopEnv.Set(node.Value.Value, pair.Value)
+		case isMap:
+			loopEnv.Set(node.Key.Value, pair.Key)
+		default:
+			loopEnv.Set(node.Key.Value, pair.Value)
+		}
+
+		if result, stop := in.evalLoopBody(node.Body, loopEnv); stop {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// rangePairs returns the keys and values a for-in loop over iterable
+// visits: the indices and elements of an array or string, or the
+// entries of a map.
+func rangePairs(iterable Object) ([]MapPair, *RuntimeError) {
+	var pairs []MapPair
+	switch iterable := iterable.(type) {
+	case *Array:
+		for i, el := range iterable.Elements {
+			pairs = append(pairs, MapPair{Key: &Integer{Value: int64(i)}, Value: el})
+		}
+	case *String:
+		for i := range len(iterable.Value) {
+			pairs = append(pairs, MapPair{Key: &Integer{Value: int64(i)}, Value: &String{Value: iterable.Value[i : i+1]}})
+		}
+	case *Map:
+		pairs = iterable.Pairs()
+	default:
+		return nil, newError("cannot range over %s", iterable.Type())
+	}
+	return pairs, nil
+}
+
+func evalPrefixExpression(operator string, right Object) Object {
+	switch operator {
+	case "!":
+		return nativeBoolToBooleanObject(!isTruthy(right))
+	case "-":
+		switch right := right.(type) {
+		case *Integer:
+			return &Integer{Value: -right.Value}
+		case *Float:
+			return &Float{Value: -right.Value}
+		}
+		return newError("unknown operator: -%s", right.Type())
+	}
+	return newError("unknown operator: %s%s", operator, right.Type())
+}
+
+func (in *Interpreter) evalInfixExpression(node *parser.InfixExpression, env *Environment) Object {
+	left := in.eval(node.Left, env)
+	if unwinds(left) {
+		return left
+	}
+
+	// && and || only evaluate their right operand when needed
+	switch node.Operator {
+	case "&&":
+		if !isTruthy(left) {
+			return FALSE
+		}
+		right := in.eval(node.Right, env)
+		if unwinds(right) {
+			return right
+		}
+		return nativeBoolToBooleanObject(isTruthy(right))
+	case "||":
+		if isTruthy(left) {
+			return TRUE
+		}
+		right := in.eval(node.Right, env)
+		if unwinds(right) {
+			return right
+		}
+		return nativeBoolToBooleanObject(isTruthy(right))
+	}
+
+	right := in.eval(node.Right, env)
+	if unwinds(right) {
+		return right
+	}
+
+	if node.Operator == ".." {
+		if err := in.Charge(concatSize(left, right)); err != nil {
+			return err
+		}
+		return withValues(evalInfixOperator(node.Operator, left, right), left, right)
+	}
+	return in.Alloc(withValues(evalInfixOperator(node.Operator, left, right), left, right))
+}
+
+func evalInfixOperator(operator string, left, right Object) Object {
+	switch {
+	case operator == "==":
+		return nativeBoolToBooleanObject(Equal(left, right))
+	case operator == "!=":
+		return nativeBoolToBooleanObject(!Equal(left, right))
+	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left.(*Integer).Value, right.(*Integer).Value)
+	case left.Type() == FLOAT_OBJ && right.Type() == FLOAT_OBJ:
+		return evalFloatInfixExpression(operator, left.(*Float).Value, right.(*Float).Value)
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return evalStringInfixExpression(operator, left.(*String).Value, right.(*String).Value)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+func evalIntegerInfixExpression(operator string, left, right int64) Object {
+	switch operator {
+	case "+":
+		return &Integer{Value: left + right}
+	case "-":
+		return &Integer{Value: left - right}
+	case "*":
+		return &Integer{Value: left * right}
+	case "/":
+		if right == 0 {
+			return newError("integer divide by zero")
+		}
+		return &Integer{Value: left / right}
+	case "%":
+		if right == 0 {
+			return newError("integer divide by zero")
+		}
+		return &Integer{Value: left % right}
+	case "<":
+		return nativeBoolToBooleanObject(left < right)
+	case ">":
+		return nativeBoolToBooleanObject(left > right)
+	}
+	return newError("unknown operator: INTEGER %s INTEGER", operator)
+}
+
+func evalFloatInfixExpression(operator string, left, right float64) Object {
+	switch operator {
+	case "+":
+		return &Float{Value: left + right}
+	case "-":
+		return &Float{Value: left - right}
+	case "*":
+		return &Float{Value: left * right}
+	case "/":
+		return &Float{Value: left / right}
+	case "<":
+		return nativeBoolToBooleanObject(left < right)
+	case ">":
+		return nativeBoolToBooleanObject(left > right)
+	}
+	return newError("unknown operator: FLOAT %s FLOAT", operator)
+}
+
+func evalStringInfixExpression(operator string, left, right string) Object {
+	switch operator {
+	case "..":
+		return &String{Value: left + right}
+	case "<":
+		return nativeBoolToBooleanObject(left < right)
+	case ">":
+		return nativeBoolToBooleanObject(left > right)
+	}
+	return newError("unknown operator: STRING %s STRING", operator)
+}
+
+// evalTryExpression evaluates `val?`, unwrapping Some and Ok and
+// returning None and Err from the enclosing function.
+func evalTryExpression(val Object) Object {
+	if e, ok := val.(*EnumValue); ok {
+		switch e.Variant {
+		case someVariant, okVariant:
+			return e.Fields[0]
+		case noneVariant, errVariant:
+			return &ReturnValue{Value: e}
+		}
+	}
+	return newError("? applied to %s, not an Option or Result", repr(val, nil)).with(val)
+}
+
+func (in *Interpreter) evalIfExpression(ie *parser.IfExpression, env *Environment) Object {
+	condition := in.eval(ie.Condition, env)
+	if unwinds(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return in.eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return in.eval(ie.Alternative, env)
+	}
+	return NULL
+}
+
+func isTruthy(obj Object) bool {
+	switch obj {
+	case TRUE:
+		return true
+	case FALSE, NULL:
+		return false
+	}
+	return true
+}
+
+func (in *Interpreter) newFunction(fn *parser.FunctionLiteral, env *Environment) *Function {
+	return &Function{Parameters: fn.Parameters, Body: fn.Body, Env: env}
+}
+
+func (in *Interpreter) evalExpressions(exps []parser.Expression, env *Environment) []Object {
+	result := make([]Object, 0, len(exps))
+
+	for _, e := range exps {
+		evaluated := in.eval(e, env)
+		if unwinds(evaluated) {
+			return []Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// evalDeferStatement evaluates the function and arguments of a deferred
+// call and adds it to the calls the current function makes on exit.
+func (in *Interpreter) evalDeferStatement(node *parser.DeferStatement, env *Environment) Object {
+	function := in.eval(node.Call.Function, env)
+	if unwinds(function) {
+		return function
+	}
+	if _, ok := functionName(function); !ok {
+		return newError("not a function: %s", function.Type()).with(function)
+	}
+	args := in.evalExpressions(node.Call.Arguments, env)
+	if len(args) == 1 && unwinds(args[0]) {
+		return args[0]
+	}
+
+	c := in.calls[len(in.calls)-1]
+	c.defers = append(c.defers, deferred{fn: function, args: args, pos: node.Call.Pos()})
+	return NULL
+}
+
+// evalTryCatchExpression evaluates the body of node, and its handler
+// if the body raises a runtime error. The error has already unwound
+// the calls made in the body, running their deferred calls.
+func (in *Interpreter) evalTryCatchExpression(node *parser.TryCatchExpression, env *Environment) Object {
+	c := in.calls[len(in.calls)-1]
+	c.trying++
+	result := in.evalBlockStatement(node.Body, NewEnclosedEnvironment(env))
+	c.trying--
+
+	err, ok := result.(*RuntimeError)
+	if !ok || err.Err != nil {
+		return result
+	}
+
+	handlerEnv := NewEnclosedEnvironment(env)
+	handlerEnv.Set(node.Name.Value, &String{Value: err.Message})
+	return in.evalBlockStatement(node.Handler, handlerEnv)
+}
+
+// applyFunction calls fn with args from pos, the position of the call
+// expression, which is invalid for calls made by builtins.
+func (in *Interpreter) applyFunction(fn Object, args []Object, pos lexer.Position) Object {
+	if in.vm != nil {
+		return in.vm.call(fn, args, pos)
+	}
+
+	name, ok := functionName(fn)
+	if !ok {
+		return newError("not a function: %s", fn.Type()).with(fn)
+	}
+	if len(in.calls) > in.maxDepth {
+		return newError("stack overflow in fn %s", name)
+	}
+
+	in.calls = append(in.calls, &call{name: name, pos: pos})
+	result := in.apply(fn, args)
+	in.calls = in.calls[:len(in.calls)-1]
+	return result
+}
+
+// functionName returns the name fn has in stack traces, and whether it
+// can be called at all.
+func functionName(fn Object) (string, bool) {
+	switch fn := fn.(type) {
+	case *Function:
+		if fn.Name == "" {
+			return "fn", true
+		}
+		return fn.Name, true
+	case *Closure:
+		if fn.Fn.Name == "" {
+			return "fn", true
+		}
+		return fn.Fn.Name, true
+	case *BoundMethod:
+		return functionName(fn.Method)
+	case *Builtin:
+		return fn.Name, true
+	}
+	return "", false
+}
+
+// apply calls fn with args in the frame applyFunction pushed for it. A
+// function whose result is a tail call makes that call in the same
+// frame, which the callee then takes over.
+func (in *Interpreter) apply(fn Object, args []Object) Object {
+	for {
+		switch f := fn.(type) {
+		case *Function:
+			if len(args) != len(f.Parameters) {
+				return newError("wrong number of arguments to %s: want=%d, got=%d",
+					f.Inspect(), len(f.Parameters), len(args))
+			}
+
+			env := NewEnclosedEnvironment(f.Env)
+			for i, param := range f.Parameters {
+				env.Set(param.Value, args[i])
+			}
+
+			c := in.calls[len(in.calls)-1]
+			evaluated := in.evalBlockStatement(f.Body, env)
+			evaluated = in.runDefers(c, evaluated)
+			rv, ok := evaluated.(*ReturnValue)
+			if !ok {
+				return evaluated
+			}
+			tc, ok := rv.Value.(*tailCall)
+			if !ok {
+				return rv.Value
+			}
+			fn, args = tc.Fn, tc.Args
+			c.name, _ = functionName(fn)
+
+		case *BoundMethod:
+			fn, args = f.Method, append([]Object{f.Receiver}, args...)
+
+		case *Builtin:
+			return f.Fn(in, args...)
+
+		default:
+			return newError("not a function: %s", fn.Type()).with(fn)
+		}
+	}
+}
+
+// canTailCall reports whether a return statement in the current
+// function may leave its call to the function's caller: it is not the
+// top level, it has no deferred calls that must run after the call, and
+// it is not in the body of a try expression that must catch the call's
+// errors.
+func (in *Interpreter) canTailCall() bool {
+	c := in.calls[len(in.calls)-1]
+	return len(in.calls) > 1 && len(c.defers) == 0 && c.trying == 0
+}
+
+// evalTailCall evaluates the function and arguments of `return f(x)`,
+// leaving the call itself to apply.
+func (in *Interpreter) evalTailCall(call *parser.CallExpression, env *Environment) Object {
+	function := in.eval(call.Function, env)
+	if unwinds(function) {
+		return function
+	}
+	args := in.evalExpressions(call.Arguments, env)
+	if len(args) == 1 && unwinds(args[0]) {
+		return args[0]
+	}
+	if _, ok := functionName(function); !ok {
+		return newError("not a function: %s", function.Type()).with(function)
+	}
+	return &ReturnValue{Value: &tailCall{Fn: function, Args: args}}
+}
+
+func (in *Interpreter) evalStructLiteral(node *parser.StructLiteral, env *Environment) Object {
+	def, ok := in.structs[node.Name.Value]
+	if !ok {
+		return newError("undefined struct type: %s", node.Name.Value)
+	}
+
+	s := &Struct{Def: def, Fields: make(map[string]Object, len(def.Fields))}
+	for i, field := range node.Fields {
+		val := in.eval(node.Values[i], env)
+		if unwinds(val) {
+			return val
+		}
+		s.Fields[field.Value] = val
+	}
+
+	return in.Alloc(s)
+}
+
+// evalSelectorExpression evaluates `left.name`. Fields take priority
+// over methods, which are returned bound to left.
+func evalSelectorExpression(left Object, name string) Object {
+	if m, ok := left.(*Module); ok {
+		if val, ok := m.Members[name]; ok {
+			return val
+		}
+		return newError("module %s has no member %s", m.Name, name)
+	}
+
+	s, ok := left.(*Struct)
+	if !ok {
+		return newError("selector not supported: %s", left.Type())
+	}
+
+	if val, ok := s.Fields[name]; ok {
+		return val
+	}
+	if method, ok := s.Def.Methods[name]; ok {
+		return &BoundMethod{Receiver: s, Method: method}
+	}
+
+	return newError("%s has no field or method %s", s.Def.Name, name)
+}
+
+func (in *Interpreter) evalMapLiteral(node *parser.MapLiteral, env *Environment) Object {
+	m := NewMap()
+
+	for i, keyNode := range node.Keys {
+		key := in.eval(keyNode, env)
+		if unwinds(key) {
+			return key
+		}
+		hashable, ok := key.(Hashable)
+		if !ok {
+			return newError("unusable as map key: %s", key.Type())
+		}
+
+		val := in.eval(node.Values[i], env)
+		if unwinds(val) {
+			return val
+		}
+
+		m.Set(hashable, val)
+	}
+
+	return in.Alloc(m)
+}
+
+func evalIndexExpression(left, index Object) Object {
+	if m, ok := left.(*Map); ok {
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError("unusable as map key: %s", index.Type())
+		}
+		val, found := m.Get(key)
+		if !found {
+			return newError("key not found: %s", repr(index, nil))
+		}
+		return val
+	}
+
+	i, ok := index.(*Integer)
+	if !ok {
+		return newError("index must be INTEGER, got %s", index.Type())
+	}
+
+	switch left := left.(type) {
+	case *Array:
+		if err := checkIndex(i.Value, len(left.Elements)); err != nil {
+			return err
+		}
+		return left.Elements[i.Value]
+
+	case *String:
+		if err := checkIndex(i.Value, len(left.Value)); err != nil {
+			return err
+		}
+		return &String{Value: left.Value[i.Value : i.Value+1]}
+	}
+
+	return newError("index operator not supported: %s", left.Type())
+}
+
+func evalIndexAssignment(left, index, val Object) Object {
+	if m, ok := left.(*Map); ok {
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError("unusable as map key: %s", index.Type())
+		}
+		m.Set(key, val)
+		return NULL
+	}
+
+	array, ok := left.(*Array)
+	if !ok {
+		return newError("index assignment not supported: %s", left.Type())
+	}
+
+	i, ok := index.(*Integer)
+	if !ok {
+		return newError("index must be INTEGER, got %s", index.Type())
+	}
+
+	if err := checkIndex(i.Value, len(array.Elements)); err != nil {
+		return err
+	}
+
+	array.Elements[i.Value] = val
+	return NULL
+}
+
+func checkIndex(i int64, length int) *RuntimeError {
+	if i < 0 || i >= int64(length) {
+		return newError("index out of range [%d] with length %d", i, length)
+	}
+	return nil
+}
+
+// evalSliceExpression evaluates left[low:high]. Slicing an array copies
+// the selected elements into a new array.
+func (in *Interpreter) evalSliceExpression(node *parser.SliceExpression, env *Environment) Object {
+	left := in.eval(node.Left, env)
+	if unwinds(left) {
+		return left
+	}
+
+	if _, ok := sliceLength(left); !ok {
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	var bounds [2]Object
+	for i, exp := range []parser.Expression{node.Low, node.High} {
+		if exp == nil {
+			continue
+		}
+		bounds[i] = in.eval(exp, env)
+		if unwinds(bounds[i]) {
+			return bounds[i]
+		}
+	}
+	return in.Alloc(evalSlice(left, bounds[0], bounds[1]))
+}
+
+func sliceLength(left Object) (int, bool) {
+	switch left := left.(type) {
+	case *Array:
+		return len(left.Elements), true
+	case *String:
+		return len(left.Value), true
+	}
+	return 0, false
+}
+
+// evalSlice slices left from low to high, either of which is nil if it
+// was left out.
+func evalSlice(left, lowObj, highObj Object) Object {
+	length, ok := sliceLength(left)
+	if !ok {
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	low, high := int64(0), int64(length)
+	for _, bound := range []struct {
+		val Object
+		dst *int64
+	}{{lowObj, &low}, {highObj, &high}} {
+		if bound.val == nil {
+			continue
+		}
+		i, ok := bound.val.(*Integer)
+		if !ok {
+			return newError("slice index must be INTEGER, got %s", bound.val.Type())
+		}
+		*bound.dst = i.Value
+	}
+
+	if low < 0 || high > int64(length) || low > high {
+		return newError("slice bounds out of range [%d:%d] with length %d", low, high, length).
+			with(&Integer{Value: low}, &Integer{Value: high})
+	}
+
+	if s, ok := left.(*String); ok {
+		return &String{Value: s.Value[low:high]}
+	}
+
+	elements := make([]Object, high-low)
+	copy(elements, left.(*Array).Elements[low:high])
+	return &Array{Elements: elements}
+}
@@ -0,0 +1,194 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+// Limits bound the work a run of a program may do, so that programs
+// that are not trusted cannot run forever or exhaust the host's memory.
+// A zero field sets no limit.
+type Limits struct {
+	// Steps is the number of steps a run may take. A step is the
+	// evaluation of a node of the syntax tree on the tree-walking
+	// engine, and the execution of an instruction on the VM, so the
+	// same program takes a different number of steps on each.
+	Steps int64
+	// Memory is the number of bytes a run may allocate for the values
+	// it creates: strings, arrays, maps, structs and enum values, as
+	// they are created. Memory the garbage collector frees is not given
+	// back, so it bounds what a run allocates in total.
+	Memory int64
+}
+
+// ErrStepLimit and ErrMemoryLimit are the errors a RuntimeError wraps
+// when a run exceeds its Limits.
+var (
+	ErrStepLimit   = errors.New("step limit exceeded")
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+)
+
+// checkInterval is the number of steps between checks of the context
+// and the step limit.
+const checkInterval = 1024
+
+// SetContext sets the context of the runs that follow, which stop with
+// a RuntimeError wrapping the context's error once it is done. A nil
+// ctx never stops them.
+func (in *Interpreter) SetContext(ctx context.Context) {
+	in.ctx = ctx
+}
+
+// SetLimits sets the limits each run that follows is held to.
+func (in *Interpreter) SetLimits(l Limits) {
+	in.limits = l
+}
+
+// resetLimits starts counting the steps and memory of a new run.
+func (in *Interpreter) resetLimits() {
+	in.steps, in.budget, in.memory = 0, 0, 0
+}
+
+// tick is called by the engines when a step uses up the budget of steps
+// granted by the last check. It checks the context and the step limit,
+// and grants the steps up to the next check.
+func (in *Interpreter) tick() *RuntimeError {
+	if in.ctx != nil {
+		select {
+		case <-in.ctx.Done():
+			in.budget = 0
+			return stopped(in.ctx.Err())
+		default:
+		}
+	}
+	n := int64(checkInterval)
+	if in.limits.Steps > 0 {
+		if in.steps >= in.limits.Steps {
+			in.budget = 0
+			return stopped(ErrStepLimit)
+		}
+		n = min(n, in.limits.Steps-in.steps)
+	}
+	in.steps += n
+	// this step is the first of the n
+	in.budget = n - 1
+	return nil
+}
+
+// Alloc charges the memory obj takes to the run, and returns obj, or
+// the error that the run has exceeded its memory limit. Builtins call
+// it for the values they create.
+func (in *Interpreter) Alloc(obj Object) Object {
+	if in.limits.Memory == 0 {
+		return obj
+	}
+	if err := in.Charge(sizeOf(obj)); err != nil {
+		return err
+	}
+	return obj
+}
+
+// ReadAll reads r to the end for a builtin and charges what it read to
+// the run. It stops with a *RuntimeError as soon as that is more than
+// the memory limit leaves, rather than after reading it all, and
+// returns the errors of r as they are.
+func (in *Interpreter) ReadAll(r io.Reader) ([]byte, error) {
+	if in.limits.Memory == 0 {
+		return io.ReadAll(r)
+	}
+	left := max(in.limits.Memory-in.memory, 0)
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(io.LimitReader(r, left+1)); err != nil {
+		return nil, err
+	}
+	if err := in.Charge(int64(buf.Len())); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Charge charges n bytes to the run, and returns the error that the run
+// has exceeded its memory limit. Builtins building a value whose size
+// they know call it before they build it, so that no run builds one
+// bigger than its limit allows.
+func (in *Interpreter) Charge(n int64) *RuntimeError {
+	if in.limits.Memory == 0 {
+		return nil
+	}
+	in.memory += n
+	if in.memory > in.limits.Memory {
+		return stopped(ErrMemoryLimit)
+	}
+	return nil
+}
+
+// The sizes Alloc charges: a word, and an Object, which is an
+// interface of two words.
+const (
+	wordSize   = 8
+	objectSize = 2 * wordSize
+	// mapEntrySize is the size of a key and value in a map's index and
+	// in its list of pairs.
+	mapEntrySize = 4 * objectSize
+)
+
+// concatSize returns the size of the string the concatenation of left
+// and right builds, or 0 if they are not strings.
+func concatSize(left, right Object) int64 {
+	l, ok := left.(*String)
+	r, ok2 := right.(*String)
+	if !ok || !ok2 {
+		return 0
+	}
+	return 2*wordSize + int64(len(l.Value)+len(r.Value))
+}
+
+// sizeOf returns an estimate of the bytes obj takes, not counting the
+// values it refers to, which are charged when they are created.
+func sizeOf(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *String:
+		return 2*wordSize + int64(len(obj.Value))
+	case *Array:
+		return 3*wordSize + objectSize*int64(len(obj.Elements))
+	case *Map:
+		return 6*wordSize + mapEntrySize*int64(obj.Len())
+	case *Struct:
+		return 2*wordSize + mapEntrySize*int64(len(obj.Fields))
+	case *EnumValue:
+		return 4*wordSize + objectSize*int64(len(obj.Fields))
+	}
+	// numbers and the like are too small to count
+	return 0
+}
+
+// assignIndex assigns val to left[index], charging the entry a map
+// grows by.
+func (in *Interpreter) assignIndex(left, index, val Object) Object {
+	m, ok := left.(*Map)
+	if !ok || in.limits.Memory == 0 {
+		return evalIndexAssignment(left, index, val)
+	}
+	n := m.Len()
+	result := evalIndexAssignment(left, index, val)
+	if m.Len() > n {
+		if err := in.Charge(mapEntrySize); err != nil {
+			return err
+		}
+	}
+	return result
+}
+
+// isStopped reports whether result is an error stopping the run.
+func isStopped(result Object) bool {
+	err, ok := result.(*RuntimeError)
+	return ok && err.Err != nil
+}
+
+// stopped returns the error that stops a run because of err, which try
+// expressions do not catch.
+func stopped(err error) *RuntimeError {
+	return &RuntimeError{Message: err.Error(), Err: err}
+}
@@ -0,0 +1,260 @@
+package interpreter
+
+import "github.com/voidwyrm-2/gust/internal/parser"
+
+// Match expressions are compiled to decision trees the first time they
+// are evaluated, following Maranget's "Compiling pattern matching to
+// good decision trees". A tree tests each part of the subject at most
+// once on any path, however many arms mention it, instead of trying
+// the arms one after another.
+
+// decision is a node of a compiled match: a *switchNode, a *leafNode,
+// or nil when no arm matches.
+type decision interface{}
+
+// occurrence is the path from the subject of a match to one of the
+// values nested inside it, as a list of field indices.
+type occurrence []int
+
+// switchNode branches on the variant or literal value found at occ.
+// Values with no case of their own go to fallback.
+type switchNode struct {
+	occ      occurrence
+	cases    map[HashKey]decision
+	fallback decision
+}
+
+// leafNode selects an arm, binding the names of its pattern. If the arm
+// has a guard and it is false, matching continues with next.
+type leafNode struct {
+	arm      *parser.MatchArm
+	bindings []binding
+	next     decision
+}
+
+type binding struct {
+	name string
+	occ  occurrence
+}
+
+// clause is a row of the pattern matrix: the patterns an arm still has
+// to match against the columns of occurrences, and the names its
+// patterns have bound so far.
+type clause struct {
+	pats     []parser.Pattern
+	arm      *parser.MatchArm
+	bindings []binding
+}
+
+func (in *Interpreter) evalMatchExpression(node *parser.MatchExpression, env *Environment) Object {
+	subject := in.eval(node.Subject, env)
+	if unwinds(subject) {
+		return subject
+	}
+
+	tree, ok := in.matches[node]
+	if !ok {
+		tree = compileMatch(in.variants, []occurrence{{}}, matchRows(node))
+		in.matches[node] = tree
+	}
+
+	for tree != nil {
+		switch d := tree.(type) {
+		case *switchNode:
+			next, ok := d.cases[matchKey(valueAt(subject, d.occ))]
+			if !ok {
+				next = d.fallback
+			}
+			tree = next
+
+		case *leafNode:
+			armEnv := NewEnclosedEnvironment(env)
+			for _, b := range d.bindings {
+				armEnv.Set(b.name, valueAt(subject, b.occ))
+			}
+			if d.arm.Guard != nil {
+				guard := in.eval(d.arm.Guard, armEnv)
+				if unwinds(guard) {
+					return guard
+				}
+				if !isTruthy(guard) {
+					tree = d.next
+					continue
+				}
+			}
+			return in.evalBlockStatement(d.arm.Body, armEnv)
+		}
+	}
+
+	return newError("no match arm matched value %s", repr(subject, nil)).with(subject)
+}
+
+// matchRows returns the pattern matrix of node, one row for each arm
+// with a single column testing the subject.
+func matchRows(node *parser.MatchExpression) []clause {
+	rows := make([]clause, len(node.Arms))
+	for i, arm := range node.Arms {
+		rows[i] = clause{pats: []parser.Pattern{arm.Pattern}, arm: arm}
+	}
+	return rows
+}
+
+// compileMatch compiles the rows of a pattern matrix whose columns test
+// the values at occs. Names in variants are variants rather than
+// patterns binding a variable.
+func compileMatch(variants map[string]*VariantDef, occs []occurrence, rows []clause) decision {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	// find a column the first row tests; if there is none it matches
+	first := rows[0]
+	col := -1
+	for i, p := range first.pats {
+		if patternKey(variants, p) != nil {
+			col = i
+			break
+		}
+	}
+	if col < 0 {
+		bindings := first.bindings[:len(first.bindings):len(first.bindings)]
+		for i, p := range first.pats {
+			if id, ok := p.(*parser.IdentPattern); ok {
+				bindings = append(bindings, binding{id.Value, occs[i]})
+			}
+		}
+		leaf := &leafNode{arm: first.arm, bindings: bindings}
+		if first.arm.Guard != nil {
+			leaf.next = compileMatch(variants, occs, rows[1:])
+		}
+		return leaf
+	}
+
+	node := &switchNode{occ: occs[col], cases: map[HashKey]decision{}}
+	rest := append(append([]occurrence{}, occs[:col]...), occs[col+1:]...)
+
+	// one case for every value some row tests the column against
+	var keys []HashKey
+	arities := map[HashKey]int{}
+	for _, row := range rows {
+		if key := patternKey(variants, row.pats[col]); key != nil {
+			if _, ok := arities[*key]; !ok {
+				keys = append(keys, *key)
+				arities[*key] = len(patternArgs(row.pats[col]))
+			}
+		}
+	}
+
+	for _, key := range keys {
+		arity := arities[key]
+		children := make([]occurrence, arity)
+		for i := range children {
+			children[i] = append(append(occurrence{}, occs[col]...), i)
+		}
+
+		var specialized []clause
+		for _, row := range rows {
+			pat := row.pats[col]
+			var args []parser.Pattern
+			if k := patternKey(variants, pat); k == nil {
+				args = make([]parser.Pattern, arity)
+				for i := range args {
+					args[i] = &parser.WildcardPattern{}
+				}
+			} else if *k == key {
+				args = patternArgs(pat)
+			} else {
+				continue
+			}
+			specialized = append(specialized, row.without(col, occs[col], args))
+		}
+		node.cases[key] = compileMatch(variants, append(children, rest...), specialized)
+	}
+
+	var defaults []clause
+	for _, row := range rows {
+		if patternKey(variants, row.pats[col]) == nil {
+			defaults = append(defaults, row.without(col, occs[col], nil))
+		}
+	}
+	node.fallback = compileMatch(variants, rest, defaults)
+
+	return node
+}
+
+// without returns the row with the pattern in column col, which tests
+// occ, replaced by args at the front of the row.
+func (c clause) without(col int, occ occurrence, args []parser.Pattern) clause {
+	pats := append(append([]parser.Pattern{}, args...), c.pats[:col]...)
+	pats = append(pats, c.pats[col+1:]...)
+
+	bindings := c.bindings
+	if id, ok := c.pats[col].(*parser.IdentPattern); ok {
+		bindings = append(bindings[:len(bindings):len(bindings)], binding{id.Value, occ})
+	}
+	return clause{pats: pats, arm: c.arm, bindings: bindings}
+}
+
+// patternKey returns the key of the value p tests for, or nil if p
+// matches anything.
+func patternKey(variants map[string]*VariantDef, p parser.Pattern) *HashKey {
+	switch p := p.(type) {
+	case *parser.IdentPattern:
+		if _, ok := variants[p.Value]; ok {
+			return &HashKey{Type: ENUM_OBJ, Str: p.Value}
+		}
+	case *parser.ConstructorPattern:
+		return &HashKey{Type: ENUM_OBJ, Str: p.Name.Value}
+	case *parser.LiteralPattern:
+		if lit, ok := literalValue(p.Value).(Hashable); ok {
+			key := lit.HashKey()
+			return &key
+		}
+	}
+	return nil
+}
+
+// literalValue returns the value of the expression of a literal
+// pattern: a literal, or a negated number.
+func literalValue(exp parser.Expression) Object {
+	switch exp := exp.(type) {
+	case *parser.IntegerLiteral:
+		return &Integer{Value: exp.Value}
+	case *parser.FloatLiteral:
+		return &Float{Value: exp.Value}
+	case *parser.StringLiteral:
+		return &String{Value: exp.Value}
+	case *parser.Boolean:
+		return nativeBoolToBooleanObject(exp.Value)
+	case *parser.PrefixExpression:
+		if exp.Operator == "-" {
+			return evalPrefixExpression("-", literalValue(exp.Right))
+		}
+	}
+	return NULL
+}
+
+func patternArgs(p parser.Pattern) []parser.Pattern {
+	if cp, ok := p.(*parser.ConstructorPattern); ok {
+		return cp.Args
+	}
+	return nil
+}
+
+func matchKey(obj Object) HashKey {
+	switch obj := obj.(type) {
+	case *EnumValue:
+		return HashKey{Type: ENUM_OBJ, Str: obj.Variant.Name}
+	case Hashable:
+		return obj.HashKey()
+	}
+	return HashKey{}
+}
+
+// valueAt returns the value at occ inside subject.
+func valueAt(subject Object, occ occurrence) Object {
+	for _, i := range occ {
+		subject = subject.(*EnumValue).Fields[i]
+	}
+	return subject
+}
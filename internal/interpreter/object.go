@@ -0,0 +1,519 @@
+package interpreter
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ           = "INTEGER"
+	FLOAT_OBJ             = "FLOAT"
+	BOOLEAN_OBJ           = "BOOLEAN"
+	STRING_OBJ            = "STRING"
+	NULL_OBJ              = "NULL"
+	ARRAY_OBJ             = "ARRAY"
+	MAP_OBJ               = "MAP"
+	STRUCT_OBJ            = "STRUCT"
+	ENUM_OBJ              = "ENUM"
+	FUNCTION_OBJ          = "FUNCTION"
+	BOUND_METHOD_OBJ      = "BOUND_METHOD"
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	BUILTIN_OBJ           = "BUILTIN"
+	MODULE_OBJ            = "MODULE"
+	RETURN_VALUE_OBJ      = "RETURN_VALUE"
+	TAIL_CALL_OBJ         = "TAIL_CALL"
+	JUMP_TABLE_OBJ        = "JUMP_TABLE"
+	ITERATOR_OBJ          = "ITERATOR"
+	ERROR_OBJ             = "ERROR"
+)
+
+// Object is a Gust runtime value.
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return strconv.FormatInt(i.Value, 10) }
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string  { return strconv.FormatFloat(f.Value, 'g', -1, 64) }
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return strconv.FormatBool(b.Value) }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+// Null is the value of expressions that produce nothing, such as an
+// if without an else whose condition is false.
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+// Array is a mutable list of values. Arrays are shared by reference:
+// assigning to an element is visible through every variable that
+// refers to the array.
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string  { return inspect(a, nil) }
+
+// HashKey identifies a map key by value, so that two equal strings
+// name the same entry.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+	Str   string
+}
+
+// Hashable is implemented by the objects that may be used as map keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey { return HashKey{Type: INTEGER_OBJ, Value: uint64(i.Value)} }
+func (f *Float) HashKey() HashKey   { return HashKey{Type: FLOAT_OBJ, Value: math.Float64bits(f.Value)} }
+func (s *String) HashKey() HashKey  { return HashKey{Type: STRING_OBJ, Str: s.Value} }
+func (b *Boolean) HashKey() HashKey {
+	if b.Value {
+		return HashKey{Type: BOOLEAN_OBJ, Value: 1}
+	}
+	return HashKey{Type: BOOLEAN_OBJ}
+}
+
+type MapPair struct {
+	Key   Object
+	Value Object
+}
+
+// Map is a mutable hash map shared by reference like Array. It keeps
+// its keys in insertion order, which is the order iteration and
+// Inspect visit them in.
+type Map struct {
+	pairs map[HashKey]*MapPair
+	keys  []HashKey
+}
+
+func NewMap() *Map {
+	return &Map{pairs: map[HashKey]*MapPair{}}
+}
+
+func (m *Map) Type() ObjectType { return MAP_OBJ }
+func (m *Map) Inspect() string  { return inspect(m, nil) }
+
+func (m *Map) Len() int { return len(m.keys) }
+
+func (m *Map) Get(key Hashable) (Object, bool) {
+	pair, ok := m.pairs[key.HashKey()]
+	if !ok {
+		return nil, false
+	}
+	return pair.Value, true
+}
+
+// Set stores val under key. A new key goes to the end of the
+// iteration order; an existing key keeps its place.
+func (m *Map) Set(key Hashable, val Object) {
+	hash := key.HashKey()
+	if pair, ok := m.pairs[hash]; ok {
+		pair.Value = val
+		return
+	}
+	m.pairs[hash] = &MapPair{Key: key, Value: val}
+	m.keys = append(m.keys, hash)
+}
+
+func (m *Map) Delete(key Hashable) {
+	hash := key.HashKey()
+	if _, ok := m.pairs[hash]; !ok {
+		return
+	}
+	delete(m.pairs, hash)
+	for i, k := range m.keys {
+		if k == hash {
+			m.keys = append(m.keys[:i:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Pairs returns a snapshot of the map's entries in insertion order.
+func (m *Map) Pairs() []MapPair {
+	pairs := make([]MapPair, len(m.keys))
+	for i, hash := range m.keys {
+		pairs[i] = *m.pairs[hash]
+	}
+	return pairs
+}
+
+// StructDef describes a struct type declared by the program: its name,
+// its fields in declaration order, the methods of its impl blocks and
+// the names of the traits they implement.
+type StructDef struct {
+	Name    string
+	Fields  []string
+	Methods map[string]Object
+	Traits  map[string]bool
+}
+
+// Struct is a value of a struct type. Like arrays and maps, structs
+// are shared by reference, so a method may modify its receiver.
+type Struct struct {
+	Def    *StructDef
+	Fields map[string]Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string  { return inspect(s, nil) }
+
+// EnumDef describes an enum type declared by the program.
+type EnumDef struct {
+	Name     string
+	Variants []*VariantDef
+}
+
+// VariantDef is a variant of an enum and the number of fields its
+// payload has.
+type VariantDef struct {
+	Name  string
+	Enum  *EnumDef
+	Arity int
+}
+
+// EnumValue is a value of an enum type: one of its variants and the
+// values of that variant's payload.
+type EnumValue struct {
+	Variant *VariantDef
+	Fields  []Object
+}
+
+func (e *EnumValue) Type() ObjectType { return ENUM_OBJ }
+func (e *EnumValue) Inspect() string  { return inspect(e, nil) }
+
+type Function struct {
+	Name       string
+	Parameters []*parser.Identifier
+	Body       *parser.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	if f.Name != "" {
+		return "fn " + f.Name
+	}
+	return "fn"
+}
+
+// CompiledFunction is a function compiled to bytecode for the VM. Lines
+// maps its instructions back to the source positions they came from.
+type CompiledFunction struct {
+	Name         string
+	Instructions Instructions
+	NumLocals    int
+	NumParams    int
+	Upvalues     []UpvalueRef
+	Lines        []LineInfo
+	// bc is the bytecode whose constants, structs and enums the
+	// instructions refer to.
+	bc *Bytecode
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string  { return "compiled fn " + cf.Name }
+
+// UpvalueRef says where a closure of a compiled function gets one of
+// its upvalues from when it is created: a local of the enclosing
+// function, or an upvalue of the enclosing closure.
+type UpvalueRef struct {
+	Local bool
+	Index int
+}
+
+// LineInfo is the source position of the instructions starting at
+// Offset, up to the next LineInfo.
+type LineInfo struct {
+	Offset int
+	Pos    lexer.Position
+}
+
+// Closure is a compiled function with the variables it captured.
+type Closure struct {
+	Fn       *CompiledFunction
+	Upvalues []*Upvalue
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	if c.Fn.Name != "" {
+		return "fn " + c.Fn.Name
+	}
+	return "fn"
+}
+
+// BoundMethod is a method selected from a struct value, `p.len`.
+// Calling it passes Receiver as the method's self parameter.
+type BoundMethod struct {
+	Receiver Object
+	Method   Object
+}
+
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+func (bm *BoundMethod) Inspect() string  { return bm.Method.Inspect() }
+
+type BuiltinFunction func(in *Interpreter, args ...Object) Object
+
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
+
+// Module is a global holding the functions and values of a module a
+// host program declares, which programs read with `name.member`.
+type Module struct {
+	Name    string
+	Members map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module " + m.Name }
+
+// ReturnValue wraps the value of a return statement while it unwinds
+// to the enclosing function call.
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// tailCall is the value of `return f(x)` in a function that can leave
+// the call to its caller. It unwinds as the value of a ReturnValue to
+// the function's activation in apply, which then calls Fn in its place
+// so that recursion in tail position does not grow the stack.
+type tailCall struct {
+	Fn   Object
+	Args []Object
+}
+
+func (tc *tailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (tc *tailCall) Inspect() string  { return "tail call" }
+
+// The builtin enums Option[T] { Some(T), None } and
+// Result[T, E] { Ok(T), Err(E) }.
+var (
+	optionDef   = &EnumDef{Name: "Option"}
+	someVariant = optionDef.variant("Some", 1)
+	noneVariant = optionDef.variant("None", 0)
+
+	resultDef  = &EnumDef{Name: "Result"}
+	okVariant  = resultDef.variant("Ok", 1)
+	errVariant = resultDef.variant("Err", 1)
+)
+
+func (e *EnumDef) variant(name string, arity int) *VariantDef {
+	v := &VariantDef{Name: name, Enum: e, Arity: arity}
+	e.Variants = append(e.Variants, v)
+	return v
+}
+
+// NewOk and NewErr return the Result values Ok(val) and Err(val).
+func NewOk(val Object) *EnumValue  { return &EnumValue{Variant: okVariant, Fields: []Object{val}} }
+func NewErr(val Object) *EnumValue { return &EnumValue{Variant: errVariant, Fields: []Object{val}} }
+
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+func nativeBoolToBooleanObject(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+// unwinds reports whether obj is an error or a value being returned
+// from the enclosing function, either of which ends the evaluation of
+// every expression it passes through on the way.
+func unwinds(obj Object) bool {
+	if obj == nil {
+		return false
+	}
+	t := obj.Type()
+	return t == ERROR_OBJ || t == RETURN_VALUE_OBJ
+}
+
+// repr formats obj the way it would be written in source code, quoting
+// strings. It is used for values nested inside other values, of which
+// active holds the ones being formatted.
+func repr(obj Object, active map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *String:
+		return strconv.Quote(obj.Value)
+	case *Array, *Map, *Struct, *EnumValue:
+		return inspect(obj, active)
+	}
+	return obj.Inspect()
+}
+
+// inspect formats the array, map, struct or enum value obj for its
+// Inspect method. A value found inside itself, as one of active, is
+// printed as <cycle>.
+func inspect(obj Object, active map[Object]bool) string {
+	if active[obj] {
+		return "<cycle>"
+	}
+	if active == nil {
+		active = map[Object]bool{}
+	}
+	active[obj] = true
+	defer delete(active, obj)
+
+	switch obj := obj.(type) {
+	case *Array:
+		elements := make([]string, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = repr(el, active)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *Map:
+		pairs := make([]string, len(obj.keys))
+		for i, pair := range obj.Pairs() {
+			pairs[i] = repr(pair.Key, active) + ": " + repr(pair.Value, active)
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *Struct:
+		fields := make([]string, len(obj.Def.Fields))
+		for i, name := range obj.Def.Fields {
+			fields[i] = name + ": " + repr(obj.Fields[name], active)
+		}
+		return obj.Def.Name + "{" + strings.Join(fields, ", ") + "}"
+	case *EnumValue:
+		if len(obj.Fields) == 0 {
+			return obj.Variant.Name
+		}
+		fields := make([]string, len(obj.Fields))
+		for i, field := range obj.Fields {
+			fields[i] = repr(field, active)
+		}
+		return obj.Variant.Name + "(" + strings.Join(fields, ", ") + ")"
+	}
+	return obj.Inspect()
+}
+
+// Equal reports whether a and b are equal values, as == compares
+// them. Arrays are compared element by element, maps entry by entry,
+// and structs and enum values field by field. Values that contain
+// themselves are equal where their cycles line up.
+func Equal(a, b Object) bool {
+	return equal(a, b, nil)
+}
+
+// equal is Equal, assuming the pairs of values in seen, which are
+// already being compared, to be equal.
+func equal(a, b Object, seen map[[2]Object]bool) bool {
+	switch a.(type) {
+	case *Array, *Map, *Struct, *EnumValue:
+		pair := [2]Object{a, b}
+		if seen[pair] {
+			return true
+		}
+		if seen == nil {
+			seen = map[[2]Object]bool{}
+		}
+		seen[pair] = true
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *Float:
+		b, ok := b.(*Float)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !equal(a.Elements[i], b.Elements[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *Map:
+		b, ok := b.(*Map)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for hash, pair := range a.pairs {
+			other, ok := b.pairs[hash]
+			if !ok || !equal(pair.Value, other.Value, seen) {
+				return false
+			}
+		}
+		return true
+	case *Struct:
+		b, ok := b.(*Struct)
+		if !ok || a.Def != b.Def {
+			return false
+		}
+		for _, name := range a.Def.Fields {
+			if !equal(a.Fields[name], b.Fields[name], seen) {
+				return false
+			}
+		}
+		return true
+	case *EnumValue:
+		b, ok := b.(*EnumValue)
+		if !ok || a.Variant != b.Variant {
+			return false
+		}
+		for i := range a.Fields {
+			if !equal(a.Fields[i], b.Fields[i], seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,863 @@
+package interpreter
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+)
+
+// machine is the virtual machine running bytecode for an Interpreter.
+// It has a single value stack, on which every call frame keeps its
+// locals followed by the temporary values of the expressions it is
+// evaluating.
+//
+// The machine shares the objects, builtins and runtime errors of the
+// tree-walking engine, and follows the same rules for call depth,
+// deferred calls, tail calls and the stacks of runtime errors, so that
+// programs behave the same on both.
+type machine struct {
+	in *Interpreter
+
+	stack  []Object
+	sp     int
+	frames []frame
+	// handlers are the try expressions whose bodies are running,
+	// innermost last.
+	handlers []handler
+	// open are the upvalues still referring to stack slots, by slot.
+	open []*Upvalue
+}
+
+// frame is an active call. Builtins get a frame without a closure, so
+// that they appear in stacks as they do in the tree-walking engine.
+type frame struct {
+	cl   *Closure
+	name string
+	ip   int
+	// bp is the stack slot of the first local; the function called is
+	// in the slot below it.
+	bp int
+	// pos is where the function was called from.
+	pos    lexer.Position
+	defers []deferred
+}
+
+// handler is the catch block of a try expression in the frame with the
+// given index, and the stack height to restore before running it.
+type handler struct {
+	frame int
+	sp    int
+	ip    int
+}
+
+// Upvalue is a variable captured by a closure. While the variable is a
+// local of a running function the upvalue is open and refers to its
+// stack slot; when the function returns or the loop iteration declaring
+// it ends, the upvalue is closed and holds the value itself.
+type Upvalue struct {
+	slot   int
+	value  Object
+	closed bool
+}
+
+// jumpTable is the operand of an OpSwitch: the offset of the code for
+// each variant or literal value, and for the values with no case.
+type jumpTable struct {
+	Cases   map[HashKey]int
+	Default int
+}
+
+func (jt *jumpTable) Type() ObjectType { return JUMP_TABLE_OBJ }
+func (jt *jumpTable) Inspect() string  { return "jump table" }
+
+// iterator is the state of a for-in loop.
+type iterator struct {
+	pairs []MapPair
+	isMap bool
+	next  int
+}
+
+func (it *iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *iterator) Inspect() string  { return "iterator" }
+
+// globalSlot returns the slot of the global called name in the VM,
+// allocating one if it has none.
+func (in *Interpreter) globalSlot(name string) int {
+	if slot, ok := in.globalSlots[name]; ok {
+		return slot
+	}
+	slot := len(in.globalNames)
+	in.globalSlots[name] = slot
+	in.globalNames = append(in.globalNames, name)
+	in.globalValues = append(in.globalValues, nil)
+	return slot
+}
+
+// RunBytecode runs bytecode on the VM, whatever the interpreter's
+// engine. It may come from Compile or from a bytecode file, in which
+// case its structs and enums are declared in the interpreter as Compile
+// would have. Bytecode from a file must run on an interpreter that has
+// not run other programs, as its globals are numbered from scratch.
+func (in *Interpreter) RunBytecode(bc *Bytecode) (Object, error) {
+	for slot, name := range bc.Globals {
+		if in.globalSlot(name) != slot {
+			return nil, fmt.Errorf("the global %s of the bytecode is numbered differently in the interpreter", name)
+		}
+	}
+	for _, def := range bc.Structs {
+		in.structs[def.Name] = def
+	}
+	for _, def := range bc.Enums {
+		for _, variant := range def.Variants {
+			in.variants[variant.Name] = variant
+		}
+	}
+	return in.execute(bc)
+}
+
+// execute runs bytecode compiled by Compile.
+func (in *Interpreter) execute(bc *Bytecode) (Object, error) {
+	return in.runMachine(func(m *machine) Object {
+		m.push(&Closure{Fn: bc.Main})
+		if err := m.enter(m.stack[0], 0, "main", lexer.Position{}); err != nil {
+			return err
+		}
+		return m.run(0)
+	})
+}
+
+// runMachine runs body on a new VM and returns its result, or the
+// runtime error it raised. The global environment is copied into the
+// VM's global slots before it runs, and back after.
+func (in *Interpreter) runMachine(body func(m *machine) Object) (result Object, err error) {
+	for name, val := range in.globals.store {
+		in.globalValues[in.globalSlot(name)] = val
+	}
+
+	m := &machine{in: in, stack: make([]Object, 1024)}
+	in.resetLimits()
+	in.vm = m
+	defer in.endRun()
+	defer func() {
+		in.vm = nil
+		for slot, val := range in.globalValues {
+			if val != nil {
+				in.globals.store[in.globalNames[slot]] = val
+			}
+		}
+		if r := recover(); r != nil {
+			rerr := in.recovered(r, m.trace(lexer.Position{}))
+			rerr.File = in.file
+			result, err = nil, rerr
+		}
+	}()
+
+	result = body(m)
+	if rerr, ok := result.(*RuntimeError); ok {
+		if rerr.Stack == nil {
+			rerr.Stack = []Frame{{Function: "main"}}
+		}
+		rerr.File = in.file
+		return nil, rerr
+	}
+	return result, nil
+}
+
+func (m *machine) push(obj Object) {
+	if m.sp == len(m.stack) {
+		m.stack = append(m.stack, make([]Object, len(m.stack))...)
+	}
+	m.stack[m.sp] = obj
+	m.sp++
+}
+
+func (m *machine) pop() Object {
+	m.sp--
+	return m.stack[m.sp]
+}
+
+// reserve grows the stack to at least n slots.
+func (m *machine) reserve(n int) {
+	if n > len(m.stack) {
+		m.stack = append(m.stack, make([]Object, n+len(m.stack))...)
+	}
+}
+
+// pos returns the position of the instruction the innermost frame is
+// executing.
+func (m *machine) pos() lexer.Position {
+	f := &m.frames[len(m.frames)-1]
+	if f.cl == nil {
+		return lexer.Position{}
+	}
+	return f.cl.Fn.posAt(f.ip - 1)
+}
+
+// posAt returns the position of the instruction at offset.
+func (cf *CompiledFunction) posAt(offset int) lexer.Position {
+	i := sort.Search(len(cf.Lines), func(i int) bool { return cf.Lines[i].Offset > offset })
+	if i == 0 {
+		return lexer.Position{}
+	}
+	return cf.Lines[i-1].Pos
+}
+
+// trace returns the frames of the active calls, innermost first, with
+// the innermost executing at pos.
+func (m *machine) trace(pos lexer.Position) []Frame {
+	frames := make([]Frame, 0, len(m.frames))
+	for i := len(m.frames) - 1; i >= 0; i-- {
+		frames = append(frames, Frame{Function: m.frames[i].name, Pos: pos})
+		pos = m.frames[i].pos
+	}
+	return frames
+}
+
+// call calls fn with args from pos and returns its result, running the
+// machine until it returns. Builtins call functions through it.
+func (m *machine) call(fn Object, args []Object, pos lexer.Position) Object {
+	base, sp := len(m.frames), m.sp
+	m.push(fn)
+	for _, arg := range args {
+		m.push(arg)
+	}
+	if err := m.callValue(len(args), pos); err != nil {
+		m.sp = sp
+		return err
+	}
+	if len(m.frames) == base {
+		return m.pop()
+	}
+	return m.run(base)
+}
+
+// callValue calls the function below the argc arguments on top of the
+// stack from pos.
+func (m *machine) callValue(argc int, pos lexer.Position) *RuntimeError {
+	fn := m.stack[m.sp-1-argc]
+	name, ok := functionName(fn)
+	if !ok {
+		return newError("not a function: %s", fn.Type()).with(fn)
+	}
+	if len(m.frames) > m.in.maxDepth {
+		return newError("stack overflow in fn %s", name)
+	}
+	return m.enter(fn, argc, name, pos)
+}
+
+// enter makes the call of callValue without checking the call depth,
+// which tail calls do not add to. A closure gets a new frame that run
+// goes on to execute; a builtin is called right away and its result
+// replaces it and its arguments on the stack.
+func (m *machine) enter(fn Object, argc int, name string, pos lexer.Position) *RuntimeError {
+	for {
+		switch f := fn.(type) {
+		case *Closure:
+			if argc != f.Fn.NumParams {
+				return newError("wrong number of arguments to %s: want=%d, got=%d",
+					f.Inspect(), f.Fn.NumParams, argc)
+			}
+			bp := m.sp - argc
+			m.reserve(bp + f.Fn.NumLocals)
+			for i := m.sp; i < bp+f.Fn.NumLocals; i++ {
+				m.stack[i] = nil
+			}
+			m.sp = bp + f.Fn.NumLocals
+			m.frames = append(m.frames, frame{cl: f, name: name, bp: bp, pos: pos})
+			return nil
+
+		case *BoundMethod:
+			// the receiver becomes the first argument
+			m.reserve(m.sp + 1)
+			first := m.sp - argc
+			copy(m.stack[first+1:], m.stack[first:m.sp])
+			m.stack[first] = f.Receiver
+			m.stack[first-1] = f.Method
+			m.sp++
+			argc++
+			fn = f.Method
+
+		case *Builtin:
+			args := make([]Object, argc)
+			copy(args, m.stack[m.sp-argc:m.sp])
+			m.sp -= argc + 1
+
+			m.frames = append(m.frames, frame{name: name, pos: pos})
+			result := f.Fn(m.in, args...)
+			m.frames = m.frames[:len(m.frames)-1]
+
+			if err, ok := result.(*RuntimeError); ok {
+				return err
+			}
+			m.push(result)
+			return nil
+
+		case *Function:
+			return newError("%s was created by the tree-walking engine and cannot be called by the VM", f.Inspect())
+
+		default:
+			return newError("not a function: %s", fn.Type()).with(fn)
+		}
+	}
+}
+
+// capture returns the open upvalue for the stack slot, creating it if
+// no closure has captured the slot yet.
+func (m *machine) capture(slot int) *Upvalue {
+	i := len(m.open)
+	for i > 0 && m.open[i-1].slot >= slot {
+		if m.open[i-1].slot == slot {
+			return m.open[i-1]
+		}
+		i--
+	}
+	u := &Upvalue{slot: slot}
+	m.open = append(m.open, nil)
+	copy(m.open[i+1:], m.open[i:])
+	m.open[i] = u
+	return u
+}
+
+// closeUpvalues closes the open upvalues of the stack slots from slot
+// up.
+func (m *machine) closeUpvalues(slot int) {
+	for len(m.open) > 0 && m.open[len(m.open)-1].slot >= slot {
+		u := m.open[len(m.open)-1]
+		u.value, u.closed = m.stack[u.slot], true
+		m.open = m.open[:len(m.open)-1]
+	}
+}
+
+func (m *machine) upvalue(u *Upvalue) Object {
+	if u.closed {
+		return u.value
+	}
+	return m.stack[u.slot]
+}
+
+func (m *machine) setUpvalue(u *Upvalue, val Object) {
+	if u.closed {
+		u.value = val
+	} else {
+		m.stack[u.slot] = val
+	}
+}
+
+// popFrame removes the innermost frame, with the try expressions in it,
+// closing the upvalues of its locals.
+func (m *machine) popFrame() {
+	i := len(m.frames) - 1
+	for len(m.handlers) > 0 && m.handlers[len(m.handlers)-1].frame == i {
+		m.handlers = m.handlers[:len(m.handlers)-1]
+	}
+	m.closeUpvalues(m.frames[i].bp)
+	m.sp = m.frames[i].bp - 1
+	m.frames = m.frames[:i]
+}
+
+// runDefers makes the calls deferred by the frame with index i once it
+// has finished with result, as runDefers does for the tree-walking
+// engine.
+func (m *machine) runDefers(i int, result Object) Object {
+	for len(m.frames[i].defers) > 0 {
+		f := &m.frames[i]
+		d := f.defers[len(f.defers)-1]
+		f.defers = f.defers[:len(f.defers)-1]
+
+		if err, ok := m.call(d.fn, d.args, d.pos).(*RuntimeError); ok && !isStopped(result) {
+			if err.Stack == nil {
+				err.Stack = m.trace(d.pos)
+			}
+			result = err
+		}
+	}
+	return result
+}
+
+// ret returns result from the innermost frame. It reports whether that
+// frame was the one run was called for, and if so what run returns.
+func (m *machine) ret(result Object, stop int) (Object, bool) {
+	i := len(m.frames) - 1
+	if len(m.frames[i].defers) > 0 {
+		result = m.runDefers(i, result)
+	}
+	m.popFrame()
+
+	if err, ok := result.(*RuntimeError); ok {
+		if err := m.throw(err, stop); err != nil {
+			return err, true
+		}
+		return nil, false
+	}
+	if len(m.frames) == stop {
+		return result, true
+	}
+	m.push(result)
+	return nil, false
+}
+
+// throw raises err in the innermost frame. If a try expression in one
+// of the frames run was called for catches it, the frames above unwind,
+// running their deferred calls, and execution goes on in its catch
+// block. Otherwise all those frames unwind and throw returns the error
+// for run to return, as it always does for an error stopping the run.
+func (m *machine) throw(err *RuntimeError, stop int) *RuntimeError {
+	if err.Stack == nil && len(m.frames) > stop {
+		err.Stack = m.trace(m.pos())
+	}
+
+	floor, h := stop, -1
+	if n := len(m.handlers); n > 0 && m.handlers[n-1].frame >= stop && err.Err == nil {
+		h = n - 1
+		floor = m.handlers[h].frame + 1
+	}
+	for len(m.frames) > floor {
+		if len(m.frames[len(m.frames)-1].defers) > 0 {
+			err = m.runDefers(len(m.frames)-1, err).(*RuntimeError)
+		}
+		m.popFrame()
+	}
+	if h < 0 {
+		return err
+	}
+
+	catch := m.handlers[h]
+	m.handlers = m.handlers[:h]
+	m.sp = catch.sp
+	m.push(&String{Value: err.Message})
+	m.frames[catch.frame].ip = catch.ip
+	return nil
+}
+
+// run executes instructions until the frame with index stop returns,
+// and returns its result or the runtime error it raised.
+func (m *machine) run(stop int) Object {
+	f := &m.frames[len(m.frames)-1]
+	code, bc := f.cl.Fn.Instructions, f.cl.Fn.bc
+
+	for {
+		if m.in.budget--; m.in.budget < 0 {
+			if err := m.in.tick(); err != nil {
+				err.Stack = m.trace(f.cl.Fn.posAt(f.ip))
+				return m.throw(err, stop)
+			}
+		}
+
+		var err *RuntimeError
+		op := Opcode(code[f.ip])
+		f.ip++
+
+		switch op {
+		case OpConstant:
+			m.push(bc.Constants[readUint16(code[f.ip:])])
+			f.ip += 2
+
+		case OpNull:
+			m.push(NULL)
+		case OpTrue:
+			m.push(TRUE)
+		case OpFalse:
+			m.push(FALSE)
+		case OpPop:
+			m.sp--
+
+		case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpConcat, OpEqual, OpNotEqual, OpLess, OpGreater:
+			right := m.pop()
+			left := m.pop()
+			err = m.binary(op, left, right)
+
+		case OpBinaryLocalConst:
+			left := m.stack[f.bp+int(readUint16(code[f.ip+1:]))]
+			right := bc.Constants[readUint16(code[f.ip+3:])]
+			err = m.binary(Opcode(code[f.ip]), left, right)
+			f.ip += 5
+
+		case OpBinaryLocals:
+			left := m.stack[f.bp+int(readUint16(code[f.ip+1:]))]
+			right := m.stack[f.bp+int(readUint16(code[f.ip+3:]))]
+			err = m.binary(Opcode(code[f.ip]), left, right)
+			f.ip += 5
+
+		case OpMinus:
+			right := m.pop()
+			err = m.pushResult(withValues(evalPrefixExpression("-", right), right))
+		case OpBang:
+			m.stack[m.sp-1] = nativeBoolToBooleanObject(!isTruthy(m.stack[m.sp-1]))
+		case OpBool:
+			m.stack[m.sp-1] = nativeBoolToBooleanObject(isTruthy(m.stack[m.sp-1]))
+
+		case OpJump:
+			f.ip = int(readUint32(code[f.ip:]))
+		case OpJumpNotTruthy:
+			if isTruthy(m.pop()) {
+				f.ip += 4
+			} else {
+				f.ip = int(readUint32(code[f.ip:]))
+			}
+
+		case OpGetGlobal:
+			slot := readUint16(code[f.ip:])
+			f.ip += 2
+			val := m.in.globalValues[slot]
+			if val == nil {
+				// a global declared later in the program may shadow a
+				// builtin that is used before it
+				name := m.in.globalNames[slot]
+				if b, ok := builtins[name]; ok {
+					val = b
+				} else {
+					err = newError("identifier not found: %s", name)
+					break
+				}
+			}
+			m.push(val)
+		case OpSetGlobal:
+			m.in.globalValues[readUint16(code[f.ip:])] = m.pop()
+			f.ip += 2
+
+		case OpGetLocal:
+			m.push(m.stack[f.bp+int(readUint16(code[f.ip:]))])
+			f.ip += 2
+		case OpSetLocal:
+			m.stack[f.bp+int(readUint16(code[f.ip:]))] = m.pop()
+			f.ip += 2
+
+		case OpGetUpvalue:
+			m.push(m.upvalue(f.cl.Upvalues[code[f.ip]]))
+			f.ip++
+		case OpSetUpvalue:
+			m.setUpvalue(f.cl.Upvalues[code[f.ip]], m.pop())
+			f.ip++
+
+		case OpGetBuiltin:
+			m.push(builtins[builtinNames[code[f.ip]]])
+			f.ip++
+
+		case OpCloseUpvalues:
+			m.closeUpvalues(f.bp + int(readUint16(code[f.ip:])))
+			f.ip += 2
+
+		case OpClosure:
+			fn := bc.Constants[readUint16(code[f.ip:])].(*CompiledFunction)
+			f.ip += 2
+			cl := &Closure{Fn: fn, Upvalues: make([]*Upvalue, len(fn.Upvalues))}
+			for i, ref := range fn.Upvalues {
+				if ref.Local {
+					cl.Upvalues[i] = m.capture(f.bp + ref.Index)
+				} else {
+					cl.Upvalues[i] = f.cl.Upvalues[ref.Index]
+				}
+			}
+			m.push(cl)
+
+		case OpError:
+			err = newError("%s", bc.Constants[readUint16(code[f.ip:])].Inspect())
+			f.ip += 2
+
+		case OpArray:
+			n := int(readUint16(code[f.ip:]))
+			f.ip += 2
+			elements := make([]Object, n)
+			copy(elements, m.stack[m.sp-n:m.sp])
+			m.sp -= n
+			err = m.pushResult(m.in.Alloc(&Array{Elements: elements}))
+
+		case OpMap:
+			n := int(readUint16(code[f.ip:]))
+			f.ip += 2
+			mp := NewMap()
+			for i := m.sp - 2*n; i < m.sp; i += 2 {
+				key, ok := m.stack[i].(Hashable)
+				if !ok {
+					err = newError("unusable as map key: %s", m.stack[i].Type())
+					break
+				}
+				mp.Set(key, m.stack[i+1])
+			}
+			m.sp -= 2 * n
+			if err == nil {
+				err = m.pushResult(m.in.Alloc(mp))
+			}
+
+		case OpStruct:
+			def := bc.Structs[readUint16(code[f.ip:])]
+			fields := bc.Constants[readUint16(code[f.ip+2:])].(*Array).Elements
+			f.ip += 4
+			s := &Struct{Def: def, Fields: make(map[string]Object, len(def.Fields))}
+			for i, field := range fields {
+				s.Fields[field.(*String).Value] = m.stack[m.sp-len(fields)+i]
+			}
+			m.sp -= len(fields)
+			err = m.pushResult(m.in.Alloc(s))
+
+		case OpVariant:
+			def := bc.Enums[readUint16(code[f.ip:])]
+			m.push(variantValue(def.Variants[code[f.ip+2]]))
+			f.ip += 3
+
+		case OpIndex:
+			index := m.pop()
+			left := m.pop()
+			err = m.pushResult(withValues(evalIndexExpression(left, index), index))
+
+		case OpSetIndex:
+			index := m.pop()
+			left := m.pop()
+			val := m.pop()
+			if result, ok := m.in.assignIndex(left, index, val).(*RuntimeError); ok {
+				err = result.with(index)
+			}
+
+		case OpSlice:
+			flags := code[f.ip]
+			f.ip++
+			var low, high Object
+			if flags&sliceHigh != 0 {
+				high = m.pop()
+			}
+			if flags&sliceLow != 0 {
+				low = m.pop()
+			}
+			err = m.pushResult(m.in.Alloc(evalSlice(m.pop(), low, high)))
+
+		case OpGetField:
+			name := bc.Constants[readUint16(code[f.ip:])].(*String).Value
+			f.ip += 2
+			err = m.pushResult(evalSelectorExpression(m.pop(), name))
+
+		case OpSetField:
+			name := bc.Constants[readUint16(code[f.ip:])].(*String).Value
+			f.ip += 2
+			left := m.pop()
+			if result, ok := evalFieldAssignment(left, name, m.pop()).(*RuntimeError); ok {
+				err = result
+			}
+
+		case OpCommaOk:
+			target := int(readUint32(code[f.ip:]))
+			f.ip += 4
+			key := m.pop()
+			val, found, e := lookupCommaOk(m.pop(), key)
+			if e != nil {
+				err = e
+				break
+			}
+			if found {
+				m.push(val)
+				m.push(TRUE)
+				f.ip = target
+			}
+
+		case OpCall:
+			argc := int(code[f.ip])
+			f.ip++
+			err = m.callValue(argc, m.pos())
+			f = &m.frames[len(m.frames)-1]
+			code, bc = f.cl.Fn.Instructions, f.cl.Fn.bc
+
+		case OpCallable:
+			if fn := m.stack[m.sp-1]; !callable(fn) {
+				err = newError("not a function: %s", fn.Type()).with(fn)
+			}
+
+		case OpTailCall:
+			argc := int(code[f.ip])
+			f.ip++
+			var result Object
+			var done bool
+			result, done, err = m.tailCall(argc, stop)
+			if done {
+				return result
+			}
+			f = &m.frames[len(m.frames)-1]
+			code, bc = f.cl.Fn.Instructions, f.cl.Fn.bc
+
+		case OpReturn:
+			if result, done := m.ret(m.pop(), stop); done {
+				return result
+			}
+			f = &m.frames[len(m.frames)-1]
+			code, bc = f.cl.Fn.Instructions, f.cl.Fn.bc
+
+		case OpDefer:
+			argc := int(code[f.ip])
+			f.ip++
+			args := make([]Object, argc)
+			copy(args, m.stack[m.sp-argc:m.sp])
+			fn := m.stack[m.sp-argc-1]
+			m.sp -= argc + 1
+			f.defers = append(f.defers, deferred{fn: fn, args: args, pos: m.pos()})
+
+		case OpUnwrap:
+			switch result := evalTryExpression(m.pop()).(type) {
+			case *RuntimeError:
+				err = result
+			case *ReturnValue:
+				if result, done := m.ret(result.Value, stop); done {
+					return result
+				}
+				f = &m.frames[len(m.frames)-1]
+				code, bc = f.cl.Fn.Instructions, f.cl.Fn.bc
+			default:
+				m.push(result)
+			}
+
+		case OpTry:
+			m.handlers = append(m.handlers, handler{frame: len(m.frames) - 1, sp: m.sp, ip: int(readUint32(code[f.ip:]))})
+			f.ip += 4
+		case OpEndTry:
+			m.handlers = m.handlers[:len(m.handlers)-1]
+
+		case OpIter:
+			iterable := m.pop()
+			pairs, e := rangePairs(iterable)
+			if e != nil {
+				err = e
+				break
+			}
+			_, isMap := iterable.(*Map)
+			m.push(&iterator{pairs: pairs, isMap: isMap})
+
+		case OpNext:
+			it := m.stack[m.sp-1].(*iterator)
+			if it.next == len(it.pairs) {
+				m.sp--
+				f.ip = int(readUint32(code[f.ip+1:]))
+				break
+			}
+			pair := it.pairs[it.next]
+			it.next++
+			switch {
+			case code[f.ip] == 1:
+				m.push(pair.Key)
+				m.push(pair.Value)
+			case it.isMap:
+				m.push(pair.Key)
+			default:
+				m.push(pair.Value)
+			}
+			f.ip += 5
+
+		case OpSwitch:
+			table := bc.Constants[readUint16(code[f.ip:])].(*jumpTable)
+			target, ok := table.Cases[matchKey(m.pop())]
+			if !ok {
+				target = table.Default
+			}
+			f.ip = target
+		case OpVariantField:
+			m.stack[m.sp-1] = m.stack[m.sp-1].(*EnumValue).Fields[code[f.ip]]
+			f.ip++
+		case OpNoMatch:
+			subject := m.pop()
+			err = newError("no match arm matched value %s", repr(subject, nil)).with(subject)
+
+		default:
+			err = newError("unknown opcode %d", op)
+		}
+
+		if err != nil {
+			if err := m.throw(err, stop); err != nil {
+				return err
+			}
+			f = &m.frames[len(m.frames)-1]
+			code, bc = f.cl.Fn.Instructions, f.cl.Fn.bc
+		}
+	}
+}
+
+// pushResult pushes the result of an operation, unless it is an error,
+// which it returns.
+func (m *machine) pushResult(result Object) *RuntimeError {
+	if err, ok := result.(*RuntimeError); ok {
+		return err
+	}
+	m.push(result)
+	return nil
+}
+
+// binary pushes the result of the binary operator op on left and right,
+// charging the string of a concatenation before it is built.
+func (m *machine) binary(op Opcode, left, right Object) *RuntimeError {
+	if op == OpConcat {
+		if err := m.in.Charge(concatSize(left, right)); err != nil {
+			return err
+		}
+		return m.pushResult(binaryOp(op, left, right))
+	}
+	return m.pushResult(m.in.Alloc(binaryOp(op, left, right)))
+}
+
+// tailCall makes the call of an OpTailCall. The callee takes over the
+// frame of the function returning, unless that is the top level or has
+// deferred calls, in which case the call is an ordinary one. It reports
+// whether the frame run was called for has returned, with the result
+// run returns.
+func (m *machine) tailCall(argc, stop int) (Object, bool, *RuntimeError) {
+	i := len(m.frames) - 1
+	f := &m.frames[i]
+	fn := m.stack[m.sp-1-argc]
+	if i == 0 || len(f.defers) > 0 {
+		return nil, false, m.callValue(argc, m.pos())
+	}
+
+	name, ok := functionName(fn)
+	if !ok {
+		// reported at the return statement, the OpReturn after the call
+		f.ip++
+		return nil, false, newError("not a function: %s", fn.Type()).with(fn)
+	}
+
+	// the callee and its arguments replace the frame
+	pos, base := f.pos, f.bp-1
+	m.closeUpvalues(f.bp)
+	copy(m.stack[base:], m.stack[m.sp-1-argc:m.sp])
+	m.popFrame()
+	m.sp = base + 1 + argc
+
+	if err := m.enter(fn, argc, name, pos); err != nil {
+		if len(m.frames) == stop {
+			m.sp = base
+			return err, true, nil
+		}
+		return nil, false, err
+	}
+	if len(m.frames) == stop {
+		// a builtin returned into the caller of run
+		return m.pop(), true, nil
+	}
+	return nil, false, nil
+}
+
+// callable reports whether fn is a function.
+func callable(fn Object) bool {
+	_, ok := functionName(fn)
+	return ok
+}
+
+// binaryOp applies the operator of a binary opcode, with a fast path
+// for integers.
+func binaryOp(op Opcode, left, right Object) Object {
+	if l, ok := left.(*Integer); ok {
+		if r, ok := right.(*Integer); ok {
+			switch op {
+			case OpAdd:
+				return &Integer{Value: l.Value + r.Value}
+			case OpSub:
+				return &Integer{Value: l.Value - r.Value}
+			case OpMul:
+				return &Integer{Value: l.Value * r.Value}
+			case OpLess:
+				return nativeBoolToBooleanObject(l.Value < r.Value)
+			case OpGreater:
+				return nativeBoolToBooleanObject(l.Value > r.Value)
+			case OpEqual:
+				return nativeBoolToBooleanObject(l.Value == r.Value)
+			case OpNotEqual:
+				return nativeBoolToBooleanObject(l.Value != r.Value)
+			}
+		}
+	}
+	return withValues(evalInfixOperator(binaryOperators[op], left, right), left, right)
+}
@@ -1,12 +1,32 @@
 package lexer
 
-import "unicode"
+import (
+	"fmt"
+	"unicode"
+)
 
 type TokenType int
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Pos     Position  `json:"pos"`
+}
+
+// Position is the 1-based line and column of the first character
+// of a token in the lexer input. The zero value means no position.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -14,6 +34,7 @@ const (
 	EOF
 	IDENT
 	INT
+	FLOAT
 	STRING
 	ASSIGN
 	PLUS
@@ -34,30 +55,141 @@ const (
 	SEMICOLON
 	COMMA
 	COLON
+	DOT
+	QUESTION
 	LEFT_PAREN
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	ARROW
+	FAT_ARROW
 	FUNCTION
 	LET
 	RETURN
 	FOR
+	IN
 	IF
 	ELSE
+	STRUCT
+	IMPL
+	ENUM
+	TRAIT
+	DEFER
+	TRY
+	CATCH
+	MATCH
 	TRUE
 	FALSE
 	COMMENT_SINGLE
 	COMMENT_MULTI
 )
 
+var tokenNames = [...]string{
+	ILLEGAL:        "ILLEGAL",
+	EOF:            "EOF",
+	IDENT:          "IDENT",
+	INT:            "INT",
+	FLOAT:          "FLOAT",
+	STRING:         "STRING",
+	ASSIGN:         "ASSIGN",
+	PLUS:           "PLUS",
+	MINUS:          "MINUS",
+	BANG:           "BANG",
+	ASTERISK:       "ASTERISK",
+	SLASH:          "SLASH",
+	MOD:            "MOD",
+	CONCAT:         "CONCAT",
+	EQ:             "EQ",
+	NOT_EQ:         "NOT_EQ",
+	LT:             "LT",
+	GT:             "GT",
+	INC:            "INC",
+	DEC:            "DEC",
+	AND:            "AND",
+	OR:             "OR",
+	SEMICOLON:      "SEMICOLON",
+	COMMA:          "COMMA",
+	COLON:          "COLON",
+	DOT:            "DOT",
+	QUESTION:       "QUESTION",
+	LEFT_PAREN:     "LEFT_PAREN",
+	RIGHT_PAREN:    "RIGHT_PAREN",
+	LEFT_BRACE:     "LEFT_BRACE",
+	RIGHT_BRACE:    "RIGHT_BRACE",
+	LEFT_BRACKET:   "LEFT_BRACKET",
+	RIGHT_BRACKET:  "RIGHT_BRACKET",
+	ARROW:          "ARROW",
+	FAT_ARROW:      "FAT_ARROW",
+	FUNCTION:       "FUNCTION",
+	LET:            "LET",
+	RETURN:         "RETURN",
+	FOR:            "FOR",
+	IN:             "IN",
+	IF:             "IF",
+	ELSE:           "ELSE",
+	STRUCT:         "STRUCT",
+	IMPL:           "IMPL",
+	ENUM:           "ENUM",
+	TRAIT:          "TRAIT",
+	DEFER:          "DEFER",
+	TRY:            "TRY",
+	CATCH:          "CATCH",
+	MATCH:          "MATCH",
+	TRUE:           "TRUE",
+	FALSE:          "FALSE",
+	COMMENT_SINGLE: "COMMENT_SINGLE",
+	COMMENT_MULTI:  "COMMENT_MULTI",
+}
+
+func (t TokenType) String() string {
+	if 0 <= t && int(t) < len(tokenNames) && tokenNames[t] != "" {
+		return tokenNames[t]
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
+func (t TokenType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *TokenType) UnmarshalText(text []byte) error {
+	tt, ok := LookupTokenType(string(text))
+	if !ok {
+		return fmt.Errorf("unknown token type %q", text)
+	}
+	*t = tt
+	return nil
+}
+
+// LookupTokenType returns the TokenType with the given name,
+// as printed by TokenType.String.
+func LookupTokenType(name string) (TokenType, bool) {
+	for i, n := range tokenNames {
+		if n == name {
+			return TokenType(i), true
+		}
+	}
+	return ILLEGAL, false
+}
+
 var keywords = map[string]TokenType{
 	"fn":     FUNCTION,
 	"let":    LET,
 	"return": RETURN,
 	"for":    FOR,
+	"in":     IN,
 	"if":     IF,
 	"else":   ELSE,
+	"struct": STRUCT,
+	"impl":   IMPL,
+	"enum":   ENUM,
+	"trait":  TRAIT,
+	"defer":  DEFER,
+	"try":    TRY,
+	"catch":  CATCH,
+	"match":  MATCH,
 	"true":   TRUE,
 	"false":  FALSE,
 }
@@ -67,15 +199,24 @@ type Lexer struct {
 	position     int
 	readPosition int
 	currentChar  byte
+
+	line   int
+	column int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.currentChar == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
 	if l.readPosition >= len(l.input) {
 		l.currentChar = 0
 	} else {
@@ -93,16 +234,27 @@ func (l *Lexer) peekChar() byte {
 }
 
 func (l *Lexer) NextToken() Token {
-	var tok Token
-
 	l.skipWhitespace()
 
+	pos := Position{Line: l.line, Column: l.column}
+	tok := l.readToken()
+	tok.Pos = pos
+	return tok
+}
+
+func (l *Lexer) readToken() Token {
+	var tok Token
+
 	switch l.currentChar {
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.currentChar
 			l.readChar()
 			tok = Token{Type: EQ, Literal: string(ch) + string(l.currentChar)}
+		} else if l.peekChar() == '>' {
+			ch := l.currentChar
+			l.readChar()
+			tok = Token{Type: FAT_ARROW, Literal: string(ch) + string(l.currentChar)}
 		} else {
 			tok = newToken(ASSIGN, l.currentChar)
 		}
@@ -147,7 +299,7 @@ func (l *Lexer) NextToken() Token {
 			l.readChar()
 			tok = Token{Type: CONCAT, Literal: string(ch) + string(l.currentChar)}
 		} else {
-			tok = newToken(ILLEGAL, l.currentChar)
+			tok = newToken(DOT, l.currentChar)
 		}
 	case '*':
 		tok = newToken(ASTERISK, l.currentChar)
@@ -159,6 +311,8 @@ func (l *Lexer) NextToken() Token {
 		tok = newToken(LT, l.currentChar)
 	case '>':
 		tok = newToken(GT, l.currentChar)
+	case '?':
+		tok = newToken(QUESTION, l.currentChar)
 	case ',':
 		tok = newToken(COMMA, l.currentChar)
 	case ':':
@@ -171,6 +325,10 @@ func (l *Lexer) NextToken() Token {
 		tok = newToken(LEFT_BRACE, l.currentChar)
 	case '}':
 		tok = newToken(RIGHT_BRACE, l.currentChar)
+	case '[':
+		tok = newToken(LEFT_BRACKET, l.currentChar)
+	case ']':
+		tok = newToken(RIGHT_BRACKET, l.currentChar)
 	case '&':
 		if l.peekChar() == '&' {
 			ch := l.currentChar
@@ -211,8 +369,7 @@ func (l *Lexer) NextToken() Token {
 			tok.Type = LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.currentChar) {
-			tok.Literal = l.readNumber()
-			tok.Type = INT
+			tok.Type, tok.Literal = l.readNumber()
 			return tok
 		} else {
 			tok = newToken(ILLEGAL, l.currentChar)
@@ -237,12 +394,21 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer, or a float if the digits are followed
+// by a '.' and more digits.
+func (l *Lexer) readNumber() (TokenType, string) {
 	position := l.position
 	for isDigit(l.currentChar) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	if l.currentChar != '.' || !isDigit(l.peekChar()) {
+		return INT, l.input[position:l.position]
+	}
+	l.readChar()
+	for isDigit(l.currentChar) {
+		l.readChar()
+	}
+	return FLOAT, l.input[position:l.position]
 }
 
 func (l *Lexer) readString() string {
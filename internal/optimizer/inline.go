@@ -0,0 +1,193 @@
+package optimizer
+
+import (
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+// maxInlineNodes is the largest body, in syntax tree nodes, of a
+// function that is inlined.
+const maxInlineNodes = 16
+
+// inlined is a function whose calls are replaced by its body.
+type inlined struct {
+	params []string
+	body   parser.Expression
+	// ordered is whether the body evaluates each parameter exactly
+	// once, in order, so that arguments with effects keep them.
+	ordered bool
+}
+
+// inline replaces calls of small top-level functions with their
+// bodies. A function is inlined if its body is a single expression
+// that cannot raise a runtime error, so that no stack or error changes,
+// and that uses nothing but its parameters, so that it means the same
+// wherever it is called. Calls of such a function cannot recurse.
+func inline(program *parser.Program) {
+	names := scan(program)
+
+	fns := map[string]*inlined{}
+	for _, stmt := range program.Statements {
+		fs, ok := stmt.(*parser.FunctionStatement)
+		if !ok {
+			continue
+		}
+		b := names.bindings[fs.Name.Value]
+		if b == nil || b.count != 1 || b.assigned {
+			continue
+		}
+		if fn := inlinable(fs.Function); fn != nil {
+			fns[fs.Name.Value] = fn
+		}
+	}
+	if len(fns) == 0 {
+		return
+	}
+
+	parser.Apply(program, nil, func(c *parser.Cursor) bool {
+		call, ok := c.Node().(*parser.CallExpression)
+		if !ok {
+			return true
+		}
+		// the call of a defer statement must stay a call
+		if _, ok := c.Parent().(*parser.DeferStatement); ok {
+			return true
+		}
+		name, ok := call.Function.(*parser.Identifier)
+		if !ok || fns[name.Value] == nil {
+			return true
+		}
+		if exp := fns[name.Value].expand(call.Arguments); exp != nil {
+			c.Replace(exp)
+		}
+		return true
+	})
+}
+
+// inlinable returns fn as an inlined function, or nil if it is not
+// one.
+func inlinable(fn *parser.FunctionLiteral) *inlined {
+	if len(fn.Body.Statements) != 1 {
+		return nil
+	}
+	var body parser.Expression
+	switch stmt := fn.Body.Statements[0].(type) {
+	case *parser.ExpressionStatement:
+		body = stmt.Expression
+	case *parser.ReturnStatement:
+		body = stmt.ReturnValue
+	}
+	if body == nil || !pure(body) {
+		return nil
+	}
+
+	f := &inlined{body: body, ordered: true}
+	index := map[string]int{}
+	for i, p := range fn.Parameters {
+		f.params = append(f.params, p.Value)
+		index[p.Value] = i
+	}
+
+	nodes, next := 0, 0
+	uses := make([]int, len(f.params))
+	parser.Inspect(body, func(n parser.Node) bool {
+		if n == nil {
+			return false
+		}
+		nodes++
+		switch n := n.(type) {
+		case *parser.Identifier:
+			i, ok := index[n.Value]
+			if !ok {
+				f = nil
+				return false
+			}
+			uses[i]++
+			if i != next {
+				f.ordered = false
+			}
+			next++
+		case *parser.InfixExpression:
+			if n.Operator == "&&" || n.Operator == "||" {
+				f.ordered = false
+			}
+		}
+		return f != nil
+	})
+	if f == nil || nodes > maxInlineNodes {
+		return nil
+	}
+	for _, n := range uses {
+		if n == 0 {
+			return nil
+		}
+		if n != 1 {
+			f.ordered = false
+		}
+	}
+	return f
+}
+
+// expand returns the body of f with args in place of its parameters,
+// or nil if it cannot replace the call. Arguments that are not names
+// or literals must be evaluated exactly once and in order, as the call
+// would have.
+func (f *inlined) expand(args []parser.Expression) parser.Expression {
+	if len(args) != len(f.params) {
+		return nil
+	}
+	subst := map[string]parser.Expression{}
+	for i, arg := range args {
+		switch arg.(type) {
+		case *parser.Identifier, *parser.IntegerLiteral, *parser.FloatLiteral, *parser.StringLiteral, *parser.Boolean:
+		default:
+			if !f.ordered {
+				return nil
+			}
+		}
+		subst[f.params[i]] = arg
+	}
+	return copyExpression(f.body, subst)
+}
+
+// copyExpression copies a pure expression, replacing the names in
+// subst.
+func copyExpression(exp parser.Expression, subst map[string]parser.Expression) parser.Expression {
+	switch exp := exp.(type) {
+	case *parser.Identifier:
+		if arg, ok := subst[exp.Value]; ok {
+			if _, ok := constant(arg); ok || isIdentifier(arg) {
+				return copyExpression(arg, nil)
+			}
+			return arg
+		}
+		c := *exp
+		return &c
+	case *parser.IntegerLiteral:
+		c := *exp
+		return &c
+	case *parser.FloatLiteral:
+		c := *exp
+		return &c
+	case *parser.StringLiteral:
+		c := *exp
+		return &c
+	case *parser.Boolean:
+		c := *exp
+		return &c
+	case *parser.PrefixExpression:
+		c := *exp
+		c.Right = copyExpression(exp.Right, subst)
+		return &c
+	case *parser.InfixExpression:
+		c := *exp
+		c.Left = copyExpression(exp.Left, subst)
+		c.Right = copyExpression(exp.Right, subst)
+		return &c
+	}
+	return exp
+}
+
+func isIdentifier(exp parser.Expression) bool {
+	_, ok := exp.(*parser.Identifier)
+	return ok
+}
@@ -0,0 +1,218 @@
+package optimizer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+// names is what the passes know about the names a program declares.
+type names struct {
+	bindings map[string]*binding
+	// funcs maps each loop to the function literal it is in, nil at the
+	// top level.
+	funcs       map[parser.Statement]*parser.FunctionLiteral
+	assignments []assignment
+}
+
+// assignment is an assignment to the name of b in the function fn.
+type assignment struct {
+	b  *binding
+	fn *parser.FunctionLiteral
+}
+
+// binding describes the declarations of a name. When count is 1, fn
+// and pos are those of its only declaration.
+type binding struct {
+	count int
+	fn    *parser.FunctionLiteral
+	pos   lexer.Position
+	// assigned is whether any assignment to the name exists, and
+	// foreign whether one is in another function than the declaration.
+	assigned bool
+	foreign  bool
+}
+
+// scan records the declarations and assignments of every name in
+// program.
+func scan(program *parser.Program) *names {
+	ns := &names{bindings: map[string]*binding{}, funcs: map[parser.Statement]*parser.FunctionLiteral{}}
+	parser.Walk(scanner{ns: ns}, program)
+	for _, a := range ns.assignments {
+		if a.b.fn != a.fn {
+			a.b.foreign = true
+		}
+	}
+	return ns
+}
+
+type scanner struct {
+	ns *names
+	fn *parser.FunctionLiteral
+}
+
+func (s scanner) declare(id *parser.Identifier, fn *parser.FunctionLiteral) {
+	if id == nil {
+		return
+	}
+	b := s.ns.binding(id.Value)
+	b.count++
+	b.fn, b.pos = fn, id.Pos()
+}
+
+func (ns *names) binding(name string) *binding {
+	b, ok := ns.bindings[name]
+	if !ok {
+		b = &binding{}
+		ns.bindings[name] = b
+	}
+	return b
+}
+
+func (s scanner) Visit(node parser.Node) parser.Visitor {
+	switch n := node.(type) {
+	case *parser.FunctionLiteral:
+		for _, p := range n.Parameters {
+			s.declare(p, n)
+		}
+		return scanner{ns: s.ns, fn: n}
+	case *parser.FunctionStatement:
+		s.declare(n.Name, s.fn)
+	case *parser.LetStatement:
+		s.declare(n.Name, s.fn)
+		s.declare(n.Ok, s.fn)
+	case *parser.ForInStatement:
+		s.declare(n.Key, s.fn)
+		s.declare(n.Value, s.fn)
+		s.ns.funcs[n] = s.fn
+	case *parser.ForStatement:
+		s.ns.funcs[n] = s.fn
+	case *parser.TryCatchExpression:
+		s.declare(n.Name, s.fn)
+	case *parser.IdentPattern:
+		s.declare(&parser.Identifier{Token: n.Token, Value: n.Value}, s.fn)
+	case *parser.AssignStatement:
+		if id, ok := n.Target.(*parser.Identifier); ok {
+			b := s.ns.binding(id.Value)
+			b.assigned = true
+			// the declaration may come later in the walk, so compare
+			// functions once it is done
+			s.ns.assignments = append(s.ns.assignments, assignment{b, s.fn})
+		}
+	}
+	return s
+}
+
+// hoist moves the loop-invariant expressions of loops into variables
+// declared before them. An expression is invariant if it is pure and
+// the variables it uses are declared once, before the loop in the same
+// function, and not assigned in the loop or by closures. Hoisting
+// evaluates it once even if the loop body never runs, which a pure
+// expression of initialized variables allows.
+func hoist(program *parser.Program) {
+	ns := scan(program)
+	count := 0
+	parser.Apply(program, nil, func(c *parser.Cursor) bool {
+		loop, ok := c.Node().(parser.Statement)
+		if _, isLoop := ns.funcs[loop]; !ok || !isLoop || !inList(c) {
+			return true
+		}
+		assigned := assignedIn(loop)
+
+		var hoisted []parser.Statement
+		pre := func(c *parser.Cursor) bool {
+			switch n := c.Node().(type) {
+			case *parser.FunctionLiteral:
+				return false
+			case *parser.LetStatement:
+				// a variable hoisted out of an inner loop moves on out
+				if strings.HasPrefix(n.Name.Value, "$inv") && inList(c) && ns.invariant(n.Value, loop, assigned) {
+					hoisted = append(hoisted, n)
+					c.Delete()
+					return false
+				}
+			case *parser.PrefixExpression, *parser.InfixExpression:
+				exp := n.(parser.Expression)
+				if !ns.invariant(exp, loop, assigned) {
+					return true
+				}
+				name := &parser.Identifier{
+					Token: lexer.Token{Type: lexer.IDENT, Literal: fmt.Sprintf("$inv%d", count), Pos: exp.Pos()},
+					Value: fmt.Sprintf("$inv%d", count),
+				}
+				count++
+				hoisted = append(hoisted, &parser.LetStatement{
+					Token: lexer.Token{Type: lexer.LET, Literal: "let", Pos: loop.Pos()},
+					Name:  name,
+					Value: exp,
+				})
+				c.Replace(name)
+				return false
+			}
+			return true
+		}
+		// the init statement of a loop runs once already
+		switch loop := loop.(type) {
+		case *parser.ForStatement:
+			if loop.Condition != nil {
+				loop.Condition = parser.Apply(loop.Condition, pre, nil).(parser.Expression)
+			}
+			if loop.Post != nil {
+				loop.Post = parser.Apply(loop.Post, pre, nil).(parser.Statement)
+			}
+			parser.Apply(loop.Body, pre, nil)
+		case *parser.ForInStatement:
+			parser.Apply(loop.Body, pre, nil)
+		}
+
+		if len(hoisted) > 0 {
+			c.Replace(&parser.BlockStatement{
+				Token:      lexer.Token{Type: lexer.LEFT_BRACE, Literal: "{", Pos: loop.Pos()},
+				Statements: append(hoisted, loop),
+			})
+		}
+		return true
+	})
+}
+
+// invariant reports whether exp has the same value in every iteration
+// of loop, whose body assigns the names in assigned.
+func (ns *names) invariant(exp parser.Expression, loop parser.Statement, assigned map[string]bool) bool {
+	if !pure(exp) {
+		return false
+	}
+	uses := 0
+	ok := true
+	parser.Inspect(exp, func(n parser.Node) bool {
+		id, isIdent := n.(*parser.Identifier)
+		if !isIdent || !ok {
+			return ok
+		}
+		uses++
+		b := ns.bindings[id.Value]
+		ok = b != nil && b.count == 1 && !b.foreign && !assigned[id.Value] &&
+			b.fn == ns.funcs[loop] && before(b.pos, loop.Pos())
+		return ok
+	})
+	return ok && uses > 0
+}
+
+// assignedIn returns the names assigned to in n.
+func assignedIn(n parser.Node) map[string]bool {
+	assigned := map[string]bool{}
+	parser.Inspect(n, func(n parser.Node) bool {
+		if as, ok := n.(*parser.AssignStatement); ok {
+			if id, ok := as.Target.(*parser.Identifier); ok {
+				assigned[id.Value] = true
+			}
+		}
+		return true
+	})
+	return assigned
+}
+
+func before(a, b lexer.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
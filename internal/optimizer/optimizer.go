@@ -0,0 +1,328 @@
+// Package optimizer rewrites type-checked Gust programs into programs
+// that compute the same results faster. Every pass preserves what a
+// program prints, the values it returns and the runtime errors it
+// raises, with their stacks; the rewritten program is not type checked
+// again.
+package optimizer
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+// Level is how much Optimize does.
+type Level int
+
+const (
+	// O0 leaves programs as they are.
+	O0 Level = iota
+	// O1 folds constant expressions and removes code that can never
+	// run.
+	O1
+	// O2 also inlines small functions and hoists loop-invariant
+	// expressions out of loops.
+	O2
+)
+
+// ParseLevel returns the level n, 0, 1 or 2.
+func ParseLevel(n int) (Level, error) {
+	if n < int(O0) || n > int(O2) {
+		return O0, fmt.Errorf("unknown optimization level %d, want 0, 1 or 2", n)
+	}
+	return Level(n), nil
+}
+
+// Optimize rewrites program in place at the given level and returns
+// it.
+func Optimize(program *parser.Program, level Level) *parser.Program {
+	if level >= O2 {
+		inline(program)
+	}
+	if level >= O1 {
+		parser.Apply(program, nil, func(c *parser.Cursor) bool {
+			fold(c)
+			eliminate(c)
+			return true
+		})
+	}
+	if level >= O2 {
+		hoist(program)
+	}
+	return program
+}
+
+// fold replaces a prefix or infix expression whose operands are
+// literals with the literal it evaluates to. Operations that would
+// raise a runtime error, such as dividing by zero, are left alone.
+func fold(c *parser.Cursor) {
+	switch n := c.Node().(type) {
+	case *parser.PrefixExpression:
+		right, ok := constant(n.Right)
+		if !ok {
+			return
+		}
+		switch v := right.(type) {
+		case int64:
+			if n.Operator == "-" {
+				c.Replace(literal(-v, n.Pos()))
+			}
+		case float64:
+			if n.Operator == "-" {
+				c.Replace(literal(-v, n.Pos()))
+			}
+		case bool:
+			if n.Operator == "!" {
+				c.Replace(literal(!v, n.Pos()))
+			}
+		}
+
+	case *parser.InfixExpression:
+		left, ok := constant(n.Left)
+		if !ok {
+			return
+		}
+		// && and || don't evaluate their right operand when the left
+		// one decides the result
+		if b, isBool := left.(bool); isBool && (n.Operator == "&&" && !b || n.Operator == "||" && b) {
+			c.Replace(literal(b, n.Left.Pos()))
+			return
+		}
+		right, ok := constant(n.Right)
+		if !ok {
+			return
+		}
+		if v, ok := evalInfix(n.Operator, left, right); ok {
+			c.Replace(literal(v, n.Left.Pos()))
+		}
+	}
+}
+
+// evalInfix applies operator to two constants as the interpreter does,
+// and reports false if it would raise an error.
+func evalInfix(operator string, left, right any) (any, bool) {
+	switch operator {
+	case "==":
+		return left == right, sameType(left, right)
+	case "!=":
+		return left != right, sameType(left, right)
+	}
+
+	switch l := left.(type) {
+	case int64:
+		r, ok := right.(int64)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			return l / nonZero(r), r != 0
+		case "%":
+			return l % nonZero(r), r != 0
+		case "<":
+			return l < r, true
+		case ">":
+			return l > r, true
+		}
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			return l / r, true
+		case "<":
+			return l < r, true
+		case ">":
+			return l > r, true
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "..":
+			return l + r, true
+		case "<":
+			return l < r, true
+		case ">":
+			return l > r, true
+		}
+	case bool:
+		r, ok := right.(bool)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "&&":
+			return l && r, true
+		case "||":
+			return l || r, true
+		}
+	}
+	return nil, false
+}
+
+func nonZero(n int64) int64 {
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+func sameType(a, b any) bool {
+	return fmt.Sprintf("%T", a) == fmt.Sprintf("%T", b)
+}
+
+// constant returns the value of a literal.
+func constant(exp parser.Expression) (any, bool) {
+	switch exp := exp.(type) {
+	case *parser.IntegerLiteral:
+		return exp.Value, true
+	case *parser.FloatLiteral:
+		return exp.Value, true
+	case *parser.StringLiteral:
+		return exp.Value, true
+	case *parser.Boolean:
+		return exp.Value, true
+	}
+	return nil, false
+}
+
+// literal returns a literal of the value v, an int64, float64, string
+// or bool, positioned at pos.
+func literal(v any, pos lexer.Position) parser.Expression {
+	switch v := v.(type) {
+	case int64:
+		return &parser.IntegerLiteral{Token: lexer.Token{Type: lexer.INT, Literal: strconv.FormatInt(v, 10), Pos: pos}, Value: v}
+	case float64:
+		return &parser.FloatLiteral{Token: lexer.Token{Type: lexer.FLOAT, Literal: strconv.FormatFloat(v, 'g', -1, 64), Pos: pos}, Value: v}
+	case string:
+		return &parser.StringLiteral{Token: lexer.Token{Type: lexer.STRING, Literal: v, Pos: pos}, Value: v}
+	case bool:
+		if v {
+			return &parser.Boolean{Token: lexer.Token{Type: lexer.TRUE, Literal: "true", Pos: pos}, Value: true}
+		}
+		return &parser.Boolean{Token: lexer.Token{Type: lexer.FALSE, Literal: "false", Pos: pos}, Value: false}
+	}
+	panic(fmt.Sprintf("optimizer: no literal for %T", v))
+}
+
+// eliminate removes the branch of an if expression with a constant
+// condition that can never run, and the statements of a block after a
+// return statement.
+func eliminate(c *parser.Cursor) {
+	switch n := c.Node().(type) {
+	case *parser.IfExpression:
+		cond, ok := n.Condition.(*parser.Boolean)
+		if !ok {
+			return
+		}
+		taken := n.Consequence
+		if !cond.Value {
+			taken = n.Alternative
+		}
+		if taken == nil {
+			taken = &parser.BlockStatement{Token: n.Token}
+		}
+		if len(taken.Statements) == 1 {
+			if es, ok := taken.Statements[0].(*parser.ExpressionStatement); ok {
+				c.Replace(es.Expression)
+				return
+			}
+		}
+		// keep the block, which scopes its declarations
+		n.Condition = literal(true, cond.Pos())
+		n.Consequence = taken
+		n.Alternative = nil
+
+	case *parser.ExpressionStatement:
+		// a statement `if true { ... }` is the block itself, whose
+		// value is that of the if
+		ie, ok := n.Expression.(*parser.IfExpression)
+		if !ok || !inList(c) {
+			return
+		}
+		if cond, ok := ie.Condition.(*parser.Boolean); !ok || !cond.Value || ie.Alternative != nil {
+			return
+		}
+		if len(ie.Consequence.Statements) == 0 && c.Index() < len(statements(c.Parent()))-1 {
+			c.Delete()
+			return
+		}
+		c.Replace(ie.Consequence)
+
+	case *parser.BlockStatement:
+		n.Statements = untilReturn(n.Statements)
+	case *parser.Program:
+		n.Statements = untilReturn(n.Statements)
+	}
+}
+
+func untilReturn(stmts []parser.Statement) []parser.Statement {
+	for i, stmt := range stmts {
+		if _, ok := stmt.(*parser.ReturnStatement); ok {
+			return stmts[:i+1]
+		}
+	}
+	return stmts
+}
+
+// inList reports whether the node of c is a statement of a program or
+// block.
+func inList(c *parser.Cursor) bool {
+	return c.Index() >= 0 && c.Name() == "Statements"
+}
+
+func statements(n parser.Node) []parser.Statement {
+	switch n := n.(type) {
+	case *parser.Program:
+		return n.Statements
+	case *parser.BlockStatement:
+		return n.Statements
+	}
+	return nil
+}
+
+// pure reports whether evaluating exp can have no effect other than
+// producing its value: it is made of literals and names combined with
+// operators that cannot raise errors.
+func pure(exp parser.Expression) bool {
+	switch exp := exp.(type) {
+	case *parser.IntegerLiteral, *parser.FloatLiteral, *parser.StringLiteral, *parser.Boolean, *parser.Identifier:
+		return true
+	case *parser.PrefixExpression:
+		return pure(exp.Right)
+	case *parser.InfixExpression:
+		if exp.Operator == "/" || exp.Operator == "%" {
+			// only a divisor that is a non-zero literal can't fail
+			switch r := exp.Right.(type) {
+			case *parser.IntegerLiteral:
+				if r.Value == 0 {
+					return false
+				}
+			case *parser.FloatLiteral:
+			default:
+				return false
+			}
+		}
+		return pure(exp.Left) && pure(exp.Right)
+	}
+	return false
+}
@@ -0,0 +1,725 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+)
+
+// DecodeJSON reads a node written by EncodeJSON from r.
+func DecodeJSON(r io.Reader) (Node, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	t, err := jsonTree(raw)
+	if err != nil {
+		return nil, err
+	}
+	return fromTree(t)
+}
+
+func jsonTree(raw json.RawMessage) (*tree, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return nil, err
+	}
+	if members == nil {
+		return nil, nil
+	}
+
+	t := &tree{}
+	if err := json.Unmarshal(members["kind"], &t.kind); err != nil {
+		return nil, fmt.Errorf("invalid node kind: %v", err)
+	}
+
+	for name, value := range members {
+		switch name {
+		case "kind":
+		case "token":
+			t.token = &lexer.Token{}
+			if err := json.Unmarshal(value, t.token); err != nil {
+				return nil, fmt.Errorf("%s: invalid token: %v", t.kind, err)
+			}
+		default:
+			v, err := jsonValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", t.kind, name, err)
+			}
+			t.add(name, v)
+		}
+	}
+
+	return t, nil
+}
+
+func jsonValue(raw json.RawMessage) (any, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	switch raw[0] {
+	case 'n':
+		return nil, nil
+	case '{':
+		return jsonTree(raw)
+	case '[':
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return nil, err
+		}
+		list := make([]*tree, len(elems))
+		for i, elem := range elems {
+			t, err := jsonTree(elem)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = t
+		}
+		return list, nil
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case 't', 'f':
+		var b bool
+		err := json.Unmarshal(raw, &b)
+		return b, err
+	default:
+		var i int64
+		if err := json.Unmarshal(raw, &i); err == nil {
+			return i, nil
+		}
+		var f float64
+		err := json.Unmarshal(raw, &f)
+		return f, err
+	}
+}
+
+// DecodeSexpr reads a node written by EncodeSexpr from r.
+func DecodeSexpr(r io.Reader) (Node, error) {
+	s := &sexprReader{r: bufio.NewReader(r)}
+	s.next()
+
+	v, err := s.value()
+	if err != nil {
+		return nil, err
+	}
+	if s.tok != "" {
+		return nil, fmt.Errorf("unexpected %q after node", s.tok)
+	}
+
+	t, ok := v.(*tree)
+	if !ok && v != nil {
+		return nil, fmt.Errorf("expected node, got %v", v)
+	}
+	return fromTree(t)
+}
+
+type sexprReader struct {
+	r   *bufio.Reader
+	tok string // current token; "" at end of input
+	str bool   // whether tok is a quoted string
+	err error
+}
+
+func (s *sexprReader) next() {
+	s.tok, s.str = "", false
+
+	ch, err := s.skipSpace()
+	if err != nil {
+		if err != io.EOF {
+			s.err = err
+		}
+		return
+	}
+
+	switch {
+	case strings.ContainsRune("()[]", ch):
+		s.tok = string(ch)
+	case ch == '"':
+		s.str = true
+		s.tok = s.readQuoted()
+	default:
+		var b strings.Builder
+		b.WriteRune(ch)
+		for {
+			ch, _, err := s.r.ReadRune()
+			if err != nil {
+				break
+			}
+			if unicode.IsSpace(ch) || strings.ContainsRune("()[]\"", ch) {
+				s.r.UnreadRune()
+				break
+			}
+			b.WriteRune(ch)
+		}
+		s.tok = b.String()
+	}
+}
+
+func (s *sexprReader) skipSpace() (rune, error) {
+	for {
+		ch, _, err := s.r.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(ch) {
+			return ch, nil
+		}
+	}
+}
+
+func (s *sexprReader) readQuoted() string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for {
+		ch, _, err := s.r.ReadRune()
+		if err != nil {
+			s.err = fmt.Errorf("unterminated string")
+			return ""
+		}
+		b.WriteRune(ch)
+		if ch == '\\' {
+			esc, _, err := s.r.ReadRune()
+			if err != nil {
+				s.err = fmt.Errorf("unterminated string")
+				return ""
+			}
+			b.WriteRune(esc)
+			continue
+		}
+		if ch == '"' {
+			break
+		}
+	}
+
+	str, err := strconv.Unquote(b.String())
+	if err != nil {
+		s.err = fmt.Errorf("invalid string %s: %v", b.String(), err)
+	}
+	return str
+}
+
+func (s *sexprReader) expect(tok string) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.str || s.tok != tok {
+		return fmt.Errorf("expected %q, got %q", tok, s.tok)
+	}
+	s.next()
+	return nil
+}
+
+func (s *sexprReader) value() (any, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	if s.str {
+		str := s.tok
+		s.next()
+		return str, nil
+	}
+
+	switch s.tok {
+	case "(":
+		return s.node()
+	case "[":
+		s.next()
+		list := []*tree{}
+		for s.tok != "]" || s.str {
+			if s.tok == "" && s.err == nil {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			v, err := s.value()
+			if err != nil {
+				return nil, err
+			}
+			t, ok := v.(*tree)
+			if !ok && v != nil {
+				return nil, fmt.Errorf("expected node in list, got %v", v)
+			}
+			list = append(list, t)
+		}
+		s.next()
+		return list, nil
+	case "nil":
+		s.next()
+		return nil, nil
+	case "true", "false":
+		b := s.tok == "true"
+		s.next()
+		return b, nil
+	case "":
+		return nil, fmt.Errorf("unexpected end of input")
+	}
+
+	if i, err := strconv.ParseInt(s.tok, 10, 64); err == nil {
+		s.next()
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(s.tok, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %q", s.tok)
+	}
+	s.next()
+	return f, nil
+}
+
+func (s *sexprReader) node() (*tree, error) {
+	if err := s.expect("("); err != nil {
+		return nil, err
+	}
+
+	t := &tree{kind: s.tok}
+	s.next()
+
+	if s.tok == "(" && !s.str {
+		tok, err := s.token()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.kind, err)
+		}
+		t.token = tok
+	}
+
+	for s.tok != ")" || s.str {
+		if s.err != nil {
+			return nil, s.err
+		}
+		if s.str || !strings.HasPrefix(s.tok, ":") {
+			return nil, fmt.Errorf("%s: expected field name, got %q", t.kind, s.tok)
+		}
+		name := s.tok[1:]
+		s.next()
+
+		v, err := s.value()
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", t.kind, name, err)
+		}
+		t.add(name, v)
+	}
+
+	return t, s.expect(")")
+}
+
+func (s *sexprReader) token() (*lexer.Token, error) {
+	if err := s.expect("("); err != nil {
+		return nil, err
+	}
+
+	tok := &lexer.Token{}
+	if err := tok.Type.UnmarshalText([]byte(s.tok)); err != nil {
+		return nil, err
+	}
+	s.next()
+
+	if !s.str {
+		return nil, fmt.Errorf("expected token literal, got %q", s.tok)
+	}
+	tok.Literal = s.tok
+	s.next()
+
+	if s.tok != "-" {
+		if _, err := fmt.Sscanf(s.tok, "%d:%d", &tok.Pos.Line, &tok.Pos.Column); err != nil {
+			return nil, fmt.Errorf("invalid position %q", s.tok)
+		}
+	}
+	s.next()
+
+	return tok, s.expect(")")
+}
+
+// decoder rebuilds nodes from trees, remembering the first error.
+type decoder struct {
+	err error
+}
+
+func fromTree(t *tree) (Node, error) {
+	d := &decoder{}
+	n := d.node(t)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return n, nil
+}
+
+func (d *decoder) errorf(t *tree, format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%s: %s", t.kind, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *decoder) token(t *tree) lexer.Token {
+	if t.token == nil {
+		d.errorf(t, "missing token")
+		return lexer.Token{}
+	}
+	return *t.token
+}
+
+func (d *decoder) node(t *tree) Node {
+	if t == nil {
+		return nil
+	}
+
+	switch t.kind {
+	case "Program":
+		return &Program{Statements: decodeList[Statement](d, t, "statements")}
+
+	case "LetStatement":
+		return &LetStatement{
+			Token: d.token(t),
+			Name:  decodeField[*Identifier](d, t, "name"),
+			Ok:    decodeField[*Identifier](d, t, "ok"),
+			Type:  decodeField[TypeExpr](d, t, "type"),
+			Value: decodeField[Expression](d, t, "value"),
+		}
+
+	case "AssignStatement":
+		return &AssignStatement{
+			Token:  d.token(t),
+			Target: decodeField[Expression](d, t, "target"),
+			Value:  decodeField[Expression](d, t, "value"),
+		}
+
+	case "FunctionStatement":
+		return &FunctionStatement{
+			Token:    d.token(t),
+			Name:     decodeField[*Identifier](d, t, "name"),
+			Function: decodeField[*FunctionLiteral](d, t, "function"),
+		}
+
+	case "ForStatement":
+		return &ForStatement{
+			Token:     d.token(t),
+			Init:      decodeField[Statement](d, t, "init"),
+			Condition: decodeField[Expression](d, t, "condition"),
+			Post:      decodeField[Statement](d, t, "post"),
+			Body:      decodeField[*BlockStatement](d, t, "body"),
+		}
+
+	case "ForInStatement":
+		return &ForInStatement{
+			Token:    d.token(t),
+			Key:      decodeField[*Identifier](d, t, "key"),
+			Value:    decodeField[*Identifier](d, t, "value"),
+			Iterable: decodeField[Expression](d, t, "iterable"),
+			Body:     decodeField[*BlockStatement](d, t, "body"),
+		}
+
+	case "StructStatement":
+		return &StructStatement{
+			Token:      d.token(t),
+			Name:       decodeField[*Identifier](d, t, "name"),
+			TypeParams: decodeList[*TypeParam](d, t, "typeParams"),
+			Fields:     decodeList[*Identifier](d, t, "fields"),
+			FieldTypes: decodeList[TypeExpr](d, t, "fieldTypes"),
+		}
+
+	case "ImplStatement":
+		return &ImplStatement{
+			Token:      d.token(t),
+			Trait:      decodeField[*Identifier](d, t, "trait"),
+			Name:       decodeField[*Identifier](d, t, "name"),
+			TypeParams: decodeList[*TypeParam](d, t, "typeParams"),
+			Methods:    decodeList[*FunctionStatement](d, t, "methods"),
+		}
+
+	case "TraitStatement":
+		return &TraitStatement{
+			Token:   d.token(t),
+			Name:    decodeField[*Identifier](d, t, "name"),
+			Methods: decodeList[*TraitMethod](d, t, "methods"),
+		}
+
+	case "TraitMethod":
+		return &TraitMethod{
+			Token:      d.token(t),
+			Name:       decodeField[*Identifier](d, t, "name"),
+			Parameters: decodeList[*Identifier](d, t, "parameters"),
+			ParamTypes: decodeList[TypeExpr](d, t, "paramTypes"),
+			ReturnType: decodeField[TypeExpr](d, t, "returnType"),
+		}
+
+	case "EnumStatement":
+		return &EnumStatement{
+			Token:    d.token(t),
+			Name:     decodeField[*Identifier](d, t, "name"),
+			Variants: decodeList[*EnumVariant](d, t, "variants"),
+		}
+
+	case "EnumVariant":
+		return &EnumVariant{
+			Token:  d.token(t),
+			Name:   decodeField[*Identifier](d, t, "name"),
+			Fields: decodeList[TypeExpr](d, t, "fields"),
+		}
+
+	case "ReturnStatement":
+		return &ReturnStatement{
+			Token:       d.token(t),
+			ReturnValue: decodeField[Expression](d, t, "returnValue"),
+		}
+
+	case "DeferStatement":
+		return &DeferStatement{Token: d.token(t), Call: decodeField[*CallExpression](d, t, "call")}
+
+	case "ExpressionStatement":
+		return &ExpressionStatement{
+			Token:      d.token(t),
+			Expression: decodeField[Expression](d, t, "expression"),
+		}
+
+	case "BlockStatement":
+		return &BlockStatement{
+			Token:      d.token(t),
+			Statements: decodeList[Statement](d, t, "statements"),
+		}
+
+	case "Identifier":
+		return &Identifier{Token: d.token(t), Value: decodeScalar[string](d, t, "value")}
+
+	case "IntegerLiteral":
+		return &IntegerLiteral{Token: d.token(t), Value: decodeScalar[int64](d, t, "value")}
+
+	case "FloatLiteral":
+		return &FloatLiteral{Token: d.token(t), Value: decodeScalar[float64](d, t, "value")}
+
+	case "StringLiteral":
+		return &StringLiteral{Token: d.token(t), Value: decodeScalar[string](d, t, "value")}
+
+	case "Boolean":
+		return &Boolean{Token: d.token(t), Value: decodeScalar[bool](d, t, "value")}
+
+	case "PrefixExpression":
+		return &PrefixExpression{
+			Token:    d.token(t),
+			Operator: decodeScalar[string](d, t, "operator"),
+			Right:    decodeField[Expression](d, t, "right"),
+		}
+
+	case "InfixExpression":
+		return &InfixExpression{
+			Token:    d.token(t),
+			Left:     decodeField[Expression](d, t, "left"),
+			Operator: decodeScalar[string](d, t, "operator"),
+			Right:    decodeField[Expression](d, t, "right"),
+		}
+
+	case "TryCatchExpression":
+		return &TryCatchExpression{
+			Token:   d.token(t),
+			Body:    decodeField[*BlockStatement](d, t, "body"),
+			Name:    decodeField[*Identifier](d, t, "name"),
+			Handler: decodeField[*BlockStatement](d, t, "handler"),
+		}
+
+	case "IfExpression":
+		return &IfExpression{
+			Token:       d.token(t),
+			Condition:   decodeField[Expression](d, t, "condition"),
+			Consequence: decodeField[*BlockStatement](d, t, "consequence"),
+			Alternative: decodeField[*BlockStatement](d, t, "alternative"),
+		}
+
+	case "FunctionLiteral":
+		return &FunctionLiteral{
+			Token:      d.token(t),
+			TypeParams: decodeList[*TypeParam](d, t, "typeParams"),
+			Parameters: decodeList[*Identifier](d, t, "parameters"),
+			ParamTypes: decodeList[TypeExpr](d, t, "paramTypes"),
+			ReturnType: decodeField[TypeExpr](d, t, "returnType"),
+			Body:       decodeField[*BlockStatement](d, t, "body"),
+		}
+
+	case "CallExpression":
+		return &CallExpression{
+			Token:     d.token(t),
+			Function:  decodeField[Expression](d, t, "function"),
+			Arguments: decodeList[Expression](d, t, "arguments"),
+		}
+
+	case "ArrayLiteral":
+		return &ArrayLiteral{Token: d.token(t), Elements: decodeList[Expression](d, t, "elements")}
+
+	case "StructLiteral":
+		return &StructLiteral{
+			Token:  d.token(t),
+			Name:   decodeField[*Identifier](d, t, "name"),
+			Fields: decodeList[*Identifier](d, t, "fields"),
+			Values: decodeList[Expression](d, t, "values"),
+		}
+
+	case "SelectorExpression":
+		return &SelectorExpression{
+			Token: d.token(t),
+			Left:  decodeField[Expression](d, t, "left"),
+			Field: decodeField[*Identifier](d, t, "field"),
+		}
+
+	case "TryExpression":
+		return &TryExpression{Token: d.token(t), Left: decodeField[Expression](d, t, "left")}
+
+	case "MatchExpression":
+		return &MatchExpression{
+			Token:   d.token(t),
+			Subject: decodeField[Expression](d, t, "subject"),
+			Arms:    decodeList[*MatchArm](d, t, "arms"),
+		}
+
+	case "MatchArm":
+		return &MatchArm{
+			Token:   d.token(t),
+			Pattern: decodeField[Pattern](d, t, "pattern"),
+			Guard:   decodeField[Expression](d, t, "guard"),
+			Body:    decodeField[*BlockStatement](d, t, "body"),
+		}
+
+	case "WildcardPattern":
+		return &WildcardPattern{Token: d.token(t)}
+
+	case "IdentPattern":
+		return &IdentPattern{Token: d.token(t), Value: decodeScalar[string](d, t, "value")}
+
+	case "LiteralPattern":
+		return &LiteralPattern{Token: d.token(t), Value: decodeField[Expression](d, t, "value")}
+
+	case "ConstructorPattern":
+		return &ConstructorPattern{
+			Token: d.token(t),
+			Name:  decodeField[*Identifier](d, t, "name"),
+			Args:  decodeList[Pattern](d, t, "args"),
+		}
+
+	case "MapLiteral":
+		return &MapLiteral{
+			Token:  d.token(t),
+			Keys:   decodeList[Expression](d, t, "keys"),
+			Values: decodeList[Expression](d, t, "values"),
+		}
+
+	case "IndexExpression":
+		return &IndexExpression{
+			Token: d.token(t),
+			Left:  decodeField[Expression](d, t, "left"),
+			Index: decodeField[Expression](d, t, "index"),
+		}
+
+	case "SliceExpression":
+		return &SliceExpression{
+			Token: d.token(t),
+			Left:  decodeField[Expression](d, t, "left"),
+			Low:   decodeField[Expression](d, t, "low"),
+			High:  decodeField[Expression](d, t, "high"),
+		}
+
+	case "TypeParam":
+		return &TypeParam{
+			Token:  d.token(t),
+			Name:   decodeScalar[string](d, t, "name"),
+			Bounds: decodeList[*Identifier](d, t, "bounds"),
+		}
+
+	case "NamedType":
+		return &NamedType{Token: d.token(t), Name: decodeScalar[string](d, t, "name")}
+
+	case "ArrayType":
+		return &ArrayType{Token: d.token(t), Elem: decodeField[TypeExpr](d, t, "elem")}
+
+	case "MapType":
+		return &MapType{
+			Token: d.token(t),
+			Key:   decodeField[TypeExpr](d, t, "key"),
+			Value: decodeField[TypeExpr](d, t, "value"),
+		}
+
+	case "GenericType":
+		return &GenericType{
+			Token: d.token(t),
+			Name:  decodeScalar[string](d, t, "name"),
+			Args:  decodeList[TypeExpr](d, t, "args"),
+		}
+
+	case "FunctionType":
+		return &FunctionType{
+			Token:  d.token(t),
+			Params: decodeList[TypeExpr](d, t, "params"),
+			Return: decodeField[TypeExpr](d, t, "return"),
+		}
+	}
+
+	d.errorf(t, "unknown node kind")
+	return nil
+}
+
+func decodeField[N Node](d *decoder, t *tree, name string) N {
+	var zero N
+
+	v, _ := t.get(name)
+	child, ok := v.(*tree)
+	if !ok {
+		if v != nil {
+			d.errorf(t, "field %s is not a node", name)
+		}
+		return zero
+	}
+
+	n := d.node(child)
+	if n == nil {
+		return zero
+	}
+	result, ok := n.(N)
+	if !ok {
+		d.errorf(t, "field %s cannot be a %s", name, child.kind)
+	}
+	return result
+}
+
+func decodeList[N Node](d *decoder, t *tree, name string) []N {
+	v, _ := t.get(name)
+	children, ok := v.([]*tree)
+	if !ok && v != nil {
+		d.errorf(t, "field %s is not a list", name)
+	}
+
+	list := make([]N, 0, len(children))
+	for _, child := range children {
+		var elem N
+		if n := d.node(child); n != nil {
+			var ok bool
+			if elem, ok = n.(N); !ok {
+				d.errorf(t, "field %s cannot contain a %s", name, child.kind)
+			}
+		}
+		list = append(list, elem)
+	}
+	return list
+}
+
+func decodeScalar[T int64 | float64 | string | bool](d *decoder, t *tree, name string) T {
+	v, _ := t.get(name)
+
+	// whole floats are written without a fraction and read back as ints
+	if i, isInt := v.(int64); isInt {
+		if _, wantFloat := any(*new(T)).(float64); wantFloat {
+			v = float64(i)
+		}
+	}
+
+	result, ok := v.(T)
+	if !ok {
+		d.errorf(t, "field %s has invalid value %v", name, v)
+	}
+	return result
+}
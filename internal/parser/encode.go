@@ -0,0 +1,420 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+)
+
+// tree is the language-neutral form of a Node shared by the JSON and
+// S-expression encodings. Every node has a kind and, except for
+// *Program, the token it was parsed from; its remaining fields are
+// kept in declaration order so that encoded output is stable.
+type tree struct {
+	kind   string
+	token  *lexer.Token
+	fields []field
+}
+
+// A field holds nil, an int64, a float64, a string, a bool, a *tree or
+// a []*tree.
+type field struct {
+	name  string
+	value any
+}
+
+func (t *tree) add(name string, value any) {
+	t.fields = append(t.fields, field{name, value})
+}
+
+func (t *tree) get(name string) (any, bool) {
+	for _, f := range t.fields {
+		if f.name == name {
+			return f.value, true
+		}
+	}
+	return nil, false
+}
+
+func toTree(n Node) *tree {
+	if nodeOf(n) == nil {
+		return nil
+	}
+
+	t := &tree{kind: strings.TrimPrefix(fmt.Sprintf("%T", n), "*parser.")}
+
+	switch n := n.(type) {
+	case *Program:
+		t.add("statements", treeList(n.Statements))
+
+	case *LetStatement:
+		t.token = &n.Token
+		t.add("name", toTree(n.Name))
+		t.add("ok", toTree(n.Ok))
+		t.add("type", toTree(n.Type))
+		t.add("value", toTree(n.Value))
+
+	case *AssignStatement:
+		t.token = &n.Token
+		t.add("target", toTree(n.Target))
+		t.add("value", toTree(n.Value))
+
+	case *FunctionStatement:
+		t.token = &n.Token
+		t.add("name", toTree(n.Name))
+		t.add("function", toTree(n.Function))
+
+	case *ForStatement:
+		t.token = &n.Token
+		t.add("init", toTree(n.Init))
+		t.add("condition", toTree(n.Condition))
+		t.add("post", toTree(n.Post))
+		t.add("body", toTree(n.Body))
+
+	case *ForInStatement:
+		t.token = &n.Token
+		t.add("key", toTree(n.Key))
+		t.add("value", toTree(n.Value))
+		t.add("iterable", toTree(n.Iterable))
+		t.add("body", toTree(n.Body))
+
+	case *StructStatement:
+		t.token = &n.Token
+		t.add("name", toTree(n.Name))
+		t.add("typeParams", treeList(n.TypeParams))
+		t.add("fields", treeList(n.Fields))
+		t.add("fieldTypes", treeList(n.FieldTypes))
+
+	case *ImplStatement:
+		t.token = &n.Token
+		t.add("trait", toTree(n.Trait))
+		t.add("name", toTree(n.Name))
+		t.add("typeParams", treeList(n.TypeParams))
+		t.add("methods", treeList(n.Methods))
+
+	case *TraitStatement:
+		t.token = &n.Token
+		t.add("name", toTree(n.Name))
+		t.add("methods", treeList(n.Methods))
+
+	case *TraitMethod:
+		t.token = &n.Token
+		t.add("name", toTree(n.Name))
+		t.add("parameters", treeList(n.Parameters))
+		t.add("paramTypes", treeList(n.ParamTypes))
+		t.add("returnType", toTree(n.ReturnType))
+
+	case *EnumStatement:
+		t.token = &n.Token
+		t.add("name", toTree(n.Name))
+		t.add("variants", treeList(n.Variants))
+
+	case *EnumVariant:
+		t.token = &n.Token
+		t.add("name", toTree(n.Name))
+		t.add("fields", treeList(n.Fields))
+
+	case *ReturnStatement:
+		t.token = &n.Token
+		t.add("returnValue", toTree(n.ReturnValue))
+
+	case *DeferStatement:
+		t.token = &n.Token
+		t.add("call", toTree(n.Call))
+
+	case *ExpressionStatement:
+		t.token = &n.Token
+		t.add("expression", toTree(n.Expression))
+
+	case *BlockStatement:
+		t.token = &n.Token
+		t.add("statements", treeList(n.Statements))
+
+	case *Identifier:
+		t.token = &n.Token
+		t.add("value", n.Value)
+
+	case *IntegerLiteral:
+		t.token = &n.Token
+		t.add("value", n.Value)
+
+	case *FloatLiteral:
+		t.token = &n.Token
+		t.add("value", n.Value)
+
+	case *StringLiteral:
+		t.token = &n.Token
+		t.add("value", n.Value)
+
+	case *Boolean:
+		t.token = &n.Token
+		t.add("value", n.Value)
+
+	case *PrefixExpression:
+		t.token = &n.Token
+		t.add("operator", n.Operator)
+		t.add("right", toTree(n.Right))
+
+	case *InfixExpression:
+		t.token = &n.Token
+		t.add("left", toTree(n.Left))
+		t.add("operator", n.Operator)
+		t.add("right", toTree(n.Right))
+
+	case *IfExpression:
+		t.token = &n.Token
+		t.add("condition", toTree(n.Condition))
+		t.add("consequence", toTree(n.Consequence))
+		t.add("alternative", toTree(n.Alternative))
+
+	case *TryCatchExpression:
+		t.token = &n.Token
+		t.add("body", toTree(n.Body))
+		t.add("name", toTree(n.Name))
+		t.add("handler", toTree(n.Handler))
+
+	case *FunctionLiteral:
+		t.token = &n.Token
+		t.add("typeParams", treeList(n.TypeParams))
+		t.add("parameters", treeList(n.Parameters))
+		t.add("paramTypes", treeList(n.ParamTypes))
+		t.add("returnType", toTree(n.ReturnType))
+		t.add("body", toTree(n.Body))
+
+	case *CallExpression:
+		t.token = &n.Token
+		t.add("function", toTree(n.Function))
+		t.add("arguments", treeList(n.Arguments))
+
+	case *ArrayLiteral:
+		t.token = &n.Token
+		t.add("elements", treeList(n.Elements))
+
+	case *StructLiteral:
+		t.token = &n.Token
+		t.add("name", toTree(n.Name))
+		t.add("fields", treeList(n.Fields))
+		t.add("values", treeList(n.Values))
+
+	case *SelectorExpression:
+		t.token = &n.Token
+		t.add("left", toTree(n.Left))
+		t.add("field", toTree(n.Field))
+
+	case *TryExpression:
+		t.token = &n.Token
+		t.add("left", toTree(n.Left))
+
+	case *MatchExpression:
+		t.token = &n.Token
+		t.add("subject", toTree(n.Subject))
+		t.add("arms", treeList(n.Arms))
+
+	case *MatchArm:
+		t.token = &n.Token
+		t.add("pattern", toTree(n.Pattern))
+		t.add("guard", toTree(n.Guard))
+		t.add("body", toTree(n.Body))
+
+	case *WildcardPattern:
+		t.token = &n.Token
+
+	case *IdentPattern:
+		t.token = &n.Token
+		t.add("value", n.Value)
+
+	case *LiteralPattern:
+		t.token = &n.Token
+		t.add("value", toTree(n.Value))
+
+	case *ConstructorPattern:
+		t.token = &n.Token
+		t.add("name", toTree(n.Name))
+		t.add("args", treeList(n.Args))
+
+	case *MapLiteral:
+		t.token = &n.Token
+		t.add("keys", treeList(n.Keys))
+		t.add("values", treeList(n.Values))
+
+	case *IndexExpression:
+		t.token = &n.Token
+		t.add("left", toTree(n.Left))
+		t.add("index", toTree(n.Index))
+
+	case *SliceExpression:
+		t.token = &n.Token
+		t.add("left", toTree(n.Left))
+		t.add("low", toTree(n.Low))
+		t.add("high", toTree(n.High))
+
+	case *TypeParam:
+		t.token = &n.Token
+		t.add("name", n.Name)
+		t.add("bounds", treeList(n.Bounds))
+
+	case *NamedType:
+		t.token = &n.Token
+		t.add("name", n.Name)
+
+	case *ArrayType:
+		t.token = &n.Token
+		t.add("elem", toTree(n.Elem))
+
+	case *MapType:
+		t.token = &n.Token
+		t.add("key", toTree(n.Key))
+		t.add("value", toTree(n.Value))
+
+	case *GenericType:
+		t.token = &n.Token
+		t.add("name", n.Name)
+		t.add("args", treeList(n.Args))
+
+	case *FunctionType:
+		t.token = &n.Token
+		t.add("params", treeList(n.Params))
+		t.add("return", toTree(n.Return))
+
+	default:
+		panic(fmt.Sprintf("parser: cannot encode node type %T", n))
+	}
+
+	return t
+}
+
+func treeList[N Node](list []N) []*tree {
+	trees := make([]*tree, len(list))
+	for i, n := range list {
+		trees[i] = toTree(n)
+	}
+	return trees
+}
+
+// EncodeJSON writes an indented JSON representation of n to w.
+// Every node is an object with a "kind", its "token" (type, literal
+// and position) and one member per child or value field.
+func EncodeJSON(w io.Writer, n Node) error {
+	var buf bytes.Buffer
+	if err := toTree(n).writeJSON(&buf); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func (t *tree) writeJSON(buf *bytes.Buffer) error {
+	if t == nil {
+		buf.WriteString("null")
+		return nil
+	}
+
+	fmt.Fprintf(buf, `{"kind":%q`, t.kind)
+
+	if t.token != nil {
+		tok, err := json.Marshal(t.token)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(`,"token":`)
+		buf.Write(tok)
+	}
+
+	for _, f := range t.fields {
+		fmt.Fprintf(buf, ",%q:", f.name)
+
+		switch v := f.value.(type) {
+		case *tree:
+			if err := v.writeJSON(buf); err != nil {
+				return err
+			}
+		case []*tree:
+			buf.WriteByte('[')
+			for i, elem := range v {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := elem.writeJSON(buf); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf.Write(data)
+		}
+	}
+
+	buf.WriteByte('}')
+	return nil
+}
+
+// EncodeSexpr writes an S-expression representation of n to w.
+// A node is written as (Kind (TYPE "literal" line:column) :field value ...),
+// lists of nodes are enclosed in square brackets and absent children are nil.
+func EncodeSexpr(w io.Writer, n Node) error {
+	var buf bytes.Buffer
+	toTree(n).writeSexpr(&buf, 0)
+	buf.WriteByte('\n')
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func (t *tree) writeSexpr(buf *bytes.Buffer, depth int) {
+	if t == nil {
+		buf.WriteString("nil")
+		return
+	}
+
+	buf.WriteString("(" + t.kind)
+
+	if t.token != nil {
+		fmt.Fprintf(buf, " (%s %s %s)", t.token.Type, strconv.Quote(t.token.Literal), t.token.Pos)
+	}
+
+	// scalar fields stay on the node's line until the first child
+	// node has been written, after which every field gets its own line
+	indent := "\n" + strings.Repeat("  ", depth+1)
+	sep := " "
+
+	for _, f := range t.fields {
+		switch v := f.value.(type) {
+		case *tree:
+			sep = indent
+			buf.WriteString(sep + ":" + f.name + " ")
+			v.writeSexpr(buf, depth+1)
+		case []*tree:
+			sep = indent
+			buf.WriteString(sep + ":" + f.name + " [")
+			for _, elem := range v {
+				buf.WriteString(indent + "  ")
+				elem.writeSexpr(buf, depth+2)
+			}
+			buf.WriteByte(']')
+		case string:
+			buf.WriteString(sep + ":" + f.name + " " + strconv.Quote(v))
+		case nil:
+			buf.WriteString(sep + ":" + f.name + " nil")
+		default:
+			fmt.Fprintf(buf, "%s:%s %v", sep, f.name, v)
+		}
+	}
+
+	buf.WriteByte(')')
+}
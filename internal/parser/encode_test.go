@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden AST fixtures in testdata")
+
+func TestEncodeRoundTrip(t *testing.T) {
+	program := parseInput(t, walkInput)
+
+	formats := []struct {
+		name   string
+		encode func(*bytes.Buffer, Node) error
+		decode func(*bytes.Buffer) (Node, error)
+	}{
+		{"json", func(b *bytes.Buffer, n Node) error { return EncodeJSON(b, n) },
+			func(b *bytes.Buffer) (Node, error) { return DecodeJSON(b) }},
+		{"sexpr", func(b *bytes.Buffer, n Node) error { return EncodeSexpr(b, n) },
+			func(b *bytes.Buffer) (Node, error) { return DecodeSexpr(b) }},
+	}
+
+	for _, f := range formats {
+		var buf bytes.Buffer
+		if err := f.encode(&buf, program); err != nil {
+			t.Fatalf("%s: encode failed: %v", f.name, err)
+		}
+		encoded := buf.String()
+		t.Logf("%s encoding:\n%s", f.name, encoded)
+
+		decoded, err := f.decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: decode failed: %v", f.name, err)
+		}
+
+		if !reflect.DeepEqual(decoded, program) {
+			t.Errorf("%s: decoded AST differs from parsed AST", f.name)
+		}
+
+		buf.Reset()
+		if err := f.encode(&buf, decoded); err != nil {
+			t.Fatalf("%s: re-encode failed: %v", f.name, err)
+		}
+		if buf.String() != encoded {
+			t.Errorf("%s: re-encoded output differs.\nexpected:\n%s\ngot:\n%s", f.name, encoded, buf.String())
+		}
+	}
+}
+
+func TestEncodePositions(t *testing.T) {
+	program := parseInput(t, "let x = 5\n  add(x)")
+
+	var buf bytes.Buffer
+	if err := EncodeSexpr(&buf, program); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`(LetStatement (LET "let" 1:1)`,
+		`(IntegerLiteral (INT "5" 1:9) :value 5)`,
+		`(CallExpression (LEFT_PAREN "(" 2:6)`,
+		`(Identifier (IDENT "x" 2:7) :value "x")`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("encoding does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Bogus"}`, "Bogus: unknown node kind"},
+		{`{"kind": "Identifier", "value": "x"}`, "Identifier: missing token"},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier", "token": {"type": "IDENT", "literal": "x"}, "value": "x"}]}`,
+			"Program: field statements cannot contain a Identifier"},
+		{`{"kind": "Boolean", "token": {"type": "NOPE", "literal": "x"}}`, `unknown token type "NOPE"`},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeJSON(strings.NewReader(tt.input))
+		if err == nil {
+			t.Errorf("expected error decoding %s", tt.input)
+			continue
+		}
+		t.Logf("decode error: %v", err)
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+
+	if _, err := DecodeSexpr(strings.NewReader(`(Program :statements [`)); err == nil {
+		t.Errorf("expected error decoding unterminated S-expression")
+	}
+}
+
+// TestGoldenAST parses every testdata/*.gt file and compares the result
+// with the AST stored in the matching .json fixture. Run the test with
+// -update to regenerate the fixtures.
+func TestGoldenAST(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.gt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program := parseInput(t, string(src))
+		golden := strings.TrimSuffix(file, ".gt") + ".json"
+
+		if *update {
+			var buf bytes.Buffer
+			if err := EncodeJSON(&buf, program); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		f, err := os.Open(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := DecodeJSON(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", golden, err)
+		}
+
+		t.Logf("comparing %s with %s", file, golden)
+		if !reflect.DeepEqual(program, expected) {
+			t.Errorf("%s: parsed AST does not match %s", file, golden)
+		}
+	}
+}
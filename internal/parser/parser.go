@@ -16,6 +16,11 @@ type Parser struct {
 
 	prefixParseFns map[lexer.TokenType]prefixParseFn
 	infixParseFns  map[lexer.TokenType]infixParseFn
+
+	// noStructLiteral is set while parsing the header of an if or for,
+	// where `x {` begins the body rather than a struct literal. It is
+	// cleared again inside parentheses, brackets and blocks.
+	noStructLiteral bool
 }
 
 type (
@@ -34,25 +39,32 @@ const (
 	PRODUCT
 	PREFIX
 	CALL
+	INDEX
+	SELECTOR
 )
 
 var precedences = map[lexer.TokenType]int{
-	lexer.EQ:         EQUALS,
-	lexer.NOT_EQ:     EQUALS,
-	lexer.LT:         LESSGREATER,
-	lexer.GT:         LESSGREATER,
-	lexer.PLUS:       SUM,
-	lexer.MINUS:      SUM,
-	lexer.SLASH:      PRODUCT,
-	lexer.ASTERISK:   PRODUCT,
-	lexer.MOD:        PRODUCT,
-	lexer.AND:        AND,
-	lexer.OR:         OR,
-	lexer.LEFT_PAREN: CALL,
+	lexer.EQ:           EQUALS,
+	lexer.NOT_EQ:       EQUALS,
+	lexer.LT:           LESSGREATER,
+	lexer.GT:           LESSGREATER,
+	lexer.PLUS:         SUM,
+	lexer.MINUS:        SUM,
+	lexer.CONCAT:       SUM,
+	lexer.SLASH:        PRODUCT,
+	lexer.ASTERISK:     PRODUCT,
+	lexer.MOD:          PRODUCT,
+	lexer.AND:          AND,
+	lexer.OR:           OR,
+	lexer.LEFT_PAREN:   CALL,
+	lexer.LEFT_BRACKET: INDEX,
+	lexer.DOT:          SELECTOR,
+	lexer.QUESTION:     SELECTOR,
 }
 
 type Node interface {
 	TokenLiteral() string
+	Pos() lexer.Position
 }
 
 type Statement interface {
@@ -65,6 +77,19 @@ type Expression interface {
 	expressionNode()
 }
 
+// TypeExpr is a type annotation such as `int`, `[str]` or `fn(int) -> bool`.
+type TypeExpr interface {
+	Node
+	typeNode()
+}
+
+// Pattern is a pattern in a match arm, such as `_`, `n`, `1` or
+// `Circle(r)`.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
 type Program struct {
 	Statements []Statement
 }
@@ -76,14 +101,76 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() lexer.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return lexer.Position{}
+}
+
+// LetStatement declares a variable, either as `let x: T = v` or as
+// the short form `x ;= v`. Type is nil when there is no annotation.
+// Ok is the second name of a comma-ok lookup, `let v, ok = m[k]`,
+// and nil otherwise.
+//
+// Zero is the zero value v is bound to when the key is missing, which
+// the type checker fills in from the map's value type: a literal, a
+// struct literal of zero values, or `None`. It is nil for types with
+// no zero value, whose v is null.
 type LetStatement struct {
 	Token lexer.Token
 	Name  *Identifier
+	Ok    *Identifier
+	Type  TypeExpr
 	Value Expression
+	Zero  Expression
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() lexer.Position  { return ls.Token.Pos }
+
+// AssignStatement assigns to an existing variable, element or field,
+// as in `x = v`, `xs[i] = v` or `p.x = v`.
+type AssignStatement struct {
+	Token  lexer.Token
+	Target Expression
+	Value  Expression
+}
+
+func (as *AssignStatement) statementNode()       {}
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssignStatement) Pos() lexer.Position  { return as.Token.Pos }
+
+// ForStatement is a loop of the form `for init, cond, post { ... }`,
+// `for cond { ... }` or `for { ... }`. Init, Condition and Post are
+// nil when omitted.
+type ForStatement struct {
+	Token     lexer.Token
+	Init      Statement
+	Condition Expression
+	Post      Statement
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() lexer.Position  { return fs.Token.Pos }
+
+// ForInStatement iterates over an array, map or string, as in
+// `for v in xs { ... }` or `for k, v in m { ... }`. Value is nil in
+// the single variable form.
+type ForInStatement struct {
+	Token    lexer.Token
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) Pos() lexer.Position  { return fs.Token.Pos }
 
 type ReturnStatement struct {
 	Token       lexer.Token
@@ -92,6 +179,19 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() lexer.Position  { return rs.Token.Pos }
+
+// DeferStatement is `defer f(x)`. The function and its arguments are
+// evaluated when the statement runs, and the call is made when the
+// enclosing function returns.
+type DeferStatement struct {
+	Token lexer.Token
+	Call  *CallExpression
+}
+
+func (ds *DeferStatement) statementNode()       {}
+func (ds *DeferStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DeferStatement) Pos() lexer.Position  { return ds.Token.Pos }
 
 type ExpressionStatement struct {
 	Token      lexer.Token
@@ -100,6 +200,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() lexer.Position  { return es.Token.Pos }
 
 type Identifier struct {
 	Token lexer.Token
@@ -108,6 +209,7 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() lexer.Position  { return i.Token.Pos }
 
 type IntegerLiteral struct {
 	Token lexer.Token
@@ -116,6 +218,16 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() lexer.Position  { return il.Token.Pos }
+
+type FloatLiteral struct {
+	Token lexer.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() lexer.Position  { return fl.Token.Pos }
 
 type StringLiteral struct {
 	Token lexer.Token
@@ -124,6 +236,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() lexer.Position  { return sl.Token.Pos }
 
 type Boolean struct {
 	Token lexer.Token
@@ -132,6 +245,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() lexer.Position  { return b.Token.Pos }
 
 type PrefixExpression struct {
 	Token    lexer.Token
@@ -141,6 +255,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() lexer.Position  { return pe.Token.Pos }
 
 type InfixExpression struct {
 	Token    lexer.Token
@@ -151,6 +266,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() lexer.Position  { return ie.Token.Pos }
 
 type IfExpression struct {
 	Token       lexer.Token
@@ -161,6 +277,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() lexer.Position  { return ie.Token.Pos }
 
 type BlockStatement struct {
 	Token      lexer.Token
@@ -169,15 +286,181 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() lexer.Position  { return bs.Token.Pos }
 
+// FunctionLiteral is a function expression. ParamTypes is parallel to
+// Parameters and holds nil for parameters without an annotation;
+// ReturnType is nil when the `-> T` clause is omitted. TypeParams is
+// empty unless the function is generic, `fn[T](x: T)`.
 type FunctionLiteral struct {
 	Token      lexer.Token
+	TypeParams []*TypeParam
 	Parameters []*Identifier
+	ParamTypes []TypeExpr
+	ReturnType TypeExpr
 	Body       *BlockStatement
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() lexer.Position  { return fl.Token.Pos }
+
+// FunctionStatement declares a named function, `fn name(...) { ... }`.
+type FunctionStatement struct {
+	Token    lexer.Token
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) Pos() lexer.Position  { return fs.Token.Pos }
+
+// StructStatement declares a struct type, `struct Name { field: T, ... }`.
+// Fields and FieldTypes are parallel.
+type StructStatement struct {
+	Token      lexer.Token
+	Name       *Identifier
+	TypeParams []*TypeParam
+	Fields     []*Identifier
+	FieldTypes []TypeExpr
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) Pos() lexer.Position  { return ss.Token.Pos }
+
+// ImplStatement is a block of methods for a struct type,
+// `impl Name { fn method(self, ...) { ... } ... }`. Trait is the trait
+// the methods implement, `impl Trait for Name { ... }`, or nil.
+type ImplStatement struct {
+	Token      lexer.Token
+	Trait      *Identifier
+	Name       *Identifier
+	TypeParams []*TypeParam
+	Methods    []*FunctionStatement
+}
+
+func (is *ImplStatement) statementNode()       {}
+func (is *ImplStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImplStatement) Pos() lexer.Position  { return is.Token.Pos }
+
+// TraitStatement declares a trait, the methods a type implementing it
+// must have, `trait Name { fn method(self, ...) -> T ... }`.
+type TraitStatement struct {
+	Token   lexer.Token
+	Name    *Identifier
+	Methods []*TraitMethod
+}
+
+func (ts *TraitStatement) statementNode()       {}
+func (ts *TraitStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TraitStatement) Pos() lexer.Position  { return ts.Token.Pos }
+
+// TraitMethod is the signature of a method of a trait. Its first
+// parameter is the receiver, and ParamTypes and ReturnType may name
+// Self, the type implementing the trait.
+type TraitMethod struct {
+	Token      lexer.Token
+	Name       *Identifier
+	Parameters []*Identifier
+	ParamTypes []TypeExpr
+	ReturnType TypeExpr
+}
+
+func (tm *TraitMethod) TokenLiteral() string { return tm.Token.Literal }
+func (tm *TraitMethod) Pos() lexer.Position  { return tm.Token.Pos }
+
+// EnumStatement declares an enum type,
+// `enum Name { Variant, Variant(T, ...), ... }`.
+type EnumStatement struct {
+	Token    lexer.Token
+	Name     *Identifier
+	Variants []*EnumVariant
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) Pos() lexer.Position  { return es.Token.Pos }
+
+// EnumVariant is one variant of an enum declaration. Fields holds the
+// types of its payload and is empty for variants without one.
+type EnumVariant struct {
+	Token  lexer.Token
+	Name   *Identifier
+	Fields []TypeExpr
+}
+
+func (ev *EnumVariant) TokenLiteral() string { return ev.Token.Literal }
+func (ev *EnumVariant) Pos() lexer.Position  { return ev.Token.Pos }
+
+// MatchExpression is `match subject { pattern => body, ... }`. Its value
+// is the value of the body of the first arm that matches.
+type MatchExpression struct {
+	Token   lexer.Token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() lexer.Position  { return me.Token.Pos }
+
+// MatchArm is `pattern if guard => body`. Guard is nil when omitted.
+// A body written as a single statement is wrapped in a block.
+type MatchArm struct {
+	Token   lexer.Token
+	Pattern Pattern
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+func (ma *MatchArm) Pos() lexer.Position  { return ma.Token.Pos }
+
+// WildcardPattern is `_`, which matches anything.
+type WildcardPattern struct {
+	Token lexer.Token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) Pos() lexer.Position  { return wp.Token.Pos }
+
+// IdentPattern is a bare name. It matches a variant without a payload
+// if one of that name is declared, and otherwise matches anything and
+// binds the value to the name.
+type IdentPattern struct {
+	Token lexer.Token
+	Value string
+}
+
+func (ip *IdentPattern) patternNode()         {}
+func (ip *IdentPattern) TokenLiteral() string { return ip.Token.Literal }
+func (ip *IdentPattern) Pos() lexer.Position  { return ip.Token.Pos }
+
+// LiteralPattern matches a value equal to a literal. Value is an
+// integer, float, string or boolean literal, or a negated number.
+type LiteralPattern struct {
+	Token lexer.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) Pos() lexer.Position  { return lp.Token.Pos }
+
+// ConstructorPattern is `Variant(p1, p2, ...)`, matching a variant whose
+// payload matches the argument patterns.
+type ConstructorPattern struct {
+	Token lexer.Token
+	Name  *Identifier
+	Args  []Pattern
+}
+
+func (cp *ConstructorPattern) patternNode()         {}
+func (cp *ConstructorPattern) TokenLiteral() string { return cp.Token.Literal }
+func (cp *ConstructorPattern) Pos() lexer.Position  { return cp.Token.Pos }
 
 type CallExpression struct {
 	Token     lexer.Token
@@ -187,6 +470,166 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() lexer.Position  { return ce.Token.Pos }
+
+type ArrayLiteral struct {
+	Token    lexer.Token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() lexer.Position  { return al.Token.Pos }
+
+type IndexExpression struct {
+	Token lexer.Token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() lexer.Position  { return ie.Token.Pos }
+
+// SelectorExpression is `left.field`, selecting a field or method of
+// a struct value.
+type SelectorExpression struct {
+	Token lexer.Token
+	Left  Expression
+	Field *Identifier
+}
+
+func (se *SelectorExpression) expressionNode()      {}
+func (se *SelectorExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SelectorExpression) Pos() lexer.Position  { return se.Token.Pos }
+
+// StructLiteral is `Name { field: value, ... }`. Fields and Values are
+// parallel and kept in source order.
+type StructLiteral struct {
+	Token  lexer.Token
+	Name   *Identifier
+	Fields []*Identifier
+	Values []Expression
+}
+
+func (sl *StructLiteral) expressionNode()      {}
+func (sl *StructLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StructLiteral) Pos() lexer.Position  { return sl.Token.Pos }
+
+// MapLiteral is `{k1: v1, k2: v2}`. Keys and Values are parallel and
+// kept in source order, which is also the map's iteration order.
+type MapLiteral struct {
+	Token  lexer.Token
+	Keys   []Expression
+	Values []Expression
+}
+
+func (ml *MapLiteral) expressionNode()      {}
+func (ml *MapLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MapLiteral) Pos() lexer.Position  { return ml.Token.Pos }
+
+// SliceExpression is `left[low:high]`; Low and High may be nil.
+type SliceExpression struct {
+	Token lexer.Token
+	Left  Expression
+	Low   Expression
+	High  Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() lexer.Position  { return se.Token.Pos }
+
+// TryExpression is `left?`. It unwraps an Option or Result, returning
+// early from the enclosing function on None or Err.
+type TryExpression struct {
+	Token lexer.Token // the '?' token
+	Left  Expression
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() lexer.Position  { return te.Token.Pos }
+
+// TryCatchExpression is `try { ... } catch e { ... }`. If Body raises
+// a runtime error, Handler runs with Name bound to its message.
+type TryCatchExpression struct {
+	Token   lexer.Token // the 'try' token
+	Body    *BlockStatement
+	Name    *Identifier
+	Handler *BlockStatement
+}
+
+func (te *TryCatchExpression) expressionNode()      {}
+func (te *TryCatchExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryCatchExpression) Pos() lexer.Position  { return te.Token.Pos }
+
+// TypeParam declares a type parameter of a generic function or
+// struct, the T of `fn first[T](xs: [T]) -> T`. Bounds names the traits
+// its type arguments must implement, `[T: Display + Eq]`.
+type TypeParam struct {
+	Token  lexer.Token
+	Name   string
+	Bounds []*Identifier
+}
+
+func (tp *TypeParam) TokenLiteral() string { return tp.Token.Literal }
+func (tp *TypeParam) Pos() lexer.Position  { return tp.Token.Pos }
+
+// NamedType refers to a type by name, such as int, str or bool.
+type NamedType struct {
+	Token lexer.Token
+	Name  string
+}
+
+func (nt *NamedType) typeNode()            {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Literal }
+func (nt *NamedType) Pos() lexer.Position  { return nt.Token.Pos }
+
+// ArrayType is `[Elem]`.
+type ArrayType struct {
+	Token lexer.Token
+	Elem  TypeExpr
+}
+
+func (at *ArrayType) typeNode()            {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Literal }
+func (at *ArrayType) Pos() lexer.Position  { return at.Token.Pos }
+
+// MapType is `map[Key]Value`.
+type MapType struct {
+	Token lexer.Token
+	Key   TypeExpr
+	Value TypeExpr
+}
+
+func (mt *MapType) typeNode()            {}
+func (mt *MapType) TokenLiteral() string { return mt.Token.Literal }
+func (mt *MapType) Pos() lexer.Position  { return mt.Token.Pos }
+
+// GenericType applies a generic type to arguments, as in
+// `Result[int, str]`.
+type GenericType struct {
+	Token lexer.Token
+	Name  string
+	Args  []TypeExpr
+}
+
+func (gt *GenericType) typeNode()            {}
+func (gt *GenericType) TokenLiteral() string { return gt.Token.Literal }
+func (gt *GenericType) Pos() lexer.Position  { return gt.Token.Pos }
+
+// FunctionType is `fn(Params...) -> Return`; Return is nil for
+// functions that return nothing.
+type FunctionType struct {
+	Token  lexer.Token
+	Params []TypeExpr
+	Return TypeExpr
+}
+
+func (ft *FunctionType) typeNode()            {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Literal }
+func (ft *FunctionType) Pos() lexer.Position  { return ft.Token.Pos }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
@@ -197,6 +640,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[lexer.TokenType]prefixParseFn)
 	p.registerPrefix(lexer.IDENT, p.parseIdentifier)
 	p.registerPrefix(lexer.INT, p.parseIntegerLiteral)
+	p.registerPrefix(lexer.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(lexer.STRING, p.parseStringLiteral)
 	p.registerPrefix(lexer.BANG, p.parsePrefixExpression)
 	p.registerPrefix(lexer.MINUS, p.parsePrefixExpression)
@@ -204,7 +648,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(lexer.FALSE, p.parseBoolean)
 	p.registerPrefix(lexer.LEFT_PAREN, p.parseGroupedExpression)
 	p.registerPrefix(lexer.IF, p.parseIfExpression)
+	p.registerPrefix(lexer.MATCH, p.parseMatchExpression)
+	p.registerPrefix(lexer.TRY, p.parseTryCatchExpression)
 	p.registerPrefix(lexer.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(lexer.LEFT_BRACKET, p.parseArrayLiteral)
+	p.registerPrefix(lexer.LEFT_BRACE, p.parseMapLiteral)
 
 	p.infixParseFns = make(map[lexer.TokenType]infixParseFn)
 	p.registerInfix(lexer.PLUS, p.parseInfixExpression)
@@ -218,7 +666,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(lexer.GT, p.parseInfixExpression)
 	p.registerInfix(lexer.AND, p.parseInfixExpression)
 	p.registerInfix(lexer.OR, p.parseInfixExpression)
+	p.registerInfix(lexer.CONCAT, p.parseInfixExpression)
 	p.registerInfix(lexer.LEFT_PAREN, p.parseCallExpression)
+	p.registerInfix(lexer.LEFT_BRACKET, p.parseIndexExpression)
+	p.registerInfix(lexer.DOT, p.parseSelectorExpression)
+	p.registerInfix(lexer.QUESTION, p.parseTryExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -233,6 +685,9 @@ func (p *Parser) Errors() []string {
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	for p.peekTokenIs(lexer.COMMENT_SINGLE) || p.peekTokenIs(lexer.COMMENT_MULTI) {
+		p.peekToken = p.l.NextToken()
+	}
 }
 
 func (p *Parser) ParseProgram() *Program {
@@ -255,6 +710,23 @@ func (p *Parser) parseStatement() Statement {
 		return p.parseLetStatement()
 	case lexer.RETURN:
 		return p.parseReturnStatement()
+	case lexer.DEFER:
+		return p.parseDeferStatement()
+	case lexer.FOR:
+		return p.parseForStatement()
+	case lexer.STRUCT:
+		return p.parseStructStatement()
+	case lexer.IMPL:
+		return p.parseImplStatement()
+	case lexer.ENUM:
+		return p.parseEnumStatement()
+	case lexer.TRAIT:
+		return p.parseTraitStatement()
+	case lexer.FUNCTION:
+		if p.peekTokenIs(lexer.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -269,6 +741,20 @@ func (p *Parser) parseLetStatement() *LetStatement {
 
 	stmt.Name = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 
+	if p.peekTokenIs(lexer.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.Ok = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	}
+
+	if p.peekTokenIs(lexer.COLON) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Type = p.parseType()
+	}
+
 	if !p.expectPeek(lexer.ASSIGN) {
 		return nil
 	}
@@ -298,9 +784,17 @@ func (p *Parser) parseReturnStatement() *ReturnStatement {
 	return stmt
 }
 
-func (p *Parser) parseExpressionStatement() *ExpressionStatement {
-	stmt := &ExpressionStatement{Token: p.currentToken}
-	stmt.Expression = p.parseExpression(LOWEST)
+func (p *Parser) parseDeferStatement() *DeferStatement {
+	stmt := &DeferStatement{Token: p.currentToken}
+
+	p.nextToken()
+
+	call, ok := p.parseExpression(LOWEST).(*CallExpression)
+	if !ok {
+		p.errorf(stmt.Token, "expression in defer must be a function call")
+		return nil
+	}
+	stmt.Call = call
 
 	if p.peekTokenIs(lexer.SEMICOLON) {
 		p.nextToken()
@@ -309,134 +803,394 @@ func (p *Parser) parseExpressionStatement() *ExpressionStatement {
 	return stmt
 }
 
-func (p *Parser) parseExpression(precedence int) Expression {
-	prefix := p.prefixParseFns[p.currentToken.Type]
-	if prefix == nil {
-		p.noPrefixParseFnError(p.currentToken.Type)
-		return nil
-	}
-	leftExp := prefix()
+func (p *Parser) parseExpressionStatement() Statement {
+	stmt := &ExpressionStatement{Token: p.currentToken}
+	stmt.Expression = p.parseExpression(LOWEST)
 
-	for !p.peekTokenIs(lexer.SEMICOLON) && precedence < p.peekPrecedence() {
-		infix := p.infixParseFns[p.peekToken.Type]
-		if infix == nil {
-			return leftExp
+	switch {
+	case p.peekTokenIs(lexer.ASSIGN):
+		return p.parseAssignStatement(stmt.Expression)
+	case p.peekTokenIs(lexer.INC) || p.peekTokenIs(lexer.DEC):
+		return p.parseIncDecStatement(stmt.Expression)
+	case p.peekTokenIs(lexer.COMMA):
+		if name, ok := stmt.Expression.(*Identifier); ok && p.shortCommaOk() {
+			return p.parseCommaOkDeclaration(name)
 		}
+	}
 
+	if p.peekTokenIs(lexer.SEMICOLON) {
 		p.nextToken()
-		leftExp = infix(leftExp)
 	}
 
-	return leftExp
+	return stmt
 }
 
-func (p *Parser) registerPrefix(tokenType lexer.TokenType, fn prefixParseFn) {
-	p.prefixParseFns[tokenType] = fn
-}
+// parseAssignStatement parses the rest of `target = value`, or of the
+// short variable declaration `name ;= value`.
+func (p *Parser) parseAssignStatement(target Expression) Statement {
+	p.nextToken()
+	token := p.currentToken
 
-func (p *Parser) registerInfix(tokenType lexer.TokenType, fn infixParseFn) {
-	p.infixParseFns[tokenType] = fn
-}
+	p.nextToken()
+	value := p.parseExpression(LOWEST)
 
-func (p *Parser) parseIdentifier() Expression {
-	return &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-}
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
 
-func (p *Parser) parseIntegerLiteral() Expression {
-	lit := &IntegerLiteral{Token: p.currentToken}
+	if token.Literal == ";=" {
+		name, ok := target.(*Identifier)
+		if !ok {
+			p.errorf(token, "cannot declare %s with ;=, expected a name", target.TokenLiteral())
+			return nil
+		}
+		return &LetStatement{Token: token, Name: name, Value: value}
+	}
 
-	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
-	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+	switch target.(type) {
+	case *Identifier, *IndexExpression, *SelectorExpression:
+	default:
+		if target != nil {
+			p.errorf(token, "cannot assign to %s", target.TokenLiteral())
+		}
 		return nil
 	}
 
-	lit.Value = value
-	return lit
-}
-
-func (p *Parser) parseStringLiteral() Expression {
-	return &StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+	return &AssignStatement{Token: token, Target: target, Value: value}
 }
 
-func (p *Parser) parseBoolean() Expression {
-	return &Boolean{Token: p.currentToken, Value: p.curTokenIs(lexer.TRUE)}
-}
+// parseIncDecStatement parses `target++` and `target--`, which are
+// shorthand for `target = target + 1` and `target = target - 1`.
+func (p *Parser) parseIncDecStatement(target Expression) Statement {
+	p.nextToken()
+	token := p.currentToken
 
-func (p *Parser) parsePrefixExpression() Expression {
-	expression := &PrefixExpression{
-		Token:    p.currentToken,
-		Operator: p.currentToken.Literal,
+	switch target.(type) {
+	case *Identifier, *IndexExpression, *SelectorExpression:
+	default:
+		if target != nil {
+			p.errorf(token, "cannot apply %s to %s", token.Literal, target.TokenLiteral())
+		}
+		return nil
 	}
 
-	p.nextToken()
+	operator := "+"
+	if token.Type == lexer.DEC {
+		operator = "-"
+	}
 
-	expression.Right = p.parseExpression(PREFIX)
+	return &AssignStatement{
+		Token:  token,
+		Target: target,
+		Value: &InfixExpression{
+			Token:    lexer.Token{Type: lexer.PLUS, Literal: operator, Pos: token.Pos},
+			Left:     target,
+			Operator: operator,
+			Right:    &IntegerLiteral{Token: lexer.Token{Type: lexer.INT, Literal: "1", Pos: token.Pos}, Value: 1},
+		},
+	}
+}
 
-	return expression
+// shortCommaOk reports whether the tokens after the current name
+// continue a short comma-ok declaration, `v, ok ;= m[k]`.
+func (p *Parser) shortCommaOk() bool {
+	// the lexer can't be rewound, so look at a copy of it
+	l := *p.l
+	ok := l.NextToken()
+	assign := l.NextToken()
+	return ok.Type == lexer.IDENT && assign.Type == lexer.ASSIGN && assign.Literal == ";="
 }
 
-func (p *Parser) parseInfixExpression(left Expression) Expression {
-	expression := &InfixExpression{
-		Token:    p.currentToken,
-		Operator: p.currentToken.Literal,
-		Left:     left,
+func (p *Parser) parseCommaOkDeclaration(name *Identifier) Statement {
+	p.nextToken()
+	p.nextToken()
+	stmt := &LetStatement{
+		Name: name,
+		Ok:   &Identifier{Token: p.currentToken, Value: p.currentToken.Literal},
 	}
 
-	precedence := p.curPrecedence()
 	p.nextToken()
-	expression.Right = p.parseExpression(precedence)
+	stmt.Token = p.currentToken
 
-	return expression
-}
-
-func (p *Parser) parseGroupedExpression() Expression {
 	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
 
-	exp := p.parseExpression(LOWEST)
-
-	if !p.expectPeek(lexer.RIGHT_PAREN) {
-		return nil
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
 	}
 
-	return exp
+	return stmt
 }
 
-func (p *Parser) parseIfExpression() Expression {
-	expression := &IfExpression{Token: p.currentToken}
+func (p *Parser) parseForStatement() Statement {
+	stmt := &ForStatement{Token: p.currentToken}
 
-	if !p.expectPeek(lexer.LEFT_PAREN) {
-		return nil
+	if p.peekTokenIs(lexer.LEFT_BRACE) {
+		p.nextToken()
+		stmt.Body = p.parseBlockStatement()
+		return stmt
 	}
 
 	p.nextToken()
-	expression.Condition = p.parseExpression(LOWEST)
 
-	if !p.expectPeek(lexer.RIGHT_PAREN) {
-		return nil
+	if p.curTokenIs(lexer.IDENT) && (p.peekTokenIs(lexer.IN) || p.peekTokenIs(lexer.COMMA)) {
+		return p.parseForInStatement(stmt.Token)
 	}
 
-	if !p.expectPeek(lexer.LEFT_BRACE) {
-		return nil
-	}
+	outer := p.noStructLiteral
+	p.noStructLiteral = true
+	defer func() { p.noStructLiteral = outer }()
 
-	expression.Consequence = p.parseBlockStatement()
+	first := p.parseExpressionStatement()
 
-	if p.peekTokenIs(lexer.ELSE) {
+	if p.peekTokenIs(lexer.COMMA) {
+		stmt.Init = first
 		p.nextToken()
-
-		if !p.expectPeek(lexer.LEFT_BRACE) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+		if !p.expectPeek(lexer.COMMA) {
 			return nil
 		}
+		p.nextToken()
+		stmt.Post = p.parseExpressionStatement()
+	} else if es, ok := first.(*ExpressionStatement); ok {
+		stmt.Condition = es.Expression
+	} else if first != nil {
+		p.errorf(stmt.Token, "expected for loop condition, got %s", first.TokenLiteral())
+		return nil
+	}
 
-		expression.Alternative = p.parseBlockStatement()
+	if !p.expectPeek(lexer.LEFT_BRACE) {
+		return nil
 	}
+	stmt.Body = p.parseBlockStatement()
 
-	return expression
+	return stmt
+}
+
+func (p *Parser) parseForInStatement(token lexer.Token) Statement {
+	stmt := &ForInStatement{Token: token}
+	stmt.Key = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if p.peekTokenIs(lexer.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.Value = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	}
+
+	if !p.expectPeek(lexer.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseCondition()
+
+	if !p.expectPeek(lexer.LEFT_BRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
+func (p *Parser) parseExpression(precedence int) Expression {
+	prefix := p.prefixParseFns[p.currentToken.Type]
+	if prefix == nil {
+		p.noPrefixParseFnError(p.currentToken.Type)
+		return nil
+	}
+	leftExp := prefix()
+
+	for !p.peekTokenIs(lexer.SEMICOLON) && precedence < p.peekPrecedence() {
+		infix := p.infixParseFns[p.peekToken.Type]
+		if infix == nil {
+			return leftExp
+		}
+
+		// a ( or [ at the start of a line begins a new statement
+		// rather than calling or indexing the previous line
+		if (p.peekTokenIs(lexer.LEFT_PAREN) || p.peekTokenIs(lexer.LEFT_BRACKET)) &&
+			p.peekToken.Pos.Line > p.currentToken.Pos.Line {
+			return leftExp
+		}
+
+		p.nextToken()
+		leftExp = infix(leftExp)
+	}
+
+	return leftExp
+}
+
+func (p *Parser) registerPrefix(tokenType lexer.TokenType, fn prefixParseFn) {
+	p.prefixParseFns[tokenType] = fn
+}
+
+func (p *Parser) registerInfix(tokenType lexer.TokenType, fn infixParseFn) {
+	p.infixParseFns[tokenType] = fn
+}
+
+func (p *Parser) parseIdentifier() Expression {
+	ident := &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	if p.peekTokenIs(lexer.LEFT_BRACE) && !p.noStructLiteral {
+		return p.parseStructLiteral(ident)
+	}
+	return ident
+}
+
+// parseCondition parses the condition of an if or the iterable of a
+// for, where a struct literal would be ambiguous with the body.
+func (p *Parser) parseCondition() Expression {
+	outer := p.noStructLiteral
+	p.noStructLiteral = true
+	defer func() { p.noStructLiteral = outer }()
+
+	return p.parseExpression(LOWEST)
+}
+
+// allowStructLiterals re-enables struct literals inside a delimited
+// expression and returns a function restoring the previous setting.
+func (p *Parser) allowStructLiterals() func() {
+	outer := p.noStructLiteral
+	p.noStructLiteral = false
+	return func() { p.noStructLiteral = outer }
+}
+
+func (p *Parser) parseIntegerLiteral() Expression {
+	lit := &IntegerLiteral{Token: p.currentToken}
+
+	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() Expression {
+	lit := &FloatLiteral{Token: p.currentToken}
+
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+	if err != nil {
+		p.errorf(p.currentToken, "could not parse %q as float", p.currentToken.Literal)
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseStringLiteral() Expression {
+	return &StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+}
+
+func (p *Parser) parseBoolean() Expression {
+	return &Boolean{Token: p.currentToken, Value: p.curTokenIs(lexer.TRUE)}
+}
+
+func (p *Parser) parsePrefixExpression() Expression {
+	expression := &PrefixExpression{
+		Token:    p.currentToken,
+		Operator: p.currentToken.Literal,
+	}
+
+	p.nextToken()
+
+	expression.Right = p.parseExpression(PREFIX)
+
+	return expression
+}
+
+func (p *Parser) parseInfixExpression(left Expression) Expression {
+	expression := &InfixExpression{
+		Token:    p.currentToken,
+		Operator: p.currentToken.Literal,
+		Left:     left,
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
+}
+
+func (p *Parser) parseGroupedExpression() Expression {
+	defer p.allowStructLiterals()()
+	p.nextToken()
+
+	exp := p.parseExpression(LOWEST)
+
+	if !p.expectPeek(lexer.RIGHT_PAREN) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseIfExpression() Expression {
+	expression := &IfExpression{Token: p.currentToken}
+
+	p.nextToken()
+	expression.Condition = p.parseCondition()
+
+	if !p.expectPeek(lexer.LEFT_BRACE) {
+		return nil
+	}
+
+	expression.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(lexer.ELSE) {
+		p.nextToken()
+
+		// `else if` is sugar for an else block holding another if expression
+		if p.peekTokenIs(lexer.IF) {
+			p.nextToken()
+			block := &BlockStatement{Token: p.currentToken}
+			block.Statements = []Statement{
+				&ExpressionStatement{Token: p.currentToken, Expression: p.parseIfExpression()},
+			}
+			expression.Alternative = block
+			return expression
+		}
+
+		if !p.expectPeek(lexer.LEFT_BRACE) {
+			return nil
+		}
+
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+func (p *Parser) parseTryCatchExpression() Expression {
+	expression := &TryCatchExpression{Token: p.currentToken}
+
+	if !p.expectPeek(lexer.LEFT_BRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(lexer.CATCH) || !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	expression.Name = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.expectPeek(lexer.LEFT_BRACE) {
+		return nil
+	}
+	expression.Handler = p.parseBlockStatement()
+
+	return expression
 }
 
 func (p *Parser) parseBlockStatement() *BlockStatement {
+	defer p.allowStructLiterals()()
 	block := &BlockStatement{Token: p.currentToken}
 	block.Statements = []Statement{}
 
@@ -454,13 +1208,24 @@ func (p *Parser) parseBlockStatement() *BlockStatement {
 }
 
 func (p *Parser) parseFunctionLiteral() Expression {
-	lit := &FunctionLiteral{Token: p.currentToken}
+	lit := &FunctionLiteral{Token: p.currentToken, TypeParams: []*TypeParam{}}
+
+	if p.peekTokenIs(lexer.LEFT_BRACKET) {
+		p.nextToken()
+		lit.TypeParams = p.parseTypeParams()
+	}
 
 	if !p.expectPeek(lexer.LEFT_PAREN) {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.ParamTypes = p.parseFunctionParameters()
+
+	if p.peekTokenIs(lexer.ARROW) {
+		p.nextToken()
+		p.nextToken()
+		lit.ReturnType = p.parseType()
+	}
 
 	if !p.expectPeek(lexer.LEFT_BRACE) {
 		return nil
@@ -471,32 +1236,168 @@ func (p *Parser) parseFunctionLiteral() Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*Identifier {
-	identifiers := []*Identifier{}
+func (p *Parser) parseFunctionStatement() Statement {
+	stmt := &FunctionStatement{Token: p.currentToken}
 
-	if p.peekTokenIs(lexer.RIGHT_PAREN) {
-		p.nextToken()
-		return identifiers
+	p.nextToken()
+	stmt.Name = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	lit, ok := p.parseFunctionLiteral().(*FunctionLiteral)
+	if !ok {
+		return nil
 	}
+	lit.Token = stmt.Token
+	stmt.Function = lit
 
-	p.nextToken()
+	return stmt
+}
 
-	ident := &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-	identifiers = append(identifiers, ident)
+// parseTypeParams parses the type parameters `[T, U]` of a generic
+// declaration, starting at the '['.
+func (p *Parser) parseTypeParams() []*TypeParam {
+	params := []*TypeParam{}
 
-	for p.peekTokenIs(lexer.COMMA) {
+	for {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		param := &TypeParam{Token: p.currentToken, Name: p.currentToken.Literal, Bounds: []*Identifier{}}
+		if p.peekTokenIs(lexer.COLON) {
+			p.nextToken()
+			for {
+				if !p.expectPeek(lexer.IDENT) {
+					return nil
+				}
+				param.Bounds = append(param.Bounds, &Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
+				if !p.peekTokenIs(lexer.PLUS) {
+					break
+				}
+				p.nextToken()
+			}
+		}
+		params = append(params, param)
+		if !p.peekTokenIs(lexer.COMMA) {
+			break
+		}
 		p.nextToken()
+	}
+
+	if !p.expectPeek(lexer.RIGHT_BRACKET) {
+		return nil
+	}
+	return params
+}
+
+func (p *Parser) parseFunctionParameters() ([]*Identifier, []TypeExpr) {
+	identifiers := []*Identifier{}
+	types := []TypeExpr{}
+
+	if p.peekTokenIs(lexer.RIGHT_PAREN) {
 		p.nextToken()
+		return identifiers, types
+	}
+
+	for {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil, nil
+		}
 
 		ident := &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 		identifiers = append(identifiers, ident)
+
+		var typ TypeExpr
+		if p.peekTokenIs(lexer.COLON) {
+			p.nextToken()
+			p.nextToken()
+			typ = p.parseType()
+		}
+		types = append(types, typ)
+
+		if !p.peekTokenIs(lexer.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
 	if !p.expectPeek(lexer.RIGHT_PAREN) {
-		return nil
+		return nil, nil
+	}
+
+	return identifiers, types
+}
+
+func (p *Parser) parseType() TypeExpr {
+	switch p.currentToken.Type {
+	case lexer.IDENT:
+		if p.currentToken.Literal == "map" && p.peekTokenIs(lexer.LEFT_BRACKET) {
+			typ := &MapType{Token: p.currentToken}
+			p.nextToken()
+			p.nextToken()
+			typ.Key = p.parseType()
+			if !p.expectPeek(lexer.RIGHT_BRACKET) {
+				return nil
+			}
+			p.nextToken()
+			typ.Value = p.parseType()
+			return typ
+		}
+		if p.peekTokenIs(lexer.LEFT_BRACKET) {
+			typ := &GenericType{Token: p.currentToken, Name: p.currentToken.Literal}
+			p.nextToken()
+			for {
+				p.nextToken()
+				typ.Args = append(typ.Args, p.parseType())
+				if !p.peekTokenIs(lexer.COMMA) {
+					break
+				}
+				p.nextToken()
+			}
+			if !p.expectPeek(lexer.RIGHT_BRACKET) {
+				return nil
+			}
+			return typ
+		}
+		return &NamedType{Token: p.currentToken, Name: p.currentToken.Literal}
+
+	case lexer.LEFT_BRACKET:
+		typ := &ArrayType{Token: p.currentToken}
+		p.nextToken()
+		typ.Elem = p.parseType()
+		if !p.expectPeek(lexer.RIGHT_BRACKET) {
+			return nil
+		}
+		return typ
+
+	case lexer.FUNCTION:
+		typ := &FunctionType{Token: p.currentToken, Params: []TypeExpr{}}
+		if !p.expectPeek(lexer.LEFT_PAREN) {
+			return nil
+		}
+		if p.peekTokenIs(lexer.RIGHT_PAREN) {
+			p.nextToken()
+		} else {
+			for {
+				p.nextToken()
+				typ.Params = append(typ.Params, p.parseType())
+				if !p.peekTokenIs(lexer.COMMA) {
+					break
+				}
+				p.nextToken()
+			}
+			if !p.expectPeek(lexer.RIGHT_PAREN) {
+				return nil
+			}
+		}
+		if p.peekTokenIs(lexer.ARROW) {
+			p.nextToken()
+			p.nextToken()
+			typ.Return = p.parseType()
+		}
+		return typ
 	}
 
-	return identifiers
+	p.errorf(p.currentToken, "expected type, got %v instead", p.currentToken.Type)
+	return nil
 }
 
 func (p *Parser) parseCallExpression(function Expression) Expression {
@@ -505,7 +1406,405 @@ func (p *Parser) parseCallExpression(function Expression) Expression {
 	return exp
 }
 
+func (p *Parser) parseArrayLiteral() Expression {
+	array := &ArrayLiteral{Token: p.currentToken}
+	array.Elements = p.parseExpressionList(lexer.RIGHT_BRACKET)
+	return array
+}
+
+func (p *Parser) parseMapLiteral() Expression {
+	defer p.allowStructLiterals()()
+	lit := &MapLiteral{Token: p.currentToken, Keys: []Expression{}, Values: []Expression{}}
+
+	for !p.peekTokenIs(lexer.RIGHT_BRACE) {
+		p.nextToken()
+		lit.Keys = append(lit.Keys, p.parseExpression(LOWEST))
+
+		if !p.expectPeek(lexer.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		lit.Values = append(lit.Values, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(lexer.RIGHT_BRACE) && !p.expectPeek(lexer.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(lexer.RIGHT_BRACE) {
+		return nil
+	}
+
+	return lit
+}
+
+// parseIndexExpression parses `left[index]` as well as the slice forms
+// `left[low:high]`, `left[low:]`, `left[:high]` and `left[:]`.
+func (p *Parser) parseIndexExpression(left Expression) Expression {
+	defer p.allowStructLiterals()()
+	token := p.currentToken
+
+	var low Expression
+	if !p.peekTokenIs(lexer.COLON) {
+		p.nextToken()
+		low = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(lexer.COLON) {
+		p.nextToken()
+		slice := &SliceExpression{Token: token, Left: left, Low: low}
+		if !p.peekTokenIs(lexer.RIGHT_BRACKET) {
+			p.nextToken()
+			slice.High = p.parseExpression(LOWEST)
+		}
+		if !p.expectPeek(lexer.RIGHT_BRACKET) {
+			return nil
+		}
+		return slice
+	}
+
+	if !p.expectPeek(lexer.RIGHT_BRACKET) {
+		return nil
+	}
+
+	return &IndexExpression{Token: token, Left: left, Index: low}
+}
+
+func (p *Parser) parseSelectorExpression(left Expression) Expression {
+	exp := &SelectorExpression{Token: p.currentToken, Left: left}
+
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	exp.Field = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	return exp
+}
+
+func (p *Parser) parseTryExpression(left Expression) Expression {
+	return &TryExpression{Token: p.currentToken, Left: left}
+}
+
+func (p *Parser) parseStructLiteral(name *Identifier) Expression {
+	p.nextToken()
+	lit := &StructLiteral{Token: p.currentToken, Name: name, Fields: []*Identifier{}, Values: []Expression{}}
+	defer p.allowStructLiterals()()
+
+	for !p.peekTokenIs(lexer.RIGHT_BRACE) {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		lit.Fields = append(lit.Fields, &Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
+
+		if !p.expectPeek(lexer.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		lit.Values = append(lit.Values, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(lexer.RIGHT_BRACE) && !p.expectPeek(lexer.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(lexer.RIGHT_BRACE) {
+		return nil
+	}
+
+	return lit
+}
+
+// parseStructStatement parses a struct declaration. Fields may be
+// separated by commas or newlines.
+func (p *Parser) parseStructStatement() Statement {
+	stmt := &StructStatement{
+		Token:      p.currentToken,
+		TypeParams: []*TypeParam{},
+		Fields:     []*Identifier{},
+		FieldTypes: []TypeExpr{},
+	}
+
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	stmt.Name = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if p.peekTokenIs(lexer.LEFT_BRACKET) {
+		p.nextToken()
+		stmt.TypeParams = p.parseTypeParams()
+	}
+
+	if !p.expectPeek(lexer.LEFT_BRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(lexer.RIGHT_BRACE) {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.Fields = append(stmt.Fields, &Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
+
+		if !p.expectPeek(lexer.COLON) {
+			return nil
+		}
+		p.nextToken()
+		stmt.FieldTypes = append(stmt.FieldTypes, p.parseType())
+
+		if p.peekTokenIs(lexer.COMMA) {
+			p.nextToken()
+		}
+	}
+
+	p.nextToken()
+
+	return stmt
+}
+
+func (p *Parser) parseImplStatement() Statement {
+	stmt := &ImplStatement{Token: p.currentToken, TypeParams: []*TypeParam{}, Methods: []*FunctionStatement{}}
+
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	stmt.Name = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if p.peekTokenIs(lexer.FOR) {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.Trait = stmt.Name
+		stmt.Name = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	}
+
+	if p.peekTokenIs(lexer.LEFT_BRACKET) {
+		p.nextToken()
+		stmt.TypeParams = p.parseTypeParams()
+	}
+
+	if !p.expectPeek(lexer.LEFT_BRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(lexer.RIGHT_BRACE) {
+		if !p.expectPeek(lexer.FUNCTION) || !p.peekTokenIs(lexer.IDENT) {
+			if p.curTokenIs(lexer.FUNCTION) {
+				p.peekError(lexer.IDENT)
+			}
+			return nil
+		}
+		method, ok := p.parseFunctionStatement().(*FunctionStatement)
+		if !ok {
+			return nil
+		}
+		stmt.Methods = append(stmt.Methods, method)
+	}
+
+	p.nextToken()
+
+	return stmt
+}
+
+func (p *Parser) parseTraitStatement() Statement {
+	stmt := &TraitStatement{Token: p.currentToken, Methods: []*TraitMethod{}}
+
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	stmt.Name = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.expectPeek(lexer.LEFT_BRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(lexer.RIGHT_BRACE) {
+		if !p.expectPeek(lexer.FUNCTION) {
+			return nil
+		}
+		method := &TraitMethod{Token: p.currentToken}
+
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		method.Name = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+		if !p.expectPeek(lexer.LEFT_PAREN) {
+			return nil
+		}
+		method.Parameters, method.ParamTypes = p.parseFunctionParameters()
+
+		if p.peekTokenIs(lexer.ARROW) {
+			p.nextToken()
+			p.nextToken()
+			method.ReturnType = p.parseType()
+		}
+
+		stmt.Methods = append(stmt.Methods, method)
+	}
+
+	p.nextToken()
+
+	return stmt
+}
+
+func (p *Parser) parseEnumStatement() Statement {
+	stmt := &EnumStatement{Token: p.currentToken, Variants: []*EnumVariant{}}
+
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	stmt.Name = &Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.expectPeek(lexer.LEFT_BRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(lexer.RIGHT_BRACE) {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		variant := &EnumVariant{
+			Token:  p.currentToken,
+			Name:   &Identifier{Token: p.currentToken, Value: p.currentToken.Literal},
+			Fields: []TypeExpr{},
+		}
+
+		if p.peekTokenIs(lexer.LEFT_PAREN) {
+			p.nextToken()
+			for !p.peekTokenIs(lexer.RIGHT_PAREN) {
+				p.nextToken()
+				variant.Fields = append(variant.Fields, p.parseType())
+				if !p.peekTokenIs(lexer.RIGHT_PAREN) && !p.expectPeek(lexer.COMMA) {
+					return nil
+				}
+			}
+			p.nextToken()
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+
+		if p.peekTokenIs(lexer.COMMA) {
+			p.nextToken()
+		}
+	}
+
+	p.nextToken()
+
+	return stmt
+}
+
+// parseMatchExpression parses a match expression. Arms may be
+// separated by commas or newlines.
+func (p *Parser) parseMatchExpression() Expression {
+	exp := &MatchExpression{Token: p.currentToken, Arms: []*MatchArm{}}
+
+	p.nextToken()
+	exp.Subject = p.parseCondition()
+
+	if !p.expectPeek(lexer.LEFT_BRACE) {
+		return nil
+	}
+	defer p.allowStructLiterals()()
+
+	for !p.peekTokenIs(lexer.RIGHT_BRACE) {
+		p.nextToken()
+		arm := &MatchArm{Token: p.currentToken, Pattern: p.parsePattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+
+		if p.peekTokenIs(lexer.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+
+		if !p.expectPeek(lexer.FAT_ARROW) {
+			return nil
+		}
+		p.nextToken()
+
+		if p.curTokenIs(lexer.LEFT_BRACE) {
+			arm.Body = p.parseBlockStatement()
+		} else {
+			arm.Body = &BlockStatement{Token: p.currentToken, Statements: []Statement{}}
+			if stmt := p.parseStatement(); stmt != nil {
+				arm.Body.Statements = append(arm.Body.Statements, stmt)
+			}
+		}
+		exp.Arms = append(exp.Arms, arm)
+
+		if p.peekTokenIs(lexer.COMMA) {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(lexer.RIGHT_BRACE) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parsePattern() Pattern {
+	switch p.currentToken.Type {
+	case lexer.IDENT:
+		if p.currentToken.Literal == "_" {
+			return &WildcardPattern{Token: p.currentToken}
+		}
+		if !p.peekTokenIs(lexer.LEFT_PAREN) {
+			return &IdentPattern{Token: p.currentToken, Value: p.currentToken.Literal}
+		}
+
+		pat := &ConstructorPattern{
+			Token: p.currentToken,
+			Name:  &Identifier{Token: p.currentToken, Value: p.currentToken.Literal},
+			Args:  []Pattern{},
+		}
+		p.nextToken()
+		for !p.peekTokenIs(lexer.RIGHT_PAREN) {
+			p.nextToken()
+			arg := p.parsePattern()
+			if arg == nil {
+				return nil
+			}
+			pat.Args = append(pat.Args, arg)
+			if !p.peekTokenIs(lexer.RIGHT_PAREN) && !p.expectPeek(lexer.COMMA) {
+				return nil
+			}
+		}
+		p.nextToken()
+		return pat
+
+	case lexer.INT, lexer.FLOAT, lexer.STRING, lexer.TRUE, lexer.FALSE:
+		token := p.currentToken
+		value := p.prefixParseFns[token.Type]()
+		if value == nil {
+			return nil
+		}
+		return &LiteralPattern{Token: token, Value: value}
+
+	case lexer.MINUS:
+		token := p.currentToken
+		if !p.peekTokenIs(lexer.INT) && !p.peekTokenIs(lexer.FLOAT) {
+			p.errorf(p.peekToken, "expected number after - in pattern, got %s", p.peekToken.Type)
+			return nil
+		}
+		p.nextToken()
+		value := p.prefixParseFns[p.currentToken.Type]()
+		if value == nil {
+			return nil
+		}
+		return &LiteralPattern{Token: token, Value: &PrefixExpression{Token: token, Operator: "-", Right: value}}
+	}
+
+	p.errorf(p.currentToken, "expected pattern, got %s", p.currentToken.Type)
+	return nil
+}
+
 func (p *Parser) parseExpressionList(end lexer.TokenType) []Expression {
+	defer p.allowStructLiterals()()
 	list := []Expression{}
 
 	if p.peekTokenIs(end) {
@@ -547,14 +1846,17 @@ func (p *Parser) expectPeek(t lexer.TokenType) bool {
 }
 
 func (p *Parser) peekError(t lexer.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %v, got %v instead",
+	p.errorf(p.peekToken, "expected next token to be %v, got %v instead",
 		t, p.peekToken.Type)
+}
+
+func (p *Parser) errorf(tok lexer.Token, format string, args ...any) {
+	msg := fmt.Sprintf("%s: %s", tok.Pos, fmt.Sprintf(format, args...))
 	p.errors = append(p.errors, msg)
 }
 
 func (p *Parser) noPrefixParseFnError(t lexer.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %v found", t)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.currentToken, "no prefix parse function for %v found", t)
 }
 
 func (p *Parser) curPrecedence() int {
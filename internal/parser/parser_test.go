@@ -194,3 +194,731 @@ func testIntegerLiteral(t *testing.T, il Expression, value int64) bool {
 
 	return true
 }
+
+func TestArrayLiteral(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+	t.Logf("Testing array literal parsing with input: %q", input)
+
+	program := parseInput(t, input)
+
+	stmt := program.Statements[0].(*ExpressionStatement)
+	array, ok := stmt.Expression.(*ArrayLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	if _, ok := array.Elements[1].(*InfixExpression); !ok {
+		t.Errorf("array.Elements[1] is not InfixExpression. got=%T", array.Elements[1])
+	}
+}
+
+func TestIndexAndSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input   string
+		slice   bool
+		hasLow  bool
+		hasHigh bool
+	}{
+		{"xs[1 + 1]", false, true, false},
+		{"xs[1:2]", true, true, true},
+		{"xs[1:]", true, true, false},
+		{"xs[:2]", true, false, true},
+		{"xs[:]", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Logf("Testing index parsing with input: %q", tt.input)
+		program := parseInput(t, tt.input)
+		exp := program.Statements[0].(*ExpressionStatement).Expression
+
+		if !tt.slice {
+			index, ok := exp.(*IndexExpression)
+			if !ok {
+				t.Fatalf("exp is not IndexExpression. got=%T", exp)
+			}
+			if _, ok := index.Index.(*InfixExpression); !ok {
+				t.Errorf("index.Index is not InfixExpression. got=%T", index.Index)
+			}
+			continue
+		}
+
+		slice, ok := exp.(*SliceExpression)
+		if !ok {
+			t.Fatalf("exp is not SliceExpression. got=%T", exp)
+		}
+		if (slice.Low != nil) != tt.hasLow || (slice.High != nil) != tt.hasHigh {
+			t.Errorf("slice bounds wrong. low=%v, high=%v", slice.Low, slice.High)
+		}
+	}
+}
+
+func TestIndexPrecedence(t *testing.T) {
+	program := parseInput(t, "-xs[0] * f(1)[2]")
+
+	infix, ok := program.Statements[0].(*ExpressionStatement).Expression.(*InfixExpression)
+	if !ok {
+		t.Fatalf("expression is not InfixExpression")
+	}
+
+	prefix, ok := infix.Left.(*PrefixExpression)
+	if !ok {
+		t.Fatalf("infix.Left is not PrefixExpression. got=%T", infix.Left)
+	}
+	if _, ok := prefix.Right.(*IndexExpression); !ok {
+		t.Errorf("prefix.Right is not IndexExpression. got=%T", prefix.Right)
+	}
+
+	index, ok := infix.Right.(*IndexExpression)
+	if !ok {
+		t.Fatalf("infix.Right is not IndexExpression. got=%T", infix.Right)
+	}
+	if _, ok := index.Left.(*CallExpression); !ok {
+		t.Errorf("index.Left is not CallExpression. got=%T", index.Left)
+	}
+}
+
+func TestAssignStatements(t *testing.T) {
+	input := `
+x = 1
+xs[0] = 2
+a ;= 3
+`
+	program := parseInput(t, input)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	if assign, ok := program.Statements[0].(*AssignStatement); !ok {
+		t.Errorf("program.Statements[0] is not AssignStatement. got=%T", program.Statements[0])
+	} else if _, ok := assign.Target.(*Identifier); !ok {
+		t.Errorf("assign.Target is not Identifier. got=%T", assign.Target)
+	}
+
+	if assign, ok := program.Statements[1].(*AssignStatement); !ok {
+		t.Errorf("program.Statements[1] is not AssignStatement. got=%T", program.Statements[1])
+	} else if _, ok := assign.Target.(*IndexExpression); !ok {
+		t.Errorf("assign.Target is not IndexExpression. got=%T", assign.Target)
+	}
+
+	let, ok := program.Statements[2].(*LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[2] is not LetStatement. got=%T", program.Statements[2])
+	}
+	if let.Name.Value != "a" || let.TokenLiteral() != ";=" {
+		t.Errorf("short declaration wrong. name=%q, token=%q", let.Name.Value, let.TokenLiteral())
+	}
+	testIntegerLiteral(t, let.Value, 3)
+}
+
+func TestInvalidAssignTarget(t *testing.T) {
+	p := New(lexer.New("1 = 2"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0] != "1:3: cannot assign to 1" {
+		t.Errorf("wrong errors. got=%q", errors)
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	input := `
+let xs: [[int]] = []
+fn apply(f: fn(int, str) -> bool, n) -> [int] { [n] }
+`
+	program := parseInput(t, input)
+
+	let := program.Statements[0].(*LetStatement)
+	outer, ok := let.Type.(*ArrayType)
+	if !ok {
+		t.Fatalf("let.Type is not ArrayType. got=%T", let.Type)
+	}
+	inner, ok := outer.Elem.(*ArrayType)
+	if !ok {
+		t.Fatalf("outer.Elem is not ArrayType. got=%T", outer.Elem)
+	}
+	if named, ok := inner.Elem.(*NamedType); !ok || named.Name != "int" {
+		t.Errorf("inner.Elem is not int. got=%T", inner.Elem)
+	}
+
+	fs, ok := program.Statements[1].(*FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not FunctionStatement. got=%T", program.Statements[1])
+	}
+	if fs.Name.Value != "apply" {
+		t.Errorf("function name wrong. got=%q", fs.Name.Value)
+	}
+
+	fn := fs.Function
+	if len(fn.Parameters) != 2 || len(fn.ParamTypes) != 2 {
+		t.Fatalf("wrong number of parameters. got=%d, %d", len(fn.Parameters), len(fn.ParamTypes))
+	}
+	ft, ok := fn.ParamTypes[0].(*FunctionType)
+	if !ok {
+		t.Fatalf("fn.ParamTypes[0] is not FunctionType. got=%T", fn.ParamTypes[0])
+	}
+	if len(ft.Params) != 2 || ft.Return.(*NamedType).Name != "bool" {
+		t.Errorf("function type wrong. params=%d, return=%v", len(ft.Params), ft.Return)
+	}
+	if fn.ParamTypes[1] != nil {
+		t.Errorf("fn.ParamTypes[1] not nil. got=%T", fn.ParamTypes[1])
+	}
+	if _, ok := fn.ReturnType.(*ArrayType); !ok {
+		t.Errorf("fn.ReturnType is not ArrayType. got=%T", fn.ReturnType)
+	}
+}
+
+func TestElseIfAndComments(t *testing.T) {
+	input := `
+# leading comment
+if x % 3 == 0 {
+    1
+} else if x % 5 == 0 { ## inline ##
+    2
+} else {
+    3
+}
+`
+	program := parseInput(t, input)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	exp := program.Statements[0].(*ExpressionStatement).Expression.(*IfExpression)
+	if _, ok := exp.Condition.(*InfixExpression); !ok {
+		t.Errorf("exp.Condition is not InfixExpression. got=%T", exp.Condition)
+	}
+
+	nested, ok := exp.Alternative.Statements[0].(*ExpressionStatement).Expression.(*IfExpression)
+	if !ok {
+		t.Fatalf("else branch is not an IfExpression")
+	}
+	if nested.Alternative == nil {
+		t.Errorf("nested if has no alternative")
+	}
+}
+
+func TestMapLiteral(t *testing.T) {
+	tests := []struct {
+		input string
+		keys  []string
+	}{
+		{`{}`, []string{}},
+		{`{"a": 1, "b": 2 * 2}`, []string{"a", "b"}},
+		{`{"a": 1,}`, []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Logf("Testing map literal parsing with input: %q", tt.input)
+		program := parseInput(t, tt.input)
+
+		stmt := program.Statements[0].(*ExpressionStatement)
+		m, ok := stmt.Expression.(*MapLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not MapLiteral. got=%T", stmt.Expression)
+		}
+
+		if len(m.Keys) != len(tt.keys) || len(m.Values) != len(tt.keys) {
+			t.Fatalf("wrong number of pairs. expected=%d, got=%d keys and %d values", len(tt.keys), len(m.Keys), len(m.Values))
+		}
+
+		for i, key := range tt.keys {
+			lit, ok := m.Keys[i].(*StringLiteral)
+			if !ok || lit.Value != key {
+				t.Errorf("m.Keys[%d] wrong. expected=%q, got=%v", i, key, m.Keys[i])
+			}
+		}
+	}
+}
+
+func TestMapTypeAndCommaOk(t *testing.T) {
+	input := `
+let m: map[str][int] = {}
+let v, ok = m["a"]
+w, found ;= m["b"]
+`
+	program := parseInput(t, input)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	typ, ok := program.Statements[0].(*LetStatement).Type.(*MapType)
+	if !ok {
+		t.Fatalf("type is not MapType. got=%T", program.Statements[0].(*LetStatement).Type)
+	}
+	if _, ok := typ.Value.(*ArrayType); !ok {
+		t.Errorf("typ.Value is not ArrayType. got=%T", typ.Value)
+	}
+
+	for i, names := range [][2]string{{"v", "ok"}, {"w", "found"}} {
+		stmt, ok := program.Statements[i+1].(*LetStatement)
+		if !ok {
+			t.Fatalf("statement %d is not LetStatement. got=%T", i+1, program.Statements[i+1])
+		}
+		if stmt.Name.Value != names[0] || stmt.Ok == nil || stmt.Ok.Value != names[1] {
+			t.Errorf("statement %d binds wrong names. expected=%v, got=%v, %v", i+1, names, stmt.Name, stmt.Ok)
+		}
+		if _, ok := stmt.Value.(*IndexExpression); !ok {
+			t.Errorf("statement %d value is not IndexExpression. got=%T", i+1, stmt.Value)
+		}
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input   string
+		hasInit bool
+		hasCond bool
+		hasPost bool
+	}{
+		{"for { x }", false, false, false},
+		{"for x < 10 { x }", false, true, false},
+		{"for i ;= 0, i < 10, i++ { i }", true, true, true},
+		{"for i = 0, i < 10, i = i + 2 { i }", true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Logf("Testing for loop parsing with input: %q", tt.input)
+		program := parseInput(t, tt.input)
+
+		stmt, ok := program.Statements[0].(*ForStatement)
+		if !ok {
+			t.Fatalf("statement is not ForStatement. got=%T", program.Statements[0])
+		}
+
+		if (stmt.Init != nil) != tt.hasInit || (stmt.Condition != nil) != tt.hasCond || (stmt.Post != nil) != tt.hasPost {
+			t.Errorf("wrong clauses. got init=%v, cond=%v, post=%v", stmt.Init, stmt.Condition, stmt.Post)
+		}
+		if stmt.Body == nil || len(stmt.Body.Statements) != 1 {
+			t.Errorf("wrong loop body: %v", stmt.Body)
+		}
+	}
+}
+
+func TestForInStatements(t *testing.T) {
+	tests := []struct {
+		input string
+		key   string
+		value string
+	}{
+		{"for x in [1, 2] { x }", "x", ""},
+		{`for k, v in {"a": 1} { k }`, "k", "v"},
+	}
+
+	for _, tt := range tests {
+		t.Logf("Testing for-in parsing with input: %q", tt.input)
+		program := parseInput(t, tt.input)
+
+		stmt, ok := program.Statements[0].(*ForInStatement)
+		if !ok {
+			t.Fatalf("statement is not ForInStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Key.Value != tt.key {
+			t.Errorf("stmt.Key wrong. expected=%q, got=%q", tt.key, stmt.Key.Value)
+		}
+		if tt.value == "" && stmt.Value != nil {
+			t.Errorf("stmt.Value should be nil. got=%v", stmt.Value)
+		}
+		if tt.value != "" && (stmt.Value == nil || stmt.Value.Value != tt.value) {
+			t.Errorf("stmt.Value wrong. expected=%q, got=%v", tt.value, stmt.Value)
+		}
+	}
+}
+
+func TestIncDecStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+	}{
+		{"x++", "+"},
+		{"xs[0]--", "-"},
+	}
+
+	for _, tt := range tests {
+		t.Logf("Testing increment parsing with input: %q", tt.input)
+		program := parseInput(t, tt.input)
+
+		stmt, ok := program.Statements[0].(*AssignStatement)
+		if !ok {
+			t.Fatalf("statement is not AssignStatement. got=%T", program.Statements[0])
+		}
+
+		value, ok := stmt.Value.(*InfixExpression)
+		if !ok || value.Operator != tt.operator {
+			t.Fatalf("stmt.Value is not `target %s 1`. got=%v", tt.operator, stmt.Value)
+		}
+		testIntegerLiteral(t, value.Right, 1)
+	}
+}
+
+func TestStructAndImplStatements(t *testing.T) {
+	input := `
+struct Point {
+    x: int,
+    y: int
+}
+
+impl Point {
+    fn len(self) -> int { self.x * self.x + self.y * self.y }
+    fn scale(self, k: int) { self.x = self.x * k }
+}
+`
+	program := parseInput(t, input)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	st, ok := program.Statements[0].(*StructStatement)
+	if !ok {
+		t.Fatalf("statement is not StructStatement. got=%T", program.Statements[0])
+	}
+	if st.Name.Value != "Point" || len(st.Fields) != 2 || len(st.FieldTypes) != 2 {
+		t.Fatalf("wrong struct declaration: name=%s, fields=%d, types=%d", st.Name.Value, len(st.Fields), len(st.FieldTypes))
+	}
+	if st.Fields[1].Value != "y" {
+		t.Errorf("st.Fields[1] is not y. got=%s", st.Fields[1].Value)
+	}
+
+	impl, ok := program.Statements[1].(*ImplStatement)
+	if !ok {
+		t.Fatalf("statement is not ImplStatement. got=%T", program.Statements[1])
+	}
+	if impl.Name.Value != "Point" || len(impl.Methods) != 2 {
+		t.Fatalf("wrong impl block: name=%s, methods=%d", impl.Name.Value, len(impl.Methods))
+	}
+	if impl.Methods[1].Name.Value != "scale" || len(impl.Methods[1].Function.Parameters) != 2 {
+		t.Errorf("wrong second method: %s", impl.Methods[1].Name.Value)
+	}
+}
+
+func TestStructLiteralsAndSelectors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Point { x: 1, y: 2 }", "StructLiteral"},
+		{"Point {}", "StructLiteral"},
+		{"p.x", "SelectorExpression"},
+		{"p.len()", "CallExpression"},
+		{"a.b.c", "SelectorExpression"},
+		{"-p.x", "PrefixExpression"},
+		{"xs[0].x", "SelectorExpression"},
+	}
+
+	for _, tt := range tests {
+		t.Logf("Testing selector parsing with input: %q", tt.input)
+		program := parseInput(t, tt.input)
+
+		exp := program.Statements[0].(*ExpressionStatement).Expression
+		if got := fmt.Sprintf("%T", exp); got != "*parser."+tt.expected {
+			t.Errorf("wrong expression type. expected=*parser.%s, got=%s", tt.expected, got)
+		}
+	}
+
+	program := parseInput(t, "-p.x")
+	prefix := program.Statements[0].(*ExpressionStatement).Expression.(*PrefixExpression)
+	if _, ok := prefix.Right.(*SelectorExpression); !ok {
+		t.Errorf("selector does not bind tighter than prefix -. got=%T", prefix.Right)
+	}
+}
+
+func TestStructLiteralInConditions(t *testing.T) {
+	input := `
+if p == q { 1 }
+for x in xs { x }
+for n < limit { n++ }
+if (Point { x: 1 }).x == 1 { 2 }
+`
+	program := parseInput(t, input)
+
+	if len(program.Statements) != 4 {
+		t.Fatalf("program.Statements does not contain 4 statements. got=%d", len(program.Statements))
+	}
+
+	cond := program.Statements[0].(*ExpressionStatement).Expression.(*IfExpression).Condition
+	if _, ok := cond.(*InfixExpression).Right.(*Identifier); !ok {
+		t.Errorf("`q {` in an if condition parsed as %T", cond.(*InfixExpression).Right)
+	}
+
+	forIn := program.Statements[1].(*ForInStatement)
+	if _, ok := forIn.Iterable.(*Identifier); !ok {
+		t.Errorf("for-in iterable is not Identifier. got=%T", forIn.Iterable)
+	}
+
+	cond = program.Statements[3].(*ExpressionStatement).Expression.(*IfExpression).Condition
+	sel := cond.(*InfixExpression).Left.(*SelectorExpression)
+	if _, ok := sel.Left.(*StructLiteral); !ok {
+		t.Errorf("parenthesized struct literal is not StructLiteral. got=%T", sel.Left)
+	}
+}
+
+func TestFloatLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"0.25", 0.25},
+		{"10.0", 10},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input)
+		lit, ok := program.Statements[0].(*ExpressionStatement).Expression.(*FloatLiteral)
+		if !ok {
+			t.Fatalf("%q is not FloatLiteral. got=%T", tt.input, program.Statements[0].(*ExpressionStatement).Expression)
+		}
+		if lit.Value != tt.expected {
+			t.Errorf("lit.Value wrong. expected=%g, got=%g", tt.expected, lit.Value)
+		}
+	}
+}
+
+func TestEnumStatement(t *testing.T) {
+	program := parseInput(t, "enum Shape { Circle(float), Rect(float, float), Empty }")
+
+	stmt, ok := program.Statements[0].(*EnumStatement)
+	if !ok {
+		t.Fatalf("statement is not EnumStatement. got=%T", program.Statements[0])
+	}
+
+	expected := []struct {
+		name   string
+		fields int
+	}{{"Circle", 1}, {"Rect", 2}, {"Empty", 0}}
+
+	if len(stmt.Variants) != len(expected) {
+		t.Fatalf("wrong number of variants. expected=%d, got=%d", len(expected), len(stmt.Variants))
+	}
+	for i, v := range expected {
+		if stmt.Variants[i].Name.Value != v.name || len(stmt.Variants[i].Fields) != v.fields {
+			t.Errorf("variant %d wrong. expected=%s with %d fields, got=%s with %d",
+				i, v.name, v.fields, stmt.Variants[i].Name.Value, len(stmt.Variants[i].Fields))
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `
+match shape {
+    Circle(Some(r)) if r > 0.0 => r,
+    Rect(_, -1) => { 0 }
+    Empty => 1
+    "s" => 2,
+    other => 3,
+}
+`
+	program := parseInput(t, input)
+
+	exp, ok := program.Statements[0].(*ExpressionStatement).Expression.(*MatchExpression)
+	if !ok {
+		t.Fatalf("expression is not MatchExpression. got=%T", program.Statements[0].(*ExpressionStatement).Expression)
+	}
+	if len(exp.Arms) != 5 {
+		t.Fatalf("wrong number of arms. expected=5, got=%d", len(exp.Arms))
+	}
+
+	circle := exp.Arms[0].Pattern.(*ConstructorPattern)
+	if _, ok := circle.Args[0].(*ConstructorPattern); !ok {
+		t.Errorf("nested pattern is not ConstructorPattern. got=%T", circle.Args[0])
+	}
+	if exp.Arms[0].Guard == nil {
+		t.Errorf("first arm has no guard")
+	}
+
+	rect := exp.Arms[1].Pattern.(*ConstructorPattern)
+	if _, ok := rect.Args[0].(*WildcardPattern); !ok {
+		t.Errorf("rect.Args[0] is not WildcardPattern. got=%T", rect.Args[0])
+	}
+	if lit, ok := rect.Args[1].(*LiteralPattern); !ok || lit.Value.(*PrefixExpression).Operator != "-" {
+		t.Errorf("rect.Args[1] is not a negative LiteralPattern. got=%T", rect.Args[1])
+	}
+
+	for i, expected := range []string{"*parser.IdentPattern", "*parser.LiteralPattern", "*parser.IdentPattern"} {
+		if got := fmt.Sprintf("%T", exp.Arms[i+2].Pattern); got != expected {
+			t.Errorf("arm %d pattern wrong. expected=%s, got=%s", i+2, expected, got)
+		}
+	}
+
+	for i, arm := range exp.Arms {
+		if arm.Body == nil || len(arm.Body.Statements) != 1 {
+			t.Errorf("arm %d has wrong body: %v", i, arm.Body)
+		}
+	}
+}
+
+func TestInvalidPattern(t *testing.T) {
+	p := New(lexer.New("match x { [1] => 1 }"))
+	p.ParseProgram()
+
+	errs := p.Errors()
+	if len(errs) == 0 || errs[0] != "1:11: expected pattern, got LEFT_BRACKET" {
+		t.Errorf("wrong errors: %q", errs)
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f(x)?", "*parser.TryExpression"},
+		{"a.b?", "*parser.TryExpression"},
+		{"-x?", "*parser.PrefixExpression"},
+		{"x? + 1", "*parser.InfixExpression"},
+	}
+
+	for _, tt := range tests {
+		program := parseInput(t, tt.input)
+		exp := program.Statements[0].(*ExpressionStatement).Expression
+		if got := fmt.Sprintf("%T", exp); got != tt.expected {
+			t.Errorf("%q: wrong expression type. expected=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+
+	program := parseInput(t, "-x?")
+	prefix := program.Statements[0].(*ExpressionStatement).Expression.(*PrefixExpression)
+	if _, ok := prefix.Right.(*TryExpression); !ok {
+		t.Errorf("prefix.Right is not TryExpression. got=%T", prefix.Right)
+	}
+}
+
+func TestGenericType(t *testing.T) {
+	program := parseInput(t, "let r: Result[[int], str] = x")
+
+	typ, ok := program.Statements[0].(*LetStatement).Type.(*GenericType)
+	if !ok {
+		t.Fatalf("type is not GenericType. got=%T", program.Statements[0].(*LetStatement).Type)
+	}
+	if typ.Name != "Result" || len(typ.Args) != 2 {
+		t.Fatalf("wrong generic type. got name=%q with %d args", typ.Name, len(typ.Args))
+	}
+	if _, ok := typ.Args[0].(*ArrayType); !ok {
+		t.Errorf("typ.Args[0] is not ArrayType. got=%T", typ.Args[0])
+	}
+	if arg, ok := typ.Args[1].(*NamedType); !ok || arg.Name != "str" {
+		t.Errorf("typ.Args[1] is not str. got=%T", typ.Args[1])
+	}
+}
+
+func TestGenericDeclarations(t *testing.T) {
+	program := parseInput(t, `
+fn pair[K, V](k: K, v: V) -> Pair[K, V] { Pair { key: k, value: v } }
+struct Pair[K, V] { key: K, value: V }
+impl Pair[A, B] { fn key(self) -> A { self.key } }
+let id = fn[T](x: T) -> T { x }
+`)
+
+	fn := program.Statements[0].(*FunctionStatement)
+	if got := typeParamNames(fn.Function.TypeParams); got != "[K V]" {
+		t.Errorf("wrong fn type params. got=%s", got)
+	}
+
+	st := program.Statements[1].(*StructStatement)
+	if got := typeParamNames(st.TypeParams); got != "[K V]" {
+		t.Errorf("wrong struct type params. got=%s", got)
+	}
+
+	impl := program.Statements[2].(*ImplStatement)
+	if got := typeParamNames(impl.TypeParams); got != "[A B]" {
+		t.Errorf("wrong impl type params. got=%s", got)
+	}
+
+	lit := program.Statements[3].(*LetStatement).Value.(*FunctionLiteral)
+	if got := typeParamNames(lit.TypeParams); got != "[T]" {
+		t.Errorf("wrong literal type params. got=%s", got)
+	}
+}
+
+func TestTraits(t *testing.T) {
+	program := parseInput(t, `
+trait Shape {
+    fn area(self) -> float
+    fn scale(self, by: float)
+}
+impl Shape for Box[T] { fn area(self) -> float { 0.0 } }
+fn total[T: Shape + Eq, U](xs: [T]) { }
+`)
+
+	trait, ok := program.Statements[0].(*TraitStatement)
+	if !ok {
+		t.Fatalf("statement is not *TraitStatement. got=%T", program.Statements[0])
+	}
+	if trait.Name.Value != "Shape" || len(trait.Methods) != 2 {
+		t.Fatalf("wrong trait. got=%s with %d methods", trait.Name.Value, len(trait.Methods))
+	}
+	area := trait.Methods[0]
+	if area.Name.Value != "area" || len(area.Parameters) != 1 || area.ReturnType.TokenLiteral() != "float" {
+		t.Errorf("wrong signature for area. got=%s(%d params) -> %v", area.Name.Value, len(area.Parameters), area.ReturnType)
+	}
+	if scale := trait.Methods[1]; len(scale.Parameters) != 2 || scale.ReturnType != nil {
+		t.Errorf("wrong signature for scale. got=%d params, return %v", len(scale.Parameters), scale.ReturnType)
+	}
+
+	impl := program.Statements[1].(*ImplStatement)
+	if impl.Trait == nil || impl.Trait.Value != "Shape" || impl.Name.Value != "Box" {
+		t.Errorf("wrong impl. got trait=%v name=%s", impl.Trait, impl.Name.Value)
+	}
+	if got := typeParamNames(impl.TypeParams); got != "[T]" {
+		t.Errorf("wrong impl type params. got=%s", got)
+	}
+
+	fn := program.Statements[2].(*FunctionStatement)
+	params := fn.Function.TypeParams
+	if len(params) != 2 || len(params[0].Bounds) != 2 || len(params[1].Bounds) != 0 {
+		t.Fatalf("wrong type params. got=%d", len(params))
+	}
+	if params[0].Bounds[0].Value != "Shape" || params[0].Bounds[1].Value != "Eq" {
+		t.Errorf("wrong bounds. got=%s + %s", params[0].Bounds[0].Value, params[0].Bounds[1].Value)
+	}
+}
+
+func typeParamNames(params []*TypeParam) string {
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Name
+	}
+	return fmt.Sprint(names)
+}
+
+func TestDeferAndTryCatch(t *testing.T) {
+	program := parseInput(t, "defer close(f, 1)\nlet x = try { f() } catch e { 0 }")
+
+	stmt, ok := program.Statements[0].(*DeferStatement)
+	if !ok {
+		t.Fatalf("statement is not *DeferStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Call.Function.TokenLiteral() != "close" || len(stmt.Call.Arguments) != 2 {
+		t.Errorf("wrong deferred call. got=%s with %d args", stmt.Call.Function.TokenLiteral(), len(stmt.Call.Arguments))
+	}
+
+	tc, ok := program.Statements[1].(*LetStatement).Value.(*TryCatchExpression)
+	if !ok {
+		t.Fatalf("value is not *TryCatchExpression. got=%T", program.Statements[1].(*LetStatement).Value)
+	}
+	if len(tc.Body.Statements) != 1 || tc.Name.Value != "e" || len(tc.Handler.Statements) != 1 {
+		t.Errorf("wrong try expression. got body=%d name=%s handler=%d",
+			len(tc.Body.Statements), tc.Name.Value, len(tc.Handler.Statements))
+	}
+
+	for input, expected := range map[string]string{
+		"defer x":               "1:1: expression in defer must be a function call",
+		"try { f() } e { 0 }":   "1:13: expected next token to be CATCH, got IDENT instead",
+		"try { f() } catch { }": "1:19: expected next token to be IDENT, got LEFT_BRACE instead",
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0] != expected {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", input, expected, errs)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package parser
+
+// ApplyFunc is called by Apply with a cursor at a node. Its result
+// steers the traversal, as Apply describes.
+type ApplyFunc func(*Cursor) bool
+
+// Apply walks the tree under root like Walk, calling pre with a cursor
+// at each node before its children and post after them, and returns
+// the tree, whose nodes the cursor may have replaced, root included.
+// Either function may be nil.
+//
+// Unlike Walk, Apply calls them for the nil children of single fields,
+// such as a missing else branch. If pre returns false, Apply skips the
+// children of the node and does not call post for it; if post returns
+// false, Apply stops.
+func Apply(root Node, pre, post ApplyFunc) Node {
+	top := childField{get: func() Node { return root }, set: func(n Node) { root = n }}
+	a := &applier{pre: pre, post: post}
+	a.field(nil, top)
+	return root
+}
+
+// Cursor is the position of Apply at a node: the node, the field of its
+// parent holding it and, in a list, its index.
+type Cursor struct {
+	parent Node
+	field  childField
+	node   Node
+	// index is the index of the node in the list holding it, or -1,
+	// and step how far the next node in the list is.
+	index, step int
+}
+
+// Node returns the node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the node the node is a child of, which is nil for the
+// root.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the field of the parent that holds the node,
+// such as "Statements" for a statement of a block.
+func (c *Cursor) Name() string { return c.field.name }
+
+// Index returns the index of the node in the list holding it, or -1 if
+// it is not in a list.
+func (c *Cursor) Index() int { return c.index }
+
+// Replace puts n in the place of the node. Replaced in pre, the node's
+// children are not visited, but n's are.
+func (c *Cursor) Replace(n Node) {
+	if c.index >= 0 {
+		c.field.list.set(c.index, n)
+	} else {
+		c.field.set(n)
+	}
+	c.node = n
+}
+
+// Delete removes the node from the list holding it, and panics if it
+// is not in one.
+func (c *Cursor) Delete() {
+	c.inList("Delete")
+	c.field.list.remove(c.index)
+	c.step--
+}
+
+// InsertBefore inserts n in the list holding the node, before it, and
+// panics if it is not in one. Apply does not visit n.
+func (c *Cursor) InsertBefore(n Node) {
+	c.inList("InsertBefore")
+	c.field.list.insert(c.index, n)
+	c.index++
+}
+
+// InsertAfter inserts n in the list holding the node, after it, and
+// panics if it is not in one. Apply does not visit n.
+func (c *Cursor) InsertAfter(n Node) {
+	c.inList("InsertAfter")
+	c.field.list.insert(c.index+1, n)
+	c.step++
+}
+
+func (c *Cursor) inList(op string) {
+	if c.index < 0 {
+		panic("parser: " + op + " of a node that is not in a list")
+	}
+}
+
+// applier is the state of a call of Apply.
+type applier struct {
+	pre, post ApplyFunc
+}
+
+// field visits the children f of parent, reporting false if post
+// stopped the traversal.
+func (a *applier) field(parent Node, f childField) bool {
+	if f.list == nil {
+		return a.visit(&Cursor{parent: parent, field: f, node: f.get(), index: -1})
+	}
+	// the list may change as its nodes are visited
+	for i := 0; i < f.list.len(); {
+		c := &Cursor{parent: parent, field: f, node: f.list.get(i), index: i, step: 1}
+		if !a.visit(c) {
+			return false
+		}
+		i = c.index + c.step
+	}
+	return true
+}
+
+// visit visits the node at c and its children.
+func (a *applier) visit(c *Cursor) bool {
+	if a.pre != nil && !a.pre(c) {
+		return true
+	}
+	if c.node != nil {
+		for _, f := range fieldsOf(c.node) {
+			if !a.field(c.node, f) {
+				return false
+			}
+		}
+	}
+	return a.post == nil || a.post(c)
+}
@@ -0,0 +1,216 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Visitor visits the nodes of a syntax tree for Walk.
+type Visitor interface {
+	// Visit is called with each node, and returns the visitor to visit
+	// its children with, or nil to skip them. Once they are visited, it
+	// is called with nil on that visitor.
+	Visit(node Node) (w Visitor)
+}
+
+// Walk visits node, which must not be nil, and then the nodes below it,
+// depth first. The children of a node are visited in the order their
+// fields are declared in; nil children are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, f := range fieldsOf(node) {
+		if f.list == nil {
+			if child := f.get(); child != nil {
+				Walk(v, child)
+			}
+			continue
+		}
+		for i := 0; i < f.list.len(); i++ {
+			if child := f.list.get(i); child != nil {
+				Walk(v, child)
+			}
+		}
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect calls f with node and the nodes below it in the order Walk
+// visits them, skipping the children of nodes for which f returns
+// false. Like a Visitor, f is called with nil after the children of a
+// node.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// childField is a field of a node that holds children: one child, which get
+// and set read and write, or a list of them.
+type childField struct {
+	name string
+	get  func() Node
+	set  func(Node)
+	list nodeEditor
+}
+
+// nodeEditor reads and edits a list of children of some node type.
+type nodeEditor interface {
+	len() int
+	get(i int) Node
+	set(i int, n Node)
+	remove(i int)
+	insert(i int, n Node)
+}
+
+// one returns the field called name holding the child *p.
+func one[N Node](name string, p *N) childField {
+	return childField{
+		name: name,
+		get:  func() Node { return nodeOf(*p) },
+		set:  func(n Node) { *p = nodeAs[N](n) },
+	}
+}
+
+// many returns the field called name holding the children *p.
+func many[N Node](name string, p *[]N) childField {
+	return childField{name: name, list: nodeList[N]{p}}
+}
+
+type nodeList[N Node] struct {
+	s *[]N
+}
+
+func (l nodeList[N]) len() int          { return len(*l.s) }
+func (l nodeList[N]) get(i int) Node    { return nodeOf((*l.s)[i]) }
+func (l nodeList[N]) set(i int, n Node) { (*l.s)[i] = nodeAs[N](n) }
+func (l nodeList[N]) remove(i int)      { *l.s = append((*l.s)[:i], (*l.s)[i+1:]...) }
+func (l nodeList[N]) insert(i int, n Node) {
+	var zero N
+	s := append(*l.s, zero)
+	copy(s[i+1:], s[i:])
+	s[i] = nodeAs[N](n)
+	*l.s = s
+}
+
+// nodeAs returns n as a node of type N, or the zero N if n is nil.
+func nodeAs[N Node](n Node) N {
+	var zero N
+	if n == nil {
+		return zero
+	}
+	v, ok := n.(N)
+	if !ok {
+		panic(fmt.Sprintf("parser: a %T cannot replace a %T", n, zero))
+	}
+	return v
+}
+
+// nodeOf returns n as a Node, which is nil if n is a nil pointer, as
+// the missing else branch of an if expression is.
+func nodeOf[N Node](n N) Node {
+	v := reflect.ValueOf(n)
+	if !v.IsValid() || v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil
+	}
+	return n
+}
+
+// fieldsOf returns the fields of n that hold children, in the order
+// they are declared in.
+func fieldsOf(n Node) []childField {
+	switch n := n.(type) {
+	case *Program:
+		return []childField{many("Statements", &n.Statements)}
+	case *LetStatement:
+		return []childField{one("Name", &n.Name), one("Ok", &n.Ok), one("Type", &n.Type), one("Value", &n.Value)}
+	case *AssignStatement:
+		return []childField{one("Target", &n.Target), one("Value", &n.Value)}
+	case *FunctionStatement:
+		return []childField{one("Name", &n.Name), one("Function", &n.Function)}
+	case *ForStatement:
+		return []childField{one("Init", &n.Init), one("Condition", &n.Condition), one("Post", &n.Post), one("Body", &n.Body)}
+	case *ForInStatement:
+		return []childField{one("Key", &n.Key), one("Value", &n.Value), one("Iterable", &n.Iterable), one("Body", &n.Body)}
+	case *StructStatement:
+		return []childField{one("Name", &n.Name), many("TypeParams", &n.TypeParams), many("Fields", &n.Fields), many("FieldTypes", &n.FieldTypes)}
+	case *ImplStatement:
+		return []childField{one("Trait", &n.Trait), one("Name", &n.Name), many("TypeParams", &n.TypeParams), many("Methods", &n.Methods)}
+	case *TraitStatement:
+		return []childField{one("Name", &n.Name), many("Methods", &n.Methods)}
+	case *TraitMethod:
+		return []childField{one("Name", &n.Name), many("Parameters", &n.Parameters), many("ParamTypes", &n.ParamTypes), one("ReturnType", &n.ReturnType)}
+	case *TypeParam:
+		return []childField{many("Bounds", &n.Bounds)}
+	case *EnumStatement:
+		return []childField{one("Name", &n.Name), many("Variants", &n.Variants)}
+	case *EnumVariant:
+		return []childField{one("Name", &n.Name), many("Fields", &n.Fields)}
+	case *ReturnStatement:
+		return []childField{one("ReturnValue", &n.ReturnValue)}
+	case *DeferStatement:
+		return []childField{one("Call", &n.Call)}
+	case *ExpressionStatement:
+		return []childField{one("Expression", &n.Expression)}
+	case *BlockStatement:
+		return []childField{many("Statements", &n.Statements)}
+
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean, *NamedType,
+		*WildcardPattern, *IdentPattern:
+		return nil
+
+	case *PrefixExpression:
+		return []childField{one("Right", &n.Right)}
+	case *InfixExpression:
+		return []childField{one("Left", &n.Left), one("Right", &n.Right)}
+	case *IfExpression:
+		return []childField{one("Condition", &n.Condition), one("Consequence", &n.Consequence), one("Alternative", &n.Alternative)}
+	case *TryCatchExpression:
+		return []childField{one("Body", &n.Body), one("Name", &n.Name), one("Handler", &n.Handler)}
+	case *FunctionLiteral:
+		return []childField{many("TypeParams", &n.TypeParams), many("Parameters", &n.Parameters), many("ParamTypes", &n.ParamTypes),
+			one("ReturnType", &n.ReturnType), one("Body", &n.Body)}
+	case *CallExpression:
+		return []childField{one("Function", &n.Function), many("Arguments", &n.Arguments)}
+	case *ArrayLiteral:
+		return []childField{many("Elements", &n.Elements)}
+	case *StructLiteral:
+		return []childField{one("Name", &n.Name), many("Fields", &n.Fields), many("Values", &n.Values)}
+	case *SelectorExpression:
+		return []childField{one("Left", &n.Left), one("Field", &n.Field)}
+	case *TryExpression:
+		return []childField{one("Left", &n.Left)}
+	case *MatchExpression:
+		return []childField{one("Subject", &n.Subject), many("Arms", &n.Arms)}
+	case *MatchArm:
+		return []childField{one("Pattern", &n.Pattern), one("Guard", &n.Guard), one("Body", &n.Body)}
+	case *LiteralPattern:
+		return []childField{one("Value", &n.Value)}
+	case *ConstructorPattern:
+		return []childField{one("Name", &n.Name), many("Args", &n.Args)}
+	case *MapLiteral:
+		return []childField{many("Keys", &n.Keys), many("Values", &n.Values)}
+	case *IndexExpression:
+		return []childField{one("Left", &n.Left), one("Index", &n.Index)}
+	case *SliceExpression:
+		return []childField{one("Left", &n.Left), one("Low", &n.Low), one("High", &n.High)}
+
+	case *ArrayType:
+		return []childField{one("Elem", &n.Elem)}
+	case *MapType:
+		return []childField{one("Key", &n.Key), one("Value", &n.Value)}
+	case *GenericType:
+		return []childField{many("Args", &n.Args)}
+	case *FunctionType:
+		return []childField{many("Params", &n.Params), one("Return", &n.Return)}
+	}
+	panic(fmt.Sprintf("parser: unknown node type %T", n))
+}
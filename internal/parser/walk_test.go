@@ -0,0 +1,298 @@
+package parser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+)
+
+const walkInput = `
+let x = 5
+let y = "hello"
+let add = fn(a, b) { a + b }
+if (x < 10) { x } else { y }
+return add(x, 15)
+!true
+let xs: [int] = [1, 2]
+xs[0] = xs[1:]
+fn apply(f: fn(int) -> int) -> int { f(x) }
+let m: map[str]int = {"a": 1}
+for k, v in m { k }
+for i ;= 0, i < 3, i++ { i }
+struct P { x: int }
+impl P { fn get(self) -> int { self.x } }
+let p = P { x: 1 }
+enum E { A, B(int) }
+match B(1) { B(n) if n > 0 => n, A => 0, B(0) => 1, _ => -1 }
+let f = 1.5
+let o: Option[int] = f(x)?
+fn id[T](v: T) -> T { v }
+trait S { fn show(self) -> str }
+impl S for P { fn show(self) -> str { "p" } }
+fn all[T: S](v: T) { }
+defer f(x)
+try { x } catch e { e }
+`
+
+func parseInput(t *testing.T, input string) *Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	return program
+}
+
+func TestWalkVisitsEveryNodeType(t *testing.T) {
+	program := parseInput(t, walkInput)
+
+	seen := map[string]int{}
+	Inspect(program, func(n Node) bool {
+		if n != nil {
+			seen[fmt.Sprintf("%T", n)]++
+		}
+		return true
+	})
+
+	expected := map[string]int{
+		"*parser.Program":             1,
+		"*parser.LetStatement":        9,
+		"*parser.ReturnStatement":     1,
+		"*parser.ExpressionStatement": 19,
+		"*parser.BlockStatement":      16,
+		"*parser.Identifier":          69,
+		"*parser.IntegerLiteral":      18,
+		"*parser.StringLiteral":       3,
+		"*parser.Boolean":             1,
+		"*parser.PrefixExpression":    2,
+		"*parser.InfixExpression":     5,
+		"*parser.IfExpression":        1,
+		"*parser.FunctionLiteral":     6,
+		"*parser.CallExpression":      5,
+		"*parser.AssignStatement":     2,
+		"*parser.FunctionStatement":   5,
+		"*parser.ArrayLiteral":        1,
+		"*parser.IndexExpression":     1,
+		"*parser.SliceExpression":     1,
+		"*parser.NamedType":           15,
+		"*parser.ArrayType":           1,
+		"*parser.FunctionType":        1,
+		"*parser.MapLiteral":          1,
+		"*parser.MapType":             1,
+		"*parser.ForStatement":        1,
+		"*parser.ForInStatement":      1,
+		"*parser.StructStatement":     1,
+		"*parser.ImplStatement":       2,
+		"*parser.StructLiteral":       1,
+		"*parser.SelectorExpression":  1,
+		"*parser.EnumStatement":       1,
+		"*parser.EnumVariant":         2,
+		"*parser.MatchExpression":     1,
+		"*parser.MatchArm":            4,
+		"*parser.ConstructorPattern":  2,
+		"*parser.IdentPattern":        2,
+		"*parser.LiteralPattern":      1,
+		"*parser.WildcardPattern":     1,
+		"*parser.FloatLiteral":        1,
+		"*parser.GenericType":         1,
+		"*parser.TryExpression":       1,
+		"*parser.TypeParam":           2,
+		"*parser.TraitStatement":      1,
+		"*parser.TraitMethod":         1,
+		"*parser.DeferStatement":      1,
+		"*parser.TryCatchExpression":  1,
+	}
+
+	for typ, count := range expected {
+		t.Logf("%s visited %d times", typ, seen[typ])
+		if seen[typ] != count {
+			t.Errorf("%s visited wrong number of times. expected=%d, got=%d", typ, count, seen[typ])
+		}
+	}
+
+	for typ := range seen {
+		if _, ok := expected[typ]; !ok {
+			t.Errorf("unexpected node type visited: %s", typ)
+		}
+	}
+}
+
+type orderVisitor struct {
+	events *[]string
+}
+
+func (v orderVisitor) Visit(n Node) Visitor {
+	if n == nil {
+		*v.events = append(*v.events, "end")
+		return nil
+	}
+	*v.events = append(*v.events, n.TokenLiteral())
+	return v
+}
+
+func TestWalkOrder(t *testing.T) {
+	program := parseInput(t, "1 + -2")
+
+	var events []string
+	Walk(orderVisitor{&events}, program)
+
+	expected := []string{"1", "1", "+", "1", "end", "-", "2", "end", "end", "end", "end", "end"}
+	t.Logf("Walk events: %v", events)
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Fatalf("walk order wrong. expected=%v, got=%v", expected, events)
+	}
+}
+
+func TestInspectPrune(t *testing.T) {
+	program := parseInput(t, walkInput)
+
+	count := 0
+	Inspect(program, func(n Node) bool {
+		if n == nil {
+			return false
+		}
+		count++
+		_, isFn := n.(*FunctionLiteral)
+		return !isFn
+	})
+
+	// 215 nodes minus the parameters, types and bodies of the functions
+	if count != 174 {
+		t.Errorf("wrong number of nodes visited. expected=%d, got=%d", 174, count)
+	}
+}
+
+func TestApplyReplace(t *testing.T) {
+	program := parseInput(t, "let x = 1 + 2 * 3")
+
+	result := Apply(program, nil, func(c *Cursor) bool {
+		ie, ok := c.Node().(*InfixExpression)
+		if !ok {
+			return true
+		}
+		left, lok := ie.Left.(*IntegerLiteral)
+		right, rok := ie.Right.(*IntegerLiteral)
+		if !lok || !rok {
+			return true
+		}
+
+		var value int64
+		switch ie.Operator {
+		case "+":
+			value = left.Value + right.Value
+		case "*":
+			value = left.Value * right.Value
+		}
+		c.Replace(&IntegerLiteral{Token: ie.Token, Value: value})
+		return true
+	})
+
+	if result != program {
+		t.Fatalf("Apply returned a different root. got=%T", result)
+	}
+
+	stmt := program.Statements[0].(*LetStatement)
+	testIntegerLiteral(t, stmt.Value, 7)
+}
+
+func TestApplyReplaceRoot(t *testing.T) {
+	program := parseInput(t, "x")
+	replacement := &Program{}
+
+	result := Apply(program, func(c *Cursor) bool {
+		if _, ok := c.Node().(*Program); ok {
+			t.Logf("root cursor name=%q index=%d", c.Name(), c.Index())
+			c.Replace(replacement)
+			return false
+		}
+		return true
+	}, nil)
+
+	if result != replacement {
+		t.Fatalf("Apply did not return replaced root. got=%v", result)
+	}
+}
+
+func TestApplyDeleteAndInsert(t *testing.T) {
+	program := parseInput(t, `
+let a = 1
+let b = 2
+let c = 3
+`)
+
+	Apply(program, func(c *Cursor) bool {
+		let, ok := c.Node().(*LetStatement)
+		if !ok {
+			return true
+		}
+
+		t.Logf("visiting %s at %s[%d]", let.Name.Value, c.Name(), c.Index())
+		switch let.Name.Value {
+		case "a":
+			c.InsertBefore(newLet("before_a", 0))
+		case "b":
+			c.Delete()
+		case "c":
+			c.InsertAfter(newLet("after_c", 4))
+		case "before_a", "after_c":
+			t.Errorf("inserted node %s was walked", let.Name.Value)
+		}
+		return false
+	}, nil)
+
+	expected := []string{"before_a", "a", "c", "after_c"}
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("wrong number of statements. expected=%d, got=%d",
+			len(expected), len(program.Statements))
+	}
+	for i, name := range expected {
+		got := program.Statements[i].(*LetStatement).Name.Value
+		if got != name {
+			t.Errorf("program.Statements[%d] wrong. expected=%q, got=%q", i, name, got)
+		}
+	}
+}
+
+func TestApplyAbort(t *testing.T) {
+	program := parseInput(t, "a\nb\nc")
+
+	var visited []string
+	Apply(program, nil, func(c *Cursor) bool {
+		if id, ok := c.Node().(*Identifier); ok {
+			visited = append(visited, id.Value)
+			return id.Value != "b"
+		}
+		return true
+	})
+
+	if fmt.Sprint(visited) != "[a b]" {
+		t.Errorf("traversal not terminated. visited=%v", visited)
+	}
+}
+
+func TestApplyNilChildren(t *testing.T) {
+	program := parseInput(t, "if (x) { 1 }")
+
+	var names []string
+	Apply(program, func(c *Cursor) bool {
+		if c.Node() == nil {
+			names = append(names, c.Name())
+		}
+		return true
+	}, nil)
+
+	if fmt.Sprint(names) != "[Alternative]" {
+		t.Errorf("nil children wrong. got=%v", names)
+	}
+}
+
+func newLet(name string, value int64) *LetStatement {
+	return &LetStatement{
+		Token: lexer.Token{Type: lexer.LET, Literal: "let"},
+		Name:  &Identifier{Token: lexer.Token{Type: lexer.IDENT, Literal: name}, Value: name},
+		Value: &IntegerLiteral{Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprint(value)}, Value: value},
+	}
+}
@@ -0,0 +1,123 @@
+package typechecker
+
+import (
+	"github.com/voidwyrm-2/gust/internal/format"
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+// checkFormat checks a call of a function whose first parameter is a
+// format string, such as fmt.printf, against the directives of its
+// format if that is a string literal, as go vet checks calls of Go's
+// fmt.Printf.
+func (c *Checker) checkFormat(exp *parser.CallExpression, args []Type) {
+	if len(exp.Arguments) == 0 {
+		return
+	}
+	lit, ok := exp.Arguments[0].(*parser.StringLiteral)
+	if !ok {
+		return
+	}
+	name := describe(exp.Function)
+	parts, err := format.Parse(lit.Value)
+	if err != nil {
+		c.errorf(lit.Pos(), "%s format %s", name, err)
+		return
+	}
+
+	next := 1
+	for _, part := range parts {
+		d := part.Directive
+		if d == nil {
+			continue
+		}
+		if next+d.Args() > len(args) {
+			c.errorf(exp.Pos(), "%s format %s reads arg #%d, but call has %d args",
+				name, d.Text, next+d.Args()-1, len(args)-1)
+			return
+		}
+		for i := 0; i < d.Args()-1; i++ {
+			if !AssignableTo(args[next], Int) {
+				c.errorf(exp.Arguments[next].Pos(), "%s format %s uses non-int %s as argument of *",
+					name, d.Text, describe(exp.Arguments[next]))
+			} else if n, ok := exp.Arguments[next].(*parser.IntegerLiteral); ok && n.Value > format.MaxNumber {
+				c.errorf(n.Pos(), "%s format %s has arg %d for *, over %d", name, d.Text, n.Value, format.MaxNumber)
+			}
+			next++
+		}
+		if !formats(d.Verb, args[next], map[Type]bool{}) {
+			c.errorf(exp.Arguments[next].Pos(), "%s format %s has arg %s of wrong type %s",
+				name, d.Text, describe(exp.Arguments[next]), args[next])
+		}
+		next++
+	}
+	if next < len(args) {
+		c.errorf(exp.Pos(), "%s call needs %d args but has %d args", name, next-1, len(args)-1)
+	}
+}
+
+// formats reports whether the verb formats values of type t: scalars
+// of the kinds it accepts, and values whose elements it formats. seen
+// holds the types being checked, so that recursive types end.
+func formats(verb byte, t Type, seen map[Type]bool) bool {
+	t = prune(t)
+	if verb == 'v' || unknown(t) || seen[t] {
+		return true
+	}
+	switch t := t.(type) {
+	case *Basic:
+		switch t {
+		case Int:
+			return format.Accepts(verb, format.Int)
+		case Float:
+			return format.Accepts(verb, format.Float)
+		case Str:
+			return format.Accepts(verb, format.Str)
+		case Bool:
+			return format.Accepts(verb, format.Bool)
+		}
+		return false
+	case *TypeParam:
+		return true
+	case *Array:
+		return formats(verb, t.Elem, seen)
+	case *Map:
+		return formats(verb, t.Key, seen) && formats(verb, t.Value, seen)
+	case *Struct:
+		if verb == 's' && implementsDisplay(t) {
+			return true
+		}
+		seen[t] = true
+		for _, f := range t.AllFields() {
+			if !formats(verb, f.Type, seen) {
+				return false
+			}
+		}
+		return true
+	case *Enum:
+		seen[t] = true
+		for _, v := range t.Variants {
+			for _, f := range v.Fields {
+				if !formats(verb, f, seen) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// implementsDisplay reports whether the struct s implements a trait
+// named Display, whose show method, declared fn show(self) -> str,
+// prints it.
+func implementsDisplay(s *Struct) bool {
+	if s.Origin != nil {
+		s = s.Origin
+	}
+	for tr := range s.Traits {
+		if tr.Name == "Display" {
+			return true
+		}
+	}
+	return false
+}
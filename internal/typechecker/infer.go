@@ -0,0 +1,178 @@
+package typechecker
+
+import "github.com/voidwyrm-2/gust/internal/lexer"
+
+// The parameters of a function literal without annotations have type
+// variables for their types, and so may its result. A variable is bound
+// to a type the first time it is unified with one: when the checker
+// asks whether a value is assignable to it, or an operator requires it
+// to have a certain type. Until then it is compatible with any type,
+// like Any, except that an arithmetic or comparison operator applied to
+// it limits it to the types that define the operator.
+//
+// Inference is local: a function literal's types are fixed by its first
+// uses, so a literal cannot be used at two different types as it could
+// be in ML. Top-level functions must annotate their parameters.
+
+// Var is a type variable.
+type Var struct {
+	// Type is the type the variable is bound to, or nil.
+	Type Type
+	// At is where the variable was bound.
+	At lexer.Position
+	// Ops are the operators applied to the variable while it was
+	// unbound, which the type it is bound to must define.
+	Ops []string
+
+	// site is the position of the expression being checked, which
+	// becomes At when the variable is bound.
+	site *lexer.Position
+}
+
+func (v *Var) String() string {
+	if v.Type != nil {
+		return v.Type.String()
+	}
+	return "_"
+}
+
+// newVar returns a fresh type variable.
+func (c *Checker) newVar() *Var {
+	return &Var{site: &c.pos}
+}
+
+// prune returns the type t stands for, following bound variables.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Var)
+		if !ok || v.Type == nil {
+			return t
+		}
+		t = v.Type
+	}
+}
+
+// unknown reports whether nothing is known about t: it is Any or an
+// unbound variable.
+func unknown(t Type) bool {
+	t = prune(t)
+	if t == Any {
+		return true
+	}
+	_, ok := t.(*Var)
+	return ok
+}
+
+// bindVar binds the unbound variable v to t. It fails if t contains v,
+// since no type is its own element or parameter.
+func bindVar(v *Var, t Type) bool {
+	if t == Type(v) || t == Any {
+		return true
+	}
+	if occurs(v, t) {
+		return false
+	}
+	if tv, ok := unboundVar(t); ok {
+		tv.Ops = append(tv.Ops, v.Ops...)
+	} else {
+		for _, op := range v.Ops {
+			if !defines(op, t) {
+				return false
+			}
+		}
+	}
+	v.Type = t
+	v.At = *v.site
+	return true
+}
+
+// requireOp reports whether the operator op is defined on values of
+// type t, which it is on Any. An unbound variable is required to define
+// it once it is bound.
+func requireOp(op string, t Type) bool {
+	t = prune(t)
+	if v, ok := unboundVar(t); ok {
+		v.Ops = append(v.Ops, op)
+		return true
+	}
+	return t == Any || defines(op, t)
+}
+
+// defines reports whether the arithmetic or comparison operator op is
+// defined on values of type t.
+func defines(op string, t Type) bool {
+	switch op {
+	case "+", "-", "*", "/":
+		return t == Int || t == Float
+	case "<", ">":
+		return t == Int || t == Float || t == Str
+	case "==", "!=":
+		_, isFunc := t.(*Function)
+		return !isFunc
+	}
+	return false
+}
+
+// unmetOp returns an operator applied to t, an unbound variable, that
+// values of type v do not define, which is why v cannot be bound to t.
+func unmetOp(t, v Type) (string, bool) {
+	tv, ok := unboundVar(prune(t))
+	if !ok {
+		return "", false
+	}
+	for _, op := range tv.Ops {
+		if !defines(op, prune(v)) {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func occurs(v *Var, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return t == v
+	case *Array:
+		return occurs(v, t.Elem)
+	case *Map:
+		return occurs(v, t.Key) || occurs(v, t.Value)
+	case *Function:
+		for _, p := range t.Params {
+			if occurs(v, p) {
+				return true
+			}
+		}
+		return occurs(v, t.Return)
+	}
+	if _, args := instanceOf(t); args != nil {
+		for _, arg := range args {
+			if occurs(v, arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unboundVar returns t as a variable if it is an unbound one.
+func unboundVar(t Type) (*Var, bool) {
+	v, ok := t.(*Var)
+	return v, ok && v.Type == nil
+}
+
+// inferredAt returns where t was inferred if it is a bound variable,
+// the type of an unannotated parameter whose uses have fixed it. For a
+// variable bound to another that is where the last was bound.
+func inferredAt(t Type) (lexer.Position, bool) {
+	v, ok := t.(*Var)
+	if !ok || v.Type == nil {
+		return lexer.Position{}, false
+	}
+	for {
+		next, ok := v.Type.(*Var)
+		if !ok || next.Type == nil {
+			return v.At, true
+		}
+		v = next
+	}
+}
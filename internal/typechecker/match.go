@@ -0,0 +1,362 @@
+package typechecker
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+// Match expressions are checked for exhaustiveness and unreachable arms
+// with the usefulness algorithm from Maranget's "Warnings for pattern
+// matching". Patterns are reduced to a tree of constructors, where a
+// constructor is an enum variant or a literal, and wildcards. A
+// pattern vector is useful with respect to a matrix of earlier rows if
+// some value matches it but none of the rows; an arm is unreachable
+// if its pattern is not useful, and a match is exhaustive if the
+// wildcard is not useful after every unguarded arm.
+
+// pattern is a checked pattern. ctor is nil for wildcards and bindings.
+type pattern struct {
+	ctor *ctor
+	args []*pattern
+}
+
+// ctor is the head of a constructor pattern. Constructors are equal
+// when their names are.
+type ctor struct {
+	name    string
+	arity   int
+	variant *Variant
+	boolean bool
+}
+
+var wildcard = &pattern{}
+
+func (p *pattern) String() string {
+	if p.ctor == nil {
+		return "_"
+	}
+	if len(p.args) == 0 {
+		return p.ctor.name
+	}
+	args := make([]string, len(p.args))
+	for i, arg := range p.args {
+		args[i] = arg.String()
+	}
+	return p.ctor.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func variantCtor(v *Variant) *ctor {
+	return &ctor{name: v.Name, arity: len(v.Fields), variant: v}
+}
+
+var boolCtors = []*ctor{{name: "true", boolean: true}, {name: "false", boolean: true}}
+
+// family returns every constructor of the type c belongs to, or nil
+// if the type has infinitely many, as int and str do.
+func (c *ctor) family() []*ctor {
+	switch {
+	case c.variant != nil:
+		all := make([]*ctor, len(c.variant.Enum.Variants))
+		for i, v := range c.variant.Enum.Variants {
+			all[i] = variantCtor(v)
+		}
+		return all
+	case c.boolean:
+		return boolCtors
+	}
+	return nil
+}
+
+func wildcards(n int) []*pattern {
+	ps := make([]*pattern, n)
+	for i := range ps {
+		ps[i] = wildcard
+	}
+	return ps
+}
+
+func concat(a, b []*pattern) []*pattern {
+	return append(append(make([]*pattern, 0, len(a)+len(b)), a...), b...)
+}
+
+// headCtors returns the distinct constructors in the first column of
+// matrix, in order of appearance.
+func headCtors(matrix [][]*pattern) []*ctor {
+	var ctors []*ctor
+	seen := map[string]bool{}
+	for _, row := range matrix {
+		if c := row[0].ctor; c != nil && !seen[c.name] {
+			seen[c.name] = true
+			ctors = append(ctors, c)
+		}
+	}
+	return ctors
+}
+
+// complete returns the family of the constructors in ctors if every
+// member of it is present.
+func complete(ctors []*ctor) ([]*ctor, bool) {
+	if len(ctors) == 0 {
+		return nil, false
+	}
+	all := ctors[0].family()
+	if all == nil {
+		return nil, false
+	}
+	present := map[string]bool{}
+	for _, c := range ctors {
+		present[c.name] = true
+	}
+	for _, c := range all {
+		if !present[c.name] {
+			return all, false
+		}
+	}
+	return all, true
+}
+
+// specialize keeps the rows of matrix that match constructor c,
+// replacing their first pattern with its arguments.
+func specialize(matrix [][]*pattern, c *ctor) [][]*pattern {
+	var result [][]*pattern
+	for _, row := range matrix {
+		switch head := row[0]; {
+		case head.ctor == nil:
+			result = append(result, concat(wildcards(c.arity), row[1:]))
+		case head.ctor.name == c.name:
+			result = append(result, concat(head.args, row[1:]))
+		}
+	}
+	return result
+}
+
+// defaults keeps the rows of matrix whose first pattern is a wildcard,
+// without it.
+func defaults(matrix [][]*pattern) [][]*pattern {
+	var result [][]*pattern
+	for _, row := range matrix {
+		if row[0].ctor == nil {
+			result = append(result, row[1:])
+		}
+	}
+	return result
+}
+
+// useful reports whether some value matches q but no row of matrix.
+func useful(matrix [][]*pattern, q []*pattern) bool {
+	if len(q) == 0 {
+		return len(matrix) == 0
+	}
+
+	if head := q[0]; head.ctor != nil {
+		return useful(specialize(matrix, head.ctor), concat(head.args, q[1:]))
+	}
+
+	if all, ok := complete(headCtors(matrix)); ok {
+		for _, c := range all {
+			if useful(specialize(matrix, c), concat(wildcards(c.arity), q[1:])) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return useful(defaults(matrix), q[1:])
+}
+
+// missing returns a vector of n patterns matching values that no row
+// of matrix matches, or nil if the rows are exhaustive.
+func missing(matrix [][]*pattern, n int) []*pattern {
+	if n == 0 {
+		if len(matrix) == 0 {
+			return []*pattern{}
+		}
+		return nil
+	}
+
+	ctors := headCtors(matrix)
+	all, ok := complete(ctors)
+	if ok {
+		for _, c := range all {
+			if w := missing(specialize(matrix, c), c.arity+n-1); w != nil {
+				head := &pattern{ctor: c, args: w[:c.arity]}
+				return concat([]*pattern{head}, w[c.arity:])
+			}
+		}
+		return nil
+	}
+
+	w := missing(defaults(matrix), n-1)
+	if w == nil {
+		return nil
+	}
+
+	// name a constructor that is not covered when there is one
+	head := wildcard
+	present := map[string]bool{}
+	for _, c := range ctors {
+		present[c.name] = true
+	}
+	for _, c := range all {
+		if !present[c.name] {
+			head = &pattern{ctor: c, args: wildcards(c.arity)}
+			break
+		}
+	}
+	return concat([]*pattern{head}, w)
+}
+
+// checkMatchExpression checks the arms of a match against its subject.
+// The type of the match is the type its arms agree on, or Void if they
+// do not, just as for if expressions.
+func (c *Checker) checkMatchExpression(exp *parser.MatchExpression) Type {
+	subject := c.checkValue(exp.Subject)
+
+	var result Type
+	var matrix [][]*pattern
+
+	for _, arm := range exp.Arms {
+		c.openScope()
+
+		pat := c.checkPattern(arm.Pattern, subject, map[string]bool{})
+		if arm.Guard != nil {
+			if cond := c.checkValue(arm.Guard); !AssignableTo(cond, Bool) {
+				c.errorf(arm.Guard.Pos(), "non-bool %s (type %s) used as guard", describe(arm.Guard), cond)
+			}
+		}
+		body := c.checkBlock(arm.Body)
+
+		c.closeScope()
+
+		if !useful(matrix, []*pattern{pat}) {
+			c.errorf(arm.Pos(), "unreachable pattern %s", pat)
+		}
+		// a guarded arm may not match, so it covers nothing
+		if arm.Guard == nil {
+			matrix = append(matrix, []*pattern{pat})
+		}
+
+		if result == nil {
+			result = body
+		} else if result = unify(result, body); result == nil {
+			result = Void
+		}
+	}
+
+	if w := missing(matrix, 1); w != nil {
+		c.errorf(exp.Pos(), "non-exhaustive match: pattern %s not covered", w[0])
+	}
+
+	if result == nil {
+		return Void
+	}
+	return result
+}
+
+// checkPattern checks that p can match values of type t, declaring the
+// names it binds in the current scope. bound holds the names already
+// bound by the enclosing pattern.
+func (c *Checker) checkPattern(p parser.Pattern, t Type, bound map[string]bool) *pattern {
+	switch p := p.(type) {
+	case *parser.WildcardPattern:
+		return wildcard
+
+	case *parser.IdentPattern:
+		if v, ok := c.variants[p.Value]; ok {
+			v = patternVariant(v, t)
+			if len(v.Fields) > 0 {
+				c.errorf(p.Pos(), "variant %s has %d fields, use %s(...) to match it", v.Name, len(v.Fields), v.Name)
+			}
+			c.checkPatternType(p, v.Enum, t)
+			return &pattern{ctor: variantCtor(v), args: wildcards(len(v.Fields))}
+		}
+
+		if bound[p.Value] {
+			c.errorf(p.Pos(), "%s bound more than once in pattern", p.Value)
+		}
+		bound[p.Value] = true
+		c.declare(p.Value, t)
+		return wildcard
+
+	case *parser.LiteralPattern:
+		lit := c.checkExpression(p.Value)
+		c.checkPatternType(p, lit, t)
+
+		key := literalKey(p.Value)
+		if lit == Bool {
+			return &pattern{ctor: &ctor{name: key, boolean: true}}
+		}
+		return &pattern{ctor: &ctor{name: key}}
+
+	case *parser.ConstructorPattern:
+		v, ok := c.variants[p.Name.Value]
+		if !ok {
+			c.errorf(p.Name.Pos(), "undefined variant: %s", p.Name.Value)
+			for _, arg := range p.Args {
+				c.checkPattern(arg, Any, bound)
+			}
+			// a constructor of its own, so later arms are not unreachable
+			return &pattern{ctor: &ctor{name: p.Name.Value}}
+		}
+		v = patternVariant(v, t)
+		c.checkPatternType(p, v.Enum, t)
+
+		if len(p.Args) != len(v.Fields) {
+			c.errorf(p.Pos(), "wrong number of fields in pattern %s: want=%d, got=%d",
+				v.Name, len(v.Fields), len(p.Args))
+		}
+
+		args := wildcards(len(v.Fields))
+		for i, arg := range p.Args {
+			field := Type(Any)
+			if i < len(v.Fields) {
+				field = v.Fields[i]
+			}
+			if sub := c.checkPattern(arg, field, bound); i < len(args) {
+				args[i] = sub
+			}
+		}
+		return &pattern{ctor: variantCtor(v), args: args}
+	}
+
+	return wildcard
+}
+
+// patternVariant returns the variant v as a variant of the subject
+// type t. The fields of a generic enum's variant have the types of the
+// subject's arguments, or Any if the subject is not that enum.
+func patternVariant(v *Variant, t Type) *Variant {
+	if !v.Enum.Generic() {
+		return v
+	}
+	if e, ok := t.(*Enum); ok && e.Origin == v.Enum {
+		return e.variant(v.Name)
+	}
+	return v.Enum.anyArgs().variant(v.Name)
+}
+
+func (c *Checker) checkPatternType(p parser.Pattern, pat, value Type) {
+	if !AssignableTo(pat, value) {
+		c.errorf(p.Pos(), "cannot match %s value against %s pattern", value, pat)
+	}
+}
+
+// literalKey returns a canonical spelling of a literal pattern's value,
+// so that `0x10` and `16` are the same constructor.
+func literalKey(exp parser.Expression) string {
+	switch exp := exp.(type) {
+	case *parser.IntegerLiteral:
+		return strconv.FormatInt(exp.Value, 10)
+	case *parser.FloatLiteral:
+		return strconv.FormatFloat(exp.Value, 'g', -1, 64)
+	case *parser.StringLiteral:
+		return strconv.Quote(exp.Value)
+	case *parser.Boolean:
+		return strconv.FormatBool(exp.Value)
+	case *parser.PrefixExpression:
+		return "-" + literalKey(exp.Right)
+	}
+	return exp.TokenLiteral()
+}
@@ -0,0 +1,1794 @@
+package typechecker
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+// Checker verifies that a parsed program is well typed. Like the parser
+// it collects every error it finds instead of stopping at the first one.
+type Checker struct {
+	errors []string
+
+	scope    *scope
+	fn       *funcContext
+	variants map[string]*Variant
+
+	// pos is the position of the expression being checked, where the
+	// type variables bound while checking it are inferred.
+	pos lexer.Position
+	// mismatched holds the types of the branches of the if expressions
+	// whose branches have different types, which have no value.
+	mismatched map[parser.Expression][2]Type
+	// zeros holds the value types of the comma-ok lookups, whose zero
+	// values are filled in once the program is checked and the type
+	// variables in them are bound.
+	zeros map[*parser.LetStatement]Type
+
+	deterministic bool
+}
+
+// scope holds the variables and types declared in a block. Types and
+// variables live in separate namespaces, so a struct may share its
+// name with a variable.
+type scope struct {
+	names map[string]Type
+	types map[string]Type
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{names: map[string]Type{}, types: map[string]Type{}, outer: outer}
+}
+
+func (s *scope) lookup(name string) (Type, bool) {
+	for ; s != nil; s = s.outer {
+		if t, ok := s.names[name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func (s *scope) lookupType(name string) (Type, bool) {
+	for ; s != nil; s = s.outer {
+		if t, ok := s.types[name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// funcContext describes the function whose body is being checked.
+// result is nil while the result type of a function literal without
+// a `-> T` clause is still being inferred from its return statements.
+type funcContext struct {
+	result  Type
+	returns []Type
+}
+
+var universe = map[string]Type{
+	"println": &Builtin{"println"},
+	"print":   &Builtin{"print"},
+	"len":     &Builtin{"len"},
+	"append":  &Builtin{"append"},
+	"delete":  &Builtin{"delete"},
+	"panic":   &Function{Params: []Type{Str}, Return: Void},
+
+	"parse_int":   &Function{Params: []Type{Str}, Return: Result.Instantiate(Int, Str)},
+	"parse_float": &Function{Params: []Type{Str}, Return: Result.Instantiate(Float, Str)},
+	"read_file":   &Function{Params: []Type{Str}, Return: Result.Instantiate(Str, Str)},
+}
+
+var namedTypes = map[string]Type{
+	"int":   Int,
+	"float": Float,
+	"str":   Str,
+	"bool":  Bool,
+
+	"Option": Option,
+	"Result": Result,
+}
+
+func New() *Checker {
+	c := &Checker{errors: []string{}, scope: newScope(nil), variants: map[string]*Variant{}, mismatched: map[parser.Expression][2]Type{}, zeros: map[*parser.LetStatement]Type{}}
+	for name, t := range universe {
+		c.scope.names[name] = t
+	}
+	for name, t := range namedTypes {
+		c.scope.types[name] = t
+	}
+	for _, e := range []*Enum{Option, Result} {
+		for _, v := range e.Variants {
+			c.variants[v.Name] = v
+			c.scope.names[v.Name] = v.Constructor()
+		}
+	}
+	return c
+}
+
+func (c *Checker) Errors() []string {
+	return c.errors
+}
+
+// SetDeterministic sets whether the programs checked must run
+// deterministically, which rejects the nondeterministic members of
+// modules.
+func (c *Checker) SetDeterministic(on bool) {
+	c.deterministic = on
+}
+
+// Declare declares a global variable of type t, such as one a host
+// program sets in an interpreter before running the programs checked.
+func (c *Checker) Declare(name string, t Type) {
+	c.declare(name, t)
+}
+
+// Lookup returns the type of the variable called name in the global
+// scope.
+func (c *Checker) Lookup(name string) (Type, bool) {
+	return c.scope.lookup(name)
+}
+
+// DeclareType declares a named type in the global scope, such as a
+// struct a host program shares with programs. It reports false, and
+// declares nothing, if a type called name exists.
+func (c *Checker) DeclareType(name string, t Type) bool {
+	if _, exists := c.scope.lookupType(name); exists {
+		return false
+	}
+	c.scope.types[name] = t
+	return true
+}
+
+// ParseSignature returns the type of a function with the signature
+// src, a function declaration without a body such as
+// `fn first[T](xs: [T]) -> Option[T]`, whose types are resolved in the
+// global scope.
+func (c *Checker) ParseSignature(src string) (*Function, error) {
+	p := parser.New(lexer.New(src + " {}"))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid signature %q: %s", src, errs[0])
+	}
+	var fs *parser.FunctionStatement
+	if len(program.Statements) == 1 {
+		fs, _ = program.Statements[0].(*parser.FunctionStatement)
+	}
+	if fs == nil {
+		return nil, fmt.Errorf("invalid signature %q: not a function declaration", src)
+	}
+
+	n := len(c.errors)
+	c.checkAnnotated(fs.Function, fs.Name.Value, 0)
+	sig := c.signature(fs.Function)
+	if len(c.errors) > n {
+		err := fmt.Errorf("invalid signature %q: %s", src, c.errors[n])
+		c.errors = c.errors[:n]
+		return nil, err
+	}
+	if sig.Return == nil {
+		sig.Return = Void
+	}
+	return sig, nil
+}
+
+// Check type checks program, adding to the checker's errors. Top-level
+// declarations are visible to statements checked by later calls, so
+// a REPL can check one line at a time.
+func (c *Checker) Check(program *parser.Program) {
+	clear(c.mismatched)
+	clear(c.zeros)
+	c.declareTypes(program.Statements)
+
+	for _, stmt := range program.Statements {
+		c.checkStatement(stmt)
+	}
+
+	for stmt, t := range c.zeros {
+		stmt.Zero = zeroValue(t, stmt.Value.Pos(), map[*Struct]bool{})
+	}
+}
+
+// Snapshot is the global state of a checker at some point, which
+// Restore returns it to.
+type Snapshot struct {
+	names, types map[string]Type
+	variants     map[string]*Variant
+	// methods and traits are those of the global struct types, which
+	// impl declarations add to
+	methods map[*Struct]map[string]*Function
+	traits  map[*Struct]map[*Trait]bool
+}
+
+// Snapshot records the global declarations of the checker, so that the
+// declarations of a program that is not kept can be undone.
+func (c *Checker) Snapshot() *Snapshot {
+	s := &Snapshot{
+		names:    maps.Clone(c.scope.names),
+		types:    maps.Clone(c.scope.types),
+		variants: maps.Clone(c.variants),
+		methods:  map[*Struct]map[string]*Function{},
+		traits:   map[*Struct]map[*Trait]bool{},
+	}
+	for _, t := range c.scope.types {
+		if st, ok := t.(*Struct); ok {
+			s.methods[st] = maps.Clone(st.Methods)
+			s.traits[st] = maps.Clone(st.Traits)
+		}
+	}
+	return s
+}
+
+// Restore undoes the global declarations made since s was taken.
+func (c *Checker) Restore(s *Snapshot) {
+	c.scope.names = maps.Clone(s.names)
+	c.scope.types = maps.Clone(s.types)
+	c.variants = maps.Clone(s.variants)
+	for st, methods := range s.methods {
+		st.Methods = maps.Clone(methods)
+		st.Traits = maps.Clone(s.traits[st])
+	}
+}
+
+// Declared returns the global variables declared since s was taken,
+// or given another type.
+func (c *Checker) Declared(s *Snapshot) []string {
+	var names []string
+	for name, t := range c.scope.names {
+		if old, ok := s.names[name]; !ok || old != t {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Undeclare undoes the declarations of the global variables names made
+// since s was taken, keeping the other declarations made since.
+func (c *Checker) Undeclare(s *Snapshot, names ...string) {
+	for _, name := range names {
+		if old, ok := s.names[name]; ok {
+			c.scope.names[name] = old
+		} else {
+			delete(c.scope.names, name)
+		}
+	}
+}
+
+// declareTypes declares the struct, enum and trait types and the
+// methods of a program before any of its statements are checked, so
+// that types may refer to each other and be used before their
+// declaration.
+func (c *Checker) declareTypes(stmts []parser.Statement) {
+	var structs []*parser.StructStatement
+	var enums []*parser.EnumStatement
+	var traits []*parser.TraitStatement
+	for _, stmt := range stmts {
+		var name *parser.Identifier
+		var typ Type
+		switch stmt := stmt.(type) {
+		case *parser.StructStatement:
+			name, typ = stmt.Name, &Struct{
+				Name:    stmt.Name.Value,
+				Params:  c.typeParams(stmt.TypeParams),
+				Methods: map[string]*Function{},
+				Traits:  map[*Trait]bool{},
+			}
+		case *parser.EnumStatement:
+			name, typ = stmt.Name, &Enum{Name: stmt.Name.Value}
+		case *parser.TraitStatement:
+			name, typ = stmt.Name, &Trait{
+				Name:    stmt.Name.Value,
+				Self:    &TypeParam{Name: "Self"},
+				Methods: map[string]*Function{},
+			}
+		default:
+			continue
+		}
+		if _, exists := c.scope.types[name.Value]; exists {
+			c.errorf(name.Pos(), "%s redeclared", name.Value)
+			continue
+		}
+		c.scope.types[name.Value] = typ
+		switch stmt := stmt.(type) {
+		case *parser.StructStatement:
+			structs = append(structs, stmt)
+		case *parser.EnumStatement:
+			enums = append(enums, stmt)
+		case *parser.TraitStatement:
+			traits = append(traits, stmt)
+		}
+	}
+
+	for _, st := range structs {
+		c.resolveBounds(c.scope.types[st.Name.Value].(*Struct).Params, st.TypeParams)
+	}
+
+	for _, en := range enums {
+		c.declareVariants(en)
+	}
+
+	for _, st := range structs {
+		typ := c.scope.types[st.Name.Value].(*Struct)
+		c.openScope()
+		c.declareTypeParams(typ.Params)
+		for i, name := range st.Fields {
+			if typ.Field(name.Value) != nil {
+				c.errorf(name.Pos(), "duplicate field %s in struct %s", name.Value, typ.Name)
+				continue
+			}
+			typ.Fields = append(typ.Fields, &Field{Name: name.Value, Type: c.resolveType(st.FieldTypes[i])})
+		}
+		c.closeScope()
+	}
+
+	for _, tr := range traits {
+		c.declareTraitMethods(tr)
+	}
+
+	for _, stmt := range stmts {
+		if impl, ok := stmt.(*parser.ImplStatement); ok {
+			c.declareMethods(impl)
+		}
+	}
+}
+
+// declareTraitMethods resolves the method signatures of a trait.
+func (c *Checker) declareTraitMethods(stmt *parser.TraitStatement) {
+	typ := c.scope.types[stmt.Name.Value].(*Trait)
+
+	c.openScope()
+	defer c.closeScope()
+	c.scope.types["Self"] = typ.Self
+
+	for _, method := range stmt.Methods {
+		name := method.Name.Value
+		if len(method.Parameters) == 0 || method.Parameters[0].Value != "self" {
+			c.errorf(method.Pos(), "method %s.%s must take self as its first parameter", typ.Name, name)
+			continue
+		}
+		if _, exists := typ.Methods[name]; exists {
+			c.errorf(method.Name.Pos(), "method %s.%s already declared", typ.Name, name)
+			continue
+		}
+
+		c.checkParamNames(method.Parameters)
+		sig := &Function{Params: make([]Type, len(method.Parameters)-1), Return: Void}
+		for i, param := range method.Parameters {
+			var t Type = Any
+			if method.ParamTypes[i] != nil {
+				t = c.resolveType(method.ParamTypes[i])
+			} else if i > 0 {
+				c.errorf(param.Pos(), "missing type for parameter %s of %s.%s", param.Value, typ.Name, name)
+			}
+			if i == 0 {
+				if method.ParamTypes[0] != nil && t != typ.Self {
+					c.errorf(method.ParamTypes[0].Pos(), "cannot use %s as the receiver type of a method of %s", t, typ.Name)
+				}
+				continue
+			}
+			sig.Params[i-1] = t
+		}
+		if method.ReturnType != nil {
+			sig.Return = c.resolveType(method.ReturnType)
+		}
+
+		typ.Methods[name] = sig
+		typ.Order = append(typ.Order, name)
+	}
+
+	// print calls the show method of a trait named Display with only
+	// the value, for its printed form
+	if show := typ.Methods["show"]; typ.Name == "Display" && (show == nil || len(show.TypeParams) > 0 || len(show.Params) > 0 || show.Return != Str) {
+		c.errorf(stmt.Name.Pos(), "trait Display must declare fn show(self) -> str")
+	}
+}
+
+// declareVariants declares the variants of an enum as top-level values.
+func (c *Checker) declareVariants(stmt *parser.EnumStatement) {
+	typ := c.scope.types[stmt.Name.Value].(*Enum)
+
+	for _, v := range stmt.Variants {
+		name := v.Name.Value
+		if _, exists := c.variants[name]; exists {
+			c.errorf(v.Pos(), "variant %s redeclared", name)
+			continue
+		}
+
+		variant := &Variant{Name: name, Fields: make([]Type, len(v.Fields)), Enum: typ}
+		for i, f := range v.Fields {
+			variant.Fields[i] = c.resolveType(f)
+		}
+		typ.Variants = append(typ.Variants, variant)
+
+		c.variants[name] = variant
+		c.declare(name, variant.Constructor())
+	}
+}
+
+func (c *Checker) declareMethods(impl *parser.ImplStatement) {
+	typ, ok := c.implType(impl)
+	if !ok {
+		return
+	}
+	if len(impl.TypeParams) != len(typ.Params) {
+		c.errorf(impl.Name.Pos(), "wrong number of type parameters in impl %s: want=%d, got=%d",
+			typ.Name, len(typ.Params), len(impl.TypeParams))
+	}
+
+	c.openScope()
+	defer c.closeScope()
+	c.declareImplParams(impl, typ)
+
+	declared := map[string]*Function{}
+	for _, method := range impl.Methods {
+		name := method.Name.Value
+		params := method.Function.Parameters
+		if len(params) == 0 || params[0].Value != "self" {
+			c.errorf(method.Pos(), "method %s.%s must take self as its first parameter", typ.Name, name)
+			continue
+		}
+		if _, exists := typ.Methods[name]; exists {
+			c.errorf(method.Name.Pos(), "method %s.%s already declared", typ.Name, name)
+			continue
+		}
+		if typ.Field(name) != nil {
+			c.errorf(method.Name.Pos(), "field and method with the same name %s", name)
+			continue
+		}
+
+		c.checkAnnotated(method.Function, typ.Name+"."+name, 1)
+		sig := c.signature(method.Function)
+		if method.Function.ReturnType == nil {
+			sig.Return = Void
+		}
+		if types := method.Function.ParamTypes; len(types) > 0 && types[0] != nil && !Identical(sig.Params[0], typ.self()) {
+			c.errorf(types[0].Pos(), "cannot use %s as the receiver type of a method of %s", sig.Params[0], typ.Name)
+		}
+		typ.Methods[name] = &Function{TypeParams: sig.TypeParams, Params: sig.Params[1:], Return: sig.Return}
+		declared[name] = typ.Methods[name]
+	}
+
+	if impl.Trait != nil {
+		c.declareTraitImpl(impl, typ, declared)
+	}
+}
+
+// declareTraitImpl records that typ implements the trait of impl,
+// checking that the impl declares exactly the trait's methods, with
+// Self replaced by typ.
+func (c *Checker) declareTraitImpl(impl *parser.ImplStatement, typ *Struct, declared map[string]*Function) {
+	t, ok := c.scope.lookupType(impl.Trait.Value)
+	if !ok {
+		c.errorf(impl.Trait.Pos(), "undefined trait: %s", impl.Trait.Value)
+		return
+	}
+	tr, ok := t.(*Trait)
+	if !ok {
+		c.errorf(impl.Trait.Pos(), "%s is not a trait", t)
+		return
+	}
+	if typ.Traits[tr] {
+		c.errorf(impl.Trait.Pos(), "%s already implements %s", typ.Name, tr.Name)
+		return
+	}
+	typ.Traits[tr] = true
+
+	self := map[*TypeParam]Type{tr.Self: typ.self()}
+	for _, method := range impl.Methods {
+		name := method.Name.Value
+		want, ok := tr.Methods[name]
+		if !ok {
+			c.errorf(method.Name.Pos(), "method %s is not in trait %s", name, tr.Name)
+			continue
+		}
+		if got, ok := declared[name]; ok {
+			if want = subst(want, self).(*Function); !Identical(got, want) {
+				c.errorf(method.Name.Pos(), "method %s.%s has type %s, but %s requires %s",
+					typ.Name, name, got, tr.Name, want)
+			}
+		}
+	}
+
+	for _, name := range tr.Order {
+		if _, ok := declared[name]; !ok {
+			c.errorf(impl.Name.Pos(), "%s does not implement %s: missing method %s", typ.Name, tr.Name, name)
+		}
+	}
+}
+
+// declareImplParams declares the names an impl block gives the type
+// parameters of the generic struct typ, `impl Stack[T]`.
+func (c *Checker) declareImplParams(impl *parser.ImplStatement, typ *Struct) {
+	for i, p := range impl.TypeParams {
+		if i < len(typ.Params) {
+			c.scope.types[p.Name] = typ.Params[i]
+		}
+	}
+}
+
+// typeParams creates the type parameters of a generic declaration.
+func (c *Checker) typeParams(params []*parser.TypeParam) []*TypeParam {
+	var result []*TypeParam
+	seen := map[string]bool{}
+	for _, p := range params {
+		if seen[p.Name] {
+			c.errorf(p.Pos(), "%s redeclared", p.Name)
+		}
+		seen[p.Name] = true
+		result = append(result, &TypeParam{Name: p.Name})
+	}
+	return result
+}
+
+// resolveBounds resolves the traits that bound the type parameters
+// params, declared by decls.
+func (c *Checker) resolveBounds(params []*TypeParam, decls []*parser.TypeParam) {
+	for i, decl := range decls {
+		for _, bound := range decl.Bounds {
+			t, ok := c.scope.lookupType(bound.Value)
+			if !ok {
+				c.errorf(bound.Pos(), "undefined trait: %s", bound.Value)
+				continue
+			}
+			tr, ok := t.(*Trait)
+			if !ok {
+				c.errorf(bound.Pos(), "%s is not a trait", t)
+				continue
+			}
+			params[i].Bounds = append(params[i].Bounds, tr)
+		}
+	}
+}
+
+// checkBounds checks that the type arguments args implement the traits
+// bounding the type parameters params. context names the generic use.
+func (c *Checker) checkBounds(pos lexer.Position, params []*TypeParam, args []Type, context string) {
+	for i, p := range params {
+		for _, tr := range p.Bounds {
+			if !Implements(args[i], tr) {
+				c.errorf(pos, "%s does not implement %s (required by %s %s)", args[i], tr.Name, p.Name, context)
+			}
+		}
+	}
+}
+
+// declareTypeParams declares type parameters in the current scope.
+func (c *Checker) declareTypeParams(params []*TypeParam) {
+	for _, p := range params {
+		c.scope.types[p.Name] = p
+	}
+}
+
+// implType returns the struct type an impl block adds methods to.
+func (c *Checker) implType(impl *parser.ImplStatement) (*Struct, bool) {
+	t, ok := c.scope.lookupType(impl.Name.Value)
+	if !ok {
+		c.errorf(impl.Name.Pos(), "undefined type: %s", impl.Name.Value)
+		return nil, false
+	}
+	typ, ok := t.(*Struct)
+	if !ok {
+		c.errorf(impl.Name.Pos(), "cannot define methods on non-struct type %s", t)
+		return nil, false
+	}
+	return typ, true
+}
+
+func (c *Checker) errorf(pos lexer.Position, format string, args ...any) {
+	msg := fmt.Sprintf("%s: %s", pos, fmt.Sprintf(format, args...))
+	c.errors = append(c.errors, msg)
+}
+
+func (c *Checker) declare(name string, t Type) {
+	c.scope.names[name] = t
+}
+
+func (c *Checker) openScope()  { c.scope = newScope(c.scope) }
+func (c *Checker) closeScope() { c.scope = c.scope.outer }
+
+func (c *Checker) checkStatement(stmt parser.Statement) {
+	switch stmt := stmt.(type) {
+	case *parser.LetStatement:
+		c.checkLetStatement(stmt)
+
+	case *parser.AssignStatement:
+		c.checkAssignStatement(stmt)
+
+	case *parser.FunctionStatement:
+		c.checkFunctionStatement(stmt)
+
+	case *parser.ReturnStatement:
+		c.checkReturnStatement(stmt)
+
+	case *parser.ForStatement:
+		c.checkForStatement(stmt)
+
+	case *parser.ForInStatement:
+		c.checkForInStatement(stmt)
+
+	case *parser.StructStatement:
+		// declared by declareTypes
+		if c.scope.outer != nil {
+			c.errorf(stmt.Pos(), "struct declarations are only allowed at the top level")
+		}
+
+	case *parser.EnumStatement:
+		// declared by declareTypes
+		if c.scope.outer != nil {
+			c.errorf(stmt.Pos(), "enum declarations are only allowed at the top level")
+		}
+
+	case *parser.TraitStatement:
+		// declared by declareTypes
+		if c.scope.outer != nil {
+			c.errorf(stmt.Pos(), "trait declarations are only allowed at the top level")
+		}
+
+	case *parser.ImplStatement:
+		c.checkImplStatement(stmt)
+
+	case *parser.ExpressionStatement:
+		c.checkExpression(stmt.Expression)
+
+	case *parser.DeferStatement:
+		c.checkExpression(stmt.Call)
+
+	case *parser.BlockStatement:
+		c.openScope()
+		c.checkBlock(stmt)
+		c.closeScope()
+
+	default:
+		c.errorf(stmt.Pos(), "unexpected statement %T", stmt)
+	}
+}
+
+// checkBlock checks the statements of block in the current scope and
+// returns the type of its value, which is the type of its final
+// expression statement or Void.
+func (c *Checker) checkBlock(block *parser.BlockStatement) Type {
+	result := Type(Void)
+	for i, stmt := range block.Statements {
+		if es, ok := stmt.(*parser.ExpressionStatement); ok && i == len(block.Statements)-1 {
+			result = c.checkExpression(es.Expression)
+			continue
+		}
+		c.checkStatement(stmt)
+	}
+	return result
+}
+
+func (c *Checker) checkLetStatement(stmt *parser.LetStatement) {
+	if stmt.Ok != nil {
+		c.checkCommaOk(stmt)
+		return
+	}
+
+	var declared Type
+	if stmt.Type != nil {
+		declared = c.resolveType(stmt.Type)
+	}
+
+	// a function literal may call itself by the name it is declared as
+	if _, ok := stmt.Value.(*parser.FunctionLiteral); ok {
+		if declared == nil {
+			declared = c.newVar()
+		}
+		c.declare(stmt.Name.Value, declared)
+	}
+
+	value := c.checkValue(stmt.Value)
+
+	t := value
+	if declared != nil {
+		t = declared
+		if !AssignableTo(value, t) {
+			c.errorf(stmt.Value.Pos(), "cannot use %s value as %s in declaration of %s",
+				value, t, stmt.Name.Value)
+		}
+	}
+
+	c.declare(stmt.Name.Value, t)
+}
+
+// checkCommaOk checks `let v, ok = m[k]`, which declares v with the
+// map's value type and ok as a bool.
+func (c *Checker) checkCommaOk(stmt *parser.LetStatement) {
+	value := Type(Any)
+
+	index, isIndex := stmt.Value.(*parser.IndexExpression)
+	if isIndex {
+		left := c.checkValue(index.Left)
+		if m, ok := left.(*Map); ok {
+			c.checkMapKey(index.Index, m)
+			value = m.Value
+		} else {
+			c.checkValue(index.Index)
+			isIndex = unknown(left)
+		}
+	} else {
+		c.checkValue(stmt.Value)
+	}
+
+	if !isIndex {
+		c.errorf(stmt.Value.Pos(), "assignment mismatch: 2 variables but %s is not a map index", describe(stmt.Value))
+	}
+
+	if stmt.Type != nil {
+		t := c.resolveType(stmt.Type)
+		if !AssignableTo(value, t) {
+			c.errorf(stmt.Value.Pos(), "cannot use %s value as %s in declaration of %s",
+				value, t, stmt.Name.Value)
+		}
+		value = t
+	}
+
+	c.zeros[stmt] = value
+	c.declare(stmt.Name.Value, value)
+	c.declare(stmt.Ok.Value, Bool)
+}
+
+// zeroValue returns an expression for the zero value of t, at pos: 0,
+// 0.0, "", false, an empty array or map, None for an Option, or a
+// struct literal of the zero values of the fields. It returns nil for
+// the other types, which have none, and for the structs in outer, whose
+// zero values would contain themselves.
+func zeroValue(t Type, pos lexer.Position, outer map[*Struct]bool) parser.Expression {
+	tok := lexer.Token{Pos: pos}
+	switch t := prune(t).(type) {
+	case *Array:
+		return &parser.ArrayLiteral{Token: tok}
+	case *Map:
+		return &parser.MapLiteral{Token: tok}
+	case *Struct:
+		origin := t
+		if t.Origin != nil {
+			origin = t.Origin
+		}
+		if outer[origin] {
+			return nil
+		}
+		outer[origin] = true
+		defer delete(outer, origin)
+
+		lit := &parser.StructLiteral{Token: tok, Name: &parser.Identifier{Token: tok, Value: t.Name}}
+		for _, f := range t.AllFields() {
+			lit.Fields = append(lit.Fields, &parser.Identifier{Token: tok, Value: f.Name})
+			lit.Values = append(lit.Values, zeroValue(f.Type, pos, outer))
+		}
+		return lit
+	case *Enum:
+		if origin, _ := instanceOf(t); origin == Option {
+			return &parser.Identifier{Token: tok, Value: "None"}
+		}
+		return nil
+	}
+
+	switch prune(t) {
+	case Int:
+		return &parser.IntegerLiteral{Token: tok}
+	case Float:
+		return &parser.FloatLiteral{Token: tok}
+	case Str:
+		return &parser.StringLiteral{Token: tok}
+	case Bool:
+		return &parser.Boolean{Token: tok}
+	}
+	return nil
+}
+
+func (c *Checker) checkAssignStatement(stmt *parser.AssignStatement) {
+	var target Type
+
+	switch t := stmt.Target.(type) {
+	case *parser.Identifier:
+		var ok bool
+		target, ok = c.scope.lookup(t.Value)
+		if !ok {
+			c.errorf(t.Pos(), "undefined: %s", t.Value)
+			target = Any
+		} else if _, isBuiltin := target.(*Builtin); isBuiltin {
+			c.errorf(t.Pos(), "cannot assign to builtin %s", t.Value)
+		}
+
+	case *parser.IndexExpression:
+		left := c.checkValue(t.Left)
+		target = Any
+		switch left := left.(type) {
+		case *Array:
+			c.checkIndex(t.Index)
+			target = left.Elem
+		case *Map:
+			c.checkMapKey(t.Index, left)
+			target = left.Value
+		default:
+			c.checkIndex(t.Index)
+			if !unknown(left) {
+				c.errorf(t.Pos(), "cannot assign to index of %s (type %s)", describe(t.Left), left)
+			}
+		}
+
+	case *parser.SelectorExpression:
+		left := c.checkValue(t.Left)
+		target = c.selector(t, left)
+		if typ, ok := left.(*Struct); ok && typ.Field(t.Field.Value) == nil {
+			if _, isMethod := typ.Methods[t.Field.Value]; isMethod {
+				c.errorf(t.Pos(), "cannot assign to method %s", describe(t))
+			}
+		}
+		if _, ok := left.(*Module); ok {
+			c.errorf(t.Pos(), "cannot assign to module member %s", describe(t))
+		}
+
+	default:
+		c.errorf(stmt.Pos(), "cannot assign to %s", stmt.Target.TokenLiteral())
+		target = Any
+	}
+
+	value := c.checkValue(stmt.Value)
+	if !AssignableTo(value, target) {
+		c.errorf(stmt.Value.Pos(), "cannot use %s value as %s in assignment", value, target)
+	}
+}
+
+func (c *Checker) checkForStatement(stmt *parser.ForStatement) {
+	c.openScope()
+	defer c.closeScope()
+
+	if stmt.Init != nil {
+		c.checkStatement(stmt.Init)
+	}
+	if stmt.Condition != nil {
+		if cond := c.checkValue(stmt.Condition); !AssignableTo(cond, Bool) {
+			c.errorf(stmt.Condition.Pos(), "non-bool %s (type %s) used as condition", describe(stmt.Condition), cond)
+		}
+	}
+	if stmt.Post != nil {
+		c.checkStatement(stmt.Post)
+	}
+
+	c.openScope()
+	c.checkBlock(stmt.Body)
+	c.closeScope()
+}
+
+// checkForInStatement checks `for k, v in x`. Arrays and strings bind
+// an index and an element, maps a key and a value; with a single
+// variable, arrays and strings bind the element and maps the key.
+func (c *Checker) checkForInStatement(stmt *parser.ForInStatement) {
+	iterable := c.checkValue(stmt.Iterable)
+
+	key, value := Type(Any), Type(Any)
+	switch t := iterable.(type) {
+	case *Array:
+		key, value = Int, t.Elem
+	case *Map:
+		key, value = t.Key, t.Value
+	default:
+		if t == Str {
+			key, value = Int, Str
+		} else if !unknown(t) {
+			c.errorf(stmt.Iterable.Pos(), "cannot range over %s (type %s)", describe(stmt.Iterable), t)
+		}
+	}
+
+	c.openScope()
+	defer c.closeScope()
+
+	if stmt.Value == nil {
+		if _, isMap := iterable.(*Map); isMap {
+			c.declare(stmt.Key.Value, key)
+		} else {
+			c.declare(stmt.Key.Value, value)
+		}
+	} else {
+		c.declare(stmt.Key.Value, key)
+		c.declare(stmt.Value.Value, value)
+	}
+
+	c.checkBlock(stmt.Body)
+}
+
+func (c *Checker) checkImplStatement(stmt *parser.ImplStatement) {
+	if c.scope.outer != nil {
+		c.errorf(stmt.Pos(), "impl blocks are only allowed at the top level")
+		return
+	}
+
+	typ, ok := c.scope.types[stmt.Name.Value].(*Struct)
+	if !ok {
+		// reported by declareMethods
+		return
+	}
+
+	c.openScope()
+	defer c.closeScope()
+	c.declareImplParams(stmt, typ)
+
+	for _, method := range stmt.Methods {
+		m, ok := typ.Methods[method.Name.Value]
+		if !ok {
+			continue
+		}
+		sig := &Function{TypeParams: m.TypeParams, Params: append([]Type{typ.self()}, m.Params...), Return: m.Return}
+		c.checkFunctionBody(method.Function, sig)
+	}
+}
+
+func (c *Checker) checkFunctionStatement(stmt *parser.FunctionStatement) {
+	c.checkAnnotated(stmt.Function, stmt.Name.Value, 0)
+	sig := c.signature(stmt.Function)
+	if stmt.Function.ReturnType == nil {
+		sig.Return = Void
+	}
+
+	// declared before the body is checked so that it may call itself
+	c.declare(stmt.Name.Value, sig)
+	c.checkFunctionBody(stmt.Function, sig)
+}
+
+func (c *Checker) checkReturnStatement(stmt *parser.ReturnStatement) {
+	t := Type(Void)
+	if stmt.ReturnValue != nil {
+		t = c.checkValue(stmt.ReturnValue)
+	}
+
+	// a return at the top level ends the program; its value is unused
+	if c.fn == nil {
+		return
+	}
+
+	if c.fn.result == nil {
+		c.fn.returns = append(c.fn.returns, t)
+		return
+	}
+
+	if !AssignableTo(t, c.fn.result) {
+		c.errorf(stmt.Pos(), "cannot use %s value as %s in return statement", t, c.fn.result)
+	}
+}
+
+// checkValue checks an expression that must produce a value.
+func (c *Checker) checkValue(exp parser.Expression) Type {
+	t := c.checkExpression(exp)
+	if branches, ok := c.mismatched[exp]; ok && t == Void {
+		c.errorf(exp.Pos(), "if branches have different types: %s and %s", branches[0], branches[1])
+		return Any
+	}
+	if t == Void {
+		c.errorf(exp.Pos(), "%s does not produce a value", describe(exp))
+		return Any
+	}
+	return t
+}
+
+// checkExpression returns the type of exp, with any type variables it
+// is known to be bound to followed.
+func (c *Checker) checkExpression(exp parser.Expression) Type {
+	if exp != nil {
+		outer := c.pos
+		c.pos = exp.Pos()
+		defer func() { c.pos = outer }()
+	}
+	return prune(c.expressionType(exp))
+}
+
+func (c *Checker) expressionType(exp parser.Expression) Type {
+	switch exp := exp.(type) {
+	case *parser.IntegerLiteral:
+		return Int
+
+	case *parser.FloatLiteral:
+		return Float
+
+	case *parser.StringLiteral:
+		return Str
+
+	case *parser.Boolean:
+		return Bool
+
+	case *parser.Identifier:
+		t, ok := c.scope.lookup(exp.Value)
+		if !ok {
+			c.errorf(exp.Pos(), "undefined: %s", exp.Value)
+			return Any
+		}
+		return t
+
+	case *parser.PrefixExpression:
+		return c.checkPrefixExpression(exp)
+
+	case *parser.InfixExpression:
+		return c.checkInfixExpression(exp)
+
+	case *parser.IfExpression:
+		return c.checkIfExpression(exp)
+
+	case *parser.MatchExpression:
+		return c.checkMatchExpression(exp)
+
+	case *parser.TryCatchExpression:
+		return c.checkTryCatchExpression(exp)
+
+	case *parser.TryExpression:
+		return c.checkTryExpression(exp)
+
+	case *parser.FunctionLiteral:
+		sig := c.signature(exp)
+		for i, t := range exp.ParamTypes {
+			if t == nil {
+				sig.Params[i] = c.newVar()
+			}
+		}
+		c.checkFunctionBody(exp, sig)
+		return sig
+
+	case *parser.CallExpression:
+		return c.checkCallExpression(exp)
+
+	case *parser.ArrayLiteral:
+		return c.checkArrayLiteral(exp)
+
+	case *parser.MapLiteral:
+		return c.checkMapLiteral(exp)
+
+	case *parser.StructLiteral:
+		return c.checkStructLiteral(exp)
+
+	case *parser.SelectorExpression:
+		return c.checkSelectorExpression(exp)
+
+	case *parser.IndexExpression:
+		return c.checkIndexExpression(exp)
+
+	case *parser.SliceExpression:
+		return c.checkSliceExpression(exp)
+
+	case nil:
+		return Any
+	}
+
+	c.errorf(exp.Pos(), "unexpected expression %T", exp)
+	return Any
+}
+
+func (c *Checker) checkPrefixExpression(exp *parser.PrefixExpression) Type {
+	right := c.checkValue(exp.Right)
+
+	var defined bool
+	var result Type
+	switch exp.Operator {
+	case "!":
+		defined, result = AssignableTo(right, Bool), Bool
+	case "-":
+		defined, result = requireOp("-", right), prune(right)
+		if result == Any {
+			result = Int
+		}
+	default:
+		c.errorf(exp.Pos(), "unknown operator %s", exp.Operator)
+		return Any
+	}
+
+	if !defined {
+		c.errorf(exp.Pos(), "invalid operation: operator %s not defined on %s", exp.Operator, right)
+	}
+	return result
+}
+
+func (c *Checker) checkInfixExpression(exp *parser.InfixExpression) Type {
+	left := c.checkValue(exp.Left)
+	right := c.checkValue(exp.Right)
+
+	// the type both operands must have, ignoring Any
+	operand := unify(left, right)
+	if operand == nil {
+		c.errorf(exp.Pos(), "invalid operation: mismatched types %s and %s", left, right)
+		operand = Any
+	}
+
+	var defined bool
+	var result Type
+
+	switch exp.Operator {
+	case "+", "-", "*", "/":
+		defined, result = requireOp(exp.Operator, operand), operand
+	case "%":
+		defined, result = AssignableTo(operand, Int), operand
+	case "..":
+		defined, result = AssignableTo(operand, Str), Str
+	case "<", ">", "==", "!=":
+		defined, result = requireOp(exp.Operator, operand), Bool
+	case "&&", "||":
+		defined, result = AssignableTo(operand, Bool), Bool
+	default:
+		c.errorf(exp.Pos(), "unknown operator %s", exp.Operator)
+		return Any
+	}
+
+	if !defined {
+		c.errorf(exp.Pos(), "invalid operation: operator %s not defined on %s", exp.Operator, operand)
+	}
+	return result
+}
+
+func (c *Checker) checkIfExpression(exp *parser.IfExpression) Type {
+	if cond := c.checkValue(exp.Condition); !AssignableTo(cond, Bool) {
+		c.errorf(exp.Condition.Pos(), "non-bool %s (type %s) used as condition", describe(exp.Condition), cond)
+	}
+
+	c.openScope()
+	consequence := c.checkBlock(exp.Consequence)
+	c.closeScope()
+
+	if exp.Alternative == nil {
+		return Void
+	}
+
+	c.openScope()
+	alternative := c.checkBlock(exp.Alternative)
+	c.closeScope()
+
+	if t := unify(consequence, alternative); t != nil {
+		return t
+	}
+	if consequence != Void || alternative != Void {
+		c.mismatched[exp] = [2]Type{consequence, alternative}
+	}
+	return Void
+}
+
+// checkTryCatchExpression checks `try { ... } catch e { ... }`, which
+// has a type like an if-else whose branches are the two blocks. e is the
+// message of the runtime error. A handler that always returns or panics
+// does not constrain the type.
+func (c *Checker) checkTryCatchExpression(exp *parser.TryCatchExpression) Type {
+	c.openScope()
+	body := c.checkBlock(exp.Body)
+	c.closeScope()
+
+	c.openScope()
+	c.declare(exp.Name.Value, Str)
+	handler := c.checkBlock(exp.Handler)
+	c.closeScope()
+
+	if terminates(exp.Handler) {
+		return body
+	}
+	if t := unify(body, handler); t != nil {
+		return t
+	}
+	return Void
+}
+
+// signature resolves the parameter and result types of fn. Parameters
+// without annotations have type Any; the result of a function without
+// a `-> T` clause is left nil to be inferred by checkFunctionBody.
+func (c *Checker) signature(fn *parser.FunctionLiteral) *Function {
+	sig := &Function{Params: make([]Type, len(fn.Parameters))}
+
+	if len(fn.TypeParams) > 0 {
+		sig.TypeParams = c.typeParams(fn.TypeParams)
+		c.resolveBounds(sig.TypeParams, fn.TypeParams)
+		c.openScope()
+		defer c.closeScope()
+		c.declareTypeParams(sig.TypeParams)
+	}
+
+	for i := range fn.Parameters {
+		sig.Params[i] = Any
+		if i < len(fn.ParamTypes) && fn.ParamTypes[i] != nil {
+			sig.Params[i] = c.resolveType(fn.ParamTypes[i])
+		}
+	}
+
+	if fn.ReturnType != nil {
+		sig.Return = c.resolveType(fn.ReturnType)
+	}
+
+	return sig
+}
+
+// checkAnnotated reports the parameters of the named function fn from
+// the first on that have no type. Only function literals infer them.
+func (c *Checker) checkAnnotated(fn *parser.FunctionLiteral, name string, first int) {
+	for i := first; i < len(fn.Parameters); i++ {
+		if i >= len(fn.ParamTypes) || fn.ParamTypes[i] == nil {
+			c.errorf(fn.Parameters[i].Pos(), "missing type for parameter %s of %s", fn.Parameters[i].Value, name)
+		}
+	}
+}
+
+// checkParamNames reports the parameters named like an earlier one.
+func (c *Checker) checkParamNames(params []*parser.Identifier) {
+	seen := map[string]bool{}
+	for _, p := range params {
+		if seen[p.Value] {
+			c.errorf(p.Pos(), "parameter %s redeclared", p.Value)
+		}
+		seen[p.Value] = true
+	}
+}
+
+// checkFunctionBody checks the body of fn against sig, filling in
+// sig.Return if it has not been declared.
+func (c *Checker) checkFunctionBody(fn *parser.FunctionLiteral, sig *Function) {
+	outerFn := c.fn
+	c.fn = &funcContext{result: sig.Return}
+	c.openScope()
+	defer func() {
+		c.closeScope()
+		c.fn = outerFn
+	}()
+
+	c.declareTypeParams(sig.TypeParams)
+	c.checkParamNames(fn.Parameters)
+	for i, param := range fn.Parameters {
+		c.declare(param.Value, sig.Params[i])
+	}
+
+	value := c.checkBlock(fn.Body)
+
+	if sig.Return == nil {
+		returns := c.fn.returns
+		if len(returns) == 0 || value != Void {
+			returns = append(returns, value)
+		}
+		sig.Return = returns[0]
+		for _, t := range returns[1:] {
+			u := unify(sig.Return, t)
+			if u == nil {
+				c.errorf(fn.Pos(), "inconsistent return types %s and %s", sig.Return, t)
+				continue
+			}
+			sig.Return = u
+		}
+		return
+	}
+
+	if sig.Return == Void || terminates(fn.Body) {
+		return
+	}
+
+	if !AssignableTo(value, sig.Return) {
+		if value == Void {
+			c.errorf(fn.Body.Pos(), "missing return")
+		} else {
+			c.errorf(fn.Body.Pos(), "cannot use %s value as %s in return", value, sig.Return)
+		}
+	}
+}
+
+// terminates reports whether every path through block ends in a
+// return statement or a call of panic.
+func terminates(block *parser.BlockStatement) bool {
+	if block == nil || len(block.Statements) == 0 {
+		return false
+	}
+
+	switch last := block.Statements[len(block.Statements)-1].(type) {
+	case *parser.ReturnStatement:
+		return true
+	case *parser.ExpressionStatement:
+		switch exp := last.Expression.(type) {
+		case *parser.IfExpression:
+			return terminates(exp.Consequence) && terminates(exp.Alternative)
+		case *parser.TryCatchExpression:
+			return terminates(exp.Body) && terminates(exp.Handler)
+		case *parser.CallExpression:
+			id, ok := exp.Function.(*parser.Identifier)
+			return ok && id.Value == "panic"
+		case *parser.MatchExpression:
+			// the checker rejects matches that are not exhaustive
+			for _, arm := range exp.Arms {
+				if !terminates(arm.Body) {
+					return false
+				}
+			}
+			return len(exp.Arms) > 0
+		}
+	}
+	return false
+}
+
+func (c *Checker) checkCallExpression(exp *parser.CallExpression) Type {
+	callee := c.checkExpression(exp.Function)
+
+	args := make([]Type, len(exp.Arguments))
+	for i, arg := range exp.Arguments {
+		args[i] = c.checkValue(arg)
+	}
+
+	// the arguments may have determined the type of the callee
+	callee = prune(callee)
+
+	switch fn := callee.(type) {
+	case *Builtin:
+		return c.checkBuiltinCall(exp, fn, args)
+
+	case *Function:
+		if fn.Format {
+			c.checkFormat(exp, args)
+		}
+		if fn.Variadic {
+			fn = fn.expand(len(args))
+		}
+		var inferred string
+		if len(fn.TypeParams) > 0 {
+			params := fn.TypeParams
+			var targs []Type
+			fn, targs = infer(fn, args)
+			inferred = describeTypeArgs(params, targs)
+			c.checkBounds(exp.Pos(), params, targs, "in call to "+describe(exp.Function))
+		}
+		if len(args) != len(fn.Params) {
+			c.errorf(exp.Pos(), "wrong number of arguments in call to %s: want=%d, got=%d",
+				describe(exp.Function), len(fn.Params), len(args))
+			return fn.Return
+		}
+		for i, arg := range args {
+			if AssignableTo(arg, fn.Params[i]) {
+				continue
+			}
+			if op, ok := unmetOp(fn.Params[i], arg); ok {
+				c.errorf(exp.Arguments[i].Pos(), "cannot use %s value in argument to %s: operator %s not defined on %s",
+					arg, describe(exp.Function), op, arg)
+				continue
+			}
+			if at, ok := inferredAt(fn.Params[i]); ok {
+				c.errorf(exp.Arguments[i].Pos(), "cannot unify %s with %s at %s", fn.Params[i], arg, at)
+				continue
+			}
+			c.errorf(exp.Arguments[i].Pos(), "cannot use %s value as %s in argument to %s%s",
+				arg, fn.Params[i], describe(exp.Function), inferred)
+		}
+		return fn.Return
+	}
+
+	// calling a value of unknown type infers it to be a function
+	if v, ok := unboundVar(callee); ok {
+		fn := &Function{Params: args, Return: c.newVar()}
+		if !bindVar(v, fn) {
+			c.errorf(exp.Pos(), "cannot unify %s with %s: %s would contain itself", v, fn, describe(exp.Function))
+			return Any
+		}
+		return fn.Return
+	}
+
+	if !unknown(callee) {
+		c.errorf(exp.Pos(), "cannot call non-function %s (type %s)", describe(exp.Function), callee)
+	}
+	return Any
+}
+
+// describeTypeArgs describes the type arguments inferred for a call to
+// a generic function, for error messages.
+func describeTypeArgs(params []*TypeParam, args []Type) string {
+	s := " (inferred "
+	for i, p := range params {
+		if i > 0 {
+			s += ", "
+		}
+		s += p.Name + " = " + args[i].String()
+	}
+	return s + ")"
+}
+
+func (c *Checker) checkBuiltinCall(exp *parser.CallExpression, fn *Builtin, args []Type) Type {
+	switch fn.Name {
+	case "println", "print":
+		return Void
+
+	case "len":
+		if len(args) != 1 {
+			c.errorf(exp.Pos(), "wrong number of arguments in call to len: want=1, got=%d", len(args))
+			return Int
+		}
+		switch args[0].(type) {
+		case *Array, *Map:
+		default:
+			if args[0] != Str && !unknown(args[0]) {
+				c.errorf(exp.Arguments[0].Pos(), "invalid argument for len: %s", args[0])
+			}
+		}
+		return Int
+
+	case "append":
+		if len(args) == 0 {
+			c.errorf(exp.Pos(), "not enough arguments in call to append")
+			return Any
+		}
+		array, ok := args[0].(*Array)
+		if !ok {
+			if !unknown(args[0]) {
+				c.errorf(exp.Arguments[0].Pos(), "first argument to append must be an array, got %s", args[0])
+			}
+			return Any
+		}
+		for i, arg := range args[1:] {
+			if !AssignableTo(arg, array.Elem) {
+				c.errorf(exp.Arguments[i+1].Pos(), "cannot use %s value as %s in argument to append",
+					arg, array.Elem)
+			}
+		}
+		return array
+
+	case "delete":
+		if len(args) != 2 {
+			c.errorf(exp.Pos(), "wrong number of arguments in call to delete: want=2, got=%d", len(args))
+			return Void
+		}
+		m, ok := args[0].(*Map)
+		if !ok {
+			if !unknown(args[0]) {
+				c.errorf(exp.Arguments[0].Pos(), "first argument to delete must be a map, got %s", args[0])
+			}
+			return Void
+		}
+		if !AssignableTo(args[1], m.Key) {
+			c.errorf(exp.Arguments[1].Pos(), "cannot use %s value as %s in argument to delete", args[1], m.Key)
+		}
+		return Void
+	}
+
+	return Any
+}
+
+// checkArrayLiteral checks `[x, ...]`. The element type is that of the
+// first element; that of an empty literal is a type variable, bound by
+// the first use of the array that needs it.
+func (c *Checker) checkArrayLiteral(exp *parser.ArrayLiteral) Type {
+	if len(exp.Elements) == 0 {
+		return &Array{Elem: c.newVar()}
+	}
+	var elem Type
+	for i, el := range exp.Elements {
+		t := c.checkValue(el)
+		if i == 0 {
+			elem = t
+			continue
+		}
+		if !AssignableTo(t, elem) {
+			c.errorf(el.Pos(), "cannot use %s value as %s in array literal", t, elem)
+		}
+	}
+	return &Array{Elem: elem}
+}
+
+// checkStructLiteral checks `Name { field: value, ... }`. Every field
+// of the struct must be given exactly once.
+func (c *Checker) checkStructLiteral(exp *parser.StructLiteral) Type {
+	t, ok := c.scope.lookupType(exp.Name.Value)
+	if !ok {
+		c.errorf(exp.Name.Pos(), "undefined type: %s", exp.Name.Value)
+		c.checkValues(exp.Values)
+		return Any
+	}
+	typ, ok := t.(*Struct)
+	if !ok {
+		c.errorf(exp.Name.Pos(), "invalid composite literal type %s", t)
+		c.checkValues(exp.Values)
+		return Any
+	}
+
+	values := make([]Type, len(exp.Values))
+	for i, value := range exp.Values {
+		values[i] = c.checkValue(value)
+	}
+	if typ.Generic() {
+		typ = inferStruct(typ, exp.Fields, values)
+		c.checkBounds(exp.Pos(), typ.Origin.Params, typ.Args, "of "+typ.Name)
+	}
+
+	seen := map[string]bool{}
+	for i, name := range exp.Fields {
+		field := typ.Field(name.Value)
+		switch {
+		case field == nil:
+			c.errorf(name.Pos(), "unknown field %s in struct literal of type %s", name.Value, typ)
+		case seen[name.Value]:
+			c.errorf(name.Pos(), "duplicate field %s in struct literal", name.Value)
+		case !AssignableTo(values[i], field.Type):
+			c.errorf(exp.Values[i].Pos(), "cannot use %s value as %s in field %s of %s",
+				values[i], field.Type, name.Value, typ)
+		}
+		seen[name.Value] = true
+	}
+
+	for _, field := range typ.AllFields() {
+		if !seen[field.Name] {
+			c.errorf(exp.Pos(), "missing field %s in struct literal of type %s", field.Name, typ)
+		}
+	}
+
+	return typ
+}
+
+// inferStruct instantiates the generic struct typ with the type
+// arguments the values of a literal's fields determine.
+func inferStruct(typ *Struct, fields []*parser.Identifier, values []Type) *Struct {
+	m := map[*TypeParam]Type{}
+	for i, name := range fields {
+		if f := typ.Field(name.Value); f != nil {
+			bind(f.Type, values[i], m)
+		}
+	}
+
+	args := make([]Type, len(typ.Params))
+	for i, p := range typ.Params {
+		args[i] = Any
+		if t, ok := m[p]; ok {
+			args[i] = t
+		}
+	}
+	return typ.Instantiate(args...)
+}
+
+func (c *Checker) checkValues(exps []parser.Expression) {
+	for _, exp := range exps {
+		c.checkValue(exp)
+	}
+}
+
+// checkSelectorExpression checks `x.f`, which is either a field of x
+// or a method bound to x.
+func (c *Checker) checkSelectorExpression(exp *parser.SelectorExpression) Type {
+	return c.selector(exp, c.checkValue(exp.Left))
+}
+
+// selector returns the type of exp given the type of its operand.
+func (c *Checker) selector(exp *parser.SelectorExpression, left Type) Type {
+	if unknown(left) {
+		return Any
+	}
+
+	switch typ := left.(type) {
+	case *Struct:
+		if field := typ.Field(exp.Field.Value); field != nil {
+			return field.Type
+		}
+		if method, ok := typ.Method(exp.Field.Value); ok {
+			return method
+		}
+	case *TypeParam:
+		if method, ok := typ.Method(exp.Field.Value); ok {
+			return method
+		}
+	case *Module:
+		if member, ok := typ.Members[exp.Field.Value]; ok {
+			if c.deterministic && typ.Nondeterministic[exp.Field.Value] {
+				c.errorf(exp.Field.Pos(), "%s is nondeterministic and cannot be used in deterministic mode", describe(exp))
+			}
+			return member
+		}
+		c.errorf(exp.Field.Pos(), "%s undefined (module %s has no member %s)",
+			describe(exp), typ.Name, exp.Field.Value)
+		return Any
+	}
+
+	c.errorf(exp.Field.Pos(), "%s undefined (type %s has no field or method %s)",
+		describe(exp), left, exp.Field.Value)
+	return Any
+}
+
+// checkMapLiteral checks `{k: v, ...}`. The key and value types are
+// those of the first pair; those of an empty literal are type
+// variables, like the element type of an empty array literal.
+func (c *Checker) checkMapLiteral(exp *parser.MapLiteral) Type {
+	m := &Map{Key: c.newVar(), Value: c.newVar()}
+	for i := range exp.Keys {
+		key := c.checkValue(exp.Keys[i])
+		value := c.checkValue(exp.Values[i])
+
+		if i == 0 {
+			if !validMapKey(key) {
+				c.errorf(exp.Keys[i].Pos(), "invalid map key type %s", key)
+				key = Any
+			}
+			m.Key, m.Value = key, value
+			continue
+		}
+
+		if !AssignableTo(key, m.Key) {
+			c.errorf(exp.Keys[i].Pos(), "cannot use %s value as %s key in map literal", key, m.Key)
+		}
+		if !AssignableTo(value, m.Value) {
+			c.errorf(exp.Values[i].Pos(), "cannot use %s value as %s in map literal", value, m.Value)
+		}
+	}
+	return m
+}
+
+func (c *Checker) checkMapKey(key parser.Expression, m *Map) {
+	t := c.checkValue(key)
+	if !AssignableTo(t, m.Key) {
+		c.errorf(key.Pos(), "cannot use %s value as %s key of %s", t, m.Key, m)
+	} else if !validMapKey(m.Key) {
+		// the key type of an empty literal is bound by its first key
+		c.errorf(key.Pos(), "invalid map key type %s", m.Key)
+	}
+}
+
+func (c *Checker) checkIndexExpression(exp *parser.IndexExpression) Type {
+	left := c.checkValue(exp.Left)
+
+	switch left := left.(type) {
+	case *Array:
+		c.checkIndex(exp.Index)
+		return left.Elem
+	case *Map:
+		c.checkMapKey(exp.Index, left)
+		return left.Value
+	}
+
+	c.checkIndex(exp.Index)
+
+	if left != Str && !unknown(left) {
+		c.errorf(exp.Pos(), "cannot index %s (type %s)", describe(exp.Left), left)
+		return Any
+	}
+	return left
+}
+
+func (c *Checker) checkSliceExpression(exp *parser.SliceExpression) Type {
+	left := c.checkValue(exp.Left)
+	c.checkIndex(exp.Low)
+	c.checkIndex(exp.High)
+
+	switch left.(type) {
+	case *Array:
+		return left
+	}
+
+	if left != Str && !unknown(left) {
+		c.errorf(exp.Pos(), "cannot slice %s (type %s)", describe(exp.Left), left)
+		return Any
+	}
+	return left
+}
+
+func (c *Checker) checkIndex(index parser.Expression) {
+	if index == nil {
+		return
+	}
+	if t := c.checkValue(index); !AssignableTo(t, Int) {
+		c.errorf(index.Pos(), "invalid index %s (type %s), must be int", describe(index), t)
+	}
+}
+
+func (c *Checker) resolveType(t parser.TypeExpr) Type {
+	switch t := t.(type) {
+	case *parser.NamedType:
+		named, ok := c.scope.lookupType(t.Name)
+		if !ok {
+			c.errorf(t.Pos(), "undefined type: %s", t.Name)
+			return Any
+		}
+		if typeParamsOf(named) != nil {
+			c.errorf(t.Pos(), "cannot use generic type %s without instantiation", t.Name)
+			return Any
+		}
+		if _, ok := named.(*Trait); ok {
+			c.errorf(t.Pos(), "cannot use trait %s as a type", t.Name)
+			return Any
+		}
+		return named
+
+	case *parser.GenericType:
+		named, ok := c.scope.lookupType(t.Name)
+		if !ok {
+			c.errorf(t.Pos(), "undefined type: %s", t.Name)
+			return Any
+		}
+		params := typeParamsOf(named)
+		if params == nil {
+			c.errorf(t.Pos(), "%s is not a generic type", t.Name)
+			return Any
+		}
+		if len(t.Args) != len(params) {
+			c.errorf(t.Pos(), "wrong number of type arguments for %s: want=%d, got=%d",
+				t.Name, len(params), len(t.Args))
+			return Any
+		}
+		args := make([]Type, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = c.resolveType(arg)
+		}
+		c.checkBounds(t.Pos(), params, args, "of "+t.Name)
+		return instantiate(named, args)
+
+	case *parser.ArrayType:
+		return &Array{Elem: c.resolveType(t.Elem)}
+
+	case *parser.MapType:
+		key := c.resolveType(t.Key)
+		if !validMapKey(key) {
+			c.errorf(t.Key.Pos(), "invalid map key type %s", key)
+			key = Any
+		}
+		return &Map{Key: key, Value: c.resolveType(t.Value)}
+
+	case *parser.FunctionType:
+		fn := &Function{Params: make([]Type, len(t.Params)), Return: Void}
+		for i, p := range t.Params {
+			fn.Params[i] = c.resolveType(p)
+		}
+		if t.Return != nil {
+			fn.Return = c.resolveType(t.Return)
+		}
+		return fn
+	}
+
+	return Any
+}
+
+// checkTryExpression checks `left?`, which unwraps an Option or Result
+// and otherwise returns its None or Err from the enclosing function.
+// That function must return an Option, or a Result whose error type
+// the Err can be used as.
+func (c *Checker) checkTryExpression(exp *parser.TryExpression) Type {
+	t := c.checkValue(exp.Left)
+	e, ok := t.(*Enum)
+	if !ok || (e.Origin != Option && e.Origin != Result) {
+		if !unknown(t) {
+			c.errorf(exp.Pos(), "invalid operation: %s (type %s) is not an Option or Result", describe(exp.Left), t)
+		}
+		return Any
+	}
+
+	// the type of the value returned early
+	early := Option.anyArgs()
+	if e.Origin == Result {
+		early = Result.Instantiate(Any, e.Args[1])
+	}
+
+	switch {
+	case c.fn == nil:
+		c.errorf(exp.Pos(), "? used outside of a function")
+	case c.fn.result == nil:
+		c.fn.returns = append(c.fn.returns, early)
+	case !AssignableTo(early, c.fn.result):
+		c.errorf(exp.Pos(), "cannot use ? on %s in function returning %s", t, c.fn.result)
+	}
+
+	return e.Args[0]
+}
+
+// typeParamsOf returns the type parameters of t if it is a generic
+// type that has not been instantiated.
+func typeParamsOf(t Type) []*TypeParam {
+	switch t := t.(type) {
+	case *Enum:
+		if t.Generic() {
+			return t.Params
+		}
+	case *Struct:
+		if t.Generic() {
+			return t.Params
+		}
+	}
+	return nil
+}
+
+// describe returns a short description of exp for error messages.
+func describe(exp parser.Expression) string {
+	switch exp := exp.(type) {
+	case *parser.Identifier:
+		return exp.Value
+	case *parser.CallExpression:
+		return describe(exp.Function) + "()"
+	case *parser.SelectorExpression:
+		return describe(exp.Left) + "." + exp.Field.Value
+	case *parser.IntegerLiteral, *parser.FloatLiteral, *parser.Boolean:
+		return exp.TokenLiteral()
+	case *parser.StringLiteral:
+		return fmt.Sprintf("%q", exp.Value)
+	}
+	return "expression"
+}
@@ -0,0 +1,704 @@
+package typechecker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is the static type of a Gust expression.
+type Type interface {
+	String() string
+}
+
+// Basic is a predeclared type such as int or str.
+type Basic struct {
+	name string
+}
+
+func (b *Basic) String() string { return b.name }
+
+var (
+	Int   = &Basic{"int"}
+	Float = &Basic{"float"}
+	Str   = &Basic{"str"}
+	Bool  = &Basic{"bool"}
+
+	// Void is the result type of functions and statements that
+	// produce no value.
+	Void = &Basic{"void"}
+
+	// Any is the type of values the checker knows nothing about, such
+	// as the elements of an empty array literal. It is compatible
+	// with every type.
+	Any = &Basic{"any"}
+)
+
+// Array is `[Elem]`.
+type Array struct {
+	Elem Type
+}
+
+func (a *Array) String() string { return "[" + a.Elem.String() + "]" }
+
+// Map is `map[Key]Value`.
+type Map struct {
+	Key   Type
+	Value Type
+}
+
+func (m *Map) String() string { return "map[" + m.Key.String() + "]" + m.Value.String() }
+
+// validMapKey reports whether values of type t may be used as map
+// keys. Only types whose values are compared by value qualify, and the
+// type parameters of generic functions over maps, which only maps with
+// such keys can instantiate.
+func validMapKey(t Type) bool {
+	t = prune(t)
+	if _, ok := t.(*TypeParam); ok {
+		return true
+	}
+	return t == Int || t == Str || t == Bool || unknown(t)
+}
+
+// Struct is a struct type declared with `struct Name { ... }`. Every
+// declaration is a distinct type, identical only to itself.
+//
+// Like an enum, a struct may be generic. An instance such as
+// Stack[int] has no fields or methods of its own; they are those of
+// its Origin with the arguments substituted.
+type Struct struct {
+	Name    string
+	Params  []*TypeParam
+	Fields  []*Field
+	Methods map[string]*Function
+	Traits  map[*Trait]bool
+
+	Origin *Struct
+	Args   []Type
+}
+
+// Field is a field of a struct type.
+type Field struct {
+	Name string
+	Type Type
+}
+
+func (s *Struct) String() string { return typeName(s.Name, s.Args) }
+
+func typeName(name string, args []Type) string {
+	if len(args) == 0 {
+		return name
+	}
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = arg.String()
+	}
+	return name + "[" + strings.Join(strs, ", ") + "]"
+}
+
+// Generic reports whether s must be instantiated before it is used.
+func (s *Struct) Generic() bool { return len(s.Params) > 0 && s.Origin == nil }
+
+// Instantiate returns the struct s with its type parameters replaced
+// by args.
+func (s *Struct) Instantiate(args ...Type) *Struct {
+	return &Struct{Name: s.Name, Origin: s, Args: args}
+}
+
+// self returns the type of the receiver of s's methods: s itself, or
+// s instantiated with its own parameters if it is generic.
+func (s *Struct) self() *Struct {
+	if !s.Generic() {
+		return s
+	}
+	args := make([]Type, len(s.Params))
+	for i, p := range s.Params {
+		args[i] = p
+	}
+	return s.Instantiate(args...)
+}
+
+// AllFields returns the fields of s in declaration order.
+func (s *Struct) AllFields() []*Field {
+	if s.Origin == nil {
+		return s.Fields
+	}
+	fields := make([]*Field, len(s.Origin.Fields))
+	for i, f := range s.Origin.Fields {
+		fields[i] = &Field{Name: f.Name, Type: subst(f.Type, s.substitution())}
+	}
+	return fields
+}
+
+// Method returns the method called name.
+func (s *Struct) Method(name string) (*Function, bool) {
+	if s.Origin != nil {
+		m, ok := s.Origin.Methods[name]
+		if !ok {
+			return nil, false
+		}
+		return subst(m, s.substitution()).(*Function), true
+	}
+	m, ok := s.Methods[name]
+	return m, ok
+}
+
+func (s *Struct) substitution() map[*TypeParam]Type {
+	m := make(map[*TypeParam]Type, len(s.Args))
+	for i, p := range s.Origin.Params {
+		m[p] = s.Args[i]
+	}
+	return m
+}
+
+// Field returns the field called name, or nil if there is none.
+func (s *Struct) Field(name string) *Field {
+	for _, f := range s.AllFields() {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Enum is an enum type declared with `enum Name { ... }`. Like structs,
+// every declaration is a distinct type.
+//
+// A generic enum such as Option[T] has Params, which its variants'
+// fields may refer to. It is not a type by itself but must be
+// instantiated with arguments, giving an Enum whose Origin is the
+// generic one and whose variants have the arguments substituted.
+type Enum struct {
+	Name     string
+	Params   []*TypeParam
+	Variants []*Variant
+
+	Origin *Enum
+	Args   []Type
+}
+
+// Variant is one variant of an enum. Fields are the types of its
+// payload, empty for variants without one.
+type Variant struct {
+	Name   string
+	Fields []Type
+	Enum   *Enum
+}
+
+func (e *Enum) String() string { return typeName(e.Name, e.Args) }
+
+// Generic reports whether e must be instantiated before it is used.
+func (e *Enum) Generic() bool { return len(e.Params) > 0 && e.Origin == nil }
+
+// Instantiate returns the enum e with its type parameters replaced by
+// args.
+func (e *Enum) Instantiate(args ...Type) *Enum {
+	inst := &Enum{Name: e.Name, Origin: e, Args: args}
+	m := make(map[*TypeParam]Type, len(e.Params))
+	for i, p := range e.Params {
+		m[p] = args[i]
+	}
+	for _, v := range e.Variants {
+		fields := make([]Type, len(v.Fields))
+		for i, f := range v.Fields {
+			fields[i] = subst(f, m)
+		}
+		inst.Variants = append(inst.Variants, &Variant{Name: v.Name, Fields: fields, Enum: inst})
+	}
+	return inst
+}
+
+// anyArgs instantiates e with Any for each of its parameters, as for a
+// value such as None whose type arguments are unknown.
+func (e *Enum) anyArgs() *Enum {
+	args := make([]Type, len(e.Params))
+	for i := range args {
+		args[i] = Any
+	}
+	return e.Instantiate(args...)
+}
+
+// variant returns the variant of e with the given name.
+func (e *Enum) variant(name string) *Variant {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// TypeParam is a type parameter of a generic declaration, such as the
+// T of Option[T]. Its type arguments must implement the traits in
+// Bounds, whose methods values of the parameter's type have.
+type TypeParam struct {
+	Name   string
+	Bounds []*Trait
+}
+
+func (p *TypeParam) String() string { return p.Name }
+
+// Method returns the method called name of p's bounds.
+func (p *TypeParam) Method(name string) (*Function, bool) {
+	for _, tr := range p.Bounds {
+		if m, ok := tr.Methods[name]; ok {
+			return subst(m, map[*TypeParam]Type{tr.Self: p}).(*Function), true
+		}
+	}
+	return nil, false
+}
+
+// Trait is a trait declared with `trait Name { ... }`: the signatures
+// of the methods a type implementing it has, without their receivers.
+// Self stands for the implementing type in them. A trait bounds type
+// parameters but is not the type of any value.
+type Trait struct {
+	Name    string
+	Self    *TypeParam
+	Methods map[string]*Function
+	Order   []string
+}
+
+func (t *Trait) String() string { return t.Name }
+
+// Implements reports whether t implements the trait tr.
+func Implements(t Type, tr *Trait) bool {
+	switch t := prune(t).(type) {
+	case *Struct:
+		if t.Origin != nil {
+			t = t.Origin
+		}
+		return t.Traits[tr]
+	case *TypeParam:
+		for _, b := range t.Bounds {
+			if b == tr {
+				return true
+			}
+		}
+	case *Basic:
+		return t == Any
+	case *Var:
+		return true
+	}
+	return false
+}
+
+// subst returns t with the type parameters in m replaced.
+func subst(t Type, m map[*TypeParam]Type) Type {
+	t = prune(t)
+	switch t := t.(type) {
+	case *TypeParam:
+		if arg, ok := m[t]; ok {
+			return arg
+		}
+	case *Array:
+		return &Array{Elem: subst(t.Elem, m)}
+	case *Map:
+		return &Map{Key: subst(t.Key, m), Value: subst(t.Value, m)}
+	case *Function:
+		fn := &Function{TypeParams: t.TypeParams, Params: make([]Type, len(t.Params)), Return: subst(t.Return, m), Variadic: t.Variadic, Format: t.Format}
+		for i, p := range t.Params {
+			fn.Params[i] = subst(p, m)
+		}
+		return fn
+	}
+	if origin, args := instanceOf(t); origin != nil {
+		substituted := make([]Type, len(args))
+		for i, arg := range args {
+			substituted[i] = subst(arg, m)
+		}
+		return instantiate(origin, substituted)
+	}
+	return t
+}
+
+// instanceOf returns the generic type t is an instance of and its type
+// arguments, or a nil origin if t is not an instance.
+func instanceOf(t Type) (origin Type, args []Type) {
+	switch t := prune(t).(type) {
+	case *Enum:
+		if t.Origin != nil {
+			return t.Origin, t.Args
+		}
+	case *Struct:
+		if t.Origin != nil {
+			return t.Origin, t.Args
+		}
+	}
+	return nil, nil
+}
+
+func instantiate(origin Type, args []Type) Type {
+	switch origin := origin.(type) {
+	case *Enum:
+		return origin.Instantiate(args...)
+	case *Struct:
+		return origin.Instantiate(args...)
+	}
+	return origin
+}
+
+// infer binds the type parameters of the generic function fn to the
+// types of the arguments it is called with, returning its signature
+// with them substituted and the inferred type arguments. Parameters no
+// argument determines are Any.
+func infer(fn *Function, args []Type) (*Function, []Type) {
+	m := map[*TypeParam]Type{}
+	for i, param := range fn.Params {
+		if i < len(args) {
+			bind(param, args[i], m)
+		}
+	}
+	targs := make([]Type, len(fn.TypeParams))
+	for i, p := range fn.TypeParams {
+		if _, ok := m[p]; !ok {
+			m[p] = Any
+		}
+		targs[i] = m[p]
+	}
+
+	inst := subst(fn, m).(*Function)
+	inst.TypeParams = nil
+	return inst, targs
+}
+
+// bind matches param against arg, binding the type parameters in
+// param to the corresponding parts of arg.
+func bind(param, arg Type, m map[*TypeParam]Type) {
+	arg = prune(arg)
+	switch p := prune(param).(type) {
+	case *TypeParam:
+		if bound, ok := m[p]; !ok || unknown(bound) {
+			m[p] = arg
+		}
+	case *Array:
+		if a, ok := arg.(*Array); ok {
+			bind(p.Elem, a.Elem, m)
+		}
+	case *Map:
+		if a, ok := arg.(*Map); ok {
+			bind(p.Key, a.Key, m)
+			bind(p.Value, a.Value, m)
+		}
+	case *Function:
+		if a, ok := arg.(*Function); ok && len(a.Params) == len(p.Params) {
+			for i := range p.Params {
+				bind(p.Params[i], a.Params[i], m)
+			}
+			bind(p.Return, a.Return, m)
+		}
+	default:
+		origin, params := instanceOf(p)
+		if argOrigin, args := instanceOf(arg); origin != nil && origin == argOrigin {
+			for i := range params {
+				bind(params[i], args[i], m)
+			}
+		}
+	}
+}
+
+// Option and Result are the builtin enums Option[T] { Some(T), None }
+// and Result[T, E] { Ok(T), Err(E) }.
+var (
+	Option = newGenericEnum("Option", []string{"T"}, func(p []*TypeParam) [][]Type {
+		return [][]Type{{p[0]}, nil}
+	}, "Some", "None")
+
+	Result = newGenericEnum("Result", []string{"T", "E"}, func(p []*TypeParam) [][]Type {
+		return [][]Type{{p[0]}, {p[1]}}
+	}, "Ok", "Err")
+)
+
+func newGenericEnum(name string, params []string, fields func([]*TypeParam) [][]Type, variants ...string) *Enum {
+	e := &Enum{Name: name}
+	for _, p := range params {
+		e.Params = append(e.Params, &TypeParam{Name: p})
+	}
+	for i, f := range fields(e.Params) {
+		e.Variants = append(e.Variants, &Variant{Name: variants[i], Fields: f, Enum: e})
+	}
+	return e
+}
+
+// Constructor returns the type of the variant's name used as a value:
+// the enum itself for variants without a payload and otherwise a
+// function from the payload to the enum.
+//
+// The constructors of a generic enum's variants are generic functions:
+// calling one infers the enum's arguments from the payload, and a
+// variant without a payload has Any for its arguments.
+func (v *Variant) Constructor() Type {
+	e := v.Enum
+	if !e.Generic() {
+		if len(v.Fields) == 0 {
+			return e
+		}
+		return &Function{Params: v.Fields, Return: e}
+	}
+
+	if len(v.Fields) == 0 {
+		return e.anyArgs()
+	}
+	args := make([]Type, len(e.Params))
+	for i, p := range e.Params {
+		args[i] = p
+	}
+	return &Function{TypeParams: e.Params, Params: v.Fields, Return: e.Instantiate(args...)}
+}
+
+// Function is `fn(Params...) -> Return`. A generic function has
+// TypeParams, which are inferred from the arguments of each call.
+//
+// The last parameter of a Variadic function, a native one written in
+// Go, is an array holding the arguments from its position on.
+type Function struct {
+	TypeParams []*TypeParam
+	Params     []Type
+	Return     Type
+	Variadic   bool
+	// Format reports whether the first parameter is a format string
+	// for the arguments after it, which calls with a constant format
+	// are checked against.
+	Format bool
+}
+
+func (f *Function) String() string {
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		params[i] = p.String()
+	}
+	if f.Variadic {
+		params[len(params)-1] = "..." + f.Params[len(params)-1].(*Array).Elem.String()
+	}
+
+	s := "fn(" + strings.Join(params, ", ") + ")"
+	if f.Return != Void {
+		s += " -> " + f.Return.String()
+	}
+	return s
+}
+
+// expand returns the function a call of the variadic function f with n
+// arguments calls, which has a parameter for each of them.
+func (f *Function) expand(n int) *Function {
+	fixed := len(f.Params) - 1
+	if n < fixed {
+		n = fixed
+	}
+	params := make([]Type, n)
+	copy(params, f.Params[:fixed])
+	for i := fixed; i < n; i++ {
+		params[i] = f.Params[fixed].(*Array).Elem
+	}
+	return &Function{TypeParams: f.TypeParams, Params: params, Return: f.Return}
+}
+
+// Module is the type of a module a host program declares, whose
+// members programs read with `name.member`.
+type Module struct {
+	Name    string
+	Members map[string]Type
+	// Nondeterministic are the members whose results the host cannot
+	// reproduce, which deterministic programs may not use.
+	Nondeterministic map[string]bool
+}
+
+func (m *Module) String() string { return "module " + m.Name }
+
+// Builtin is the type of a builtin function. Calls to builtins are
+// checked by hand since most of them are generic over their arguments.
+type Builtin struct {
+	Name string
+}
+
+func (b *Builtin) String() string { return "builtin " + b.Name }
+
+// Identical reports whether a and b are the same type. An unbound type
+// variable in either is bound to the corresponding part of the other.
+func Identical(a, b Type) bool {
+	a, b = prune(a), prune(b)
+	if v, ok := unboundVar(a); ok {
+		return bindVar(v, b)
+	}
+	if v, ok := unboundVar(b); ok {
+		return bindVar(v, a)
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && Identical(a.Elem, b.Elem)
+
+	case *Map:
+		b, ok := b.(*Map)
+		return ok && Identical(a.Key, b.Key) && Identical(a.Value, b.Value)
+
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Params) != len(b.Params) || a.Variadic != b.Variadic || !Identical(a.Return, b.Return) {
+			return false
+		}
+		for i := range a.Params {
+			if !Identical(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if origin, aargs := instanceOf(a); origin != nil {
+		borigin, bargs := instanceOf(b)
+		if origin != borigin {
+			return false
+		}
+		for i := range aargs {
+			if !Identical(aargs[i], bargs[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
+
+// AssignableTo reports whether a value of type v may be stored in a
+// variable of type t. Types are assignable when they are identical up
+// to occurrences of Any, binding unbound type variables in either.
+func AssignableTo(v, t Type) bool {
+	v, t = prune(v), prune(t)
+	if v == Any || t == Any {
+		return true
+	}
+	if tv, ok := unboundVar(t); ok {
+		return bindVar(tv, v)
+	}
+	if vv, ok := unboundVar(v); ok {
+		return bindVar(vv, t)
+	}
+
+	switch t := t.(type) {
+	case *Array:
+		v, ok := v.(*Array)
+		return ok && AssignableTo(v.Elem, t.Elem)
+
+	case *Map:
+		v, ok := v.(*Map)
+		return ok && AssignableTo(v.Key, t.Key) && AssignableTo(v.Value, t.Value)
+
+	case *Function:
+		v, ok := v.(*Function)
+		if !ok || len(v.Params) != len(t.Params) || v.Variadic != t.Variadic || !AssignableTo(v.Return, t.Return) {
+			return false
+		}
+		for i := range v.Params {
+			if !AssignableTo(t.Params[i], v.Params[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if origin, targs := instanceOf(t); origin != nil {
+		vorigin, vargs := instanceOf(v)
+		if origin != vorigin {
+			return false
+		}
+		for i := range vargs {
+			if !AssignableTo(vargs[i], targs[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return Identical(v, t)
+}
+
+// CheckCall reports why fn, called name, cannot be called with
+// arguments of the types args, as a call in a program would be
+// rejected, or returns nil if it can.
+func CheckCall(name string, fn *Function, args []Type) error {
+	if fn.Variadic {
+		fn = fn.expand(len(args))
+	}
+	if len(fn.TypeParams) > 0 {
+		fn, _ = infer(fn, args)
+	}
+	if len(args) != len(fn.Params) {
+		return fmt.Errorf("wrong number of arguments in call to %s: want=%d, got=%d", name, len(fn.Params), len(args))
+	}
+	for i, arg := range args {
+		if !AssignableTo(arg, fn.Params[i]) {
+			if op, ok := unmetOp(fn.Params[i], arg); ok {
+				return fmt.Errorf("cannot use %s value in argument %d to %s: operator %s not defined on %s", arg, i+1, name, op, arg)
+			}
+			return fmt.Errorf("cannot use %s value as %s in argument %d to %s", arg, fn.Params[i], i+1, name)
+		}
+	}
+	return nil
+}
+
+// unify returns the type that values of both a and b have, filling in
+// occurrences of Any and unbound type variables in either from the
+// other, or nil if there is none. The branches of `if Ok(1) else Err("e")` unify to
+// Result[int, str].
+func unify(a, b Type) Type {
+	a, b = prune(a), prune(b)
+	if a == Any {
+		return b
+	}
+	if b == Any {
+		return a
+	}
+	if v, ok := unboundVar(a); ok {
+		if !bindVar(v, b) {
+			return nil
+		}
+		return b
+	}
+	if v, ok := unboundVar(b); ok {
+		if !bindVar(v, a) {
+			return nil
+		}
+		return a
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		if b, ok := b.(*Array); ok {
+			if elem := unify(a.Elem, b.Elem); elem != nil {
+				return &Array{Elem: elem}
+			}
+		}
+		return nil
+
+	case *Map:
+		if b, ok := b.(*Map); ok {
+			key, value := unify(a.Key, b.Key), unify(a.Value, b.Value)
+			if key != nil && value != nil {
+				return &Map{Key: key, Value: value}
+			}
+		}
+		return nil
+	}
+
+	if origin, aargs := instanceOf(a); origin != nil {
+		borigin, bargs := instanceOf(b)
+		if origin != borigin {
+			return nil
+		}
+		args := make([]Type, len(aargs))
+		for i := range aargs {
+			if args[i] = unify(aargs[i], bargs[i]); args[i] == nil {
+				return nil
+			}
+		}
+		return instantiate(origin, args)
+	}
+
+	if Identical(a, b) {
+		return a
+	}
+	return nil
+}
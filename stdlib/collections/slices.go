@@ -0,0 +1,107 @@
+// Package collections is the Gust module collections, of generic
+// functions over arrays and maps:
+//
+//	let evens = collections.filter([1, 2, 3, 4], fn(n) { n % 2 == 0 })
+package collections
+
+import (
+	"sort"
+
+	"github.com/voidwyrm-2/gust/internal/host"
+)
+
+// Module returns the collections module.
+func Module() *host.Module {
+	return host.NewModule("collections").
+		FuncSig("map", "fn map[T, U](xs: [T], f: fn(T) -> U) -> [U]", mapEach).
+		FuncSig("filter", "fn filter[T](xs: [T], keep: fn(T) -> bool) -> [T]", filter).
+		FuncSig("reduce", "fn reduce[T, U](xs: [T], init: U, f: fn(U, T) -> U) -> U", reduce).
+		FuncSig("contains", "fn contains[T](xs: [T], x: T) -> bool", contains).
+		FuncSig("index", "fn index[T](xs: [T], x: T) -> int", index).
+		FuncSig("reverse", "fn reverse[T](xs: [T]) -> [T]", reverse).
+		FuncSig("sorted", "fn sorted[T](xs: [T]) -> [T]", sorted).
+		FuncSig("keys", "fn keys[K, V](m: map[K]V) -> [K]", keys).
+		FuncSig("values", "fn values[K, V](m: map[K]V) -> [V]", values)
+}
+
+func mapEach(xs []host.Value, f func(host.Value) host.Value) []host.Value {
+	out := make([]host.Value, len(xs))
+	for i, x := range xs {
+		out[i] = f(x)
+	}
+	return out
+}
+
+func filter(xs []host.Value, keep func(host.Value) bool) []host.Value {
+	out := []host.Value{}
+	for _, x := range xs {
+		if keep(x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func reduce(xs []host.Value, acc host.Value, f func(host.Value, host.Value) host.Value) host.Value {
+	for _, x := range xs {
+		acc = f(acc, x)
+	}
+	return acc
+}
+
+func contains(xs []host.Value, x host.Value) bool {
+	return index(xs, x) >= 0
+}
+
+// index returns the index of the first element of xs equal to x, or -1.
+func index(xs []host.Value, x host.Value) int {
+	for i, el := range xs {
+		if el.Equal(x) {
+			return i
+		}
+	}
+	return -1
+}
+
+func reverse(xs []host.Value) []host.Value {
+	out := make([]host.Value, len(xs))
+	for i, x := range xs {
+		out[len(xs)-1-i] = x
+	}
+	return out
+}
+
+// sorted returns the elements of xs, ints, floats or strs, in
+// increasing order.
+func sorted(xs []host.Value) []host.Value {
+	out := append([]host.Value{}, xs...)
+	sort.SliceStable(out, func(i, j int) bool {
+		switch a := out[i].Interface().(type) {
+		case int64:
+			return a < out[j].Interface().(int64)
+		case float64:
+			return a < out[j].Interface().(float64)
+		case string:
+			return a < out[j].Interface().(string)
+		}
+		host.Raise("cannot sort %s", out[i])
+		return false
+	})
+	return out
+}
+
+func keys(m host.Value) []host.Value {
+	out := []host.Value{}
+	for _, p := range m.Pairs() {
+		out = append(out, p.Key)
+	}
+	return out
+}
+
+func values(m host.Value) []host.Value {
+	out := []host.Value{}
+	for _, p := range m.Pairs() {
+		out = append(out, p.Value)
+	}
+	return out
+}
@@ -0,0 +1,39 @@
+// Package env is the Gust module env, of the environment variables of
+// the process running the program:
+//
+//	let home = env.get("HOME")?
+//
+// Reading them takes the env capability; without it its functions
+// return a PermissionError.
+package env
+
+import (
+	"os"
+
+	"github.com/voidwyrm-2/gust/internal/host"
+)
+
+// Module returns the env module.
+func Module() *host.Module {
+	return host.NewModule("env").
+		Func("get", get).
+		Func("has", has).
+		Nondeterministic("get", "has")
+}
+
+// get returns the value of the variable name, or "" if it is not set.
+func get(c *host.Call, name string) (string, *host.PermissionError) {
+	if err := c.Capabilities().CheckEnv("env.get", name); err != nil {
+		return "", err
+	}
+	return os.Getenv(name), nil
+}
+
+// has reports whether the variable name is set.
+func has(c *host.Call, name string) (bool, *host.PermissionError) {
+	if err := c.Capabilities().CheckEnv("env.has", name); err != nil {
+		return false, err
+	}
+	_, ok := os.LookupEnv(name)
+	return ok, nil
+}
@@ -0,0 +1,260 @@
+// Package fmt is the Gust module fmt, of formatted output:
+//
+//	fmt.printf("%-8s %5.2f", name, price)
+//	fmt.println()
+//	let line = fmt.sprintf("%d items", len(items))
+//
+// String literals have no escapes, so a newline is printed with
+// fmt.println, or written in the literal as it is.
+//
+// printf and sprintf take a format string like Go's fmt.Printf, in
+// which each directive formats the next argument. The checker checks
+// calls whose format is a string literal against it; other formats
+// raise a runtime error when they do not fit their arguments.
+package fmt
+
+import (
+	stdfmt "fmt"
+	"strings"
+
+	"github.com/voidwyrm-2/gust/internal/format"
+	"github.com/voidwyrm-2/gust/internal/host"
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+)
+
+// Module returns the fmt module.
+func Module() *host.Module {
+	return host.NewModule("fmt").
+		Func("print", printValues).
+		Func("println", printLine).
+		Func("eprintln", printErrLine).
+		Func("printf", printf).
+		Func("sprintf", sprintf).
+		Format("printf", "sprintf")
+}
+
+// printValues prints args as the print builtin does.
+func printValues(c *host.Call, args ...host.Value) {
+	stdfmt.Fprint(c.Output(), join(c, args))
+}
+
+// printLine prints args as the println builtin does.
+func printLine(c *host.Call, args ...host.Value) {
+	stdfmt.Fprintln(c.Output(), join(c, args))
+}
+
+// printErrLine prints args as println does, to the error output.
+func printErrLine(c *host.Call, args ...host.Value) {
+	stdfmt.Fprintln(c.ErrOutput(), join(c, args))
+}
+
+// join returns args as println prints them, separated by spaces.
+func join(c *host.Call, args []host.Value) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = c.Display(arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// printf prints args formatted by the format f.
+func printf(c *host.Call, f string, args ...host.Value) {
+	stdfmt.Fprint(c.Output(), formatArgs(c, "fmt.printf", f, args))
+}
+
+// sprintf returns args formatted by the format f.
+func sprintf(c *host.Call, f string, args ...host.Value) string {
+	return formatArgs(c, "fmt.sprintf", f, args)
+}
+
+// formatArgs formats args by the format f for the function name,
+// raising the errors the checker reports for literal formats.
+func formatArgs(c *host.Call, name, f string, args []host.Value) string {
+	parts, err := format.Parse(f)
+	if err != nil {
+		host.Raise("%s format %s", name, err)
+	}
+
+	var b strings.Builder
+	next := 0
+	for _, part := range parts {
+		d := part.Directive
+		if d == nil {
+			b.WriteString(part.Text)
+			continue
+		}
+		if next+d.Args() > len(args) {
+			host.Raise("%s format %s reads arg #%d, but call has %d args", name, d.Text, next+d.Args(), len(args))
+		}
+		p := printer{c: c, d: *d, active: map[interpreter.Object]bool{}}
+		if d.StarWidth {
+			p.d.Width = star(name, d, args, next)
+			if p.d.Width < 0 {
+				// a negative width pads on the right, as in Go
+				p.d.Flags += "-"
+				p.d.Width = -p.d.Width
+			}
+			next++
+		}
+		if d.StarPrecision {
+			p.d.Precision = max(star(name, d, args, next), -1)
+			next++
+		}
+		s, ok := p.format(args[next].Object(), d.Verb)
+		if !ok {
+			host.Raise("%s format %s has arg #%d of wrong type %s", name, d.Text, next+1, typeName(args[next].Object()))
+		}
+		b.WriteString(s)
+		next++
+	}
+	if next < len(args) {
+		host.Raise("%s call needs %d args but has %d args", name, next, len(args))
+	}
+	return b.String()
+}
+
+// star returns args[i], the argument of a * in the directive d, which
+// may be up to format.MaxNumber either way.
+func star(name string, d *format.Directive, args []host.Value, i int) int {
+	n, ok := args[i].Object().(*interpreter.Integer)
+	if !ok {
+		host.Raise("%s format %s uses non-int arg #%d as argument of *", name, d.Text, i+1)
+	}
+	if n.Value > format.MaxNumber || n.Value < -format.MaxNumber {
+		host.Raise("%s format %s has arg #%d of %d for *, over %d", name, d.Text, i+1, n.Value, format.MaxNumber)
+	}
+	return int(n.Value)
+}
+
+// printer formats the values of a directive, with the width and
+// precision its * arguments gave. active holds the values being
+// formatted, so that a value found inside itself prints as <cycle>.
+type printer struct {
+	c      *host.Call
+	d      format.Directive
+	active map[interpreter.Object]bool
+}
+
+// format formats obj with verb, reporting false if verb does not
+// format it. Arrays, maps, structs and enum values are formatted as
+// println prints them, with each element formatted by verb.
+func (p printer) format(obj interpreter.Object, verb byte) (string, bool) {
+	spec := p.d.Spec(p.d.Width, p.d.Precision, verb)
+	if verb == 'v' {
+		switch obj := obj.(type) {
+		case *interpreter.Integer:
+			return p.sprintf(spec, obj.Value), true
+		case *interpreter.Float:
+			return p.sprintf(spec, obj.Value), true
+		case *interpreter.String:
+			return p.sprintf(spec, obj.Value), true
+		case *interpreter.Boolean:
+			return p.sprintf(spec, obj.Value), true
+		}
+		return p.sprintf(p.d.Spec(p.d.Width, p.d.Precision, 's'), p.c.Display(host.Wrap(obj))), true
+	}
+
+	switch obj.(type) {
+	case *interpreter.Array, *interpreter.Map, *interpreter.Struct, *interpreter.EnumValue:
+		if p.active[obj] {
+			return "<cycle>", true
+		}
+		p.active[obj] = true
+		defer delete(p.active, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *interpreter.Integer:
+		return p.sprintf(spec, obj.Value), format.Accepts(verb, format.Int)
+	case *interpreter.Float:
+		return p.sprintf(spec, obj.Value), format.Accepts(verb, format.Float)
+	case *interpreter.String:
+		return p.sprintf(spec, obj.Value), format.Accepts(verb, format.Str)
+	case *interpreter.Boolean:
+		return p.sprintf(spec, obj.Value), format.Accepts(verb, format.Bool)
+	case *interpreter.Array:
+		s, ok := p.list(obj.Elements, verb)
+		return "[" + s + "]", ok
+	case *interpreter.Map:
+		pairs := make([]string, 0, obj.Len())
+		for _, pair := range obj.Pairs() {
+			k, ok := p.format(pair.Key, verb)
+			if !ok {
+				return "", false
+			}
+			v, ok := p.format(pair.Value, verb)
+			if !ok {
+				return "", false
+			}
+			pairs = append(pairs, k+": "+v)
+		}
+		return "{" + strings.Join(pairs, ", ") + "}", true
+	case *interpreter.Struct:
+		if verb == 's' && obj.Def.Traits["Display"] {
+			return p.sprintf(spec, p.c.Display(host.Wrap(obj))), true
+		}
+		fields := make([]string, len(obj.Def.Fields))
+		for i, name := range obj.Def.Fields {
+			v, ok := p.format(obj.Fields[name], verb)
+			if !ok {
+				return "", false
+			}
+			fields[i] = name + ": " + v
+		}
+		return obj.Def.Name + "{" + strings.Join(fields, ", ") + "}", true
+	case *interpreter.EnumValue:
+		if len(obj.Fields) == 0 {
+			return obj.Variant.Name, true
+		}
+		s, ok := p.list(obj.Fields, verb)
+		return obj.Variant.Name + "(" + s + ")", ok
+	}
+	return "", false
+}
+
+// sprintf formats x by spec and charges the result to the run, so that
+// widths repeated over the elements of a value cannot build a string
+// bigger than the memory limit allows.
+func (p printer) sprintf(spec string, x any) string {
+	s := stdfmt.Sprintf(spec, x)
+	p.c.Charge(int64(len(s)))
+	return s
+}
+
+// list formats objs with verb, separated by commas.
+func (p printer) list(objs []interpreter.Object, verb byte) (string, bool) {
+	parts := make([]string, len(objs))
+	for i, obj := range objs {
+		s, ok := p.format(obj, verb)
+		if !ok {
+			return "", false
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, ", "), true
+}
+
+// typeName returns the name of the type of obj, for errors.
+func typeName(obj interpreter.Object) string {
+	switch obj := obj.(type) {
+	case *interpreter.Integer:
+		return "int"
+	case *interpreter.Float:
+		return "float"
+	case *interpreter.String:
+		return "str"
+	case *interpreter.Boolean:
+		return "bool"
+	case *interpreter.Null:
+		return "void"
+	case *interpreter.Array:
+		return "array"
+	case *interpreter.Map:
+		return "map"
+	case *interpreter.Struct:
+		return obj.Def.Name
+	case *interpreter.EnumValue:
+		return obj.Variant.Enum.Name
+	}
+	return "fn"
+}
@@ -0,0 +1,343 @@
+package io
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/voidwyrm-2/gust/internal/host"
+)
+
+// File is a handle of a file a program opened, or of one of its
+// standard streams. Programs pass it to the io functions that read,
+// write and close it.
+//
+// The ID of an opened file is a random number, which programs cannot
+// guess to make Files of their own, and the handles a run opened are
+// closed when it ends.
+type File struct {
+	ID   int64 `gust:"id"`
+	Path string
+}
+
+// The IDs of the handles of the standard streams, which are always
+// open.
+const (
+	stdin int64 = iota
+	stdout
+	stderr
+)
+
+// maxRead is the most io.read reads at once, however many bytes it is
+// asked for.
+const maxRead = 1 << 20
+
+// handle is what a File refers to: an open file, or a buffer writing
+// to the writer of another handle.
+type handle struct {
+	path string
+	// capability is the capability, "read" or "write", that the file
+	// was opened with in the directory dir, which each use needs too
+	capability, dir string
+	// file is the file to close, if the handle has one
+	file *os.File
+	// r is nil if the handle is not open for reading, and w if it is
+	// not open for writing
+	r *bufio.Reader
+	w io.Writer
+	// buf is the buffer of a buffered handle, which is also w
+	buf *bufio.Writer
+}
+
+// handles are the handles a program opened. Each host registers its own
+// io module and so has its own handles, which last until they are
+// closed or the run that opened them ends.
+type handles struct {
+	byID map[int64]*handle
+	// in is the reader the handle of stdin reads from, and src the
+	// input it was made for
+	in  *bufio.Reader
+	src io.Reader
+}
+
+func newHandles() *handles {
+	return &handles{byID: map[int64]*handle{}}
+}
+
+// get returns the handle f refers to, for the function op.
+func (h *handles) get(c *host.Call, op string, f File) (*handle, *IOError) {
+	switch f.ID {
+	case stdin:
+		if h.src != c.Input() {
+			h.src = c.Input()
+			h.in = bufio.NewReader(h.src)
+		}
+		return &handle{path: f.Path, r: h.in}, nil
+	case stdout:
+		return &handle{path: f.Path, w: c.Output()}, nil
+	case stderr:
+		return &handle{path: f.Path, w: c.ErrOutput()}, nil
+	}
+	hd, ok := h.byID[f.ID]
+	if !ok {
+		return nil, &IOError{Op: op, Path: f.Path, Kind: "closed", Message: "file already closed"}
+	}
+	// the capabilities may have changed since the file was opened
+	caps := c.Capabilities()
+	need := host.ReadFiles
+	if hd.capability == "write" {
+		need = host.WriteFiles
+	}
+	if hd.capability != "" && (caps.Files < need || caps.Dir != hd.dir) {
+		return nil, newError(op, f.Path, &host.PermissionError{Op: op, Path: f.Path, Capability: hd.capability})
+	}
+	return hd, nil
+}
+
+// reader returns the handle f refers to, which op reads.
+func (h *handles) reader(c *host.Call, op string, f File) (*handle, *IOError) {
+	hd, err := h.get(c, op, f)
+	if err == nil && hd.r == nil {
+		err = invalid(op, f.Path, "file not open for reading")
+	}
+	return hd, err
+}
+
+// writer returns the handle f refers to, which op writes.
+func (h *handles) writer(c *host.Call, op string, f File) (*handle, *IOError) {
+	hd, err := h.get(c, op, f)
+	if err == nil && hd.w == nil {
+		err = invalid(op, f.Path, "file not open for writing")
+	}
+	return hd, err
+}
+
+// add adds hd to the open handles and returns its File.
+func (h *handles) add(c *host.Call, hd *handle) File {
+	id := c.Rand().Int64()
+	for id <= stderr || h.byID[id] != nil {
+		id = c.Rand().Int64()
+	}
+	h.byID[id] = hd
+	return File{ID: id, Path: hd.path}
+}
+
+// closeAll closes the handles of the run that ended, flushing the
+// buffered ones first, as they may write to the others.
+func (h *handles) closeAll() {
+	for _, hd := range h.byID {
+		if hd.buf != nil {
+			hd.buf.Flush()
+		}
+	}
+	for _, hd := range h.byID {
+		if hd.file != nil {
+			hd.file.Close()
+		}
+	}
+	clear(h.byID)
+}
+
+// invalid returns the IOError of a use of the file at path that op does
+// not allow.
+func invalid(op, path, msg string) *IOError {
+	return &IOError{Op: op, Path: path, Kind: "invalid", Message: msg}
+}
+
+// open opens the file at path with mode "r" to read it, "w" to write
+// it, creating or truncating it, or "a" to append to it, creating it.
+func (h *handles) open(c *host.Call, path, mode string) (File, *IOError) {
+	var flag int
+	switch mode {
+	case "r":
+		flag = os.O_RDONLY
+	case "w":
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	case "a":
+		flag = os.O_WRONLY | os.O_APPEND | os.O_CREATE
+	default:
+		return File{}, invalid("io.open", path, fmt.Sprintf("unknown mode %q, want \"r\", \"w\" or \"a\"", mode))
+	}
+	file, err := c.Capabilities().OpenFile("io.open", path, flag, 0o644)
+	if err != nil {
+		return File{}, newError("io.open", path, err)
+	}
+	hd := &handle{path: path, dir: c.Capabilities().Dir, file: file}
+	if mode == "r" {
+		hd.capability, hd.r = "read", bufio.NewReader(file)
+	} else {
+		hd.capability, hd.w = "write", file
+	}
+	return h.add(c, hd), nil
+}
+
+// close flushes and closes f. Closing a standard stream does nothing.
+func (h *handles) close(c *host.Call, f File) *IOError {
+	if f.ID <= stderr {
+		return nil
+	}
+	// closing needs no capability
+	hd, ok := h.byID[f.ID]
+	if !ok {
+		return &IOError{Op: "io.close", Path: f.Path, Kind: "closed", Message: "file already closed"}
+	}
+	delete(h.byID, f.ID)
+
+	var err error
+	if hd.buf != nil {
+		err = hd.buf.Flush()
+	}
+	if hd.file != nil {
+		if cerr := hd.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return newError("io.close", f.Path, err)
+	}
+	return nil
+}
+
+// read reads up to n bytes from f, fewer only at the end of the file.
+// It fails with kind "eof" at the end.
+func (h *handles) read(c *host.Call, f File, n int64) (string, *IOError) {
+	hd, ioErr := h.reader(c, "io.read", f)
+	if ioErr != nil {
+		return "", ioErr
+	}
+	if n < 1 {
+		return "", invalid("io.read", f.Path, fmt.Sprintf("n must be positive, got %d", n))
+	}
+	data, err := c.ReadAll(io.LimitReader(hd.r, min(n, maxRead)))
+	if err == nil && len(data) == 0 {
+		err = io.EOF
+	}
+	if err != nil {
+		return "", newError("io.read", f.Path, err)
+	}
+	return string(data), nil
+}
+
+// readLine reads the next line from f, without its line ending. It
+// fails with kind "eof" when there are no more lines.
+func (h *handles) readLine(c *host.Call, f File) (string, *IOError) {
+	hd, err := h.reader(c, "io.read_line", f)
+	if err != nil {
+		return "", err
+	}
+	return nextLine(c, hd, "io.read_line")
+}
+
+// readLines reads the rest of f as lines, without their line endings.
+func (h *handles) readLines(c *host.Call, f File) ([]string, *IOError) {
+	hd, err := h.reader(c, "io.read_lines", f)
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{}
+	for {
+		line, err := nextLine(c, hd, "io.read_lines")
+		if err != nil {
+			if err.Kind == "eof" {
+				return lines, nil
+			}
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+}
+
+// nextLine reads the next line from hd for the function op.
+func nextLine(c *host.Call, hd *handle, op string) (string, *IOError) {
+	lr := &lineReader{r: hd.r}
+	data, err := c.ReadAll(lr)
+	// the last line need not end in a newline, but is not empty
+	if err == nil && len(data) == 0 {
+		err = io.EOF
+	}
+	if err != nil {
+		return "", newError(op, hd.path, err)
+	}
+	line := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// lineReader reads from r up to the end of the line, so that lines are
+// read within the memory limit of the run as other reads are.
+type lineReader struct {
+	r    *bufio.Reader
+	done bool
+}
+
+func (l *lineReader) Read(p []byte) (int, error) {
+	if l.done {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && !l.done {
+		b, err := l.r.ReadByte()
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		p[n] = b
+		n++
+		l.done = b == '\n'
+	}
+	return n, nil
+}
+
+// readAll reads the rest of f.
+func (h *handles) readAll(c *host.Call, f File) (string, *IOError) {
+	hd, ioErr := h.reader(c, "io.read_all", f)
+	if ioErr != nil {
+		return "", ioErr
+	}
+	data, err := c.ReadAll(hd.r)
+	if err != nil {
+		return "", newError("io.read_all", f.Path, err)
+	}
+	return string(data), nil
+}
+
+// write writes s to f.
+func (h *handles) write(c *host.Call, f File, s string) *IOError {
+	hd, ioErr := h.writer(c, "io.write", f)
+	if ioErr != nil {
+		return ioErr
+	}
+	if _, err := io.WriteString(hd.w, s); err != nil {
+		return newError("io.write", f.Path, err)
+	}
+	return nil
+}
+
+// buffered returns a handle writing to f through a buffer, which io.flush
+// and io.close flush. Closing it leaves f open.
+func (h *handles) buffered(c *host.Call, f File) (File, *IOError) {
+	hd, err := h.writer(c, "io.buffered", f)
+	if err != nil {
+		return File{}, err
+	}
+	buf := bufio.NewWriter(hd.w)
+	return h.add(c, &handle{path: f.Path, capability: hd.capability, dir: hd.dir, w: buf, buf: buf}), nil
+}
+
+// flush writes what the buffer of f holds. It does nothing for handles
+// that are not buffered.
+func (h *handles) flush(c *host.Call, f File) *IOError {
+	hd, ioErr := h.writer(c, "io.flush", f)
+	if ioErr != nil {
+		return ioErr
+	}
+	if hd.buf != nil {
+		if err := hd.buf.Flush(); err != nil {
+			return newError("io.flush", f.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Package io is the Gust module io, of files, directories and the
+// standard streams:
+//
+//	match io.read_file("config.txt") {
+//	    Ok(text) => println(text),
+//	    Err(e) => println("cannot read", e.path, e.message),
+//	}
+//
+// Besides reading and writing whole files, programs open files as File
+// handles, which they read in lines or chunks and write, optionally
+// through a buffer, and close. io.stdin, io.stdout and io.stderr are
+// the program's input and output as handles.
+//
+// Every function returns a Result whose error is an IOError. Those
+// using files are held to the capabilities of the host running the
+// program, and fail with an IOError of kind "permission" when those do
+// not allow them.
+package io
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/voidwyrm-2/gust/internal/host"
+)
+
+// Module returns the io module.
+func Module() *host.Module {
+	h := newHandles()
+	return host.NewModule("io").
+		Func("read_file", readFile).
+		Func("write_file", writeFile).
+		Func("list_dir", listDir).
+		Value("stdin", File{ID: stdin, Path: "<stdin>"}).
+		Value("stdout", File{ID: stdout, Path: "<stdout>"}).
+		Value("stderr", File{ID: stderr, Path: "<stderr>"}).
+		Func("open", h.open).
+		Func("close", h.close).
+		Func("read", h.read).
+		Func("read_line", h.readLine).
+		Func("read_lines", h.readLines).
+		Func("read_all", h.readAll).
+		Func("write", h.write).
+		Func("buffered", h.buffered).
+		Func("flush", h.flush).
+		AtRunEnd(h.closeAll)
+}
+
+// IOError is the error of an io function.
+type IOError struct {
+	// Op is the function that failed, such as io.read_file.
+	Op   string
+	Path string
+	// Kind classifies the error: "permission", "not_found", "exists",
+	// "is_dir", "eof" at the end of a file, "closed" for a handle that
+	// was closed, "invalid" for a use the handle does not allow, or
+	// "other".
+	Kind    string
+	Message string
+}
+
+func (e *IOError) Error() string { return e.Op + " " + e.Path + ": " + e.Message }
+
+// newError returns the IOError of err, raised by op on path.
+func newError(op, path string, err error) *IOError {
+	var perm *host.PermissionError
+	kind := "other"
+	switch {
+	case errors.As(err, &perm), errors.Is(err, fs.ErrPermission):
+		kind = "permission"
+	case errors.Is(err, fs.ErrNotExist):
+		kind = "not_found"
+	case errors.Is(err, fs.ErrExist):
+		kind = "exists"
+	case errors.Is(err, syscall.EISDIR):
+		kind = "is_dir"
+	case errors.Is(err, io.EOF):
+		kind = "eof"
+	}
+
+	// the op and path are fields of their own
+	msg := err.Error()
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		msg = pathErr.Err.Error()
+	}
+	if perm != nil {
+		msg = "permission denied: no " + perm.Capability + " capability"
+	}
+	if kind == "eof" {
+		msg = "end of file"
+	}
+	return &IOError{Op: op, Path: path, Kind: kind, Message: msg}
+}
+
+func readFile(c *host.Call, path string) (string, *IOError) {
+	f, err := c.Capabilities().OpenFile("io.read_file", path, os.O_RDONLY, 0)
+	if err != nil {
+		return "", newError("io.read_file", path, err)
+	}
+	defer f.Close()
+	data, err := c.ReadAll(f)
+	if err != nil {
+		return "", newError("io.read_file", path, err)
+	}
+	return string(data), nil
+}
+
+func writeFile(c *host.Call, path, data string) *IOError {
+	f, err := c.Capabilities().OpenFile("io.write_file", path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return newError("io.write_file", path, err)
+	}
+	_, err = f.WriteString(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return newError("io.write_file", path, err)
+	}
+	return nil
+}
+
+// DirEntry is an entry of a directory, as io.list_dir lists it.
+type DirEntry struct {
+	Name  string
+	IsDir bool `gust:"is_dir"`
+	// Size is the size of a file in bytes, and 0 for a directory.
+	Size int64
+}
+
+// listDir returns the entries of the directory at path, sorted by
+// name.
+func listDir(c *host.Call, path string) ([]DirEntry, *IOError) {
+	dir, err := c.Capabilities().OpenFile("io.list_dir", path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, newError("io.list_dir", path, err)
+	}
+	defer dir.Close()
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		return nil, newError("io.list_dir", path, err)
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	out := make([]DirEntry, 0, len(entries))
+	for _, e := range entries {
+		entry := DirEntry{Name: e.Name(), IsDir: e.IsDir()}
+		if !e.IsDir() {
+			info, err := e.Info()
+			if err != nil {
+				return nil, newError("io.list_dir", path, err)
+			}
+			entry.Size = info.Size()
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
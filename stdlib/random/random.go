@@ -0,0 +1,39 @@
+// Package random is the Gust module random, of pseudo-random numbers:
+//
+//	let roll = random.int(6) + 1
+//
+// The numbers come from the host, which seeds them from its seed when
+// it is deterministic, so that every run gives the same ones.
+package random
+
+import "github.com/voidwyrm-2/gust/internal/host"
+
+// Module returns the random module.
+func Module() *host.Module {
+	return host.NewModule("random").
+		Func("int", intn).
+		Func("float", float).
+		FuncSig("shuffle", "fn shuffle[T](xs: [T]) -> [T]", shuffle)
+}
+
+// intn returns a random int from 0 to n, not including n.
+func intn(c *host.Call, n int64) int64 {
+	if n < 1 {
+		host.Raise("random.int: n must be positive, got %d", n)
+	}
+	return c.Rand().Int64N(n)
+}
+
+// float returns a random float from 0 to 1, not including 1.
+func float(c *host.Call) float64 {
+	return c.Rand().Float64()
+}
+
+// shuffle returns the elements of xs in a random order.
+func shuffle(c *host.Call, xs []host.Value) []host.Value {
+	out := append([]host.Value{}, xs...)
+	c.Rand().Shuffle(len(out), func(i, j int) {
+		out[i], out[j] = out[j], out[i]
+	})
+	return out
+}
@@ -0,0 +1,29 @@
+// Package stdlib is the Gust standard library: modules written in Go
+// the way host programs write native modules, which every program can
+// use.
+package stdlib
+
+import (
+	"github.com/voidwyrm-2/gust/internal/host"
+	"github.com/voidwyrm-2/gust/stdlib/collections"
+	"github.com/voidwyrm-2/gust/stdlib/env"
+	"github.com/voidwyrm-2/gust/stdlib/fmt"
+	"github.com/voidwyrm-2/gust/stdlib/io"
+	"github.com/voidwyrm-2/gust/stdlib/random"
+	"github.com/voidwyrm-2/gust/stdlib/time"
+)
+
+// Modules returns the modules of the standard library.
+func Modules() []*host.Module {
+	return []*host.Module{collections.Module(), env.Module(), fmt.Module(), io.Module(), random.Module(), time.Module()}
+}
+
+// Register declares the modules of the standard library in h.
+func Register(h *host.Host) {
+	for _, m := range Modules() {
+		if err := h.Register(m); err != nil {
+			// the modules are fixed, so this is a bug in one of them
+			panic(err)
+		}
+	}
+}
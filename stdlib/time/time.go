@@ -0,0 +1,33 @@
+// Package time is the Gust module time, of the host's clock, which is
+// the wall clock unless the host is deterministic:
+//
+//	let start = time.now()?
+//
+// Reading the clock takes the clock capability; without it its
+// functions return a PermissionError.
+package time
+
+import "github.com/voidwyrm-2/gust/internal/host"
+
+// Module returns the time module.
+func Module() *host.Module {
+	return host.NewModule("time").
+		Func("now", now).
+		Func("unix", unix)
+}
+
+// now returns the time in nanoseconds since the Unix epoch.
+func now(c *host.Call) (int64, *host.PermissionError) {
+	if err := c.Capabilities().CheckClock("time.now"); err != nil {
+		return 0, err
+	}
+	return c.Now().UnixNano(), nil
+}
+
+// unix returns the time in seconds since the Unix epoch.
+func unix(c *host.Call) (int64, *host.PermissionError) {
+	if err := c.Capabilities().CheckClock("time.unix"); err != nil {
+		return 0, err
+	}
+	return c.Now().Unix(), nil
+}
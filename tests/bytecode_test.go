@@ -0,0 +1,139 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+)
+
+// roundTrip compiles input and decodes it from its binary format.
+func roundTrip(t *testing.T, input string) *interpreter.Bytecode {
+	t.Helper()
+
+	in := interpreter.New(nil)
+	in.SetFile("app.gt")
+	bc, err := in.Compile(parseChecked(t, input))
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	data, err := bc.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	if !interpreter.IsBytecode(data) {
+		t.Fatalf("bytecode does not start with the magic header: %q", data[:8])
+	}
+
+	decoded := &interpreter.Bytecode{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	return decoded
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	for _, tt := range conformancePrograms {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := roundTrip(t, tt.input)
+
+			var out bytes.Buffer
+			if _, err := interpreter.New(&out).RunBytecode(bc); err != nil {
+				t.Fatalf("runtime error: %v", err)
+			}
+			if out.String() != tt.out {
+				t.Errorf("wrong output.\nexpected=%q\ngot=%q", tt.out, out.String())
+			}
+		})
+	}
+}
+
+func TestBytecodeKeepsPositions(t *testing.T) {
+	bc := roundTrip(t, "fn div(a: int, b: int) -> int { a / b }\ndiv(1, 0)")
+	if bc.Source != "app.gt" {
+		t.Errorf("wrong source. got=%q", bc.Source)
+	}
+
+	_, err := interpreter.New(nil).RunBytecode(bc)
+	var rerr *interpreter.RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected a *RuntimeError, got %T (%v)", err, err)
+	}
+	if got := formatStack(rerr.Stack); got != "div@1:35 main@2:4" {
+		t.Errorf("wrong stack. got=%q", got)
+	}
+}
+
+func TestBytecodeLargeFunction(t *testing.T) {
+	// the branches and loop of big jump over more than 64KB of code
+	body := strings.Repeat("a = a + 1\n", 10000)
+	input := "fn big(n: int) -> int {\nlet a = 0\nlet i = n\nfor i > 0 {\n" +
+		"try { if i % 2 == 0 {\n" + body + "} else { a = a - 1 } } catch e { a = 0 }\n" +
+		"let m = {1: 2}\nlet v, ok = m[i]\nif ok { a = a + v }\n" +
+		"for x in [1] {\n" + body + "}\ni = i - 1\n}\na\n}\nprintln(big(3))"
+
+	var out bytes.Buffer
+	if _, err := interpreter.New(&out).RunBytecode(roundTrip(t, input)); err != nil {
+		t.Fatalf("runtime error: %v", err)
+	}
+	if out.String() != "40000\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestBytecodeRejectsBadFiles(t *testing.T) {
+	in := interpreter.New(nil)
+	bc, err := in.Compile(parseChecked(t, `println("hi")`))
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	data, err := bc.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+
+	modify := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), data...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"source", []byte(`println("hi")`), "not a gust bytecode file"},
+		{"version", modify(func(b []byte) []byte { b[5] = 99; return b }), "unsupported bytecode version 99, want 3"},
+		{"corrupt", modify(func(b []byte) []byte { b[len(b)/2] ^= 0xff; return b }), "bytecode checksum mismatch"},
+		{"truncated", data[:len(data)-1], "bytecode checksum mismatch"},
+		{"header only", data[:6], "truncated bytecode"},
+	}
+
+	for _, tt := range tests {
+		err := (&interpreter.Bytecode{}).UnmarshalBinary(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestEmbedBytecode(t *testing.T) {
+	exe := []byte("\x7fELF the gust binary")
+	if data, err := interpreter.EmbeddedBytecode(bytes.NewReader(exe), int64(len(exe))); data != nil || err != nil {
+		t.Fatalf("expected no embedded bytecode, got %q, %v", data, err)
+	}
+
+	first := interpreter.EmbedBytecode(exe, []byte("GBC\x00first"))
+	second := interpreter.EmbedBytecode(first, []byte("GBC\x00second"))
+	if !bytes.HasPrefix(second, exe) || len(second) != len(exe)+len("GBC\x00second")+16 {
+		t.Fatalf("embedding twice does not replace the first bytecode: %q", second)
+	}
+
+	data, err := interpreter.EmbeddedBytecode(bytes.NewReader(second), int64(len(second)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != "GBC\x00second" {
+		t.Errorf("wrong embedded bytecode. got=%q", data)
+	}
+}
@@ -0,0 +1,64 @@
+package test
+
+import "testing"
+
+func TestClosureCounters(t *testing.T) {
+	const counter = `
+let counter = fn() {
+    let n = 0
+    fn() {
+        n = n + 1
+        n
+    }
+}
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let c = counter()\nc()\nc()\nc()", "3"},
+		{"let a = counter()\nlet b = counter()\na()\na()\n[a(), b()]", "[3, 1]"},
+		{"let total = 0\nlet add = fn(k) { total = total + k }\nadd(5)\nadd(6)\ntotal", "11"},
+		{"let x = 1\nlet get = fn() { x }\nx = 2\nget()", "2"},
+		{"let make = fn() { let v = 0\n[fn() { v = v + 1\nv }, fn() { v }] }\nlet fs = make()\nfs[0]()\nfs[0]()\nfs[1]()", "2"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, counter+tt.input, tt.expected)
+	}
+}
+
+func TestClosureLoopVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let fs: [fn() -> int] = []\nfor i ;= 0, i < 3, i++ { fs = append(fs, fn() { i }) }\n[fs[0](), fs[1](), fs[2]()]", "[0, 1, 2]"},
+		{"let fs: [fn() -> int] = []\nfor x in [10, 20, 30] { fs = append(fs, fn() { x }) }\n[fs[0](), fs[2]()]", "[10, 30]"},
+		{"let fs: [fn() -> str] = []\nfor k, v in {\"a\": \"b\"} { fs = append(fs, fn() { k .. v }) }\nfs[0]()", "ab"},
+		// changes the body makes carry over to the next iteration's copy
+		{"let fs: [fn() -> int] = []\nfor i ;= 0, i < 6, i++ { fs = append(fs, fn() { i })\ni++ }\n[fs[0](), fs[1](), fs[2]()]", "[1, 3, 5]"},
+		{"let fs: [fn() -> int] = []\nfor i ;= 0, i < 2, i++ { fs = append(fs, fn() { i = i + 10\ni }) }\n[fs[0](), fs[0](), fs[1]()]", "[10, 20, 11]"},
+		{"let n = 0\nlet fs: [fn() -> int] = []\nfor n < 2 { n++\nfs = append(fs, fn() { n }) }\n[fs[0](), fs[1]()]", "[2, 2]"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestRecursiveClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let fact = fn(n) { if n < 2 { 1 } else { n * fact(n - 1) } }\nfact(5)", "120"},
+		{"let fib: fn(int) -> int = fn(n) { if n < 2 { n } else { fib(n - 1) + fib(n - 2) } }\nfib(15)", "610"},
+		{"let outer = fn(n: int) -> int {\nlet down = fn(k) { if k == 0 { 0 } else { 1 + down(k - 1) } }\ndown(n) }\nouter(7)", "7"},
+		{"let sum = fn(xs: [int]) -> int { if len(xs) == 0 { return 0 }\nxs[0] + sum(xs[1:]) }\nsum([1, 2, 3, 4])", "10"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
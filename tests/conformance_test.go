@@ -0,0 +1,286 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/optimizer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+	"github.com/voidwyrm-2/gust/internal/typechecker"
+)
+
+// engines are the engines the interpreter tests run every program on.
+// The tree-walking engine is the reference: the others must give the
+// same value, output and runtime error, with the same stack.
+var engines = []interpreter.Engine{interpreter.TreeEngine, interpreter.VMEngine}
+
+type outcome struct {
+	obj interpreter.Object
+	out string
+	err error
+}
+
+// describe formats everything about an outcome the engines must agree
+// on.
+func (o outcome) describe() string {
+	var b strings.Builder
+	if o.obj != nil {
+		fmt.Fprintf(&b, "value: %s\n", o.obj.Inspect())
+	}
+	fmt.Fprintf(&b, "output: %q\n", o.out)
+	var rerr *interpreter.RuntimeError
+	switch {
+	case errors.As(o.err, &rerr):
+		fmt.Fprintf(&b, "error: %s", rerr.Trace())
+	case o.err != nil:
+		fmt.Fprintf(&b, "error: %v\n", o.err)
+	}
+	return b.String()
+}
+
+// runEngines runs program, parsed from input, on every engine, on an
+// interpreter set up by setup if it is not nil. It runs it optimized at
+// every level too, and fails the test if the engines or levels
+// disagree. It returns the outcome of the tree-walking engine on the
+// program as written.
+func runEngines(t *testing.T, input string, program *parser.Program, setup func(*interpreter.Interpreter)) outcome {
+	t.Helper()
+
+	var reference outcome
+	for _, level := range []optimizer.Level{optimizer.O0, optimizer.O1, optimizer.O2} {
+		if level != optimizer.O0 {
+			// the optimizer rewrites the program it is given, which
+			// must be checked for the zero values the checker fills in
+			program = optimizer.Optimize(parseChecked(t, input), level)
+		}
+		for i, engine := range engines {
+			var out bytes.Buffer
+			in := interpreter.New(&out)
+			in.SetEngine(engine)
+			if setup != nil {
+				setup(in)
+			}
+			obj, err := in.Run(program)
+			o := outcome{obj, out.String(), err}
+
+			if i == 0 && level == optimizer.O0 {
+				reference = o
+				continue
+			}
+			if got, want := o.describe(), reference.describe(); got != want {
+				t.Errorf("%q: the %s engine at -O%d disagrees with the tree engine.\ngot:\n%s\nwant:\n%s", input, engine, level, got, want)
+			}
+		}
+	}
+	return reference
+}
+
+func parseChecked(t *testing.T, input string) *parser.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %q", errs)
+	}
+
+	checker := typechecker.New()
+	checker.Check(program)
+	if errs := checker.Errors(); len(errs) > 0 {
+		t.Fatalf("type errors: %q", errs)
+	}
+	return program
+}
+
+// conformancePrograms are programs exercising every feature of the
+// language, with the output they print.
+var conformancePrograms = []struct {
+	name  string
+	input string
+	out   string
+}{
+	{"fizzbuzz", `
+for i ;= 1, i < 16, i++ {
+    if i % 15 == 0 { println("fizzbuzz") } else if i % 3 == 0 { println("fizz") } else if i % 5 == 0 { println("buzz") } else { println(i) }
+}`, "1\n2\nfizz\n4\nbuzz\nfizz\n7\n8\nfizz\nbuzz\n11\nfizz\n13\n14\nfizzbuzz\n"},
+	{"recursion", `
+fn fib(n: int) -> int { if n < 2 { n } else { fib(n - 1) + fib(n - 2) } }
+println(fib(20))`, "6765\n"},
+	{"closures", `
+let make = fn() {
+    let n = 0
+    fn() { n = n + 1
+        n }
+}
+let a = make()
+let b = make()
+a()
+a()
+println(a(), b())
+let fs: [fn() -> int] = []
+for i ;= 0, i < 3, i++ { fs = append(fs, fn() { i * 10 }) }
+for f in fs { print(f(), "") }
+println()
+let gs: [fn() -> str] = []
+for k, v in {"x": "1", "y": "2"} { gs = append(gs, fn() { k .. "=" .. v }) }
+println(gs[0](), gs[1]())`, "3 1\n0 10 20 \nx=1 y=2\n"},
+	{"nested closures", `
+fn adder(a: int) -> fn(int) -> fn(int) -> int {
+    fn(b) { fn(c) { a + b + c } }
+}
+println(adder(1)(2)(3))`, "6\n"},
+	{"structs and traits", `
+trait Display { fn show(self) -> str }
+struct Point { x: int, y: int }
+impl Point {
+    fn norm(self) -> int { self.x * self.x + self.y * self.y }
+    fn scale(self, k: int) { self.x = self.x * k
+        self.y = self.y * k }
+}
+impl Display for Point {
+    fn show(self) -> str { if self.x > self.y { "wide" } else { "tall" } }
+}
+let p = Point { x: 3, y: 4 }
+p.scale(2)
+println(p, p.norm())
+let f = p.norm
+println(f())
+println([p], {"p": p}, Some(p))`, "tall 100\n100\n[tall] {\"p\": tall} Some(tall)\n"},
+	{"enums and match", `
+enum Shape { Circle(int), Rect(int, int), Empty }
+fn area(s: Shape) -> int {
+    match s {
+        Circle(r) => 3 * r * r,
+        Rect(w, h) if w == h => w * w
+        Rect(w, h) => w * h
+        Empty => 0
+    }
+}
+println(area(Circle(2)), area(Rect(3, 3)), area(Rect(2, 5)), area(Empty))
+fn describe(o: Option[Result[int, str]]) -> str {
+    match o {
+        Some(Ok(0)) => "zero",
+        Some(Ok(n)) if n < 0 => "negative",
+        Some(Ok(n)) => "ok",
+        Some(Err(e)) => e,
+        None => "none"
+    }
+}
+println(describe(Some(Ok(0))), describe(Some(Ok(-1))), describe(Some(Ok(5))), describe(Some(Err("bad"))), describe(None))
+println(match "b" { "a" => 1, "b" => 2, _ => 3 })`, "12 9 10 0\nzero negative ok bad none\n2\n"},
+	{"option and result", `
+fn sum(a: str, b: str) -> Result[int, str] {
+    let x = parse_int(a)?
+    let y = parse_int(b)?
+    Ok(x + y)
+}
+println(sum("40", "2"), sum("40", "x"))`, "Ok(42) Err(\"invalid int: \\\"x\\\"\")\n"},
+	{"maps and arrays", `
+let m: map[str]int = {"a": 1}
+m["b"] = 2
+delete(m, "a")
+let v, ok = m["a"]
+let xs = [1, 2, 3, 4]
+xs[0] = 10
+println(m, v, ok, xs[1:3], xs[:1], len(xs), "abc"[1], "hello"[1:])`, "{\"b\": 2} 0 false [2, 3] [10] 4 b ello\n"},
+	{"comma-ok zero values", `
+struct P { name: str, tags: [str], next: Option[P] }
+let None = 1
+let ps: map[str]P = {}
+let p, found = ps["x"]
+let fs: map[int]float = {}
+let f, _ = fs[1]
+let os: map[bool]Option[int] = {}
+let o, _ = os[true]
+let ms = {}
+ms["a"] = {"b": true}
+let m, _ = ms["z"]
+println(p, found, f, o, m, len(p.tags))`, "P{name: \"\", tags: [], next: None} false 0 None {} 0\n"},
+	{"defer and try", `
+fn risky(n: int) -> int {
+    defer println("leaving", n)
+    if n > 1 { panic("too big") }
+    n
+}
+let r = try { risky(1) + risky(2) } catch e {
+    println("caught", e)
+    0 - 1
+}
+println(r)
+let z = try { 1 / 0 } catch e {
+    println(e)
+    0
+}`, "leaving 1\nleaving 2\ncaught too big\n-1\ninteger divide by zero\n"},
+	{"tail calls", `
+fn count(n: int, acc: int) -> int { if n == 0 { return acc }
+    return count(n - 1, acc + 1) }
+println(count(50000, 0))`, "50000\n"},
+	{"generics", `
+fn map[T, U](xs: [T], f: fn(T) -> U) -> [U] {
+    let out: [U] = []
+    for x in xs { out = append(out, f(x)) }
+    out
+}
+println(map([1, 2, 3], fn(x) { x * 2 }), map(["a"], fn(s) { s .. "!" }))`, "[2, 4, 6] [\"a!\"]\n"},
+	{"floats and logic", `
+let x = 1.5 * 2.0
+println(x, -x, x > 2.0, !true, true && false, false || true, 1 != 2, "a" < "b")`, "3 -3 true false false true true true\n"},
+	{"cyclic values", `
+struct Node { v: int, next: Option[Node] }
+let a = Node { v: 1, next: None }
+a.next = Some(a)
+let b = Node { v: 1, next: None }
+b.next = Some(b)
+let c = Node { v: 1, next: Some(a) }
+let shared = Node { v: 2, next: None }
+println(a, [shared, shared], {"a": a})
+println(a == a, a == b, a == c, a == shared)`, "Node{v: 1, next: Some(<cycle>)} [Node{v: 2, next: None}, Node{v: 2, next: None}] {\"a\": Node{v: 1, next: Some(<cycle>)}}\ntrue true true false\n"},
+}
+
+func TestConformance(t *testing.T) {
+	for _, tt := range conformancePrograms {
+		t.Run(tt.name, func(t *testing.T) {
+			o := runEngines(t, tt.input, parseChecked(t, tt.input), nil)
+			if o.err != nil {
+				t.Fatalf("runtime error: %v", o.err)
+			}
+			if o.out != tt.out {
+				t.Errorf("wrong output.\nexpected=%q\ngot=%q", tt.out, o.out)
+			}
+		})
+	}
+}
+
+func TestVMSuperinstructions(t *testing.T) {
+	program := parseChecked(t, "fn f(n: int, m: int) -> int { if n < 1 { m } else { n - 1 + m } }\nf(3, 4)")
+	bc, err := interpreter.New(nil).Compile(program)
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+
+	var f *interpreter.CompiledFunction
+	for _, c := range bc.Constants {
+		if fn, ok := c.(*interpreter.CompiledFunction); ok && fn.Name == "f" {
+			f = fn
+		}
+	}
+	if f == nil {
+		t.Fatalf("no compiled function f in %v", bc.Constants)
+	}
+	code := f.Instructions.String()
+	t.Logf("f:\n%s", code)
+
+	// n < 1 and n - 1 each fuse into one instruction; the sum of the
+	// result and m does not, as its left operand is not a local
+	if got := strings.Count(code, "OpBinaryLocalConst"); got != 2 {
+		t.Errorf("expected 2 OpBinaryLocalConst, got %d", got)
+	}
+	if strings.Contains(code, "OpLess") || !strings.Contains(code, "OpAdd") {
+		t.Errorf("wrong superinstructions")
+	}
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/gust"
+)
+
+const deterministicProgram = `
+fn now() -> int {
+    match time.now() {
+        Ok(t) => t,
+        Err(e) => 0,
+    }
+}
+let start = now()
+println(now() - start, time.unix())
+println(random.int(1000), random.int(1000), random.float())
+println(random.shuffle(["a", "b", "c", "d", "e"]))
+let m: map[int]int = {}
+for i ;= 0, i != 5, i++ { m[random.int(100)] = i }
+for k, v in m { println(k, v) }`
+
+// runDeterministic runs deterministicProgram on a deterministic runtime
+// with seed and returns its output.
+func runDeterministic(t *testing.T, engine gust.Engine, seed uint64) string {
+	t.Helper()
+	var out bytes.Buffer
+	rt := gust.New(&out)
+	rt.SetEngine(engine)
+	rt.SetDeterministic(seed)
+	if err := rt.Compile(deterministicProgram); err != nil {
+		t.Fatalf("%s: compile error: %v", engine, err)
+	}
+	if _, err := rt.Run(context.Background()); err != nil {
+		t.Fatalf("%s: runtime error: %v", engine, err)
+	}
+	return out.String()
+}
+
+func TestDeterministic(t *testing.T) {
+	for _, engine := range engines {
+		first := runDeterministic(t, engine, 42)
+		if again := runDeterministic(t, engine, 42); again != first {
+			t.Errorf("%s: runs with the same seed differ:\n%s\n%s", engine, first, again)
+		}
+		if other := runDeterministic(t, engine, 43); other == first {
+			t.Errorf("%s: runs with different seeds are the same:\n%s", engine, first)
+		}
+		if !strings.HasPrefix(first, "1000000 Ok(946684800)\n") {
+			t.Errorf("%s: wrong virtual clock: %q", engine, first)
+		}
+	}
+	if tree, vm := runDeterministic(t, gust.TreeEngine, 42), runDeterministic(t, gust.VMEngine, 42); tree != vm {
+		t.Errorf("engines differ:\n%s\n%s", tree, vm)
+	}
+}
+
+func TestDeterministicRejects(t *testing.T) {
+	rt := gust.New(nil)
+	rt.SetDeterministic(1)
+
+	var cerr *gust.CompileError
+	err := rt.Compile(`env.get("HOME")`)
+	if !errors.As(err, &cerr) || !strings.Contains(err.Error(), "env.get is nondeterministic and cannot be used in deterministic mode") {
+		t.Errorf("expected env.get to be rejected, got %v", err)
+	}
+
+	if err := rt.Compile(`random.int(0)`); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	var rerr *gust.RuntimeError
+	if _, err := rt.Run(context.Background()); !errors.As(err, &rerr) || rerr.Message != "random.int: n must be positive, got 0" {
+		t.Errorf("expected a runtime error, got %v", err)
+	}
+
+	// the same program is fine on a runtime that is not deterministic
+	if err := gust.New(nil).Compile(`env.get("HOME")`); err != nil {
+		t.Errorf("compile error: %v", err)
+	}
+}
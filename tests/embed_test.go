@@ -0,0 +1,235 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/gust"
+)
+
+type server struct {
+	Host    string
+	Port    int
+	Tags    []string          `gust:"labels"`
+	Limits  map[string]uint16 `gust:"limits"`
+	Secret  string            `gust:"-"`
+	private int
+}
+
+type node struct {
+	Value int
+	Next  *node
+}
+
+// newRuntimes returns a runtime for every engine, writing to out.
+func newRuntimes(out *bytes.Buffer) map[string]*gust.Runtime {
+	rts := map[string]*gust.Runtime{}
+	for _, engine := range engines {
+		rt := gust.New(out)
+		rt.SetEngine(engine)
+		rts[engine.String()] = rt
+	}
+	return rts
+}
+
+func TestEmbedRuntime(t *testing.T) {
+	var out bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		out.Reset()
+		cfg := server{Host: "localhost", Port: 80, Tags: []string{"a", "b"}, Limits: map[string]uint16{"z": 2, "a": 1}, Secret: "x"}
+		if err := rt.Set("config", cfg); err != nil {
+			t.Fatalf("%s: set error: %v", engine, err)
+		}
+		if err := rt.Set("scale", 3); err != nil {
+			t.Fatalf("%s: set error: %v", engine, err)
+		}
+
+		err := rt.Compile(`
+fn bump(s: server, by: int) -> server {
+    server { host: s.host, port: s.port * scale + by, labels: append(s.labels, "c"), limits: s.limits }
+}
+fn lookup(m: map[str]int, k: str) -> Option[int] {
+    let v, ok = m[k]
+    if ok { Some(v) } else { None }
+}
+println(config, config.limits)
+let count = len(config.labels)
+count * 10`)
+		if err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		v, err := rt.Run(context.Background())
+		if err != nil {
+			t.Fatalf("%s: runtime error: %v", engine, err)
+		}
+		if v.Interface() != int64(20) {
+			t.Errorf("%s: wrong result. got=%#v", engine, v.Interface())
+		}
+		if want := "server{host: \"localhost\", port: 80, labels: [\"a\", \"b\"], limits: {\"a\": 1, \"z\": 2}} {\"a\": 1, \"z\": 2}\n"; out.String() != want {
+			t.Errorf("%s: wrong output.\nexpected=%q\ngot=%q", engine, want, out.String())
+		}
+
+		v, err = rt.Call(context.Background(), "bump", cfg, 1)
+		if err != nil {
+			t.Fatalf("%s: call error: %v", engine, err)
+		}
+		var got server
+		if err := v.Decode(&got); err != nil {
+			t.Fatalf("%s: decode error: %v", engine, err)
+		}
+		want := server{Host: "localhost", Port: 241, Tags: []string{"a", "b", "c"}, Limits: map[string]uint16{"a": 1, "z": 2}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: wrong struct. got=%+v, want=%+v", engine, got, want)
+		}
+
+		var n *int
+		if v, err = rt.Call(context.Background(), "lookup", map[string]int{"k": 7}, "k"); err != nil || v.Decode(&n) != nil || n == nil || *n != 7 {
+			t.Errorf("%s: wrong Some. got=%v, %v", engine, v, err)
+		}
+		if v, err = rt.Call(context.Background(), "lookup", map[string]int{}, "k"); err != nil || v.Decode(&n) != nil || n != nil {
+			t.Errorf("%s: wrong None. got=%v, %v", engine, v, err)
+		}
+		if e, ok := v.Interface().(gust.Enum); !ok || e.Variant != "None" {
+			t.Errorf("%s: wrong enum. got=%#v", engine, v.Interface())
+		}
+
+		count, ok := rt.Get("count")
+		if !ok || count.Interface() != int64(2) {
+			t.Errorf("%s: wrong global count. got=%v", engine, count)
+		}
+		if err := rt.Set("count", 5); err != nil {
+			t.Fatalf("%s: set error: %v", engine, err)
+		}
+		if err := rt.Compile("count + 1"); err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if v, err := rt.Run(context.Background()); err != nil || v.Interface() != int64(6) {
+			t.Errorf("%s: wrong result after Set. got=%v, %v", engine, v, err)
+		}
+	}
+}
+
+func TestEmbedErrors(t *testing.T) {
+	rt := gust.New(nil)
+
+	var cerr *gust.CompileError
+	if err := rt.Compile(`let x: int = "a"`); !errors.As(err, &cerr) || len(cerr.Errors) != 1 {
+		t.Errorf("expected one compile error, got %v", err)
+	}
+	if _, err := rt.Run(context.Background()); err == nil {
+		t.Errorf("expected an error running without a program")
+	}
+
+	// only the declarations of programs that ran are kept
+	if err := rt.Compile("struct P { x: int }\nlet x = 1\nlet y: int = \"a\""); err == nil {
+		t.Errorf("expected a compile error")
+	}
+	if err := rt.Compile("let z = 1"); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	for _, src := range []string{"x + 1", "z + 1"} {
+		if err := rt.Compile(src); !errors.As(err, &cerr) {
+			t.Errorf("%s: expected a compile error, got %v", src, err)
+		}
+	}
+	if err := rt.Compile("struct P { y: int }\nlet z = P { y: 1 }"); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	if _, err := rt.Run(context.Background()); err != nil {
+		t.Fatalf("runtime error: %v", err)
+	}
+	if err := rt.Compile("z.y + 1"); err != nil {
+		t.Errorf("compile error: %v", err)
+	}
+
+	if err := rt.Set("n", 1); err != nil {
+		t.Fatalf("set error: %v", err)
+	}
+	if err := rt.Set("n", "one"); err == nil {
+		t.Errorf("expected an error setting an int to a str")
+	}
+	if err := rt.Set("c", make(chan int)); err == nil {
+		t.Errorf("expected an error converting a channel")
+	}
+	cyclic := &node{Value: 1}
+	cyclic.Next = cyclic
+	if err := rt.Set("c", cyclic); err == nil {
+		t.Errorf("expected an error converting a value that contains itself")
+	}
+	list := []any{1, nil}
+	list[1] = list
+	if err := rt.Set("c", list); err == nil {
+		t.Errorf("expected an error converting a slice that contains itself")
+	}
+	shared := &node{Value: 2}
+	if err := rt.Set("c", []*node{shared, shared}); err != nil {
+		t.Errorf("set error: %v", err)
+	}
+
+	if err := rt.Compile("fn div(a: int, b: int) -> int { a / b }"); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := rt.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := rt.Run(context.Background()); err != nil {
+		t.Fatalf("runtime error: %v", err)
+	}
+
+	_, err := rt.Call(context.Background(), "div", 1, 0)
+	var rerr *gust.RuntimeError
+	if !errors.As(err, &rerr) || rerr.Message != "integer divide by zero" {
+		t.Errorf("expected a runtime error, got %v", err)
+	}
+	if _, err := rt.Call(context.Background(), "missing"); err == nil {
+		t.Errorf("expected an error calling an undefined function")
+	}
+	for _, args := range [][]any{{1}, {1, 2, 3}, {"a", 1}, {1, 2.5}} {
+		_, err := rt.Call(context.Background(), "div", args...)
+		if err == nil || errors.As(err, &rerr) {
+			t.Errorf("div%v: expected an argument error, got %v", args, err)
+		}
+	}
+
+	// a program that stops keeps only the declarations it reached
+	for _, engine := range []gust.Engine{gust.TreeEngine, gust.VMEngine} {
+		rt.SetEngine(engine)
+		if err := rt.Compile("let a = 1\nlet b = div(1, 0)\nlet n = \"n\""); err != nil {
+			t.Fatalf("compile error: %v", err)
+		}
+		if _, err := rt.Run(context.Background()); !errors.As(err, &rerr) {
+			t.Fatalf("expected a runtime error, got %v", err)
+		}
+		for _, src := range []string{"a + 1", "n + 1"} {
+			if err := rt.Compile(src); err != nil {
+				t.Errorf("%s: compile error: %v", src, err)
+			}
+		}
+		for _, src := range []string{"b + 1", "n .. \"a\""} {
+			if err := rt.Compile(src); !errors.As(err, &cerr) {
+				t.Errorf("%s: expected a compile error, got %v", src, err)
+			}
+		}
+	}
+	rt.SetEngine(gust.TreeEngine)
+
+	v, err := rt.Call(context.Background(), "div", 7, 2)
+	var s string
+	if err != nil || v.Decode(&s) == nil {
+		t.Errorf("expected an error decoding an int into a string")
+	}
+
+	if err := rt.Compile("struct N { next: Option[N] }\nlet n = N { next: None }\nn.next = Some(n)\nn"); err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	v, err = rt.Run(context.Background())
+	var x any
+	if err != nil || v.Decode(&x) == nil {
+		t.Errorf("expected an error decoding a value that contains itself")
+	}
+}
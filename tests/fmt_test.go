@@ -0,0 +1,158 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/gust"
+)
+
+const fmtDecls = `
+struct Point { x: int, y: int }
+struct Name { name: str }
+trait Display { fn show(self) -> str }
+impl Display for Name { fn show(self) -> str { return "<" .. self.name .. ">" } }
+struct Node { v: int, next: Option[Node] }
+`
+
+func TestFmt(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fmt.sprintf("%d|%5d|%-5d|%05d|%+d", 42, 42, 42, 42, 42)`, "42|   42|42   |00042|+42"},
+		{`fmt.sprintf("%x %X %o %b %#x", 255, 255, 8, 5, 255)`, "ff FF 10 101 0xff"},
+		{`fmt.sprintf("%s|%q|%6s|%-6s|%.3s|%x", "hi", "hi", "hi", "hi", "hello", "hi")`, `hi|"hi"|    hi|hi    |hel|6869`},
+		{`fmt.sprintf("%f %.2f %7.3f %e %g", 3.14159, 3.14159, 3.14159, 1000.0, 0.5)`, "3.141590 3.14   3.142 1.000000e+03 0.5"},
+		{`fmt.sprintf("%t %v %v %v %v", true, 1, 1.5, "s", false)`, "true 1 1.5 s false"},
+		{`fmt.sprintf("%*d|%-*d|%.*f", 4, 7, 3, 7, 1, 2.25)`, "   7|7  |2.2"},
+		{`fmt.sprintf("%*d|", 0 - 3, 7)`, "7  |"},
+		{`fmt.sprintf("%v", len(fmt.sprintf("%1000000d", 7)))`, "1000000"},
+		{`fmt.sprintf("100%% of %d", 3)`, "100% of 3"},
+		{`fmt.sprintf("no directives")`, "no directives"},
+		{`fmt.sprintf("%v %v %v", [1, 2], {"a": 1}, Point{x: 1, y: 2})`, `[1, 2] {"a": 1} Point{x: 1, y: 2}`},
+		{`fmt.sprintf("%02d %s %x", [1, 2], ["a", "b"], {1: 255})`, "[01, 02] [a, b] {1: ff}"},
+		{`fmt.sprintf("%03d", Point{x: 1, y: 2})`, "Point{x: 001, y: 002}"},
+		{`fmt.sprintf("%v %s %8s", Name{name: "n"}, Name{name: "n"}, Name{name: "n"})`, "<n> <n>      <n>"},
+		{`fmt.sprintf("%03d %d %v", Some(3), None, Some("x"))`, `Some(003) None Some("x")`},
+		{"let n = Node{v: 1, next: None}\nn.next = Some(n)\nfmt.sprintf(\"%02d %v\", n, [n])", "Node{v: 01, next: Some(<cycle>)} [Node{v: 1, next: Some(<cycle>)}]"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			rt := gust.New(nil)
+			rt.SetEngine(engine)
+			if err := rt.Compile(fmtDecls + tt.input); err != nil {
+				t.Fatalf("%s: %s: compile error: %v", engine, tt.input, err)
+			}
+			v, err := rt.Run(context.Background())
+			if err != nil {
+				t.Errorf("%s: %s: runtime error: %v", engine, tt.input, err)
+			} else if v.Interface() != tt.expected {
+				t.Errorf("%s: %s: expected %q, got %q", engine, tt.input, tt.expected, v.Interface())
+			}
+		}
+	}
+}
+
+func TestFmtPrint(t *testing.T) {
+	input := fmtDecls + `fmt.print("a", 1)
+fmt.println("", [1], Name{name: "n"})
+fmt.printf("%d-%s", 1, "x")
+fmt.println()
+fmt.eprintln("oops", 2)`
+
+	var out, errOut bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		out.Reset()
+		errOut.Reset()
+		rt.SetErrOutput(&errOut)
+		if err := rt.Compile(input); err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if _, err := rt.Run(context.Background()); err != nil {
+			t.Fatalf("%s: runtime error: %v", engine, err)
+		}
+		if expected := "a 1 [1] <n>\n1-x\n"; out.String() != expected {
+			t.Errorf("%s: expected output %q, got %q", engine, expected, out.String())
+		}
+		if expected := "oops 2\n"; errOut.String() != expected {
+			t.Errorf("%s: expected error output %q, got %q", engine, expected, errOut.String())
+		}
+	}
+}
+
+func TestFmtTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fmt.printf("%d", "s")`, `fmt.printf format %d has arg "s" of wrong type str`},
+		{`fmt.sprintf("%s", 1.5)`, "fmt.sprintf format %s has arg 1.5 of wrong type float"},
+		{`fmt.sprintf("%d %d", 1)`, "fmt.sprintf format %d reads arg #2, but call has 1 args"},
+		{`fmt.sprintf("%d", 1, 2)`, "fmt.sprintf call needs 1 args but has 2 args"},
+		{`fmt.sprintf("%*d", "a", 1)`, `fmt.sprintf format %*d uses non-int "a" as argument of *`},
+		{`fmt.sprintf("%z", 1)`, "fmt.sprintf format directive %z has unknown verb z"},
+		{`fmt.sprintf("%5", 1)`, "fmt.sprintf format directive %5 has no verb"},
+		{`fmt.sprintf("%d", ["a"])`, "has arg expression of wrong type [str]"},
+		{`let p = Point{x: 1, y: 2}
+fmt.sprintf("%s", p)`, "fmt.sprintf format %s has arg p of wrong type Point"},
+		{`fmt.sprintf("%t", {"a": true})`, "of wrong type map[str]bool"},
+		{`fmt.sprintf("%1000001d", 1)`, "fmt.sprintf format directive %1000001d has width over 1000000"},
+		{`fmt.sprintf("%.99999999999999999999f", 1.5)`, "has precision over 1000000"},
+		{`fmt.sprintf("%*d", 2000000, 1)`, "fmt.sprintf format %*d has arg 2000000 for *, over 1000000"},
+	}
+	for _, tt := range tests {
+		rt := gust.New(nil)
+		err := rt.Compile(fmtDecls + tt.input)
+		var cerr *gust.CompileError
+		if !errors.As(err, &cerr) || !strings.Contains(cerr.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+
+	// the checker checks only literal formats, and the module the rest
+	runtime := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = "%d"
+fmt.sprintf(f, "s")`, "fmt.sprintf format %d has arg #1 of wrong type str"},
+		{`let f = "%d %d"
+fmt.sprintf(f, 1)`, "fmt.sprintf format %d reads arg #2, but call has 1 args"},
+		{`let f = "%d"
+fmt.sprintf(f, 1, 2)`, "fmt.sprintf call needs 1 args but has 2 args"},
+		{`let f = "%q"
+fmt.sprintf(f, Point{x: 1, y: 2})`, "fmt.sprintf format %q has arg #1 of wrong type Point"},
+		{`let f = "%"
+fmt.sprintf(f)`, "fmt.sprintf format directive % has no verb"},
+		{`let w = 2000000
+fmt.sprintf("%*d", w, 1)`, "fmt.sprintf format %*d has arg #1 of 2000000 for *, over 1000000"},
+		{`let p = 0 - 2000000
+fmt.sprintf("%.*f", p, 1.5)`, "has arg #1 of -2000000 for *, over 1000000"},
+		{`let f = "%2000000s"
+fmt.sprintf(f, "s")`, "fmt.sprintf format directive %2000000s has width over 1000000"},
+	}
+	for _, engine := range engines {
+		for _, tt := range runtime {
+			rt := gust.New(nil)
+			rt.SetEngine(engine)
+			if err := rt.Compile(fmtDecls + tt.input); err != nil {
+				t.Fatalf("%s: %s: compile error: %v", engine, tt.input, err)
+			}
+			_, err := rt.Run(context.Background())
+			var rerr *gust.RuntimeError
+			if !errors.As(err, &rerr) || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("%s: %s: expected runtime error containing %q, got %v", engine, tt.input, tt.expected, err)
+			}
+		}
+	}
+
+	bad := gust.NewModule("bad").Func("f", func(n int, args ...int) {}).Format("f")
+	if err := gust.New(nil).Register(bad); err == nil {
+		t.Errorf("expected a register error for a format function without a str")
+	}
+}
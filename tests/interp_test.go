@@ -1 +1,499 @@
 package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+)
+
+// run parses, type checks and evaluates input on every engine,
+// returning the value of the program, everything it printed and its
+// runtime error, if any.
+func run(t *testing.T, input string) (interpreter.Object, string, error) {
+	t.Helper()
+
+	o := runEngines(t, input, parseChecked(t, input), nil)
+	return o.obj, o.out, o.err
+}
+
+func testInspect(t *testing.T, input, expected string) {
+	t.Helper()
+
+	obj, _, err := run(t, input)
+	if err != nil {
+		t.Fatalf("%q: runtime error: %v", input, err)
+	}
+	t.Logf("%q => %s", input, obj.Inspect())
+	if obj.Inspect() != expected {
+		t.Errorf("%q: wrong result. expected=%q, got=%q", input, expected, obj.Inspect())
+	}
+}
+
+func testRuntimeError(t *testing.T, input, expected string) {
+	t.Helper()
+
+	_, _, err := run(t, input)
+	if err == nil {
+		t.Fatalf("%q: expected runtime error %q", input, expected)
+	}
+	t.Logf("%q => error: %v", input, err)
+	if err.Error() != expected {
+		t.Errorf("%q: wrong error. expected=%q, got=%q", input, expected, err.Error())
+	}
+}
+
+func TestEvalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5", "5"},
+		{"-5 + 10 * 2", "15"},
+		{"(1 + 2) * 3 % 4", "1"},
+		{`"a" .. "b"`, "ab"},
+		{"1 < 2 == true", "true"},
+		{"!true || false && true", "false"},
+		{"if 1 > 2 { 10 } else { 20 }", "20"},
+		{"if false { 10 }", "null"},
+		{"let x = 5\nx = x + 1\nx", "6"},
+		{"a ;= 2\na", "2"},
+		{"let add = fn(a, b) { a + b }\nadd(2, 3)", "5"},
+		{"fn fact(n: int) -> int { if n < 2 { return 1 }\n return n * fact(n - 1) }\nfact(5)", "120"},
+		{"let x = 1\nif true { let x = 2 }\nx", "1"},
+		{"let x = 1\nif true { x = 2 }\nx", "2"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestArrays(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2 * 2, 3 + 3]", "[1, 4, 6]"},
+		{`["a", "b"]`, `["a", "b"]`},
+		{"[[1], [2, 3]]", "[[1], [2, 3]]"},
+		{"[1, 2, 3][0]", "1"},
+		{"let xs = [1, 2, 3]\nxs[len(xs) - 1]", "3"},
+		{"let xs: [int] = []\nlen(xs)", "0"},
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[4]`, "o"},
+		{`len("hello")`, "5"},
+		{"let xs = [1, 2, 3]\nxs[1] = 20\nxs", "[1, 20, 3]"},
+		{"let xs = [[1, 2]]\nxs[0][1] = 5\nxs", "[[1, 5]]"},
+		{"let xs = [1]\nlet ys = xs\nys[0] = 2\nxs", "[2]"},
+		{"let xs = [1, 2]\nlet ys = xs[:]\nys[0] = 9\nxs", "[1, 2]"},
+		{"let xs = [1]\nlet ys = append(xs, 2, 3)\n[len(xs), len(ys)]", "[1, 3]"},
+		{"[[1], [2]] == [[1], [2]]", "true"},
+		{"fn first(xs: [int]) -> int { xs[0] }\nfirst([7, 8])", "7"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestArrayRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3][3]", "index out of range [3] with length 3"},
+		{"[1, 2, 3][-1]", "index out of range [-1] with length 3"},
+		{"let xs: [int] = []\nxs[0] = 1", "index out of range [0] with length 0"},
+		{`"abc"[10]`, "index out of range [10] with length 3"},
+		{"[1, 2, 3][2:1]", "slice bounds out of range [2:1] with length 3"},
+		{"[1, 2, 3][:4]", "slice bounds out of range [0:4] with length 3"},
+		{"1 / 0", "integer divide by zero"},
+	}
+
+	for _, tt := range tests {
+		testRuntimeError(t, tt.input, tt.expected)
+	}
+}
+
+func TestPrintln(t *testing.T) {
+	_, out, err := run(t, `
+println("hello", 1, true)
+print("a", [1, 2])
+println()
+println(["x"])
+`)
+	if err != nil {
+		t.Fatalf("runtime error: %v", err)
+	}
+
+	expected := "hello 1 true\na [1, 2]\n[\"x\"]\n"
+	if out != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out)
+	}
+}
+
+func TestMaps(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a": 1, "b": 2}`, `{"a": 1, "b": 2}`},
+		{`{}`, `{}`},
+		{`{1: "one", 2: "two"}`, `{1: "one", 2: "two"}`},
+		{`{true: 1}[1 < 2]`, "1"},
+		{`{"a": 1}["a"]`, "1"},
+		{`let m = {"a": 1}` + "\n" + `m["b"] = 2` + "\n" + `m["a"] = 3` + "\nm", `{"a": 3, "b": 2}`},
+		{`let m = {"a": 1, "b": 2, "c": 3}` + "\n" + `delete(m, "b")` + "\n" + `delete(m, "z")` + "\nm", `{"a": 1, "c": 3}`},
+		{`let m = {"a": 1, "b": 2}` + "\n" + `delete(m, "a")` + "\n" + `m["a"] = 1` + "\nm", `{"b": 2, "a": 1}`},
+		{`let m = {"a": 1}` + "\n" + `let v, ok = m["a"]` + "\nok && v == 1", "true"},
+		{`let m = {"a": 1}` + "\n" + `v, ok ;= m["z"]` + "\nok", "false"},
+		{`len({"a": 1, "b": 2})`, "2"},
+		{`{"a": [1]} == {"a": [1]}`, "true"},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, "true"},
+		{`{"a": 1} == {"a": 2}`, "false"},
+		{`let m = {"a": 1}` + "\nlet n = m\n" + `n["a"] = 2` + "\n" + `m["a"]`, "2"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+
+	testRuntimeError(t, `let m = {"a": 1}`+"\n"+`m["b"]`, `key not found: "b"`)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let total = 0\nfor i ;= 0, i < 5, i++ { total = total + i }\ntotal", "10"},
+		{"let n = 10\nfor n > 3 { n-- }\nn", "3"},
+		{"let xs: [int] = []\nfor x in [1, 2, 3] { xs = append(xs, x * x) }\nxs", "[1, 4, 9]"},
+		{"let xs: [int] = []\nfor i, x in [5, 6] { xs = append(xs, i) }\nxs", "[0, 1]"},
+		{`let s = ""` + "\n" + `for c in "abc" { s = c .. s }` + "\ns", "cba"},
+		{`let ks: [str] = []` + "\n" + `for k in {"z": 1, "a": 2, "m": 3} { ks = append(ks, k) }` + "\nks", `["z", "a", "m"]`},
+		{`let vs: [int] = []` + "\n" + `for k, v in {"z": 1, "a": 2} { vs = append(vs, v) }` + "\nvs", "[1, 2]"},
+		{"let xs = [1, 2]\nfor x in xs { xs = append(xs, x) }\nxs", "[1, 2, 1, 2]"},
+		{`let m = {"a": 1, "b": 2}` + "\n" + `for k in m { delete(m, k) }` + "\nm", "{}"},
+		{"fn find(xs: [int], y: int) -> int { for i, x in xs { if x == y { return i } }\n return -1 }\nfind([4, 5, 6], 6)", "2"},
+		{"let i = 100\nfor i ;= 0, i < 2, i++ { }\ni", "100"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestStructs(t *testing.T) {
+	const point = `
+struct Point { x: int, y: int }
+
+impl Point {
+    fn norm(self) -> int { self.x * self.x + self.y * self.y }
+    fn scale(self, k: int) {
+        self.x = self.x * k
+        self.y = self.y * k
+    }
+    fn add(self, o: Point) -> Point { Point { x: self.x + o.x, y: self.y + o.y } }
+}
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Point { y: 2, x: 1 }", "Point{x: 1, y: 2}"},
+		{"Point { x: 1, y: 2 }.y", "2"},
+		{"let p = Point { x: 3, y: 4 }\np.norm()", "25"},
+		{"let p = Point { x: 1, y: 2 }\np.scale(3)\np", "Point{x: 3, y: 6}"},
+		{"let p = Point { x: 1, y: 2 }\np.x = 10\np.x + p.y", "12"},
+		{"Point { x: 1, y: 2 }.add(Point { x: 10, y: 20 })", "Point{x: 11, y: 22}"},
+		{"let p = Point { x: 1, y: 2 }\nlet q = p\nq.x = 5\np.x", "5"},
+		{"Point { x: 1, y: 2 } == Point { x: 1, y: 2 }", "true"},
+		{"Point { x: 1, y: 2 } == Point { x: 2, y: 1 }", "false"},
+		{"let f = Point { x: 2, y: 0 }.norm\nf()", "4"},
+		{"let ps = [Point { x: 1, y: 1 }]\nps[0].x = 7\nps", "[Point{x: 7, y: 1}]"},
+		{`struct Named { name: str }` + "\n" + `Named { name: "a" }`, `Named{name: "a"}`},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, point+tt.input, tt.expected)
+	}
+}
+
+func TestStructDeclarationOrder(t *testing.T) {
+	testInspect(t, `
+fn count(times: int) -> int {
+    let c = Counter { n: 0 }
+    for i ;= 0, i < times, i++ { c.inc() }
+    c.n
+}
+
+impl Counter {
+    fn inc(self) { self.n++ }
+}
+
+struct Counter { n: int }
+
+count(2)
+`, "2")
+}
+
+func TestEnumsAndMatch(t *testing.T) {
+	const shapes = `
+enum Shape { Circle(float), Rect(float, float), Empty }
+
+fn area(s: Shape) -> float {
+    match s {
+        Circle(r) => 3.0 * r * r,
+        Rect(w, h) if w == h => w * w
+        Rect(w, h) => w * h
+        Empty => 0.0
+    }
+}
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Rect(1.5, 2.0)", "Rect(1.5, 2)"},
+		{"Some(Empty)", "Some(Empty)"},
+		{"Some(Circle(1.0)) == Some(Circle(1.0))", "true"},
+		{"Rect(1.0, 2.0) == Rect(2.0, 1.0)", "false"},
+		{"area(Circle(2.0))", "12"},
+		{"area(Rect(3.0, 3.0))", "9"},
+		{"area(Rect(2.0, 3.5))", "7"},
+		{"area(Empty)", "0"},
+		{"match Some(Rect(1.0, 2.0)) { Some(Rect(w, _)) => w, Some(_) => -1.0, None => 0.0 }", "1"},
+		{"match None { Some(_) => 1, None => 2 }", "2"},
+		{"let xs = [Empty, Circle(1.0)]\nmatch xs[1] { Circle(r) => r + 0.5, _ => 0.0 }", "1.5"},
+		{"let r = 5.0\nmatch Circle(1.0) { Circle(r) => r, _ => 0.0 }\nr", "5"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, shapes+tt.input, tt.expected)
+	}
+}
+
+func TestMatchLiterals(t *testing.T) {
+	const sign = `
+fn sign(n: int) -> str {
+    match n {
+        -1 => "minus one",
+        0 => "zero",
+        n if n < 0 => "negative",
+        _ => "positive"
+    }
+}
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sign(-1)", "minus one"},
+		{"sign(0)", "zero"},
+		{"sign(-7)", "negative"},
+		{"sign(7)", "positive"},
+		{`match "b" { "a" => 1, "b" => 2, _ => 3 }`, "2"},
+		{"match 1.5 { 1.5 => true, _ => false }", "true"},
+		{"match 1 > 2 { true => \"yes\", false => \"no\" }", "no"},
+		{"let total = 0\nfor i ;= 0, i < 4, i++ { total = total + match i { 0 => 10, n => n } }\ntotal", "16"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, sign+tt.input, tt.expected)
+	}
+}
+
+func TestFloats(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5 + 2.25", "3.75"},
+		{"-0.5 * 4.0", "-2"},
+		{"1.0 / 4.0", "0.25"},
+		{"0.1 < 0.2", "true"},
+		{"2.5 == 2.5", "true"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestOptionAndResult(t *testing.T) {
+	const funcs = `
+fn half(n: int) -> Option[int] {
+    if n % 2 == 0 { Some(n / 2) } else { None }
+}
+
+fn quarter(n: int) -> Option[int] { Some(half(half(n)?)?) }
+
+fn sum(a: str, b: str) -> Result[int, str] {
+    let x = parse_int(a)?
+    let y = parse_int(b)?
+    Ok(x + y)
+}
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"quarter(8)", "Some(2)"},
+		{"quarter(6)", "None"},
+		{"quarter(3)", "None"},
+		{`sum("40", "2")`, "Ok(42)"},
+		{`sum("1", "x")`, `Err("invalid int: \"x\"")`},
+		{`sum("x", "y")`, `Err("invalid int: \"x\"")`},
+		{`parse_int("99999999999999999999")`, `Err("int out of range: \"99999999999999999999\"")`},
+		{`parse_float("2.5")`, "Ok(2.5)"},
+		{`match sum("1", "2") { Ok(n) => n, Err(_) => -1 }`, "3"},
+		{`let f = fn(s: str) { Ok(parse_float(s)? * 2.0) }` + "\n" + `[f("1.25"), f("z")]`, `[Ok(2.5), Err("invalid float: \"z\"")]`},
+		{"let f = fn() { let xs = [half(3)?]\nSome(xs) }\nf()", "None"},
+		{"Some(1) == Some(1)", "true"},
+		{"None == Some(1)", "false"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, funcs+tt.input, tt.expected)
+	}
+}
+
+func TestGenerics(t *testing.T) {
+	const decls = `
+fn map[T, U](xs: [T], f: fn(T) -> U) -> [U] {
+    let out: [U] = []
+    for x in xs { out = append(out, f(x)) }
+    out
+}
+
+fn filter[T](xs: [T], keep: fn(T) -> bool) -> [T] {
+    let out: [T] = []
+    for x in xs { if keep(x) { out = append(out, x) } }
+    out
+}
+
+fn first[T](xs: [T]) -> Option[T] {
+    if len(xs) == 0 { return None }
+    Some(xs[0])
+}
+
+struct Stack[T] { items: [T] }
+
+impl Stack[T] {
+    fn push(self, x: T) { self.items = append(self.items, x) }
+    fn pop(self) -> Option[T] {
+        let n = len(self.items)
+        if n == 0 { return None }
+        let top = self.items[n - 1]
+        self.items = self.items[:n - 1]
+        Some(top)
+    }
+}
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 2, 3], fn(n: int) -> int { n * n })", "[1, 4, 9]"},
+		{`map(["a", "b"], fn(s: str) -> str { s .. s })`, `["aa", "bb"]`},
+		{"filter([1, 2, 3, 4], fn(n: int) -> bool { n % 2 == 0 })", "[2, 4]"},
+		{"first([7, 8])", "Some(7)"},
+		{`let xs: [str] = []` + "\n" + `first(xs)`, "None"},
+		{"let s = Stack { items: [1] }\ns.push(2)\n[s.pop(), s.pop(), s.pop()]", "[Some(2), Some(1), None]"},
+		{`let s: Stack[str] = Stack { items: [] }` + "\n" + `s.push("a")` + "\n" + `s.items`, `["a"]`},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, decls+tt.input, tt.expected)
+	}
+}
+
+func TestTraits(t *testing.T) {
+	const decls = `
+trait Display { fn show(self) -> str }
+
+trait Area {
+    fn area(self) -> int
+    fn bigger(self, other: Self) -> bool
+}
+
+struct Rect { w: int, h: int }
+
+impl Display for Rect {
+    fn show(self) -> str { "rect" }
+}
+
+impl Area for Rect {
+    fn area(self) -> int { self.w * self.h }
+    fn bigger(self, other: Rect) -> bool { self.area() > other.area() }
+}
+
+fn largest[T: Area](xs: [T]) -> T {
+    let best = xs[0]
+    for x in xs { if x.bigger(best) { best = x } }
+    best
+}
+
+fn label[T: Display + Area](x: T) -> str { x.show() }
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Rect { w: 2, h: 3 }.area()", "6"},
+		{"largest([Rect { w: 1, h: 1 }, Rect { w: 3, h: 2 }, Rect { w: 2, h: 2 }]).w", "3"},
+		{"label(Rect { w: 1, h: 1 })", "rect"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, decls+tt.input, tt.expected)
+	}
+
+	_, out, err := run(t, decls+`
+struct Plain { n: int }
+println(Rect { w: 1, h: 2 }, [Rect { w: 1, h: 2 }], Plain { n: 1 })
+`)
+	if err != nil {
+		t.Fatalf("runtime error: %v", err)
+	}
+	// Display applies to the elements of other values too
+	expected := "rect [rect] Plain{n: 1}\n"
+	if out != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out)
+	}
+}
+
+func TestLambdaInference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let add = fn(a, b) { a + b }\nadd(2, 3)", "5"},
+		{"let twice = fn(f, x) { f(f(x)) }\ntwice(fn(n) { n * 3 }, 2)", "18"},
+		{`let greet = fn(name) { "hi " .. name }` + "\n" + `greet("bob")`, "hi bob"},
+		{"let compose = fn(f, g) { fn(x) { g(f(x)) } }\ncompose(fn(n) { n + 1 }, fn(n) { n * 10 })(1)", "20"},
+		{"fn apply(f: fn(int) -> int, n: int) -> int { f(n) }\napply(fn(n) { n - 1 }, 5)", "4"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testInspect(t, fmt.Sprintf("read_file(%q)", path), `Ok("hello")`)
+	testInspect(t, fmt.Sprintf("match read_file(%q) { Ok(_) => \"ok\", Err(_) => \"missing\" }", path+".missing"), "missing")
+}
@@ -0,0 +1,228 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/gust"
+)
+
+const ioProgram = `
+fn check[T](r: Result[T, IOError]) {
+    match r {
+        Ok(v) => {},
+        Err(e) => println("error:", e.kind, e.message),
+    }
+}
+
+match io.open("log.txt", "w") {
+    Ok(f) => {
+        check(io.write(f, "one
+two
+"))
+        check(io.close(f))
+    },
+    Err(e) => println(e),
+}
+match io.open("log.txt", "a") {
+    Ok(f) => {
+        let b = match io.buffered(f) { Ok(b) => b, Err(e) => f, }
+        check(io.write(b, "three"))
+        println(io.read_file("log.txt"))
+        check(io.flush(b))
+        println(io.read_file("log.txt"))
+        check(io.close(b))
+        check(io.close(f))
+        check(io.close(f))
+    },
+    Err(e) => println(e),
+}
+match io.open("log.txt", "r") {
+    Ok(f) => {
+        println(io.read_line(f))
+        println(io.read(f, 2))
+        println(io.read_lines(f))
+        println(io.read_line(f))
+        println(io.read_all(f))
+        check(io.write(f, "x"))
+        check(io.close(f))
+        println(io.read_line(f))
+    },
+    Err(e) => println(e),
+}
+io.write_file("sub.txt", "x")
+println(io.list_dir("."))
+println(io.open("missing.txt", "r"))
+println(io.open("log.txt", "rw"))
+io.write(io.stdout, "to stdout
+")`
+
+const ioExpected = `Ok("one\ntwo\n")
+Ok("one\ntwo\nthree")
+error: closed file already closed
+Ok("one")
+Ok("tw")
+Ok(["o", "three"])
+Err(IOError{op: "io.read_line", path: "log.txt", kind: "eof", message: "end of file"})
+Ok("")
+error: invalid file not open for writing
+Err(IOError{op: "io.read_line", path: "log.txt", kind: "closed", message: "file already closed"})
+Ok([DirEntry{name: "dir", is_dir: true, size: 0}, DirEntry{name: "log.txt", is_dir: false, size: 13}, DirEntry{name: "sub.txt", is_dir: false, size: 1}])
+Err(IOError{op: "io.open", path: "missing.txt", kind: "not_found", message: "no such file or directory"})
+Err(IOError{op: "io.open", path: "log.txt", kind: "invalid", message: "unknown mode \"rw\", want \"r\", \"w\" or \"a\""})
+to stdout
+`
+
+func TestIOFiles(t *testing.T) {
+	var out bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		out.Reset()
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, "dir"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		rt.SetCapabilities(gust.Capabilities{Files: gust.WriteFiles, Dir: dir})
+		if err := rt.Compile(ioProgram); err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if _, err := rt.Run(context.Background()); err != nil {
+			t.Fatalf("%s: runtime error: %v", engine, err)
+		}
+		if out.String() != ioExpected {
+			t.Errorf("%s: wrong output.\nexpected=%s\ngot=%s", engine, ioExpected, out.String())
+		}
+	}
+}
+
+func TestIOStreams(t *testing.T) {
+	input := `println(io.read_line(io.stdin))
+println(io.read_lines(io.stdin))
+println(io.read_line(io.stdin))
+io.write(io.stderr, "oops")
+let b = match io.buffered(io.stdout) { Ok(b) => b, Err(e) => io.stdout, }
+io.write(b, "buffered")
+println("first")
+io.close(b)
+io.close(io.stdout)
+println()`
+
+	var out, errOut bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		out.Reset()
+		errOut.Reset()
+		rt.SetInput(strings.NewReader("a\r\nb\nc"))
+		rt.SetErrOutput(&errOut)
+		if err := rt.Compile(input); err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if _, err := rt.Run(context.Background()); err != nil {
+			t.Fatalf("%s: runtime error: %v", engine, err)
+		}
+		expected := `Ok("a")
+Ok(["b", "c"])
+Err(IOError{op: "io.read_line", path: "<stdin>", kind: "eof", message: "end of file"})
+first
+buffered
+`
+		if out.String() != expected {
+			t.Errorf("%s: wrong output.\nexpected=%s\ngot=%s", engine, expected, out.String())
+		}
+		if errOut.String() != "oops" {
+			t.Errorf("%s: expected error output %q, got %q", engine, "oops", errOut.String())
+		}
+	}
+}
+
+func TestIOPermissions(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		caps     gust.Capabilities
+		input    string
+		expected string
+	}{
+		{gust.Capabilities{}, `io.list_dir(".")`,
+			`Err(IOError{op: "io.list_dir", path: ".", kind: "permission", message: "permission denied: no read capability"})`},
+		{gust.Capabilities{}, `io.open("a.txt", "r")`,
+			`Err(IOError{op: "io.open", path: "a.txt", kind: "permission", message: "permission denied: no read capability"})`},
+		{gust.Capabilities{Files: gust.ReadFiles, Dir: dir}, `io.open("a.txt", "a")`,
+			`Err(IOError{op: "io.open", path: "a.txt", kind: "permission", message: "permission denied: no write capability"})`},
+		{gust.Capabilities{Files: gust.WriteFiles, Dir: dir}, `match io.open("../a.txt", "w") { Ok(f) => "opened", Err(e) => e.kind, }`,
+			`permission`},
+		{gust.Capabilities{}, `io.write(io.stdout, "")`, `Ok(null)`},
+	}
+
+	var out bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		for _, tt := range tests {
+			rt.SetCapabilities(tt.caps)
+			if err := rt.Compile(tt.input); err != nil {
+				t.Fatalf("%s: %s: compile error: %v", engine, tt.input, err)
+			}
+			v, err := rt.Run(context.Background())
+			if err != nil {
+				t.Fatalf("%s: %s: runtime error: %v", engine, tt.input, err)
+			}
+			if v.String() != tt.expected {
+				t.Errorf("%s: %s: wrong result.\nexpected=%s\ngot=%s", engine, tt.input, tt.expected, v.String())
+			}
+		}
+	}
+}
+
+func TestIOHandles(t *testing.T) {
+	var out bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		out.Reset()
+		dir := t.TempDir()
+		rt.SetCapabilities(gust.Capabilities{Files: gust.WriteFiles, Dir: dir})
+		if err := rt.Set("revoke", func() { rt.SetCapabilities(gust.Capabilities{Files: gust.ReadFiles, Dir: dir}) }); err != nil {
+			t.Fatalf("%s: set error: %v", engine, err)
+		}
+
+		// handles are left open for the end of the run to close
+		err := rt.Compile(`let f = match io.open("a.txt", "w") { Ok(f) => f, Err(e) => io.stdout, }
+let b = match io.buffered(f) { Ok(b) => b, Err(e) => f, }
+io.write(f, "x")
+io.write(b, "y")
+println(io.stdout.id, io.read_line(File{id: 3, path: "a.txt"}))`)
+		if err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if _, err := rt.Run(context.Background()); err != nil {
+			t.Fatalf("%s: runtime error: %v", engine, err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+		if err != nil || string(data) != "xy" {
+			t.Errorf("%s: expected the run's end to flush and close the file, got %q, %v", engine, data, err)
+		}
+
+		// nor do they outlive it, or the capabilities they were opened with
+		err = rt.Compile(`println(io.write(f, "z"))
+match io.open("b.txt", "w") {
+    Ok(g) => {
+        revoke()
+        println(io.write(g, "z"))
+        println(io.close(g))
+    },
+    Err(e) => println(e),
+}`)
+		if err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if _, err := rt.Run(context.Background()); err != nil {
+			t.Fatalf("%s: runtime error: %v", engine, err)
+		}
+		expected := `1 Err(IOError{op: "io.read_line", path: "a.txt", kind: "closed", message: "file already closed"})
+Err(IOError{op: "io.write", path: "a.txt", kind: "closed", message: "file already closed"})
+Err(IOError{op: "io.write", path: "b.txt", kind: "permission", message: "permission denied: no write capability"})
+Ok(null)
+`
+		if out.String() != expected {
+			t.Errorf("%s: wrong output.\nexpected=%s\ngot=%s", engine, expected, out.String())
+		}
+	}
+}
@@ -238,3 +238,43 @@ func TestLexer(t *testing.T) {
         t.Logf("Token %d: type=%v, literal=%q", i, tok.Type, tok.Literal)
     }
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 10;\n  x ;= \"hi\"\n\n# done"
+
+	expected := []lexer.Token{
+		{Type: lexer.LET, Literal: "let", Pos: lexer.Position{Line: 1, Column: 1}},
+		{Type: lexer.IDENT, Literal: "x", Pos: lexer.Position{Line: 1, Column: 5}},
+		{Type: lexer.ASSIGN, Literal: "=", Pos: lexer.Position{Line: 1, Column: 7}},
+		{Type: lexer.INT, Literal: "10", Pos: lexer.Position{Line: 1, Column: 9}},
+		{Type: lexer.SEMICOLON, Literal: ";", Pos: lexer.Position{Line: 1, Column: 11}},
+		{Type: lexer.IDENT, Literal: "x", Pos: lexer.Position{Line: 2, Column: 3}},
+		{Type: lexer.ASSIGN, Literal: ";=", Pos: lexer.Position{Line: 2, Column: 5}},
+		{Type: lexer.STRING, Literal: "hi", Pos: lexer.Position{Line: 2, Column: 8}},
+		{Type: lexer.COMMENT_SINGLE, Literal: "# done", Pos: lexer.Position{Line: 4, Column: 1}},
+		{Type: lexer.EOF, Literal: "", Pos: lexer.Position{Line: 4, Column: 7}},
+	}
+
+	l := lexer.New(input)
+
+	for i, expectedToken := range expected {
+		tok := l.NextToken()
+		if tok != expectedToken {
+			t.Fatalf("tests[%d] - token wrong. expected=%+v, got=%+v", i, expectedToken, tok)
+		}
+	}
+}
+
+func TestTokenTypeNames(t *testing.T) {
+	for _, tt := range []lexer.TokenType{lexer.ILLEGAL, lexer.LEFT_PAREN, lexer.COMMENT_MULTI} {
+		name := tt.String()
+		got, ok := lexer.LookupTokenType(name)
+		if !ok || got != tt {
+			t.Errorf("LookupTokenType(%q) wrong. expected=%v, got=%v (ok=%v)", name, tt, got, ok)
+		}
+	}
+
+	if lexer.EQ.String() != "EQ" {
+		t.Errorf("lexer.EQ.String() wrong. expected=%q, got=%q", "EQ", lexer.EQ.String())
+	}
+}
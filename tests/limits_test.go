@@ -0,0 +1,173 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/voidwyrm-2/gust/gust"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits gust.Limits
+		input  string
+		err    error
+	}{
+		{"steps", gust.Limits{Steps: 10000}, `for true { }`, gust.ErrStepLimit},
+		{"try", gust.Limits{Steps: 10000}, `try { for true { } } catch e { println(e) }`, gust.ErrStepLimit},
+		{"recursion", gust.Limits{Steps: 10000}, `fn f(n: int) -> int { return f(n + 1) }
+f(0)`, gust.ErrStepLimit},
+		{"strings", gust.Limits{Memory: 1 << 16}, `let s = "x"
+for true { s = s .. s }`, gust.ErrMemoryLimit},
+		{"arrays", gust.Limits{Memory: 1 << 16}, `let xs = [0]
+for true { xs = append(xs, 1) }`, gust.ErrMemoryLimit},
+		{"maps", gust.Limits{Memory: 1 << 16}, `let m: map[int]int = {}
+let i = 0
+for true { m[i] = i
+i = i + 1 }`, gust.ErrMemoryLimit},
+		{"fmt", gust.Limits{Memory: 1 << 16}, `fmt.printf("%100000d", [1, 2, 3, 4, 5, 6, 7, 8])`, gust.ErrMemoryLimit},
+		{"defer", gust.Limits{Steps: 10000}, `fn f() { defer panic("deferred")
+for true { } }
+f()`, gust.ErrStepLimit},
+		{"native", gust.Limits{Steps: 10000}, `collections.map([1], fn(n: int) -> int { for true { }
+n })`, gust.ErrStepLimit},
+	}
+
+	var out bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		for _, tt := range tests {
+			out.Reset()
+			rt.SetLimits(tt.limits)
+			if err := rt.Compile(tt.input); err != nil {
+				t.Fatalf("%s: %s: compile error: %v", engine, tt.name, err)
+			}
+			_, err := rt.Run(context.Background())
+			var rerr *gust.RuntimeError
+			if !errors.Is(err, tt.err) || !errors.As(err, &rerr) {
+				t.Errorf("%s: %s: expected %v, got %v", engine, tt.name, tt.err, err)
+			}
+			if out.Len() > 0 {
+				t.Errorf("%s: %s: the error was caught: %q", engine, tt.name, out.String())
+			}
+		}
+
+		// the limits hold for each run, not for all of them
+		rt.SetLimits(gust.Limits{Steps: 50000, Memory: 1 << 20})
+		err := rt.Compile(`let n = 0
+let s = ""
+for i ;= 0, i != 1000, i++ { n = n + i
+s = s .. "x" }
+n`)
+		if err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		for i := 0; i < 3; i++ {
+			if v, err := rt.Run(context.Background()); err != nil || v.Interface() != int64(499500) {
+				t.Errorf("%s: run %d: got %v, %v", engine, i, v, err)
+			}
+		}
+		rt.SetLimits(gust.Limits{})
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	var out bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		if err := rt.Compile(`for true { }`); err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := rt.Run(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected the deadline to stop the run, got %v", engine, err)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		_, err = rt.Run(ctx)
+		var rerr *gust.RuntimeError
+		if !errors.Is(err, context.Canceled) || !errors.As(err, &rerr) {
+			t.Errorf("%s: expected cancelling to stop the run, got %v", engine, err)
+		}
+
+		if err := rt.Compile(`fn spin(n: int) -> int { for true { } n }`); err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if _, err := rt.Run(context.Background()); err != nil {
+			t.Fatalf("%s: runtime error: %v", engine, err)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err = rt.Call(ctx, "spin", 1)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) || !errors.As(err, &rerr) {
+			t.Errorf("%s: expected the deadline to stop the call, got %v", engine, err)
+		}
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		if _, err := rt.Call(ctx, "spin", 1); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected a done context not to start the call, got %v", engine, err)
+		}
+
+		// a later run with a live context is not stopped
+		if err := rt.Compile(`1 + 1`); err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if v, err := rt.Run(context.Background()); err != nil || v.Interface() != int64(2) {
+			t.Errorf("%s: got %v, %v after a cancelled run", engine, v, err)
+		}
+	}
+}
+
+func TestLargeValueLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.txt")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), 1<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		if err := rt.Set("path", path); err != nil {
+			t.Fatalf("%s: set error: %v", engine, err)
+		}
+		// the host's values are not charged, what is built from them is
+		if err := rt.Set("big", strings.Repeat("x", 1<<20)); err != nil {
+			t.Fatalf("%s: set error: %v", engine, err)
+		}
+		if err := rt.Set("bigs", make([]int, 1<<19)); err != nil {
+			t.Fatalf("%s: set error: %v", engine, err)
+		}
+		inputs := []string{
+			`read_file(path)`,
+			`io.read_file(path)`,
+			`match io.open(path, "r") { Ok(f) => io.read_all(f), Err(e) => Err(e), }`,
+			`match io.open(path, "r") { Ok(f) => io.read_line(f), Err(e) => Err(e), }`,
+			`big .. big`,
+			`append(bigs, 1)`,
+		}
+		for _, input := range inputs {
+			rt.SetLimits(gust.Limits{Memory: 1 << 16})
+			if err := rt.Compile(input); err != nil {
+				t.Fatalf("%s: %s: compile error: %v", engine, input, err)
+			}
+			if _, err := rt.Run(context.Background()); !errors.Is(err, gust.ErrMemoryLimit) {
+				t.Errorf("%s: %s: expected %v, got %v", engine, input, gust.ErrMemoryLimit, err)
+			}
+
+			rt.SetLimits(gust.Limits{})
+			v, err := rt.Run(context.Background())
+			if err != nil || len(v.String()) < 1<<20 {
+				t.Errorf("%s: %s: expected the value without limits, got %v", engine, input, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/gust"
+)
+
+type parseError struct {
+	Input  string
+	Reason string
+}
+
+func (e *parseError) Error() string { return e.Reason }
+
+func TestNativeModule(t *testing.T) {
+	var out bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		out.Reset()
+		m := gust.NewModule("conv").
+			Func("atoi", strconv.Atoi).
+			Func("parse", func(s string) (int, *parseError) {
+				n, err := strconv.Atoi(s)
+				if err != nil {
+					return 0, &parseError{Input: s, Reason: "not a number"}
+				}
+				return n, nil
+			}).
+			Func("sum", func(ns ...int) int {
+				total := 0
+				for _, n := range ns {
+					total += n
+				}
+				return total
+			}).
+			Func("say", func(c *gust.Call, s string) {
+				fmt.Fprintln(c.Output(), "said", s)
+			}).
+			Func("twice", func(c *gust.Call, f gust.Value, n int) (int, error) {
+				v, err := c.Call(f, n)
+				if err != nil {
+					return 0, err
+				}
+				var m int
+				if err := v.Decode(&m); err != nil {
+					return 0, err
+				}
+				v, err = c.Call(f, m)
+				if err != nil {
+					return 0, err
+				}
+				return m, v.Decode(&m)
+			}).
+			FuncSig("apply", "fn apply(f: fn(int) -> int, n: int) -> int", func(f func(int) int, n int) int {
+				return f(n)
+			}).
+			Func("check", func(n int) int {
+				if n < 0 {
+					gust.Raise("negative: %d", n)
+				}
+				return n
+			}).
+			Value("base", 10)
+		if err := rt.Register(m); err != nil {
+			t.Fatalf("%s: register error: %v", engine, err)
+		}
+
+		err := rt.Compile(`
+match conv.atoi("42") {
+    Ok(n) => println(n + conv.base),
+    Err(e) => println("error", e),
+}
+match conv.atoi("x") {
+    Ok(n) => println(n),
+    Err(e) => println("error", e),
+}
+match conv.parse("y") {
+    Ok(n) => println(n),
+    Err(e) => println(e.input, e.reason),
+}
+println(conv.sum(), conv.sum(1, 2, 3))
+conv.say("hi")
+println(conv.apply(fn(n: int) -> int { n * 3 }, 2))
+println(conv.twice(fn(n: int) -> int { n + 1 }, 0))
+conv.check(5)`)
+		if err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		v, err := rt.Run(context.Background())
+		if err != nil {
+			t.Fatalf("%s: runtime error: %v", engine, err)
+		}
+		if v.Interface() != int64(5) {
+			t.Errorf("%s: wrong result. got=%#v", engine, v.Interface())
+		}
+		want := `52
+error strconv.Atoi: parsing "x": invalid syntax
+y not a number
+0 6
+said hi
+6
+Ok(2)
+`
+		if out.String() != want {
+			t.Errorf("%s: wrong output.\nexpected=%q\ngot=%q", engine, want, out.String())
+		}
+
+		var rerr *gust.RuntimeError
+		if err := rt.Compile("conv.check(0 - 1)"); err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if _, err := rt.Run(context.Background()); !errors.As(err, &rerr) || rerr.Message != "negative: -1" {
+			t.Errorf("%s: expected a raised error, got %v", engine, err)
+		}
+		if err := rt.Compile(`conv.apply(fn(n: int) -> int { n / 0 }, 1)`); err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if _, err := rt.Run(context.Background()); !errors.As(err, &rerr) || rerr.Message != "integer divide by zero" {
+			t.Errorf("%s: expected the callback's error, got %v", engine, err)
+		}
+		if err := rt.Compile(`conv.twice(fn(n: int) -> int { n / 0 }, 1)`); err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		if _, err := rt.Run(context.Background()); !errors.As(err, &rerr) || rerr.Message != "integer divide by zero" {
+			t.Errorf("%s: expected the returned error to be raised, got %v", engine, err)
+		}
+	}
+}
+
+func TestNativeTypeErrors(t *testing.T) {
+	rt := gust.New(nil)
+	m := gust.NewModule("conv").
+		Func("atoi", strconv.Atoi).
+		Func("sum", func(ns ...int) int { return len(ns) })
+	if err := rt.Register(m); err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`conv.atoi(1)`, "cannot use int value as str"},
+		{`conv.sum(1, "a")`, "cannot use str value as int"},
+		{`conv.missing()`, "conv.missing undefined (module conv has no member missing)"},
+		{`let n: int = conv.atoi("1")`, "cannot use Result[int, str] value as int"},
+		{`collections.map(1, fn(n: int) -> int { n })`, "cannot use int value as [int] in argument to collections.map"},
+	}
+	for _, tt := range tests {
+		err := rt.Compile(tt.input)
+		var cerr *gust.CompileError
+		if !errors.As(err, &cerr) || !strings.Contains(cerr.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+
+	bad := []*gust.Module{
+		gust.NewModule("a").Func("f", 1),
+		gust.NewModule("b").FuncSig("f", "fn f(a: int, b: int) -> int", func(a int) int { return a }),
+		gust.NewModule("c").FuncSig("f", "fn f(a: nope) -> int", func(a int) int { return a }),
+		gust.NewModule("d").Func("f", func() (int, int) { return 0, 0 }),
+		gust.NewModule("e").FuncSig("f", "fn f(a: str) -> int", func(a int) int { return a }),
+		gust.NewModule("f").FuncSig("f", "fn f(a: int) -> str", func(a int) int { return a }),
+		gust.NewModule("g").FuncSig("f", "fn f[T](a: T) -> int", func(a int) int { return a }),
+		gust.NewModule("h").FuncSig("f", "fn f[T](xs: [T]) -> int", func(xs []any) int { return len(xs) }),
+		gust.NewModule("i").FuncSig("f", "fn f(g: fn(int) -> str) -> int", func(g func(int) int) int { return g(1) }),
+		gust.NewModule("j").FuncSig("f", "fn f(a: int) -> Result[int, str]", func(a int) int { return a }),
+		gust.NewModule("k").FuncSig("f", "fn f(a: int) -> int", func(a int) (int, error) { return a, nil }),
+	}
+	for _, m := range bad {
+		if err := rt.Register(m); err == nil {
+			t.Errorf("%s: expected a register error", m.Name)
+		}
+	}
+}
+
+func TestCollections(t *testing.T) {
+	var out bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		out.Reset()
+		err := rt.Compile(`
+let xs = [3, 1, 2]
+println(collections.map(xs, fn(n: int) -> bool { n == 1 }))
+println(collections.filter(xs, fn(n: int) -> bool { n > 1 }))
+println(collections.reduce(xs, 0, fn(acc: int, n: int) -> int { acc + n }))
+println(collections.contains(xs, 2), collections.index(xs, 2), collections.index(xs, 9))
+println(collections.reverse(xs), collections.sorted(xs), collections.sorted(["b", "a"]))
+let m = {"a": 1, "b": 2}
+println(collections.keys(m), collections.values(m))
+collections.sorted([[1], [1]])`)
+		if err != nil {
+			t.Fatalf("%s: compile error: %v", engine, err)
+		}
+		_, err = rt.Run(context.Background())
+		var rerr *gust.RuntimeError
+		if !errors.As(err, &rerr) || rerr.Message != "cannot sort [1]" {
+			t.Errorf("%s: expected a sort error, got %v", engine, err)
+		}
+		want := `[false, true, false]
+[3, 2]
+6
+true 2 -1
+[2, 1, 3] [1, 2, 3] ["a", "b"]
+["a", "b"] [1, 2]
+`
+		if out.String() != want {
+			t.Errorf("%s: wrong output.\nexpected=%q\ngot=%q", engine, want, out.String())
+		}
+	}
+}
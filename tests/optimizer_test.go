@@ -0,0 +1,179 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/internal/optimizer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+// unparse writes the statements and expressions the optimizer produces
+// back as source, on one line.
+func unparse(n parser.Node) string {
+	switch n := n.(type) {
+	case *parser.Program:
+		return unparseList(n.Statements)
+	case *parser.BlockStatement:
+		return "{ " + unparseList(n.Statements) + " }"
+	case *parser.ExpressionStatement:
+		return unparse(n.Expression)
+	case *parser.LetStatement:
+		return "let " + n.Name.Value + " = " + unparse(n.Value)
+	case *parser.AssignStatement:
+		return unparse(n.Target) + " = " + unparse(n.Value)
+	case *parser.ReturnStatement:
+		return "return " + unparse(n.ReturnValue)
+	case *parser.FunctionStatement:
+		return "fn " + n.Name.Value + " " + unparse(n.Function.Body)
+	case *parser.FunctionLiteral:
+		return "fn " + unparse(n.Body)
+	case *parser.ForStatement:
+		return "for " + unparse(n.Init) + ", " + unparse(n.Condition) + ", " + unparse(n.Post) + " " + unparse(n.Body)
+	case *parser.ForInStatement:
+		return "for " + n.Key.Value + " in " + unparse(n.Iterable) + " " + unparse(n.Body)
+	case *parser.IfExpression:
+		s := "if " + unparse(n.Condition) + " " + unparse(n.Consequence)
+		if n.Alternative != nil {
+			s += " else " + unparse(n.Alternative)
+		}
+		return s
+	case *parser.InfixExpression:
+		return "(" + unparse(n.Left) + " " + n.Operator + " " + unparse(n.Right) + ")"
+	case *parser.PrefixExpression:
+		return "(" + n.Operator + unparse(n.Right) + ")"
+	case *parser.CallExpression:
+		args := make([]string, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			args[i] = unparse(arg)
+		}
+		return unparse(n.Function) + "(" + strings.Join(args, ", ") + ")"
+	case *parser.Identifier:
+		return n.Value
+	case *parser.StringLiteral:
+		return fmt.Sprintf("%q", n.Value)
+	case *parser.IntegerLiteral, *parser.FloatLiteral, *parser.Boolean:
+		return n.TokenLiteral()
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("<%T>", n)
+}
+
+func unparseList(stmts []parser.Statement) string {
+	parts := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		parts[i] = unparse(stmt)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func TestOptimizer(t *testing.T) {
+	tests := []struct {
+		input    string
+		level    optimizer.Level
+		expected string
+	}{
+		// constant folding
+		{`let x = 2 * 3 + 1`, optimizer.O1, `let x = 7`},
+		{`let x = -2.0 * 2.5 > 0.0`, optimizer.O1, `let x = false`},
+		{`let s = "a" .. "b" .. "c"`, optimizer.O1, `let s = "abc"`},
+		{`let b = !(1 < 2) || 3 == 3`, optimizer.O1, `let b = true`},
+		{"let x = 1\nlet b = false && x > 0", optimizer.O1, `let x = 1; let b = false`},
+		{"let x = 1\nlet b = x > 0 && false", optimizer.O1, `let x = 1; let b = ((x > 0) && false)`},
+		// operations that fail at runtime are left to fail there
+		{`let x = 7 / 0 + 1`, optimizer.O1, `let x = ((7 / 0) + 1)`},
+		{`let x = 7 % (2 - 2)`, optimizer.O1, `let x = (7 % 0)`},
+		{`let x = 2 * 3`, optimizer.O0, `let x = (2 * 3)`},
+
+		// dead code
+		{`if 1 > 2 { println("a") } else { println("b") }`, optimizer.O1, `println("b")`},
+		{`if true { let a = 1
+println(a) }
+println(2)`, optimizer.O1, `{ let a = 1; println(a) }; println(2)`},
+		{`if false { println(1) }
+println(2)`, optimizer.O1, `println(2)`},
+		{`let x = if 2 > 1 { 1 } else { 2 }`, optimizer.O1, `let x = 1`},
+		{`fn f() -> int { return 1
+println(2)
+3 }`, optimizer.O1, `fn f { return 1 }`},
+
+		// inlining
+		{`fn sq(x: int) -> int { x * x }
+let z = 2
+let y = sq(3) + sq(z)`, optimizer.O2, `fn sq { (x * x) }; let z = 2; let y = (9 + (z * z))`},
+		{`fn sub(a: int, b: int) -> int { a - b }
+println(sub(len("ab"), 1))`, optimizer.O2, `fn sub { (a - b) }; println((len("ab") - 1))`},
+		// arguments with effects are not evaluated twice or out of order
+		{`fn sq(x: int) -> int { x * x }
+println(sq(len("ab")))`, optimizer.O2, `fn sq { (x * x) }; println(sq(len("ab")))`},
+		{`fn rsub(a: int, b: int) -> int { b - a }
+println(rsub(len("ab"), 1))`, optimizer.O2, `fn rsub { (b - a) }; println(rsub(len("ab"), 1))`},
+		// nor are functions that might fail, call others or use globals
+		{`fn div(a: int, b: int) -> int { a / b }
+println(div(1, 2))`, optimizer.O2, `fn div { (a / b) }; println(div(1, 2))`},
+		{`fn half(a: int) -> int { a / 2 }
+println(half(8))`, optimizer.O2, `fn half { (a / 2) }; println(4)`},
+		{`let k = 2
+fn f(a: int) -> int { a * k }
+println(f(8))`, optimizer.O2, `let k = 2; fn f { (a * k) }; println(f(8))`},
+
+		// loop-invariant code
+		{`fn f(n: int, m: int) -> int {
+    let total = 0
+    for i ;= 0, i < n * 2, i++ { total = total + i * (m + 1) }
+    total
+}`, optimizer.O2, `fn f { let total = 0; { let $inv0 = (n * 2); let $inv1 = (m + 1); for let i = 0, (i < $inv0), i = (i + 1) { total = (total + (i * $inv1)) } }; total }`},
+		// nested loops hoist as far out as the variables allow
+		{`fn f(xs: [int], k: int) {
+    for x in xs {
+        for y in xs { println(x * 2, k * 3) }
+    }
+}`, optimizer.O2, `fn f { { let $inv1 = (k * 3); for x in xs { { let $inv0 = (x * 2); for y in xs { println($inv0, $inv1) } } } } }`},
+		// variables assigned in the loop or by closures are not invariant
+		{`fn f(n: int) {
+    let m = n
+    let bump = fn() { m = m + 1 }
+    for i ;= 0, i < 3, i++ {
+        bump()
+        println(m * 2)
+    }
+}`, optimizer.O2, `fn f { let m = n; let bump = fn { m = (m + 1) }; for let i = 0, (i < 3), i = (i + 1) { bump(); println((m * 2)) } }`},
+	}
+
+	for _, tt := range tests {
+		program := optimizer.Optimize(parseChecked(t, tt.input), tt.level)
+		if got := unparse(program); got != tt.expected {
+			t.Errorf("%q at -O%d:\nexpected=%s\ngot=     %s", tt.input, tt.level, tt.expected, got)
+		}
+	}
+}
+
+func TestOptimizerKeepsBehavior(t *testing.T) {
+	// run checks that every level gives the same output and errors
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn sq(x: int) -> int { x * x }
+fn f(n: int) -> int {
+    let total = 0
+    for i ;= 0, i < n * 2, i++ { total = total + sq(i) + sq(n - 1) }
+    total
+}
+println(f(10), if 1 > 2 { "a" } else { "b" })`, "4090 b\n"},
+		{`fn f(n: int) -> int {
+    for i ;= 0, i < 0, i++ { println(n * 2) }
+    n / (n - 1)
+}
+f(1)`, ""},
+	}
+
+	for _, tt := range tests {
+		_, out, _ := run(t, tt.input)
+		if out != tt.expected {
+			t.Errorf("%q: wrong output. expected=%q, got=%q", tt.input, tt.expected, out)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/internal/interpreter"
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+)
+
+func runtimeError(t *testing.T, input string) *interpreter.RuntimeError {
+	t.Helper()
+
+	_, _, err := run(t, input)
+	var rerr *interpreter.RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("%q: expected a *RuntimeError, got %T (%v)", input, err, err)
+	}
+	return rerr
+}
+
+func formatStack(stack []interpreter.Frame) string {
+	s := ""
+	for i, frame := range stack {
+		if i > 0 {
+			s += " "
+		}
+		s += fmt.Sprintf("%s@%s", frame.Function, frame.Pos)
+	}
+	return s
+}
+
+func TestRuntimeErrorStack(t *testing.T) {
+	tests := []struct {
+		input    string
+		message  string
+		values   string
+		expected string
+	}{
+		{"1 / 0", "integer divide by zero", "[1 0]", "main@1:3"},
+		{
+			"fn div(a: int, b: int) -> int {\n a / b\n}\nfn half(n: int) -> int { div(n, 0) }\nlet x = 2\nhalf(x)",
+			"integer divide by zero", "[2 0]",
+			"div@2:4 half@4:29 main@6:5",
+		},
+		{
+			"let xs = [1, 2]\nlet at = fn(i: int) -> int { xs[i] }\nat(5)",
+			"index out of range [5] with length 2", "[5]",
+			"at@2:32 main@3:3",
+		},
+		{
+			"struct P { n: int }\nimpl P { fn get(self) -> int { 10 % self.n } }\nlet p = P { n: 0 }\np.get()",
+			"integer divide by zero", "[10 0]",
+			"P.get@2:35 main@4:6",
+		},
+		{
+			"let m = {\"a\": 1}\nm[\"b\"]",
+			`key not found: "b"`, "[b]",
+			"main@2:2",
+		},
+		{
+			"trait Display { fn show(self) -> str }\nstruct P { n: int }\nimpl Display for P { fn show(self) -> str { \"x\"[self.n] } }\nprintln(P { n: 3 })",
+			"index out of range [3] with length 1", "[3]",
+			"P.show@3:48 println@- main@4:8",
+		},
+	}
+
+	for _, tt := range tests {
+		rerr := runtimeError(t, tt.input)
+		t.Logf("%q =>\n%s", tt.input, rerr.Trace())
+
+		if rerr.Message != tt.message {
+			t.Errorf("%q: wrong message. expected=%q, got=%q", tt.input, tt.message, rerr.Message)
+		}
+
+		values := make([]string, len(rerr.Values))
+		for i, v := range rerr.Values {
+			values[i] = v.Inspect()
+		}
+		if fmt.Sprint(values) != tt.values {
+			t.Errorf("%q: wrong values. expected=%s, got=%v", tt.input, tt.values, values)
+		}
+
+		if got := formatStack(rerr.Stack); got != tt.expected {
+			t.Errorf("%q: wrong stack. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestRuntimeErrorTrace(t *testing.T) {
+	in := interpreter.New(nil)
+	in.SetFile("app.gt")
+
+	program := parser.New(lexer.New("fn div(a: int, b: int) -> int { a / b }\ndiv(1, 0)")).ParseProgram()
+	_, err := in.Run(program)
+
+	var rerr *interpreter.RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected a *RuntimeError, got %T (%v)", err, err)
+	}
+
+	expected := "runtime error: integer divide by zero\n" +
+		"values: 1, 0\n" +
+		"\n" +
+		"div(...)\n" +
+		"\tapp.gt:1:35\n" +
+		"main()\n" +
+		"\tapp.gt:2:4\n"
+	if rerr.Trace() != expected {
+		t.Errorf("wrong trace. expected=\n%s\ngot=\n%s", expected, rerr.Trace())
+	}
+}
+
+func TestRuntimeErrorNotAFunction(t *testing.T) {
+	// the type checker rejects this, so run it unchecked
+	program := parser.New(lexer.New("let x = 1\nx(2)")).ParseProgram()
+	_, err := interpreter.New(nil).Run(program)
+
+	var rerr *interpreter.RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected a *RuntimeError, got %T (%v)", err, err)
+	}
+	if rerr.Message != "not a function: INTEGER" {
+		t.Errorf("wrong message. got=%q", rerr.Message)
+	}
+	if len(rerr.Values) != 1 || rerr.Values[0].Inspect() != "1" {
+		t.Errorf("wrong values. got=%v", rerr.Values)
+	}
+	if got := formatStack(rerr.Stack); got != "main@2:2" {
+		t.Errorf("wrong stack. got=%q", got)
+	}
+}
+
+func TestRuntimeErrorRecoversPanics(t *testing.T) {
+	for _, engine := range engines {
+		in := interpreter.New(nil)
+		in.SetEngine(engine)
+		in.Globals().Set("boom", &interpreter.Builtin{
+			Name: "boom",
+			Fn: func(in *interpreter.Interpreter, args ...interpreter.Object) interpreter.Object {
+				var xs []int
+				return &interpreter.Integer{Value: int64(xs[len(args)])}
+			},
+		})
+
+		program := parser.New(lexer.New("fn f() -> int { boom(1) }\nf()")).ParseProgram()
+		_, err := in.Run(program)
+
+		var rerr *interpreter.RuntimeError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("%s engine: expected a *RuntimeError, got %T (%v)", engine, err, err)
+		}
+		t.Logf("%s engine trace:\n%s", engine, rerr.Trace())
+		if rerr.Message != "panic: index out of range [1] with length 0" {
+			t.Errorf("%s engine: wrong message. got=%q", engine, rerr.Message)
+		}
+		if got := formatStack(rerr.Stack); got != "boom@- f@1:21 main@2:2" {
+			t.Errorf("%s engine: wrong stack. got=%q", engine, got)
+		}
+
+		// the interpreter is still usable afterwards
+		obj, err := in.Run(parser.New(lexer.New("1 + 1")).ParseProgram())
+		if err != nil || obj.Inspect() != "2" {
+			t.Errorf("%s engine: interpreter unusable after panic. got=%v, %v", engine, obj, err)
+		}
+	}
+}
+
+func TestDefer(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// deferred calls run last first, after the function's result is computed
+		{"fn f() -> int {\n defer println(1)\n defer println(2)\n println(3)\n 4 }\nprintln(f())", "3\n2\n1\n4\n"},
+		// arguments are evaluated when the defer statement runs
+		{"fn f() {\n let x = 1\n defer println(x)\n x = 2 }\nf()", "1\n"},
+		// an early return still runs them
+		{"fn f(n: int) -> int {\n defer println(\"done\")\n if n > 0 { return n }\n 0 }\nprintln(f(5))", "done\n5\n"},
+		// deferred closures see the function's variables
+		{"fn f() {\n let n = 1\n defer fn() { println(n) }()\n n = 2 }\nf()", "2\n"},
+		// a defer in a loop runs when the function returns, not each iteration
+		{"fn f() {\n for i in [1, 2] { defer println(i) }\n println(\"loop done\") }\nf()", "loop done\n2\n1\n"},
+		// top-level defers run when the program ends
+		{"defer println(\"end\")\nprintln(\"start\")", "start\nend\n"},
+	}
+
+	for _, tt := range tests {
+		_, out, err := run(t, tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if out != tt.expected {
+			t.Errorf("%q: wrong output. expected=%q, got=%q", tt.input, tt.expected, out)
+		}
+	}
+}
+
+func TestDeferOnError(t *testing.T) {
+	_, out, err := run(t, "fn f() -> int {\n defer println(\"cleanup\")\n 1 / 0 }\nf()")
+	if err == nil || err.Error() != "integer divide by zero" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if out != "cleanup\n" {
+		t.Errorf("deferred call did not run. output=%q", out)
+	}
+
+	// an error in a deferred call replaces the function's result, and the
+	// calls deferred before it still run
+	rerr := runtimeError(t, "fn f() -> int {\n defer println(\"first\")\n defer panic(\"in defer\")\n 1 }\nf()")
+	if rerr.Message != "in defer" || !rerr.Panic {
+		t.Errorf("wrong error. got=%q (panic=%t)", rerr.Message, rerr.Panic)
+	}
+	if got := formatStack(rerr.Stack); got != "f@3:13 main@5:2" {
+		t.Errorf("wrong stack. got=%q", got)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	rerr := runtimeError(t, "fn open(name: str) {\n panic(\"cannot open \" .. name)\n}\nopen(\"x\")")
+	if !rerr.Panic || rerr.Message != "cannot open x" {
+		t.Errorf("wrong error. got=%q (panic=%t)", rerr.Message, rerr.Panic)
+	}
+	expected := "panic: cannot open x\n\nopen(...)\n\t2:7\nmain()\n\t4:5\n"
+	if rerr.Trace() != expected {
+		t.Errorf("wrong trace. expected=%q, got=%q", expected, rerr.Trace())
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 } catch e { 2 }", "1"},
+		{"try { 1 / 0 } catch e { 2 }", "2"},
+		{"try { panic(\"boom\")\n 1 } catch e { len(e) }", "4"},
+		{"let xs = [1]\ntry { xs[5] } catch e { e }", "index out of range [5] with length 1"},
+		{"fn f(n: int) -> int { if n == 0 { panic(\"zero\") }\n 10 / n }\n[try { f(2) } catch e { 0 }, try { f(0) } catch e { -1 }]", "[5, -1]"},
+		// the handler may return from the enclosing function
+		{"fn f() -> str { let n = try { 1 / 0 } catch e { return e }\n \"ok\" }\nf()", "integer divide by zero"},
+		// errors in the handler are not caught by the same try
+		{"try { try { panic(\"a\") } catch e { panic(e .. \"b\") } } catch e { e }", "ab"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+
+	// deferred calls of the functions the error unwinds run before the handler
+	_, out, err := run(t, "fn f() {\n defer println(\"deferred\")\n panic(\"p\") }\ntry { f() } catch e { println(\"caught\", e) }")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "deferred\ncaught p\n" {
+		t.Errorf("wrong output. got=%q", out)
+	}
+}
+
+func runWithMaxDepth(t *testing.T, input string, depth int) (interpreter.Object, string, error) {
+	t.Helper()
+
+	o := runEngines(t, input, parseChecked(t, input), func(in *interpreter.Interpreter) {
+		in.SetMaxDepth(depth)
+	})
+	return o.obj, o.out, o.err
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn count(n: int, acc: int) -> int { if n == 0 { return acc }\n return count(n - 1, acc + 1) }\ncount(100000, 0)", "100000"},
+		{"struct C { step: int }\nimpl C { fn down(self, n: int) -> int { if n < 1 { return n }\n return self.down(n - self.step) } }\nC { step: 3 }.down(100000)", "-2"},
+		{"let loop = fn(n: int) -> str { if n == 0 { return \"done\" }\n return loop(n - 1) }\nloop(100000)", "done"},
+		{"fn last(xs: [int], i: int) -> int { if i == len(xs) - 1 { return xs[i] }\n return last(xs, i + 1) }\nlast([1, 2, 3, 4], 0)", "4"},
+		// a builtin in tail position
+		{"fn size(s: str) -> int { return len(s) }\nsize(\"abc\")", "3"},
+	}
+
+	for _, tt := range tests {
+		obj, _, err := runWithMaxDepth(t, tt.input, 50)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+}
+
+func TestTailCallsKeepSemantics(t *testing.T) {
+	// deferred calls still run after the call in tail position
+	_, out, err := runWithMaxDepth(t, "fn g() -> int { println(\"g\")\n 1 }\nfn f() -> int { defer println(\"deferred\")\n return g() }\nf()", 50)
+	if err != nil || out != "g\ndeferred\n" {
+		t.Errorf("wrong output. got=%q, %v", out, err)
+	}
+
+	// a try expression still catches the errors of a call in its body
+	obj, _, err := runWithMaxDepth(t, "fn g() -> int { panic(\"no\") }\nfn f() -> int { try { return g() } catch e { return -1 } }\nf()", 50)
+	if err != nil || obj.Inspect() != "-1" {
+		t.Errorf("wrong result. got=%v, %v", obj, err)
+	}
+
+	// the callee replaces the caller in stack traces
+	_, _, err = runWithMaxDepth(t, "fn g(n: int) -> int { 1 / n }\nfn f(n: int) -> int { return g(n) }\nf(0)", 50)
+	var rerr *interpreter.RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected a *RuntimeError, got %T (%v)", err, err)
+	}
+	if got := formatStack(rerr.Stack); got != "g@1:25 main@3:2" {
+		t.Errorf("wrong stack. got=%q", got)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	input := "fn deep(n: int) -> int { if n == 0 { return 0 }\n return 1 + deep(n - 1) }\ndeep(100)"
+
+	obj, _, err := runWithMaxDepth(t, input, 101)
+	if err != nil || obj.Inspect() != "100" {
+		t.Errorf("deep(100) failed with max depth 101. got=%v, %v", obj, err)
+	}
+
+	_, _, err = runWithMaxDepth(t, input, 50)
+	var rerr *interpreter.RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected a *RuntimeError, got %T (%v)", err, err)
+	}
+	if rerr.Message != "stack overflow in fn deep" {
+		t.Errorf("wrong message. got=%q", rerr.Message)
+	}
+	if len(rerr.Stack) != 51 {
+		t.Errorf("wrong stack depth. expected=51, got=%d", len(rerr.Stack))
+	}
+
+	// the default limit stops runaway recursion before the Go stack does
+	rerr = runtimeError(t, "fn forever(n: int) -> int { 1 + forever(n + 1) }\nforever(0)")
+	if rerr.Message != "stack overflow in fn forever" {
+		t.Errorf("wrong message. got=%q", rerr.Message)
+	}
+	if !strings.Contains(rerr.Trace(), fmt.Sprintf("...%d frames elided...\n", len(rerr.Stack)-100)) {
+		t.Errorf("trace of deep stack not elided:\n%.500s", rerr.Trace())
+	}
+
+	// so does the highest limit, which a larger one is clamped to
+	input = "fn forever(n: int) -> int { let xs = [n, n * 2]\n match xs[0] { 0 => 0, _ => 1 + forever(n + 1) } }\nforever(1)"
+	_, _, err = runWithMaxDepth(t, input, math.MaxInt)
+	if !errors.As(err, &rerr) || rerr.Message != "stack overflow in fn forever" {
+		t.Fatalf("expected a stack overflow, got %v", err)
+	}
+	if len(rerr.Stack) != interpreter.MaxDepth+1 {
+		t.Errorf("wrong stack depth. expected=%d, got=%d", interpreter.MaxDepth+1, len(rerr.Stack))
+	}
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/voidwyrm-2/gust/gust"
+)
+
+func TestSandbox(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	if err := os.Mkdir(data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(data, "in.txt"), []byte("inside"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(secret, []byte("outside"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(data, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(data, "up")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		caps     gust.Capabilities
+		input    string
+		expected string
+	}{
+		{"no files", gust.Capabilities{}, `io.read_file("in.txt")`,
+			`Err(IOError{op: "io.read_file", path: "in.txt", kind: "permission", message: "permission denied: no read capability"})`},
+		{"no files builtin", gust.Capabilities{}, `read_file("in.txt")`,
+			`Err("read_file in.txt: permission denied: no read capability")`},
+		{"read dir", gust.Capabilities{Files: gust.ReadFiles, Dir: data}, `io.read_file("in.txt")`,
+			`Ok("inside")`},
+		{"read dir builtin", gust.Capabilities{Files: gust.ReadFiles, Dir: data}, `read_file("in.txt")`,
+			`Ok("inside")`},
+		{"read outside", gust.Capabilities{Files: gust.ReadFiles, Dir: data}, `io.read_file("../secret.txt")`,
+			`Err(IOError{op: "io.read_file", path: "../secret.txt", kind: "permission", message: "permission denied: no read capability"})`},
+		{"read absolute", gust.Capabilities{Files: gust.ReadFiles, Dir: data}, `match io.read_file(secret) { Ok(s) => s, Err(e) => e.kind }`,
+			`permission`},
+		{"read link", gust.Capabilities{Files: gust.ReadFiles, Dir: data}, `match io.read_file("link.txt") { Ok(s) => s, Err(e) => e.kind }`,
+			`permission`},
+		{"read linked dir", gust.Capabilities{Files: gust.ReadFiles, Dir: data}, `match io.read_file("up/secret.txt") { Ok(s) => s, Err(e) => e.kind }`,
+			`permission`},
+		{"list outside", gust.Capabilities{Files: gust.ReadFiles, Dir: data}, `match io.list_dir("..") { Ok(s) => "listed", Err(e) => e.kind }`,
+			`permission`},
+		{"write link", gust.Capabilities{Files: gust.WriteFiles, Dir: data}, `match io.write_file("link.txt", "x") { Ok(v) => "written", Err(e) => e.kind }`,
+			`permission`},
+		{"read only", gust.Capabilities{Files: gust.ReadFiles, Dir: data}, `io.write_file("out.txt", "x")`,
+			`Err(IOError{op: "io.write_file", path: "out.txt", kind: "permission", message: "permission denied: no write capability"})`},
+		{"write dir", gust.Capabilities{Files: gust.WriteFiles, Dir: data}, `io.write_file("out.txt", "x")
+io.read_file("out.txt")`,
+			`Ok("x")`},
+		{"no env", gust.Capabilities{}, `env.get("HOME")`,
+			`Err(PermissionError{op: "env.get", path: "HOME", capability: "env"})`},
+		{"env", gust.Capabilities{Env: true}, `env.has("GUST_SANDBOX_TEST")`,
+			`Ok(true)`},
+		{"no clock", gust.Capabilities{}, `time.now()`,
+			`Err(PermissionError{op: "time.now", path: "", capability: "clock"})`},
+		{"clock", gust.Capabilities{Clock: true}, `match time.unix() { Ok(n) => n > 0, Err(e) => false }`,
+			`true`},
+	}
+
+	t.Setenv("GUST_SANDBOX_TEST", "1")
+	var out bytes.Buffer
+	for engine, rt := range newRuntimes(&out) {
+		if err := rt.Set("secret", secret); err != nil {
+			t.Fatalf("%s: set error: %v", engine, err)
+		}
+		for _, tt := range tests {
+			rt.SetCapabilities(tt.caps)
+			if err := rt.Compile(tt.input); err != nil {
+				t.Fatalf("%s: %s: compile error: %v", engine, tt.name, err)
+			}
+			v, err := rt.Run(context.Background())
+			if err != nil {
+				t.Fatalf("%s: %s: runtime error: %v", engine, tt.name, err)
+			}
+			if v.String() != tt.expected {
+				t.Errorf("%s: %s: wrong result.\nexpected=%s\ngot=%s", engine, tt.name, tt.expected, v.String())
+			}
+		}
+		if err := os.Remove(filepath.Join(data, "out.txt")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var perr *gust.PermissionError
+	f, err := gust.AllCapabilities().OpenFile("f", secret, os.O_RDONLY, 0)
+	if err != nil {
+		t.Errorf("expected every path to be readable, got %v", err)
+	} else {
+		f.Close()
+	}
+	f, err = (gust.Capabilities{Files: gust.ReadFiles, Dir: data}).OpenFile("f", filepath.Join(data, "in.txt"), os.O_RDONLY, 0)
+	if err != nil {
+		t.Errorf("expected an absolute path in the directory to be readable, got %v", err)
+	} else {
+		f.Close()
+	}
+	_, err = (gust.Capabilities{Files: gust.ReadFiles, Dir: data}).OpenFile("f", "x", os.O_WRONLY|os.O_CREATE, 0o644)
+	if !errors.As(err, &perr) || perr.Capability != "write" {
+		t.Errorf("expected a write permission error, got %v", err)
+	}
+}
@@ -1 +1,243 @@
 package test
+
+import (
+	"testing"
+
+	"github.com/voidwyrm-2/gust/internal/lexer"
+	"github.com/voidwyrm-2/gust/internal/parser"
+	"github.com/voidwyrm-2/gust/internal/typechecker"
+)
+
+func check(t *testing.T, input string) []string {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %q", errs)
+	}
+
+	checker := typechecker.New()
+	checker.Check(program)
+	return checker.Errors()
+}
+
+func TestTypeCheckValidPrograms(t *testing.T) {
+	tests := []string{
+		"let x: int = 5\nx = x * 2",
+		"let xs: [int] = [1, 2]\nxs[0] = len(xs)",
+		"let xss: [[str]] = [[\"a\"], []]\nxss[0][0] = \"b\"",
+		"let xs = [1, 2, 3]\nlet ys: [int] = xs[1:]",
+		"let xs = []\nxs = append(xs, 1)\nlet n: int = xs[0]",
+		"let m = {}\nm[\"a\"] = 1\nlet n: int = m[\"a\"]",
+		"let s: str = \"abc\"[0] .. \"abc\"[1:]",
+		"fn greet(name: str) -> str {\n return \"hello \" .. name\n}\nlet g: str = greet(\"nick\")",
+		"fn apply(f: fn(int) -> int, x: int) -> int { f(x) }\napply(fn(x: int) -> int { x + 1 }, 2)",
+		"let add = fn(a, b) { a + b }\nadd(1, 2)",
+		"fn fact(n: int) -> int { if n < 2 { return 1 } else { return n * fact(n - 1) } }",
+		"let xs = append([1], 2, 3)\nxs[0] = 4",
+		"let n: int = if true { 1 } else { 2 }",
+		"if true { 1 } else { \"a\" }",
+		"let n: int = try { 1 / 0 } catch e { len(e) }",
+		"fn f(n: int) -> int { if n > 0 { return n }\n panic(\"negative\") }",
+		"fn f() -> int { let n: int = try { 1 } catch e { return 0 }\n n }",
+		"fn f(name: str) { defer println(\"closed\", name)\n defer fn() { }() }",
+		"let m: map[str]int = {\"a\": 1}\nm[\"b\"] = m[\"a\"] + len(m)",
+		"let m: map[int][str] = {}\nm[1] = [\"x\"]\ndelete(m, 1)",
+		"let m = {\"a\": 1}\nlet v, ok = m[\"a\"]\nlet n: int = v\nlet b: bool = ok",
+		"let m = {true: \"yes\"}\nfor k, v in m { let b: bool = k\nlet s: str = v }",
+		"for i, x in [\"a\"] { let n: int = i\nlet s: str = x }",
+		"for c in \"abc\" { let s: str = c }",
+		"let total = 0\nfor i ;= 0, i < 10, i++ { total = total + i }",
+		"let n = 3\nfor n > 0 { n-- }",
+		"struct P { x: int, y: int }\nlet p = P { y: 2, x: 1 }\np.x = p.y\nlet n: int = p.x",
+		"let p = P { x: 1 }\nlet n: int = p.get()\nimpl P { fn get(self) -> int { self.x } }\nstruct P { x: int }",
+		"struct Node { value: int, next: [Node] }\nlet n = Node { value: 1, next: [] }\nlet m: [Node] = n.next",
+		"struct C { n: int }\nimpl C { fn add(self, k: int) { self.n = self.n + k }\nfn get(self) -> int { self.add(0)\nself.n } }\nlet f: fn(int) = C { n: 0 }.add",
+		"struct P { x: int }\nlet P = 1\nlet p: P = P { x: P }",
+		"enum S { C(float), R(float, float), E }\nlet a: float = match R(1.0, 2.0) { C(r) => r * r, R(w, h) => w * h, E => 0.0 }",
+		"fn get(o: Option[int]) -> int { match o { Some(n) if n > 0 => n, Some(_) => 0, None => -1 } }",
+		"enum B { T, F }\nmatch Some(T) { Some(T) => 1, Some(F) => 2, None => 3 }",
+		"let s: str = match 2 { 0 => \"zero\", -1 => \"neg\", n => \"other\" }",
+		"match true { true => 1, false => 0 }",
+		"let f: float = -1.5 * 2.0",
+		"let o: Option[int] = None\nlet r: Result[str, int] = Err(1)\nlet b: bool = o == Some(2)",
+		"fn half(n: int) -> Option[int] { if n % 2 == 0 { Some(n / 2) } else { None } }\nfn quarter(n: int) -> Option[int] { Some(half(half(n)?)?) }",
+		"fn sum(a: str, b: str) -> Result[int, str] { Ok(parse_int(a)? + parse_int(b)?) }",
+		"let f = fn(s: str) { let n = parse_float(s)?\nOk(n * 2.0) }\nlet r: Result[float, str] = f(\"1\")",
+		"let n: int = match parse_int(\"1\") { Ok(n) => n, Err(_) => 0 }",
+		"let c: str = match read_file(\"x\") { Ok(s) => s, Err(e) => e }",
+		"fn id[T](x: T) -> T { x }\nlet n: int = id(1)\nlet s: str = id(\"a\")",
+		"fn map[T, U](xs: [T], f: fn(T) -> U) -> [U] { let out: [U] = []\nfor x in xs { out = append(out, f(x)) }\nout }\nlet ys: [str] = map([1], fn(n: int) -> str { \"a\" })",
+		"fn first[T](xs: [T]) -> Option[T] { if len(xs) == 0 { return None }\nSome(xs[0]) }\nlet o: Option[int] = first([1])",
+		"struct Pair[A, B] { a: A, b: B }\nlet p: Pair[int, str] = Pair { a: 1, b: \"x\" }\nlet s: str = p.b",
+		"struct Stack[T] { items: [T] }\nimpl Stack[T] { fn push(self, x: T) { self.items = append(self.items, x) }\nfn top(self) -> T { self.items[len(self.items) - 1] } }\nlet s = Stack { items: [1] }\ns.push(2)\nlet n: int = s.top()",
+		"struct Box[T] { v: T }\nfn unbox[T](b: Box[T]) -> T { b.v }\nlet n: int = unbox(Box { v: 1 })",
+		"trait Display { fn show(self) -> str }\nstruct P { x: int }\nimpl Display for P { fn show(self) -> str { \"p\" } }\nlet s: str = P { x: 1 }.show()",
+		"fn show[T: Display](v: T) -> str { v.show() }\nlet s: str = show(P { x: 1 })\nimpl Display for P { fn show(self) -> str { \"p\" } }\nstruct P { x: int }\ntrait Display { fn show(self) -> str }",
+		"trait Eq { fn eq(self, other: Self) -> bool }\nstruct P { x: int }\nimpl Eq for P { fn eq(self, o: P) -> bool { self.x == o.x } }\nfn same[T: Eq](a: T, b: T) -> bool { a.eq(b) }\nsame(P { x: 1 }, P { x: 2 })",
+		"let inc = fn(x) { x + 1 }\nlet n: int = inc(1)",
+		"let add = fn(a, b) { a + b }\nlet f: float = add(1.5, 2.0)",
+		"let lt = fn(a, b) { a < b }\nlet b: bool = lt(\"a\", \"b\")",
+		"let neg = fn(x) { -x }\nlet f: float = neg(1.5)",
+		"let twice = fn(f, x) { f(f(x)) }\nlet n: int = twice(fn(x) { x * 2 }, 1)",
+		"let greet = fn(name) { \"hi \" .. name }\nlet s: str = greet(\"bob\")",
+		"let pick = fn(c, a, b) { if c { a } else { b } }\nlet s: str = pick(true, \"a\", \"b\")",
+		"fn map[T, U](xs: [T], f: fn(T) -> U) -> [U] { let out: [U] = []\nfor x in xs { out = append(out, f(x)) }\nout }\nlet ys: [str] = map([\"a\"], fn(s) { s .. s })",
+		"fn apply(f: fn(int) -> int) -> int { f(1) }\napply(fn(n) { n })",
+		"let fact = fn(n) { if n < 2 { 1 } else { n * fact(n - 1) } }\nlet x: int = fact(5)",
+		"let fib: fn(int) -> int = fn(n) { if n < 2 { n } else { fib(n - 1) + fib(n - 2) } }",
+		"trait Sized { fn size(self) -> int }\nstruct Box[T: Sized] { v: T }\nimpl Box[T] { fn size(self) -> int { self.v.size() } }\nstruct U { }\nimpl Sized for U { fn size(self) -> int { 0 } }\nlet b: Box[U] = Box { v: U { } }",
+	}
+
+	for _, input := range tests {
+		if errs := check(t, input); len(errs) > 0 {
+			t.Errorf("%q: unexpected type errors: %q", input, errs)
+		}
+	}
+}
+
+func TestTypeCheckErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = \"a\"", "1:14: cannot use str value as int in declaration of x"},
+		{"let xs: [int] = [1, \"a\"]", "1:21: cannot use str value as int in array literal"},
+		{"let xs = [1]\nxs[0] = \"a\"", "2:9: cannot use str value as int in assignment"},
+		{"let xs = [1]\nxs[\"a\"]", "2:4: invalid index \"a\" (type str), must be int"},
+		{"let x = 1\nx[0]", "2:2: cannot index x (type int)"},
+		{"let x = 1\nx[0:1]", "2:2: cannot slice x (type int)"},
+		{"let s = \"abc\"\ns[0] = \"b\"", "2:2: cannot assign to index of s (type str)"},
+		{"len(1)", "1:5: invalid argument for len: int"},
+		{"append(1, 2)", "1:8: first argument to append must be an array, got int"},
+		{"append([1], \"a\")", "1:13: cannot use str value as int in argument to append"},
+		{"1 + \"a\"", "1:3: invalid operation: mismatched types int and str"},
+		{"true + false", "1:6: invalid operation: operator + not defined on bool"},
+		{"y = 1", "1:1: undefined: y"},
+		{"fn f(x: int) -> int { x }\nf(\"a\")", "2:3: cannot use str value as int in argument to f"},
+		{"fn f(x: int) -> int { x }\nf()", "2:2: wrong number of arguments in call to f: want=1, got=0"},
+		{"fn f() -> int { }", "1:15: missing return"},
+		{"fn f() -> int { return \"a\" }", "1:17: cannot use str value as int in return statement"},
+		{"let x = println(1)", "1:16: println() does not produce a value"},
+		{"let x = if true { 1 } else { \"a\" }", "1:9: if branches have different types: int and str"},
+		{"if 1 { 2 }", "1:4: non-bool 1 (type int) used as condition"},
+		{"let x = 1\nx()", "2:2: cannot call non-function x (type int)"},
+		{"let x: [nope] = []", "1:9: undefined type: nope"},
+		{"let m = {\"a\": 1, \"b\": \"c\"}", "1:23: cannot use str value as int in map literal"},
+		{"let m = {\"a\": 1, 2: 3}", "1:18: cannot use int value as str key in map literal"},
+		{"let m = {[1]: 1}", "1:10: invalid map key type [int]"},
+		{"let m: map[[int]]int = {}", "1:12: invalid map key type [int]"},
+		{"let m = {\"a\": 1}\nm[1]", "2:3: cannot use int value as str key of map[str]int"},
+		{"let m = {\"a\": 1}\nm[\"b\"] = \"c\"", "2:10: cannot use str value as int in assignment"},
+		{"let m = {\"a\": 1}\ndelete(m, 1)", "2:11: cannot use int value as str in argument to delete"},
+		{"delete([1], 0)", "1:8: first argument to delete must be a map, got [int]"},
+		{"let xs = [1]\nlet v, ok = xs[0]", "2:15: assignment mismatch: 2 variables but expression is not a map index"},
+		{"for x in 5 { x }", "1:10: cannot range over 5 (type int)"},
+		{"for 1 { }", "1:5: non-bool 1 (type int) used as condition"},
+		{"let m = {\"a\": 1}\nfor k in m { let n: int = k }", "2:27: cannot use str value as int in declaration of n"},
+		{"struct P { x: int }\nP { x: \"a\" }", "2:8: cannot use str value as int in field x of P"},
+		{"struct P { x: int }\nP { }", "2:3: missing field x in struct literal of type P"},
+		{"struct P { x: int }\nP { x: 1, y: 2 }", "2:11: unknown field y in struct literal of type P"},
+		{"struct P { x: int }\nP { x: 1, x: 2 }", "2:11: duplicate field x in struct literal"},
+		{"Q { x: 1 }", "1:1: undefined type: Q"},
+		{"struct P { x: int }\nlet p = P { x: 1 }\np.y", "3:3: p.y undefined (type P has no field or method y)"},
+		{"let n = 1\nn.x", "2:3: n.x undefined (type int has no field or method x)"},
+		{"struct P { x: int }\nlet p = P { x: 1 }\np.x = true", "3:7: cannot use bool value as int in assignment"},
+		{"struct P { x: int }\nstruct P { y: int }", "2:8: P redeclared"},
+		{"struct P { x: int, x: int }", "1:20: duplicate field x in struct P"},
+		{"struct P { x: int }\nimpl P { fn f() { } }", "2:10: method P.f must take self as its first parameter"},
+		{"struct P { x: int }\nimpl P { fn x(self) { } }", "2:13: field and method with the same name x"},
+		{"impl Q { fn f(self) { } }", "1:6: undefined type: Q"},
+		{"struct P { x: int }\nimpl P { fn f(self) -> str { self.x } }", "2:28: cannot use int value as str in return"},
+		{"struct P { x: int }\nimpl P { fn f(self) { } }\nlet p = P { x: 1 }\np.f = p.f", "4:2: cannot assign to method p.f"},
+		{"fn f() { struct P { x: int } }", "1:10: struct declarations are only allowed at the top level"},
+		{"match Some(1) { Some(n) => n }", "1:1: non-exhaustive match: pattern None not covered"},
+		{"enum B { T, F }\nmatch Some(T) { Some(T) => 1, None => 3 }", "2:1: non-exhaustive match: pattern Some(F) not covered"},
+		{"match Some(1) { Some(n) if n > 0 => n, None => 0 }", "1:1: non-exhaustive match: pattern Some(_) not covered"},
+		{"match 1 { 0 => 1 }", "1:1: non-exhaustive match: pattern _ not covered"},
+		{"match true { true => 1 }", "1:1: non-exhaustive match: pattern false not covered"},
+		{"match 1 { n => n, 0 => 0 }", "1:19: unreachable pattern 0"},
+		{"match Some(1) { Some(_) => 1, None => 2, _ => 3 }", "1:42: unreachable pattern _"},
+		{"match Some(1) { Some(_, _) => 1, _ => 2 }", "1:17: wrong number of fields in pattern Some: want=1, got=2"},
+		{"match 1 { Foo(x) => x, _ => 0 }", "1:11: undefined variant: Foo"},
+		{"enum P { Pair(int, int) }\nmatch Pair(1, 2) { Pair(x, x) => x }", "2:28: x bound more than once in pattern"},
+		{"match \"a\" { 1 => 1, _ => 2 }", "1:13: cannot match str value against int pattern"},
+		{"match 1 { n if n => n, _ => 0 }", "1:16: non-bool n (type int) used as guard"},
+		{"fn f() { enum E { A } }", "1:10: enum declarations are only allowed at the top level"},
+		{"fn f() -> int { parse_int(\"1\")? }", "1:31: cannot use ? on Result[int, str] in function returning int"},
+		{"fn f() -> Option[int] { Some(parse_int(\"1\")?) }", "1:44: cannot use ? on Result[int, str] in function returning Option[int]"},
+		{"fn f() -> Result[int, int] { Ok(parse_int(\"1\")?) }", "1:47: cannot use ? on Result[int, str] in function returning Result[int, int]"},
+		{"fn f() { Some(1)? }", "1:17: cannot use ? on Option[int] in function returning void"},
+		{"let n = Some(1)?", "1:16: ? used outside of a function"},
+		{"fn f() -> Option[int] { 5? }", "1:26: invalid operation: 5 (type int) is not an Option or Result"},
+		{"let o: Option = None", "1:8: cannot use generic type Option without instantiation"},
+		{"let o: Option[int, str] = None", "1:8: wrong number of type arguments for Option: want=1, got=2"},
+		{"let o: int[str] = 1", "1:8: int is not a generic type"},
+		{"let o: Option[str] = Some(1)", "1:26: cannot use Option[int] value as Option[str] in declaration of o"},
+		{"enum E { Some }", "1:10: variant Some redeclared"},
+		{"fn pair[T](a: T, b: T) { }\npair(1, \"x\")", "2:9: cannot use str value as int in argument to pair (inferred T = int)"},
+		{"fn id[T](x: T) -> T { x }\nlet s: str = id(1)", "2:16: cannot use int value as str in declaration of s"},
+		{"fn f[T, T](x: T) { }", "1:9: T redeclared"},
+		{"fn f(a: int, a: int) { }", "1:14: parameter a redeclared"},
+		{"let f = fn(a, b, a) { }", "1:18: parameter a redeclared"},
+		{"trait T { fn m(self, self: int) }", "1:22: parameter self redeclared"},
+		{"fn f[T](x: T) -> int { x }", "1:22: cannot use T value as int in return"},
+		{"struct Box[T] { v: T }\nlet b: Box = Box { v: 1 }", "2:8: cannot use generic type Box without instantiation"},
+		{"struct Box[T] { v: T }\nlet b: Box[int, str] = Box { v: 1 }", "2:8: wrong number of type arguments for Box: want=1, got=2"},
+		{"struct Box[T] { v: T }\nlet b: Box[int] = Box { v: \"s\" }", "2:23: cannot use Box[str] value as Box[int] in declaration of b"},
+		{"struct Box[T] { v: T }\nimpl Box { fn get(self) { } }", "2:6: wrong number of type parameters in impl Box: want=1, got=0"},
+		{"struct Box[T] { v: T }\nlet b = Box { v: 1 }\nlet s: str = b.v", "3:15: cannot use int value as str in declaration of s"},
+		{"trait D { fn show(self) -> str }\nstruct P { x: int }\nimpl D for P { }", "3:12: P does not implement D: missing method show"},
+		{"trait D { fn show(self) -> str }\nstruct P { x: int }\nimpl D for P { fn show(self) -> int { 1 } }", "3:19: method P.show has type fn() -> int, but D requires fn() -> str"},
+		{"trait D { }\nstruct P { x: int }\nimpl D for P { fn show(self) { } }", "3:19: method show is not in trait D"},
+		{"trait D { }\nstruct P { x: int }\nimpl D for P { }\nimpl D for P { }", "4:6: P already implements D"},
+		{"struct P { x: int }\nimpl D for P { }", "2:6: undefined trait: D"},
+		{"struct P { x: int }\nimpl P for P { }", "2:6: P is not a trait"},
+		{"trait D { fn show(self) -> str }\nfn f[T: D](v: T) { }\nf(1)", "3:2: int does not implement D (required by T in call to f)"},
+		{"trait D { }\nstruct Box[T: D] { v: T }\nfn f(b: Box[str]) { }", "3:9: str does not implement D (required by T of Box)"},
+		{"trait D { }\nstruct Box[T: D] { v: T }\nBox { v: 1 }", "3:5: int does not implement D (required by T of Box)"},
+		{"fn f[T](v: T) { v.show() }", "1:19: v.show undefined (type T has no field or method show)"},
+		{"fn f[T: D](v: T) { }", "1:9: undefined trait: D"},
+		{"trait D { }\nlet d: D = 1", "2:8: cannot use trait D as a type"},
+		{"trait D { fn show() }", "1:11: method D.show must take self as its first parameter"},
+		{"trait D { fn f(self, x) }", "1:22: missing type for parameter x of D.f"},
+		{"trait Display { fn show(self) -> int }", "1:7: trait Display must declare fn show(self) -> str"},
+		{"trait Display { fn show(self, n: int) -> str }", "1:7: trait Display must declare fn show(self) -> str"},
+		{"trait Display { fn print(self) }", "1:7: trait Display must declare fn show(self) -> str"},
+		{"let inc = fn(x) { x + 1 }\ninc(\"a\")", "2:5: cannot unify int with str at 1:21"},
+		{"let add = fn(a, b) { a + b }\nadd(1, 2)\nadd(3, \"b\")", "3:8: cannot unify int with str at 2:4"},
+		{"let f = fn(b) { b && true }\nf(1)", "2:3: cannot unify bool with int at 1:19"},
+		{"let xs = []\nxs = append(xs, 1)\nxs = append(xs, \"a\")", "3:17: cannot use str value as int in argument to append"},
+		{"let m = {}\nm[\"a\"] = 1\nm[2] = 1", "3:3: cannot use int value as str key of map[str]int"},
+		{"let m = {}\nm[fn() { }] = 1", "2:3: invalid map key type fn()"},
+		{"let x: any = 1", "1:8: undefined type: any"},
+		{"let double = fn(a) { a + a }\ndouble(\"x\")", "2:8: cannot use str value in argument to double: operator + not defined on str"},
+		{"let less = fn(a) { a < a }\nless(true)", "2:6: cannot use bool value in argument to less: operator < not defined on bool"},
+		{"let neg = fn(x) { -x }\nneg(\"s\")", "2:5: cannot use str value in argument to neg: operator - not defined on str"},
+		{"let same = fn(a) { a == a }\nsame(fn() { })", "2:6: cannot use fn() value in argument to same: operator == not defined on fn()"},
+		{"let g = fn(s) { s .. \"!\" }\nlet n: int = g(\"a\")", "2:15: cannot use str value as int in declaration of n"},
+		{"let f = fn(x) { x(x) }", "1:18: cannot unify _ with fn(_) -> _: x would contain itself"},
+		{"let f = fn(x) { x + 1 }\nlet s: str = f(1)", "2:15: cannot use int value as str in declaration of s"},
+		{"let f = fn(n) { f(n, 1) }", "1:9: cannot use fn(_) -> _ value as fn(_, int) -> _ in declaration of f"},
+		{"let f: fn(int) -> str = fn(n) { f(\"a\") }", "1:35: cannot use str value as int in argument to f"},
+		{"fn f(x, y: int) { }", "1:6: missing type for parameter x of f"},
+		{"struct P { x: int }\nimpl P { fn f(self, n) { } }", "2:21: missing type for parameter n of P.f"},
+		{"fn f() { trait D { } }", "1:10: trait declarations are only allowed at the top level"},
+		{"panic(1)", "1:7: cannot use int value as str in argument to panic"},
+		{"let n: int = try { 1 } catch e { \"x\" }", "1:14: expression does not produce a value"},
+		{"try { 1 } catch e { e + 1 }", "1:23: invalid operation: mismatched types str and int"},
+	}
+
+	for _, tt := range tests {
+		errs := check(t, tt.input)
+		t.Logf("%q => %q", tt.input, errs)
+		if len(errs) != 1 {
+			t.Errorf("%q: expected 1 error, got %d: %q", tt.input, len(errs), errs)
+			continue
+		}
+		if errs[0] != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errs[0])
+		}
+	}
+}